@@ -9,8 +9,9 @@ mkdir -p dist
 # Build the CSS using Tailwind
 npx tailwindcss --minify --cwd src -i style.css -o ../dist/style.css
 
-# Minify the icons.js file
+# Minify the icons.js and webauthn.js files
 npx terser src/icons.js -o dist/icons.js --compress --mangle
+npx terser src/webauthn.js -o dist/webauthn.js --compress --mangle
 
 # Hash a file and print the first 12 hex chars
 hash_file() {
@@ -24,10 +25,17 @@ STYLE_NAME="style.${STYLE_HASH}.css"
 mv dist/style.css "dist/${STYLE_NAME}"
 gzip -9 -c "dist/${STYLE_NAME}" > "dist/${STYLE_NAME}.gz"
 
+# Same for webauthn.js
+WEBAUTHN_HASH=$(hash_file dist/webauthn.js)
+WEBAUTHN_NAME="webauthn.${WEBAUTHN_HASH}.js"
+mv dist/webauthn.js "dist/${WEBAUTHN_NAME}"
+gzip -9 -c "dist/${WEBAUTHN_NAME}" > "dist/${WEBAUTHN_NAME}.gz"
+
 # Write the asset manifest consumed by the server at startup
 cat > dist/manifest.json <<EOF
 {
-  "style": "${STYLE_NAME}"
+  "style": "${STYLE_NAME}",
+  "webauthn": "${WEBAUTHN_NAME}"
 }
 EOF
 
@@ -0,0 +1,28 @@
+<!DOCTYPE html>
+<html lang="en">
+
+<head>
+    <meta charset="utf-8">
+    <title>{{ .Title }}</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="referrer" content="no-referrer">
+    <link rel="stylesheet" href="{{ .BaseUrl }}/{{ .StyleAsset }}" nonce="{{ .CspNonce }}">
+</head>
+
+<body>
+    <main class="layout h-full">
+        <form id="saml-form" method="POST" action="{{ .ActionUrl }}" class="p-4">
+            <input type="hidden" name="SAMLResponse" value="{{ .SAMLResponse }}">
+            <input type="hidden" name="RelayState" value="{{ .RelayState }}">
+            <input type="hidden" name="{{ .ResubmitField }}" value="1">
+            <noscript>
+                <button type="submit" class="px-3 py-1.5 text-sm font-medium bg-white rounded-lg dark:bg-gray-900 cursor-pointer">Continue</button>
+            </noscript>
+        </form>
+    </main>
+    <script nonce="{{ .CspNonce }}">
+        document.getElementById('saml-form').submit()
+    </script>
+</body>
+
+</html>
@@ -38,6 +38,80 @@
             <div class="layout-content">
                 <div class="layout-content-main">
                     <h1 class="pb-2 text-2xl md:text-3xl md:pb-4">{{ .Title }}</h1>
+                    {{ if .LoginForm }}
+                    <form method="POST" action="{{ .LoginForm.Action }}" class="login-form" aria-label="Sign in with {{ .LoginForm.DisplayName }}">
+                        {{ if .LoginForm.Error }}
+                        <p class="login-form-error" role="alert">{{ .LoginForm.Error }}</p>
+                        {{ end }}
+                        <input type="hidden" name="state" value="{{ .LoginForm.State }}">
+                        <label>
+                            <span>Username</span>
+                            <input type="text" name="username" value="{{ .LoginForm.Username }}" autocomplete="username" autocapitalize="none" spellcheck="false" required{{ if not .LoginForm.Username }} autofocus{{ end }}>
+                        </label>
+                        <label>
+                            <span>Password</span>
+                            <input type="password" name="password" autocomplete="current-password" required{{ if .LoginForm.Username }} autofocus{{ end }}>
+                        </label>
+                        <div class="provider-button group tfa-{{ .LoginForm.Color }}">
+                            <button type="submit" class="provider-button-inner justify-center cursor-pointer" data-svg-icon="{{ .LoginForm.Icon }}">
+                                <svg aria-hidden="true"></svg>
+                                Sign in with {{ .LoginForm.DisplayName }}
+                            </button>
+                        </div>
+                    </form>
+                    {{ else if .Passkey }}
+                    <form method="POST" action="{{ .Passkey.Action }}" class="login-form" data-webauthn="{{ .Passkey.Mode }}" data-webauthn-options="{{ .Passkey.Options }}" aria-label="{{ if eq .Passkey.Mode "login" }}Sign in with {{ .Passkey.DisplayName }}{{ else }}Register a passkey{{ end }}">
+                        {{ if .Passkey.Error }}
+                        <p class="login-form-error" role="alert">{{ .Passkey.Error }}</p>
+                        {{ end }}
+                        {{ if .Passkey.Message }}
+                        <p class="login-form-message" role="status">{{ .Passkey.Message }}</p>
+                        {{ end }}
+                        {{ if eq .Passkey.Mode "login" }}
+                        <input type="hidden" name="state" value="{{ .Passkey.State }}">
+                        <input type="hidden" name="credentialId">
+                        <input type="hidden" name="authenticatorData">
+                        <input type="hidden" name="signature">
+                        <input type="hidden" name="userHandle">
+                        {{ else if eq .Passkey.Mode "register" }}
+                        <p class="text-sm">Register a passkey for <b>{{ .Passkey.UserName }}</b>. You will be able to use it to sign in.</p>
+                        <input type="hidden" name="attestationObject">
+                        {{ end }}
+                        {{ if .Passkey.Options }}
+                        <input type="hidden" name="clientDataJSON">
+                        <div class="provider-button group tfa-{{ .Passkey.Color }}">
+                            <button type="button" class="provider-button-inner justify-center cursor-pointer" data-webauthn-start data-svg-icon="{{ .Passkey.Icon }}">
+                                <svg aria-hidden="true"></svg>
+                                {{ if eq .Passkey.Mode "register" }}Register a passkey{{ else }}Sign in with {{ .Passkey.DisplayName }}{{ end }}
+                            </button>
+                        </div>
+                        {{ else if .Passkey.Link }}
+                        <div class="provider-button group tfa-{{ .Passkey.Color }}">
+                            <a href="{{ .Passkey.Link }}" class="provider-button-inner justify-center" data-svg-icon="{{ .Passkey.Icon }}">
+                                <svg aria-hidden="true"></svg>
+                                Continue
+                            </a>
+                        </div>
+                        {{ end }}
+                    </form>
+                    {{ else if .TOTP }}
+                    <form method="POST" action="{{ .TOTP.Action }}" class="login-form" aria-label="Verification code">
+                        {{ if .TOTP.Error }}
+                        <p class="login-form-error" role="alert">{{ .TOTP.Error }}</p>
+                        {{ end }}
+                        {{ if .TOTP.Secret }}
+                        <p class="text-sm">Set up an authenticator app for <b>{{ .TOTP.Account }}</b>: <a href="{{ .TOTP.KeyURI }}" class="underline">open it in your authenticator app</a>, or enter this key manually:</p>
+                        <code class="login-form-secret">{{ .TOTP.Secret }}</code>
+                        {{ end }}
+                        <label>
+                            <span>Enter the 6-digit code from your authenticator app</span>
+                            <input type="text" name="code" inputmode="numeric" pattern="[0-9 ]{6,7}" maxlength="7" autocomplete="one-time-code" required autofocus>
+                        </label>
+                        <div class="provider-button group tfa-slate">
+                            <button type="submit" class="provider-button-inner justify-center cursor-pointer">Verify</button>
+                        </div>
+                    </form>
+                    {{ else }}
                     <ul aria-label="Sign-in providers" class="flex flex-col items-center justify-center space-y-2 md:space-y-3 list-none p-0 m-0">
                         {{ range .Providers }}
                         <li class="provider-button group tfa-{{ .Color }}">
@@ -48,6 +122,7 @@
                         </li>
                         {{ end }}
                     </ul>
+                    {{ end }}
                 </div>
                 <div class="layout-content-side"></div>
             </div>
@@ -55,6 +130,9 @@
     </main>
 </body>
 
+{{ if and .Passkey .Passkey.Options }}
+<script defer src="{{ .BaseUrl }}/{{ .WebAuthnAsset }}" nonce="{{ .CspNonce }}"></script>
+{{ end }}
 {{ if gt (len .UsedIcons) 0 }}
 <script defer src="{{ .BaseUrl }}/icons.js?include={{ .UsedIcons }}" nonce="{{ .CspNonce }}"></script>
 {{ end }}
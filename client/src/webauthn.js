@@ -0,0 +1,124 @@
+(() => {
+    'use strict'
+
+    // Encode an ArrayBuffer as base64url, without padding
+    function bufferToBase64url(buf) {
+        const bytes = new Uint8Array(buf)
+        let str = ''
+        for (let i = 0; i < bytes.length; i++) {
+            str += String.fromCharCode(bytes[i])
+        }
+        return btoa(str).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+    }
+
+    // Decode a base64url string into an ArrayBuffer
+    function base64urlToBuffer(str) {
+        const b64 = str.replace(/-/g, '+').replace(/_/g, '/') + '==='.slice((str.length + 3) % 4)
+        const bin = atob(b64)
+        const bytes = new Uint8Array(bin.length)
+        for (let i = 0; i < bin.length; i++) {
+            bytes[i] = bin.charCodeAt(i)
+        }
+        return bytes.buffer
+    }
+
+    // Set the value of a hidden input in the form
+    function setField(form, name, value) {
+        const input = form.querySelector('input[name="' + name + '"]')
+        if (input) {
+            input.value = value
+        }
+    }
+
+    // Show an error message in the form
+    function showError(form, message) {
+        let el = form.querySelector('.login-form-error')
+        if (!el) {
+            el = document.createElement('p')
+            el.className = 'login-form-error'
+            el.setAttribute('role', 'alert')
+            form.insertBefore(el, form.firstChild)
+        }
+        el.textContent = message
+    }
+
+    // Sign in with a passkey
+    async function login(form, options) {
+        options.challenge = base64urlToBuffer(options.challenge)
+        if (options.allowCredentials) {
+            options.allowCredentials.forEach(function(c) {
+                c.id = base64urlToBuffer(c.id)
+            })
+        }
+
+        const cred = await navigator.credentials.get({publicKey: options})
+        setField(form, 'credentialId', bufferToBase64url(cred.rawId))
+        setField(form, 'clientDataJSON', bufferToBase64url(cred.response.clientDataJSON))
+        setField(form, 'authenticatorData', bufferToBase64url(cred.response.authenticatorData))
+        setField(form, 'signature', bufferToBase64url(cred.response.signature))
+        if (cred.response.userHandle) {
+            setField(form, 'userHandle', bufferToBase64url(cred.response.userHandle))
+        }
+    }
+
+    // Register a new passkey
+    async function register(form, options) {
+        options.challenge = base64urlToBuffer(options.challenge)
+        options.user.id = base64urlToBuffer(options.user.id)
+        if (options.excludeCredentials) {
+            options.excludeCredentials.forEach(function(c) {
+                c.id = base64urlToBuffer(c.id)
+            })
+        }
+
+        const cred = await navigator.credentials.create({publicKey: options})
+        setField(form, 'clientDataJSON', bufferToBase64url(cred.response.clientDataJSON))
+        setField(form, 'attestationObject', bufferToBase64url(cred.response.attestationObject))
+    }
+
+    function initWebAuthn() {
+        const form = document.querySelector('form[data-webauthn]')
+        if (!form) {
+            return
+        }
+        const button = form.querySelector('[data-webauthn-start]')
+        if (!button) {
+            return
+        }
+
+        if (!window.PublicKeyCredential) {
+            showError(form, 'This browser does not support passkeys.')
+            button.disabled = true
+            return
+        }
+
+        button.addEventListener('click', async function() {
+            button.disabled = true
+            try {
+                // Options are parsed again at every attempt, as they are modified in place
+                const options = JSON.parse(form.getAttribute('data-webauthn-options'))
+                if (form.getAttribute('data-webauthn') === 'register') {
+                    await register(form, options)
+                } else {
+                    await login(form, options)
+                }
+                form.submit()
+            } catch (err) {
+                // NotAllowedError is raised when users cancel the request or it times out
+                if (err && err.name === 'NotAllowedError') {
+                    showError(form, 'The request was canceled or timed out. Please try again.')
+                } else {
+                    showError(form, 'Something went wrong: ' + ((err && err.message) || err))
+                }
+                button.disabled = false
+            }
+        })
+    }
+
+    // Run when DOM is ready
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', initWebAuthn)
+    } else {
+        initWebAuthn()
+    }
+})()
@@ -18,6 +18,8 @@ import (
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
 	tfametrics "github.com/italypaleale/traefik-forward-auth/pkg/metrics"
 	"github.com/italypaleale/traefik-forward-auth/pkg/server"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
 )
 
 const (
@@ -133,11 +135,40 @@ func runService() {
 	}
 	shutdowns.Add(tracerShutdownFn)
 
+	// Init the session store
+	sessionStore, err := sessionstore.New(cfg.Sessions.Store, cfg.Sessions.StorePath)
+	if err != nil {
+		shutdowns.Run(ctx, log)
+		slogkit.FatalError(log, "Failed to init session store", err)
+		return
+	}
+	if sessionStore != nil {
+		shutdowns.Add(func(context.Context) error {
+			return sessionStore.Close()
+		})
+	}
+
+	// Init the TOTP store, if configured
+	var totpStore *totp.Store
+	if cfg.TOTP.StorePath != "" {
+		totpStore, err = totp.NewStore(cfg.TOTP.StorePath)
+		if err != nil {
+			shutdowns.Run(ctx, log)
+			slogkit.FatalError(log, "Failed to init TOTP store", err)
+			return
+		}
+		shutdowns.Add(func(context.Context) error {
+			return totpStore.Close()
+		})
+	}
+
 	// Create the Server object
 	srv, err := server.NewServer(server.NewServerOpts{
 		Portals:       portals,
 		Metrics:       metrics,
 		TraceProvider: traceProvider,
+		SessionStore:  sessionStore,
+		TOTPStore:     totpStore,
 	})
 	if err != nil {
 		shutdowns.Run(ctx, log)
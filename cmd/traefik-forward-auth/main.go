@@ -1,6 +1,9 @@
 package main
 
 import (
+	// Embed the time zone database, used by authorization conditions that reference a time zone, as it may not be available in the container image
+	_ "time/tzdata"
+
 	"github.com/italypaleale/traefik-forward-auth/cmd/traefik-forward-auth/cmds"
 )
 
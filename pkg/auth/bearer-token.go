@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/lestrrat-go/jwx/v4/jwt"
+	"github.com/lestrrat-go/jwx/v4/jwt/openid"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+// BearerToken is a Provider that authenticates non-browser clients, such as CI jobs and service accounts, with a JWT passed in the "Authorization: Bearer" header.
+// Tokens are issued by an external OpenID Connect issuer, and are verified with the keys published in the issuer's JWKS.
+type BearerToken struct {
+	baseProvider
+
+	tokenIssuer   string
+	tokenAudience string
+	jwks          *jwksFetcher
+
+	httpClient *http.Client
+}
+
+// NewBearerTokenOptions is the options for NewBearerToken
+type NewBearerTokenOptions struct {
+	// Issuer of the tokens
+	// The openid-configuration document is fetched from "<issuer>/.well-known/openid-configuration"
+	TokenIssuer string
+	// Expected value for the "aud" claim of the tokens
+	TokenAudience string
+	// Skip validating TLS certificates when connecting to the issuer
+	TLSSkipVerify bool
+	// Optional PEM-encoded CA certificate to trust when connecting to the issuer
+	TLSCACertificate []byte
+	// Request timeout
+	// Defaults to 10s
+	RequestTimeout time.Duration
+}
+
+// NewBearerToken returns a new BearerToken provider
+func NewBearerToken(ctx context.Context, opts NewBearerTokenOptions) (*BearerToken, error) {
+	if opts.TokenIssuer == "" {
+		return nil, errors.New("value for tokenIssuer is required in config for auth with provider 'bearertoken'")
+	}
+	_, err := url.Parse(opts.TokenIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("value for tokenIssuer is invalid in config for auth with provider 'bearertoken': failed to parse URL: %w", err)
+	}
+	if opts.TokenAudience == "" {
+		return nil, errors.New("value for tokenAudience is required in config for auth with provider 'bearertoken'")
+	}
+	if opts.RequestTimeout < time.Second {
+		opts.RequestTimeout = 10 * time.Second
+	}
+
+	a := &BearerToken{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Bearer token",
+				Name:        "bearertoken",
+				Color:       "slate",
+			},
+		},
+		tokenIssuer:   opts.TokenIssuer,
+		tokenAudience: opts.TokenAudience,
+		httpClient:    newProviderHTTPClient(opts.TLSSkipVerify, opts.TLSCACertificate),
+	}
+
+	// Fetch the openid-configuration document to get the JWKS URI
+	// Issuers that only issue tokens for workloads, such as CI systems, may not include the endpoints for signing users in, so we only need the JWKS URI here
+	// We retry this in case of failures
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = time.Second
+	bo.MaxInterval = 30 * time.Second
+	endpoints, err := backoff.Retry(ctx, func() (OAuth2Endpoints, error) {
+		return fetchOIDCDiscoveryDocument(ctx, opts.TokenIssuer, a.GetHTTPClient(), opts.RequestTimeout)
+	}, backoff.WithBackOff(bo))
+	if err != nil {
+		return nil, err
+	}
+
+	a.jwks, err = newJWKSFetcher(endpoints.JWKSUri, a.GetHTTPClient, opts.RequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure JWKS for auth with provider 'bearertoken': %w", err)
+	}
+
+	return a, nil
+}
+
+func (a *BearerToken) GetProviderType() string {
+	return "bearertoken"
+}
+
+func (a *BearerToken) GetHTTPClient() *http.Client {
+	return a.httpClient
+}
+
+func (a *BearerToken) AuthenticateRequest(r *http.Request) (*user.Profile, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// Before fetching the JWKS, check that the token was issued by this issuer and for this audience
+	// If it's not, the token could be meant for another provider in the portal
+	unverified, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bearer token: %w", err)
+	}
+	iss, _ := unverified.Issuer()
+	aud, _ := unverified.Audience()
+	if iss != a.tokenIssuer || !slices.Contains(aud, a.tokenAudience) {
+		return nil, fmt.Errorf("bearer token was not issued by this provider: %w", ErrNoCredentials)
+	}
+
+	set, err := a.jwks.Get(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS for bearer token verification: %w", err)
+	}
+
+	// Parse and verify the token, including its expiration
+	parsed, err := jwt.Parse(
+		[]byte(token),
+		jwt.WithKeySet(set, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithIssuer(a.tokenIssuer),
+		jwt.WithAudience(a.tokenAudience),
+		jwt.WithAcceptableSkew(idTokenClockSkew),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithToken(openid.New()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bearer token: %w", err)
+	}
+	oidToken, ok := parsed.(openid.Token)
+	if !ok {
+		return nil, errors.New("failed to parse bearer token: included claims cannot be cast to openid.Token")
+	}
+
+	profile, err := user.NewProfileFromOpenIDToken(oidToken, a.GetProviderName())
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims in bearer token: %w", err)
+	}
+
+	return profile, nil
+}
+
+// Compile-time interface assertion
+var _ RequestAuthProvider = &BearerToken{}
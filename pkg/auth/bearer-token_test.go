@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerToken(t *testing.T) {
+	key := newTestSigningKey(t)
+
+	// The discovery document doesn't include the authorization and token endpoints, like for issuers of tokens for workloads
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/.well-known/openid-configuration":
+				_, _ = w.Write([]byte(`{"issuer":"http://` + r.Host + `","jwks_uri":"http://` + r.Host + `/jwks"}`))
+			case "/jwks":
+				_, _ = w.Write(key.jwksRaw)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+	)
+	defer ts.Close()
+
+	p, err := NewBearerToken(t.Context(), NewBearerTokenOptions{
+		TokenIssuer:   ts.URL,
+		TokenAudience: "my-api",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "bearertoken", p.GetProviderType())
+	assert.Equal(t, "bearertoken", p.GetProviderName())
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss":    ts.URL,
+			"aud":    []string{"my-api"},
+			"sub":    "repo:acme/widgets:ref:refs/heads/main",
+			"email":  "ci@example.com",
+			"groups": []string{"ci"},
+			"iat":    time.Now().Add(-time.Minute).Unix(),
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	newRequest := func(authorization string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return req
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		profile, err := p.AuthenticateRequest(newRequest("Bearer " + key.SignClaims(t, validClaims())))
+		require.NoError(t, err)
+		assert.Equal(t, "bearertoken", profile.Provider)
+		assert.Equal(t, "repo:acme/widgets:ref:refs/heads/main", profile.ID)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "ci@example.com", profile.Email.Value)
+		assert.Equal(t, []string{"ci"}, profile.Groups)
+
+		// The scheme is case-insensitive
+		_, err = p.AuthenticateRequest(newRequest("bearer " + key.SignClaims(t, validClaims())))
+		require.NoError(t, err)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		_, err := p.AuthenticateRequest(newRequest(""))
+		require.ErrorIs(t, err, ErrNoCredentials)
+
+		_, err = p.AuthenticateRequest(newRequest("Basic dXNlcjpwYXNz"))
+		require.ErrorIs(t, err, ErrNoCredentials)
+
+		_, err = p.AuthenticateRequest(newRequest("Bearer "))
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("token for another issuer or audience", func(t *testing.T) {
+		claims := validClaims()
+		claims["iss"] = "https://other.example.com"
+		_, err := p.AuthenticateRequest(newRequest("Bearer " + key.SignClaims(t, claims)))
+		require.ErrorIs(t, err, ErrNoCredentials)
+
+		claims = validClaims()
+		claims["aud"] = []string{"other-api"}
+		_, err = p.AuthenticateRequest(newRequest("Bearer " + key.SignClaims(t, claims)))
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		_, err := p.AuthenticateRequest(newRequest("Bearer not-a-jwt"))
+		require.ErrorContains(t, err, "failed to parse bearer token")
+		require.NotErrorIs(t, err, ErrNoCredentials)
+
+		expired := validClaims()
+		expired["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err = p.AuthenticateRequest(newRequest("Bearer " + key.SignClaims(t, expired)))
+		require.ErrorContains(t, err, "failed to parse bearer token")
+
+		noExpiration := validClaims()
+		delete(noExpiration, "exp")
+		_, err = p.AuthenticateRequest(newRequest("Bearer " + key.SignClaims(t, noExpiration)))
+		require.ErrorContains(t, err, "failed to parse bearer token")
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		_, err = p.AuthenticateRequest(newRequest("Bearer " + signClaimsWithKey(t, otherKey, validClaims())))
+		require.ErrorContains(t, err, "failed to parse bearer token")
+
+		unsigned, err := buildUnsignedJWT(validClaims())
+		require.NoError(t, err)
+		_, err = p.AuthenticateRequest(newRequest("Bearer " + unsigned))
+		require.ErrorContains(t, err, "failed to parse bearer token")
+		require.NotErrorIs(t, err, ErrNoCredentials)
+	})
+}
+
+func TestNewBearerToken(t *testing.T) {
+	t.Run("missing options", func(t *testing.T) {
+		_, err := NewBearerToken(t.Context(), NewBearerTokenOptions{TokenAudience: "my-api"})
+		require.ErrorContains(t, err, "value for tokenIssuer is required")
+
+		_, err = NewBearerToken(t.Context(), NewBearerTokenOptions{TokenIssuer: "https://issuer.example.com"})
+		require.ErrorContains(t, err, "value for tokenAudience is required")
+	})
+
+	t.Run("discovery document without JWKS", func(t *testing.T) {
+		ts := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"issuer":"http://` + r.Host + `"}`))
+			}),
+		)
+		defer ts.Close()
+
+		_, err := NewBearerToken(t.Context(), NewBearerTokenOptions{
+			TokenIssuer:   ts.URL,
+			TokenAudience: "my-api",
+		})
+		require.ErrorContains(t, err, "failed to configure JWKS")
+	})
+}
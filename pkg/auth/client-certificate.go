@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwt"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	clientCertificateClaimIssuer      = "issuer"
+	clientCertificateClaimFingerprint = "fingerprint"
+
+	// ClientCertificateUserIDCommonName uses the certificate's subject common name as user ID
+	ClientCertificateUserIDCommonName = "cn"
+	// ClientCertificateUserIDEmail uses the first email address in the certificate's subject alternative names as user ID
+	ClientCertificateUserIDEmail = "email"
+	// ClientCertificateUserIDURI uses the first URI in the certificate's subject alternative names as user ID, such as a SPIFFE ID
+	ClientCertificateUserIDURI = "uri"
+)
+
+// ClientCertificate is a Provider that authenticates users and services with a TLS client certificate.
+// The certificate is read from the TLS connection, or from a header set by a trusted proxy, such as the one set by Traefik's PassTLSClientCert middleware.
+type ClientCertificate struct {
+	baseProvider
+
+	header         string
+	trustedProxies []netip.Prefix
+	caPool         *x509.CertPool
+	userIDFrom     string
+}
+
+// NewClientCertificateOptions is the options for NewClientCertificate
+type NewClientCertificateOptions struct {
+	// Name of the header containing the client certificate, set by a trusted proxy
+	// If empty, the certificate is read from the TLS connection, where it was already verified during the handshake
+	Header string
+	// List of IP ranges, in CIDR notation, of the proxies that are allowed to set the header
+	// Required when Header is set
+	TrustedProxies []string
+	// Optional PEM-encoded CA certificates used to verify the certificates passed in the header
+	CACertificate []byte
+	// Field of the certificate used as user ID
+	// Allowed values are "cn" (the default), "email", and "uri"
+	UserIDFrom string
+}
+
+// NewClientCertificate returns a new ClientCertificate provider
+func NewClientCertificate(opts NewClientCertificateOptions) (*ClientCertificate, error) {
+	a := &ClientCertificate{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Client certificate",
+				Name:        "clientcertificate",
+				Color:       "slate",
+			},
+		},
+		header:     opts.Header,
+		userIDFrom: opts.UserIDFrom,
+	}
+
+	switch a.userIDFrom {
+	case "":
+		a.userIDFrom = ClientCertificateUserIDCommonName
+	case ClientCertificateUserIDCommonName, ClientCertificateUserIDEmail, ClientCertificateUserIDURI:
+		// All good
+	default:
+		return nil, fmt.Errorf("value for 'userIdFrom' is invalid: '%s'", a.userIDFrom)
+	}
+
+	if a.header == "" {
+		if len(opts.TrustedProxies) > 0 || len(opts.CACertificate) > 0 {
+			return nil, errors.New("trusted proxies and CA certificate can only be set when the certificate is read from a header")
+		}
+		return a, nil
+	}
+
+	if len(opts.TrustedProxies) == 0 {
+		return nil, errors.New("at least one trusted proxy is required when the certificate is read from a header")
+	}
+	var err error
+	a.trustedProxies, err = parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.CACertificate) > 0 {
+		a.caPool = x509.NewCertPool()
+		if !a.caPool.AppendCertsFromPEM(opts.CACertificate) {
+			return nil, errors.New("failed to parse CA certificate: no valid PEM-encoded certificate found")
+		}
+	}
+
+	return a, nil
+}
+
+func (a *ClientCertificate) GetProviderType() string {
+	return "clientcertificate"
+}
+
+func (a *ClientCertificate) SeamlessAuth(r *http.Request) (*user.Profile, error) {
+	return a.AuthenticateRequest(r)
+}
+
+func (a *ClientCertificate) AuthenticateRequest(r *http.Request) (*user.Profile, error) {
+	cert, err := a.getCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	switch a.userIDFrom {
+	case ClientCertificateUserIDEmail:
+		if len(cert.EmailAddresses) > 0 {
+			id = cert.EmailAddresses[0]
+		}
+	case ClientCertificateUserIDURI:
+		if len(cert.URIs) > 0 {
+			id = cert.URIs[0].String()
+		}
+	default:
+		id = cert.Subject.CommonName
+	}
+	if id == "" {
+		return nil, fmt.Errorf("client certificate does not contain a value for '%s', which is used as user ID", a.userIDFrom)
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+		ID:       id,
+		Name: user.ProfileName{
+			FullName: cert.Subject.CommonName,
+		},
+		Groups: slices.Clone(cert.Subject.OrganizationalUnit),
+		AdditionalClaims: map[string]any{
+			clientCertificateClaimIssuer:      cert.Issuer.String(),
+			clientCertificateClaimFingerprint: certificateFingerprint(cert),
+		},
+	}
+	if len(cert.EmailAddresses) > 0 {
+		// The email address was asserted by the CA that issued the certificate
+		profile.Email = &user.ProfileEmail{
+			Value:    cert.EmailAddresses[0],
+			Verified: true,
+		}
+	}
+
+	return profile, nil
+}
+
+func (a *ClientCertificate) ValidateRequestClaims(r *http.Request, profile *user.Profile) error {
+	// Sessions can only be used with the same certificate they were created with
+	cert, err := a.getCertificate(r)
+	if err != nil {
+		return err
+	}
+
+	var expectFingerprint string
+	if profile.AdditionalClaims != nil {
+		expectFingerprint, _ = profile.AdditionalClaims[clientCertificateClaimFingerprint].(string)
+	}
+	if expectFingerprint != certificateFingerprint(cert) {
+		return errors.New("token was issued for a different client certificate")
+	}
+
+	return nil
+}
+
+func (a *ClientCertificate) PopulateAdditionalClaims(token jwt.Token, setClaimFn func(key string, val any)) {
+	issuer, err := jwt.Get[string](token, clientCertificateClaimIssuer)
+	if err == nil && issuer != "" {
+		setClaimFn(clientCertificateClaimIssuer, issuer)
+	}
+
+	fingerprint, err := jwt.Get[string](token, clientCertificateClaimFingerprint)
+	if err == nil && fingerprint != "" {
+		setClaimFn(clientCertificateClaimFingerprint, fingerprint)
+	}
+}
+
+// getCertificate returns the client certificate for the request
+// If the request doesn't contain a certificate, the error wraps ErrNoCredentials
+func (a *ClientCertificate) getCertificate(r *http.Request) (*x509.Certificate, error) {
+	// Certificates from the TLS connection were verified against the server's CA during the handshake
+	if a.header == "" {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return nil, ErrNoCredentials
+		}
+		return r.TLS.PeerCertificates[0], nil
+	}
+
+	val := r.Header.Get(a.header)
+	if val == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// Anyone could send the header, so it's accepted only from trusted proxies
+	if !isTrustedProxy(a.trustedProxies, r.RemoteAddr) {
+		return nil, fmt.Errorf("header '%s' was sent by '%s', which is not a trusted proxy", a.header, r.RemoteAddr)
+	}
+
+	chain, err := parseClientCertificateHeader(val)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate in header '%s': %w", a.header, err)
+	}
+	cert := chain[0]
+
+	now := time.Now()
+	if a.caPool == nil {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, errors.New("client certificate is expired or not yet valid")
+		}
+		return cert, nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         a.caPool,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify client certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// parseClientCertificateHeader parses the value of a header containing a client certificate and, optionally, its chain
+// The format is the one used by Traefik's PassTLSClientCert middleware: URL-encoded PEM certificates, with or without the "BEGIN" and "END" lines, separated by commas
+func parseClientCertificateHeader(val string) ([]*x509.Certificate, error) {
+	unescaped, err := url.QueryUnescape(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL encoding: %w", err)
+	}
+
+	parts := strings.Split(unescaped, ",")
+	chain := make([]*x509.Certificate, 0, len(parts))
+	for _, part := range parts {
+		var der []byte
+		block, _ := pem.Decode([]byte(strings.TrimSpace(part)))
+		if block != nil {
+			der = block.Bytes
+		} else {
+			// Traefik removes the "BEGIN" and "END" lines, leaving the base64-encoded data only
+			der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(part), ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate encoding: %w", err)
+			}
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
+}
+
+// certificateFingerprint returns the hex-encoded SHA-256 fingerprint of the certificate
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Compile-time interface assertion
+var (
+	_ SeamlessProvider    = &ClientCertificate{}
+	_ RequestAuthProvider = &ClientCertificate{}
+)
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestNewClientCertificate(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   NewClientCertificateOptions
+		errMsg string
+	}{
+		{name: "TLS source", opts: NewClientCertificateOptions{}},
+		{name: "header source", opts: NewClientCertificateOptions{Header: "X-Cert", TrustedProxies: []string{"10.0.0.0/8", "::1/128"}}},
+		{name: "header requires trusted proxies", opts: NewClientCertificateOptions{Header: "X-Cert"}, errMsg: "at least one trusted proxy is required"},
+		{name: "invalid trusted proxy", opts: NewClientCertificateOptions{Header: "X-Cert", TrustedProxies: []string{"10.0.0.1"}}, errMsg: "invalid trusted proxy '10.0.0.1'"},
+		{name: "invalid CA certificate", opts: NewClientCertificateOptions{Header: "X-Cert", TrustedProxies: []string{"10.0.0.0/8"}, CACertificate: []byte("nope")}, errMsg: "failed to parse CA certificate"},
+		{name: "trusted proxies without header", opts: NewClientCertificateOptions{TrustedProxies: []string{"10.0.0.0/8"}}, errMsg: "can only be set when the certificate is read from a header"},
+		{name: "invalid user ID field", opts: NewClientCertificateOptions{UserIDFrom: "serial"}, errMsg: "value for 'userIdFrom' is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewClientCertificate(tt.opts)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "clientcertificate", p.GetProviderType())
+			assert.Equal(t, "clientcertificate", p.GetProviderName())
+		})
+	}
+}
+
+func TestClientCertificateAuthenticateRequest(t *testing.T) {
+	ca := NewTestCertificateAuthority("Test CA")
+	otherCA := NewTestCertificateAuthority("Other CA")
+
+	alice := ca.Issue(TestClientCertificate{
+		CommonName:          "alice",
+		OrganizationalUnits: []string{"engineering", "ops"},
+		EmailAddresses:      []string{"alice@example.com"},
+		URIs:                []string{"spiffe://example.com/ns/default/sa/alice"},
+	})
+
+	newRequest := func(remoteAddr string, header string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if header != "" {
+			req.Header.Set("X-Forwarded-Tls-Client-Cert", header)
+		}
+		return req
+	}
+
+	newHeaderProvider := func(t *testing.T, opts NewClientCertificateOptions) *ClientCertificate {
+		t.Helper()
+		opts.Header = "X-Forwarded-Tls-Client-Cert"
+		opts.TrustedProxies = []string{"10.0.0.0/8"}
+		p, err := NewClientCertificate(opts)
+		require.NoError(t, err)
+		return p
+	}
+
+	t.Run("TLS connection", func(t *testing.T) {
+		p, err := NewClientCertificate(NewClientCertificateOptions{})
+		require.NoError(t, err)
+
+		req := newRequest("192.168.1.1:1234", "")
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{alice}}
+		profile, err := p.AuthenticateRequest(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, "clientcertificate", profile.Provider)
+		assert.Equal(t, "alice", profile.ID)
+		assert.Equal(t, "alice", profile.Name.FullName)
+		assert.Equal(t, &user.ProfileEmail{Value: "alice@example.com", Verified: true}, profile.Email)
+		assert.ElementsMatch(t, []string{"engineering", "ops"}, profile.Groups)
+		assert.Equal(t, "CN=Test CA", profile.AdditionalClaims[clientCertificateClaimIssuer])
+		assert.Len(t, profile.AdditionalClaims[clientCertificateClaimFingerprint], 64)
+
+		// Requests without a certificate have no credentials
+		_, err = p.AuthenticateRequest(newRequest("192.168.1.1:1234", ""))
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("header from trusted proxy", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{CACertificate: ca.PEM()})
+
+		profile, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(alice)))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", profile.ID)
+		assert.ElementsMatch(t, []string{"engineering", "ops"}, profile.Groups)
+	})
+
+	t.Run("header with PEM certificate", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		header := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: alice.Raw})))
+		profile, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", header))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", profile.ID)
+	})
+
+	t.Run("header from untrusted client", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		_, err := p.AuthenticateRequest(newRequest("192.168.1.1:1234", TraefikClientCertificateHeader(alice)))
+		require.ErrorContains(t, err, "not a trusted proxy")
+		require.NotErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		_, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", ""))
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		_, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", "not-a-certificate"))
+		require.ErrorContains(t, err, "failed to parse client certificate")
+	})
+
+	t.Run("certificate from another CA", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{CACertificate: ca.PEM()})
+
+		mallory := otherCA.Issue(TestClientCertificate{CommonName: "alice"})
+		_, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(mallory)))
+		require.ErrorContains(t, err, "failed to verify client certificate")
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		expired := ca.Issue(TestClientCertificate{CommonName: "alice", NotAfter: time.Now().Add(-time.Minute)})
+		_, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(expired)))
+		require.ErrorContains(t, err, "expired or not yet valid")
+	})
+
+	t.Run("user ID from email and URI", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{UserIDFrom: ClientCertificateUserIDEmail})
+		profile, err := p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(alice)))
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", profile.ID)
+
+		p = newHeaderProvider(t, NewClientCertificateOptions{UserIDFrom: ClientCertificateUserIDURI})
+		profile, err = p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(alice)))
+		require.NoError(t, err)
+		assert.Equal(t, "spiffe://example.com/ns/default/sa/alice", profile.ID)
+
+		// Certificates without the field are rejected
+		bob := ca.Issue(TestClientCertificate{CommonName: "bob"})
+		_, err = p.AuthenticateRequest(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(bob)))
+		require.ErrorContains(t, err, "does not contain a value for 'uri'")
+	})
+
+	t.Run("sessions are bound to the certificate", func(t *testing.T) {
+		p := newHeaderProvider(t, NewClientCertificateOptions{})
+
+		req := newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(alice))
+		profile, err := p.AuthenticateRequest(req)
+		require.NoError(t, err)
+		require.NoError(t, p.ValidateRequestClaims(req, profile))
+
+		// A different certificate for the same user
+		alice2 := ca.Issue(TestClientCertificate{CommonName: "alice"})
+		err = p.ValidateRequestClaims(newRequest("10.1.2.3:1234", TraefikClientCertificateHeader(alice2)), profile)
+		require.ErrorContains(t, err, "different client certificate")
+
+		err = p.ValidateRequestClaims(newRequest("10.1.2.3:1234", ""), profile)
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+// GenericOAuth2 manages authentication with an OAuth2 server that doesn't support OpenID Connect.
+// The endpoints are configured explicitly, and the user profile is built from the response of the user info endpoint using a configurable mapping.
+// It is based on the OAuth 2 provider.
+type GenericOAuth2 struct {
+	oAuth2
+
+	claims genericOAuth2ClaimPaths
+}
+
+// GenericOAuth2ClaimMapping contains the paths of the properties in the response of the user info endpoint that are used to populate the user profile.
+// Paths use a subset of the JSONPath syntax, for example "id", "data.user.email", "emails[0].value", "teams[*].name", or `["https://example.com/claim"]`.
+// When a path is empty, the property with the standard OpenID Connect claim name is used ("sub" or "id", "name", "email", "groups", "picture").
+type GenericOAuth2ClaimMapping struct {
+	// Path of the user ID
+	ID string
+	// Path of the user's full name
+	Name string
+	// Path of the user's email address
+	Email string
+	// Path of the list of groups
+	// The value can be a string, an array of strings, or a path with a wildcard that selects multiple strings
+	Groups string
+	// Path of the URL of the user's picture
+	Picture string
+}
+
+type genericOAuth2ClaimPaths struct {
+	id      user.ClaimPath
+	name    user.ClaimPath
+	email   user.ClaimPath
+	groups  user.ClaimPath
+	picture user.ClaimPath
+}
+
+// NewGenericOAuth2Options is the options for NewGenericOAuth2
+type NewGenericOAuth2Options struct {
+	// URL of the authorization endpoint
+	AuthorizationURL string
+	// URL of the token endpoint
+	TokenURL string
+	// URL of the user info endpoint
+	UserInfoURL string
+	// Client ID
+	ClientID string
+	// Client secret
+	ClientSecret string
+	// Scopes for requesting the token
+	// This is optional and defaults to "openid profile email"
+	Scopes string
+	// Request timeout
+	// Defaults to 10s
+	RequestTimeout time.Duration
+	// Key for generating PKCE code verifiers
+	// Enables the use of PKCE if non-empty
+	PKCEKey []byte
+	// Skip validating TLS certificates when connecting to the Identity Provider
+	TLSSkipVerify bool
+	// Optional, PEM-encoded CA certificate used when connecting to the Identity Provider
+	TLSCACertificate []byte
+	// Mapping from the response of the user info endpoint to the user profile
+	ClaimMapping GenericOAuth2ClaimMapping
+}
+
+// NewGenericOAuth2 returns a new GenericOAuth2 provider
+func NewGenericOAuth2(opts NewGenericOAuth2Options) (*GenericOAuth2, error) {
+	if opts.ClientID == "" {
+		return nil, errors.New("value for clientId is required in config for auth with provider 'genericoauth2'")
+	}
+	if opts.ClientSecret == "" {
+		return nil, errors.New("value for clientSecret is required in config for auth with provider 'genericoauth2'")
+	}
+
+	if opts.AuthorizationURL == "" || opts.TokenURL == "" || opts.UserInfoURL == "" {
+		return nil, errors.New("values for authorizationURL, tokenURL, and userInfoURL are required in config for auth with provider 'genericoauth2'")
+	}
+
+	claims, err := opts.ClaimMapping.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	const providerType = "genericoauth2"
+	metadata := ProviderMetadata{
+		DisplayName: "OAuth2",
+		Name:        providerType,
+		Color:       "slate",
+	}
+	oauth2, err := NewOAuth2(providerType, metadata, NewOAuth2Options{
+		Config: OAuth2Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+		},
+		Scopes:           opts.Scopes,
+		RequestTimeout:   opts.RequestTimeout,
+		PKCEKey:          opts.PKCEKey,
+		TLSSkipVerify:    opts.TLSSkipVerify,
+		TLSCACertificate: opts.TLSCACertificate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = oauth2.SetEndpoints(OAuth2Endpoints{
+		Authorization: opts.AuthorizationURL,
+		Token:         opts.TokenURL,
+		UserInfo:      opts.UserInfoURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GenericOAuth2{
+		oAuth2: oauth2,
+		claims: claims,
+	}, nil
+}
+
+// parse parses all paths in the claim mapping
+func (m GenericOAuth2ClaimMapping) parse() (res genericOAuth2ClaimPaths, err error) {
+	fields := []struct {
+		name string
+		path string
+		dest *user.ClaimPath
+	}{
+		{"id", m.ID, &res.id},
+		{"name", m.Name, &res.name},
+		{"email", m.Email, &res.email},
+		{"groups", m.Groups, &res.groups},
+		{"picture", m.Picture, &res.picture},
+	}
+	for _, f := range fields {
+		if f.path == "" {
+			continue
+		}
+		*f.dest, err = user.ParseClaimPath(f.path)
+		if err != nil {
+			return res, fmt.Errorf("invalid path for claim '%s': %w", f.name, err)
+		}
+		if f.name != "groups" && f.dest.HasWildcard() {
+			return res, fmt.Errorf("invalid path for claim '%s': wildcards are only allowed for groups", f.name)
+		}
+	}
+
+	return res, nil
+}
+
+func (a *GenericOAuth2) OAuth2RetrieveProfile(ctx context.Context, at OAuth2AccessToken) (*user.Profile, error) {
+	if at.AccessToken == "" {
+		return nil, errors.New("missing AccessToken in parameter at")
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, a.endpoints.UserInfo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+at.AccessToken)
+	req.Header.Set("User-Agent", "tfa/1")
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	// Use json.Number so large numeric IDs are not converted to floats
+	var doc any
+	dec := json.NewDecoder(res.Body)
+	dec.UseNumber()
+	err = dec.Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response body: %w", err)
+	}
+
+	claims, ok := doc.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid response body: not a JSON object")
+	}
+
+	profile, err := user.NewProfileFromClaims(a.claims.apply(claims), a.GetProviderName())
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims in user info response: %w", err)
+	}
+
+	return profile, nil
+}
+
+// apply returns a copy of the claims in which the properties selected by the configured paths are set using the standard OpenID Connect claim names
+func (p genericOAuth2ClaimPaths) apply(claims map[string]any) map[string]any {
+	res := make(map[string]any, len(claims)+5)
+	for k, v := range claims {
+		res[k] = v
+	}
+
+	set := func(name string, path user.ClaimPath) {
+		if len(path) == 0 {
+			return
+		}
+		val, ok := path.Get(claims)
+		if !ok {
+			// Remove the standard claim so it's not used in place of the configured path
+			delete(res, name)
+			return
+		}
+		res[name] = val
+	}
+
+	if len(p.id) > 0 {
+		// NewProfileFromClaims falls back to "id" if "sub" is empty
+		delete(res, "id")
+		set("sub", p.id)
+	}
+	set("name", p.name)
+	set("email", p.email)
+	set("picture", p.picture)
+	if len(p.groups) > 0 {
+		delete(res, "group")
+		set("groups", p.groups)
+	}
+
+	return res
+}
+
+// Compile-time interface assertion
+var _ OAuth2Provider = &GenericOAuth2{}
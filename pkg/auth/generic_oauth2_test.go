@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGenericOAuth2(t *testing.T) {
+	opts := NewGenericOAuth2Options{
+		AuthorizationURL: "https://auth.example.com/authorize",
+		TokenURL:         "https://auth.example.com/token",
+		UserInfoURL:      "https://api.example.com/me",
+		ClientID:         "cid",
+		ClientSecret:     "secret",
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		provider, err := NewGenericOAuth2(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "genericoauth2", provider.GetProviderType())
+		assert.Equal(t, "OAuth2", provider.GetProviderDisplayName())
+	})
+
+	t.Run("missing endpoint", func(t *testing.T) {
+		o := opts
+		o.UserInfoURL = ""
+		_, err := NewGenericOAuth2(o)
+		require.ErrorContains(t, err, "userInfoURL")
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		o := opts
+		o.ClaimMapping.Email = "emails["
+		_, err := NewGenericOAuth2(o)
+		require.ErrorContains(t, err, "invalid path for claim 'email'")
+	})
+
+	t.Run("wildcard not allowed", func(t *testing.T) {
+		o := opts
+		o.ClaimMapping.ID = "ids[*]"
+		_, err := NewGenericOAuth2(o)
+		require.ErrorContains(t, err, "wildcards are only allowed for groups")
+	})
+}
+
+func TestGenericOAuth2RetrieveProfile(t *testing.T) {
+	newProvider := func(t *testing.T, mapping GenericOAuth2ClaimMapping, body string) *GenericOAuth2 {
+		t.Helper()
+
+		provider, err := NewGenericOAuth2(NewGenericOAuth2Options{
+			AuthorizationURL: "https://auth.example.com/authorize",
+			TokenURL:         "https://auth.example.com/token",
+			UserInfoURL:      "https://api.example.com/me",
+			ClientID:         "cid",
+			ClientSecret:     "secret",
+			Scopes:           "identify email",
+			ClaimMapping:     mapping,
+		})
+		require.NoError(t, err)
+
+		provider.httpClient = &http.Client{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() != "https://api.example.com/me" || req.Header.Get("Authorization") != "Bearer token-1" {
+					return nil, assert.AnError
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader(body)),
+				}, nil
+			}),
+		}
+		return provider
+	}
+
+	t.Run("authorize URL", func(t *testing.T) {
+		provider := newProvider(t, GenericOAuth2ClaimMapping{}, "{}")
+		authURL, err := provider.OAuth2AuthorizeURL("state-1", "https://app.example.com/callback")
+		require.NoError(t, err)
+
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, "https://auth.example.com/authorize", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal(t, "identify email", u.Query().Get("scope"))
+	})
+
+	t.Run("default mapping", func(t *testing.T) {
+		provider := newProvider(t, GenericOAuth2ClaimMapping{},
+			`{"id":"80351110224678912","name":"Nelly","email":"nelly@example.com","groups":["a","b"],"picture":"https://example.com/p.png"}`)
+		profile, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "genericoauth2", profile.Provider)
+		assert.Equal(t, "80351110224678912", profile.ID)
+		assert.Equal(t, "Nelly", profile.Name.FullName)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "nelly@example.com", profile.Email.Value)
+		assert.Equal(t, []string{"a", "b"}, profile.Groups)
+		assert.Equal(t, "https://example.com/p.png", profile.Picture)
+	})
+
+	t.Run("custom mapping", func(t *testing.T) {
+		provider := newProvider(t, GenericOAuth2ClaimMapping{
+			ID:      "user.uuid",
+			Name:    "user.display_name",
+			Email:   "emails[0].email",
+			Groups:  "teams[*].slug",
+			Picture: `user.links["avatar.href"]`,
+		}, `{
+			"id": "ignored",
+			"name": "ignored",
+			"user": {"uuid": 12345678901234567, "display_name": "Jane Doe", "links": {"avatar.href": "https://example.com/a.png"}},
+			"emails": [{"email": "jane@example.com"}],
+			"teams": [{"slug": "dev"}, {"slug": "ops"}]
+		}`)
+		profile, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "12345678901234567", profile.ID)
+		assert.Equal(t, "Jane Doe", profile.Name.FullName)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "jane@example.com", profile.Email.Value)
+		assert.Equal(t, []string{"dev", "ops"}, profile.Groups)
+		assert.Equal(t, "https://example.com/a.png", profile.Picture)
+	})
+
+	t.Run("missing ID", func(t *testing.T) {
+		provider := newProvider(t, GenericOAuth2ClaimMapping{ID: "user.uuid"}, `{"id":"ignored"}`)
+		_, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.Error(t, err)
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		provider := newProvider(t, GenericOAuth2ClaimMapping{}, `["a"]`)
+		_, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.ErrorContains(t, err, "not a JSON object")
+	})
+}
@@ -1,13 +1,13 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v4/jwt"
@@ -24,6 +24,8 @@ const (
 // It is based on the OAuth 2 provider.
 type GitHub struct {
 	oAuth2
+
+	includeGroups bool
 }
 
 // NewGitHubOptions is the options for NewGitHub
@@ -35,6 +37,8 @@ type NewGitHubOptions struct {
 	// Request timeout
 	// Defaults to 10s
 	RequestTimeout time.Duration
+	// If true, requests the "read:org" scope, and includes the organizations and teams the user is a member of in the list of groups
+	IncludeGroups bool
 }
 
 // NewGitHub returns a new GitHub provider
@@ -47,6 +51,11 @@ func NewGitHub(opts NewGitHubOptions) (*GitHub, error) {
 	}
 
 	const providerType = "github"
+	scopes := "user"
+	if opts.IncludeGroups {
+		scopes += " read:org"
+	}
+
 	metadata := ProviderMetadata{
 		DisplayName: "GitHub",
 		Name:        providerType,
@@ -58,7 +67,7 @@ func NewGitHub(opts NewGitHubOptions) (*GitHub, error) {
 			ClientID:     opts.ClientID,
 			ClientSecret: opts.ClientSecret,
 		},
-		Scopes:         "user",
+		Scopes:         scopes,
 		RequestTimeout: opts.RequestTimeout,
 	})
 	if err != nil {
@@ -76,7 +85,8 @@ func NewGitHub(opts NewGitHubOptions) (*GitHub, error) {
 	}
 
 	return &GitHub{
-		oAuth2: oauth2,
+		oAuth2:        oauth2,
+		includeGroups: opts.IncludeGroups,
 	}, nil
 }
 
@@ -85,45 +95,20 @@ func (a *GitHub) OAuth2RetrieveProfile(ctx context.Context, at OAuth2AccessToken
 		return nil, errors.New("missing AccessToken in parameter at")
 	}
 
-	reqCtx, cancel := context.WithTimeout(ctx, a.requestTimeout)
-	defer cancel()
-	reqBody := strings.NewReader(`{"query": "query { viewer { id, login, avatarUrl, name } }"}`)
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, githubGraphQLEndpoint, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	var resData struct {
+		Viewer struct {
+			ID        string `json:"id"`
+			Login     string `json:"login"`
+			AvatarUrl string `json:"avatarUrl"`
+			Name      string `json:"name"`
+		} `json:"viewer"`
 	}
-	req.Header.Set("Authorization", "token "+at.AccessToken)
-	req.Header.Set("User-Agent", "tfa/1")
-
-	res, err := a.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to perform request: %w", err)
-	}
-	defer func() {
-		_, _ = io.Copy(io.Discard, res.Body)
-		res.Body.Close()
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("invalid response status code: %d", res.StatusCode)
-	}
-
-	var resBody struct {
-		Data struct {
-			Viewer struct {
-				ID        string `json:"id"`
-				Login     string `json:"login"`
-				AvatarUrl string `json:"avatarUrl"`
-				Name      string `json:"name"`
-			} `json:"viewer"`
-		} `json:"data"`
-	}
-	err = json.NewDecoder(res.Body).Decode(&resBody)
+	err := a.graphQLQuery(ctx, at.AccessToken, "query { viewer { id, login, avatarUrl, name } }", nil, &resData)
 	if err != nil {
 		return nil, err
 	}
 
-	userData := resBody.Data.Viewer
+	userData := resData.Viewer
 	if userData.ID == "" || userData.Login == "" {
 		return nil, errors.New("missing required fields in user profile response")
 	}
@@ -145,9 +130,111 @@ func (a *GitHub) OAuth2RetrieveProfile(ctx context.Context, at OAuth2AccessToken
 	}
 	profile.SetAdditionalClaim(githubClaimGitHubUserID, userData.ID)
 
+	if a.includeGroups {
+		profile.Groups, err = a.retrieveGroups(ctx, at.AccessToken, userData.Login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve organizations and teams: %w", err)
+		}
+	}
+
 	return profile, nil
 }
 
+// retrieveGroups returns the organizations and teams the user is a member of, in the format "org" and "org/team"
+// This requires the "read:org" scope; organizations that restrict access to OAuth apps are only included if the application was approved
+// At most 100 organizations, and 100 teams in each organization, are returned
+func (a *GitHub) retrieveGroups(ctx context.Context, accessToken string, login string) ([]string, error) {
+	const query = `query($login: String!) { viewer { organizations(first: 100) { nodes { login, teams(first: 100, userLogins: [$login]) { nodes { slug } } } } } }`
+	var resData struct {
+		Viewer struct {
+			Organizations struct {
+				Nodes []struct {
+					Login string `json:"login"`
+					Teams struct {
+						Nodes []struct {
+							Slug string `json:"slug"`
+						} `json:"nodes"`
+					} `json:"teams"`
+				} `json:"nodes"`
+			} `json:"organizations"`
+		} `json:"viewer"`
+	}
+	err := a.graphQLQuery(ctx, accessToken, query, map[string]any{"login": login}, &resData)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(resData.Viewer.Organizations.Nodes))
+	for _, org := range resData.Viewer.Organizations.Nodes {
+		if org.Login == "" {
+			continue
+		}
+		groups = append(groups, org.Login)
+		for _, team := range org.Teams.Nodes {
+			if team.Slug != "" {
+				groups = append(groups, org.Login+"/"+team.Slug)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// graphQLQuery invokes the GitHub GraphQL API and decodes the "data" property of the response into out
+func (a *GitHub) graphQLQuery(ctx context.Context, accessToken string, query string, variables map[string]any, out any) error {
+	reqBody, err := json.Marshal(map[string]any{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize request body: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, githubGraphQLEndpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tfa/1")
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	var resBody struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&resBody)
+	if err != nil {
+		return err
+	}
+
+	// The GraphQL API returns errors with a 200 status code
+	if len(resBody.Errors) > 0 {
+		return fmt.Errorf("error returned by the GraphQL API: %s", resBody.Errors[0].Message)
+	}
+	if len(resBody.Data) == 0 {
+		return errors.New("response from the GraphQL API does not contain data")
+	}
+
+	return json.Unmarshal(resBody.Data, out)
+}
+
 func (a *GitHub) PopulateAdditionalClaims(token jwt.Token, setClaimFn func(key string, val any)) {
 	val, err := jwt.Get[string](token, githubClaimGitHubUserID)
 	if err == nil && val != "" {
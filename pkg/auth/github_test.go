@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/url"
@@ -108,3 +109,65 @@ func TestGitHubOAuth2ExchangeCodeAndRetrieveProfile(t *testing.T) {
 	assert.Equal(t, "The Octocat", profile.Name.FullName)
 	assert.Equal(t, "123", profile.AdditionalClaims[githubClaimGitHubUserID])
 }
+
+func TestGitHubRetrieveProfileWithGroups(t *testing.T) {
+	provider, err := NewGitHub(NewGitHubOptions{ClientID: "cid", ClientSecret: "secret", IncludeGroups: true})
+	require.NoError(t, err)
+
+	authURL, err := provider.OAuth2AuthorizeURL("state-1", "https://app.example.com/callback")
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "user read:org", u.Query().Get("scope"))
+
+	var orgsResponse string
+	provider.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.String() != githubGraphQLEndpoint {
+				return nil, assert.AnError
+			}
+
+			var body struct {
+				Query     string         `json:"query"`
+				Variables map[string]any `json:"variables"`
+			}
+			rErr := json.NewDecoder(req.Body).Decode(&body)
+			if rErr != nil {
+				return nil, rErr
+			}
+
+			resBody := `{"data":{"viewer":{"id":"123","login":"octocat","avatarUrl":"","name":"The Octocat"}}}`
+			if strings.Contains(body.Query, "organizations") {
+				if body.Variables["login"] != "octocat" {
+					return nil, assert.AnError
+				}
+				resBody = orgsResponse
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(resBody)),
+			}, nil
+		}),
+	}
+
+	t.Run("organizations and teams", func(t *testing.T) {
+		orgsResponse = `{"data":{"viewer":{"organizations":{"nodes":[` +
+			`{"login":"acme","teams":{"nodes":[{"slug":"platform"},{"slug":"security"}]}},` +
+			`{"login":"other","teams":{"nodes":[]}}` +
+			`]}}}}`
+
+		profile, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "octocat", profile.ID)
+		assert.Equal(t, []string{"acme", "acme/platform", "acme/security", "other"}, profile.Groups)
+	})
+
+	t.Run("GraphQL error", func(t *testing.T) {
+		orgsResponse = `{"data":null,"errors":[{"message":"Your token has not been granted the required scopes"}]}`
+
+		_, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "token-1"})
+		require.ErrorContains(t, err, "required scopes")
+	})
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwt/openid"
+	"github.com/spf13/cast"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	// Default URL for GitLab, for users of gitlab.com
+	gitLabDefaultEndpoint = "https://gitlab.com"
+
+	// Claim with the list of groups the user is a direct member of
+	// This is included in ID tokens, which don't include the "groups" claim
+	gitLabClaimGroupsDirect = "groups_direct"
+)
+
+// GitLab manages authentication with GitLab, including self-hosted instances.
+// It is based on the OpenIDConnect provider.
+type GitLab struct {
+	*OpenIDConnect
+}
+
+// NewGitLabOptions is the options for NewGitLab
+type NewGitLabOptions struct {
+	// Base URL of the GitLab instance
+	// This is optional and defaults to "https://gitlab.com"
+	Endpoint string
+	// Client ID
+	ClientID string
+	// Client secret
+	ClientSecret string
+	// Request timeout
+	// Defaults to 10s
+	RequestTimeout time.Duration
+	// Scopes for requesting the token
+	// This is optional and defaults to "openid profile email"
+	Scopes string
+	// Key for generating PKCE code verifiers
+	// Enables the use of PKCE if non-empty
+	PKCEKey []byte
+	// Skip validating TLS certificates when connecting to the Identity Provider
+	TLSSkipVerify bool
+	// Optional, PEM-encoded CA certificate used when connecting to the Identity Provider
+	TLSCACertificate []byte
+}
+
+func (o NewGitLabOptions) ToNewOpenIDConnectOptions() NewOpenIDConnectOptions {
+	return NewOpenIDConnectOptions{
+		ClientID:         o.ClientID,
+		ClientSecret:     o.ClientSecret,
+		RequestTimeout:   o.RequestTimeout,
+		Scopes:           o.Scopes,
+		TokenIssuer:      o.Endpoint,
+		PKCEKey:          o.PKCEKey,
+		TLSSkipVerify:    o.TLSSkipVerify,
+		TLSCACertificate: o.TLSCACertificate,
+
+		// Profile modifier functions that populate the list of groups
+		// ID tokens issued by GitLab contain the groups the user is a direct member of in the "groups_direct" claim, while the UserInfo endpoint returns all groups in the "groups" claim
+		// https://docs.gitlab.com/integration/openid_connect_provider/
+		profileModifier: profileModifierFn{
+			Token: func(token openid.Token, profile *user.Profile) error {
+				if len(profile.Groups) > 0 {
+					return nil
+				}
+				v, ok := token.Field(gitLabClaimGroupsDirect)
+				if ok {
+					profile.Groups = cast.ToStringSlice(v)
+				}
+				return nil
+			},
+			Claims: func(claims map[string]any, profile *user.Profile) error {
+				if len(profile.Groups) > 0 {
+					return nil
+				}
+				v, ok := claims[gitLabClaimGroupsDirect]
+				if ok {
+					profile.Groups = cast.ToStringSlice(v)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// NewGitLab returns a new GitLab provider
+func NewGitLab(ctx context.Context, opts NewGitLabOptions) (*GitLab, error) {
+	// Remove the trailing slash if present
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	if opts.Endpoint == "" {
+		opts.Endpoint = gitLabDefaultEndpoint
+	}
+
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errors.New("value for endpoint is invalid in config for auth with provider 'gitlab': must be a URL like 'https://gitlab.example.com'")
+	}
+	if opts.ClientID == "" {
+		return nil, errors.New("value for clientID is required in config for auth with provider 'gitlab'")
+	}
+	if opts.ClientSecret == "" {
+		return nil, errors.New("value for clientSecret is required in config for auth with provider 'gitlab'")
+	}
+	oidcOpts := opts.ToNewOpenIDConnectOptions()
+	// Set default scopes if not specified
+	if oidcOpts.Scopes == "" {
+		oidcOpts.Scopes = "openid profile email"
+	}
+
+	const providerType = "gitlab"
+	metadata := ProviderMetadata{
+		DisplayName: "GitLab",
+		Name:        providerType,
+		Icon:        "gitlab",
+		Color:       "orange",
+	}
+	oidc, err := newOpenIDConnectInternal(ctx, providerType, metadata, oidcOpts, OAuth2Endpoints{
+		Authorization: opts.Endpoint + "/oauth/authorize",
+		Token:         opts.Endpoint + "/oauth/token",
+		UserInfo:      opts.Endpoint + "/oauth/userinfo",
+		JWKSUri:       opts.Endpoint + "/oauth/discovery/keys",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &GitLab{
+		OpenIDConnect: oidc,
+	}
+
+	return a, nil
+}
+
+// Compile-time interface assertions
+var (
+	_ OAuth2Provider = &GitLab{}
+)
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGitLab(t *testing.T) {
+	t.Run("defaults to gitlab.com", func(t *testing.T) {
+		provider, err := NewGitLab(t.Context(), NewGitLabOptions{
+			ClientID:     "cid",
+			ClientSecret: "secret",
+		})
+		require.NoError(t, err)
+
+		authURL, err := provider.OAuth2AuthorizeURL("st", "https://app.example.com/callback")
+		require.NoError(t, err)
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, "https://gitlab.com/oauth/authorize", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal(t, "openid profile email", u.Query().Get("scope"))
+		assert.Equal(t, "gitlab", provider.GetProviderName())
+	})
+
+	t.Run("self-hosted instance", func(t *testing.T) {
+		provider, err := NewGitLab(t.Context(), NewGitLabOptions{
+			Endpoint:     "https://gitlab.example.com/",
+			ClientID:     "cid",
+			ClientSecret: "secret",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "https://gitlab.example.com", provider.tokenIssuer)
+		assert.Equal(t, "https://gitlab.example.com/oauth/token", provider.endpoints.Token)
+		assert.Equal(t, "https://gitlab.example.com/oauth/userinfo", provider.endpoints.UserInfo)
+		assert.Equal(t, "https://gitlab.example.com/oauth/discovery/keys", provider.endpoints.JWKSUri)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewGitLab(t.Context(), NewGitLabOptions{Endpoint: "gitlab.example.com", ClientID: "cid", ClientSecret: "secret"})
+		require.ErrorContains(t, err, "value for endpoint is invalid")
+		_, err = NewGitLab(t.Context(), NewGitLabOptions{ClientSecret: "secret"})
+		require.ErrorContains(t, err, "value for clientID is required")
+		_, err = NewGitLab(t.Context(), NewGitLabOptions{ClientID: "cid"})
+		require.ErrorContains(t, err, "value for clientSecret is required")
+	})
+}
+
+func TestGitLabRetrieveProfileGroups(t *testing.T) {
+	signer := newTestSigningKey(t)
+
+	provider, err := NewGitLab(t.Context(), NewGitLabOptions{
+		Endpoint:     "https://gitlab.example.com",
+		ClientID:     "cid",
+		ClientSecret: "secret",
+	})
+	require.NoError(t, err)
+
+	provider.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.String() {
+			case "https://gitlab.example.com/oauth/discovery/keys":
+				return signer.serveJWKS(), nil
+			case "https://gitlab.example.com/oauth/userinfo":
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader(`{"sub":"42","name":"GitLab User","groups":["platform","platform/infra"]}`)),
+				}, nil
+			default:
+				return nil, assert.AnError
+			}
+		}),
+	}
+
+	t.Run("groups_direct claim in ID token", func(t *testing.T) {
+		now := time.Now().Unix()
+		idToken := signer.SignClaims(t, map[string]any{
+			"iss":           "https://gitlab.example.com",
+			"aud":           "cid",
+			"sub":           "42",
+			"name":          "GitLab User",
+			"groups_direct": []string{"platform", "platform/infra"},
+			"exp":           now + 600,
+			"iat":           now,
+		})
+
+		profile, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "at", IDToken: idToken})
+		require.NoError(t, err)
+		assert.Equal(t, "42", profile.ID)
+		assert.Equal(t, "gitlab", profile.Provider)
+		assert.Equal(t, []string{"platform", "platform/infra"}, profile.Groups)
+	})
+
+	t.Run("groups claim from UserInfo", func(t *testing.T) {
+		jwks := provider.jwks
+		provider.jwks = nil
+		defer func() {
+			provider.jwks = jwks
+		}()
+
+		profile, err := provider.OAuth2RetrieveProfile(t.Context(), OAuth2AccessToken{AccessToken: "at"})
+		require.NoError(t, err)
+		assert.Equal(t, "42", profile.ID)
+		assert.Equal(t, []string{"platform", "platform/infra"}, profile.Groups)
+	})
+}
@@ -0,0 +1,385 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	// Default filter used to search for users
+	ldapDefaultUserFilter = "(|(uid={username})(sAMAccountName={username}))"
+	// Placeholder in the user filter that is replaced with the username
+	ldapUsernamePlaceholder = "{username}"
+)
+
+// Default names of the attributes used to populate the user profile
+// The names include the attributes used by OpenLDAP (inetOrgPerson) and Active Directory
+var (
+	ldapDefaultIDAttributes        = []string{"uid", "sAMAccountName"}
+	ldapDefaultNameAttributes      = []string{"displayName", "cn"}
+	ldapDefaultFirstNameAttributes = []string{"givenName"}
+	ldapDefaultLastNameAttributes  = []string{"sn"}
+	ldapDefaultEmailAttributes     = []string{"mail"}
+	ldapDefaultGroupsAttributes    = []string{"memberOf"}
+)
+
+// LDAP manages authentication with an LDAP directory, such as Active Directory or OpenLDAP.
+// Users enter their username and password in a login form: the provider searches for the user's entry in the directory, then verifies the password by binding as the user.
+type LDAP struct {
+	baseProvider
+
+	address        string
+	useTLS         bool
+	startTLS       bool
+	tlsConfig      *tls.Config
+	bindDN         string
+	bindPassword   string
+	baseDN         string
+	userFilter     string
+	attributes     LDAPAttributeMapping
+	groupsFullDN   bool
+	requestTimeout time.Duration
+	dial           func(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+// LDAPAttributeMapping contains the names of the attributes used to populate the user profile.
+// When a value is empty, a list of commonly-used attribute names is used.
+type LDAPAttributeMapping struct {
+	// Name of the attribute with the user ID
+	ID string
+	// Name of the attribute with the user's full name
+	Name string
+	// Name of the attribute with the user's email address
+	Email string
+	// Name of the attribute with the list of groups
+	Groups string
+}
+
+// NewLDAPOptions is the options for NewLDAP
+type NewLDAPOptions struct {
+	// URL of the LDAP server, with the "ldap" or "ldaps" scheme, such as "ldaps://ldap.example.com"
+	URL string
+	// If true, upgrades the connection to TLS using StartTLS
+	// This can only be used with URLs with the "ldap" scheme
+	StartTLS bool
+	// DN of the account used to search for users
+	// If empty, searches are performed after an anonymous bind
+	BindDN string
+	// Password of the account used to search for users
+	BindPassword string
+	// Base DN for searching users
+	BaseDN string
+	// Filter used to search for users, where "{username}" is replaced with the username
+	// Defaults to "(|(uid={username})(sAMAccountName={username}))"
+	UserFilter string
+	// Mapping from the attributes of the user's entry to the user profile
+	AttributeMapping LDAPAttributeMapping
+	// If true, groups in the profile contain the full DN of each group
+	// Otherwise, they contain the value of the first RDN only, which is usually the CN
+	GroupsFullDN bool
+	// Timeout for requests to the LDAP server
+	// Defaults to 10s
+	RequestTimeout time.Duration
+	// Skip validating TLS certificates when connecting to the LDAP server
+	TLSSkipVerify bool
+	// Optional, PEM-encoded CA certificate used when connecting to the LDAP server
+	TLSCACertificate []byte
+}
+
+// NewLDAP returns a new LDAP provider
+func NewLDAP(opts NewLDAPOptions) (*LDAP, error) {
+	if opts.URL == "" {
+		return nil, errors.New("value for url is required in config for auth with provider 'ldap'")
+	}
+	if opts.BaseDN == "" {
+		return nil, errors.New("value for baseDN is required in config for auth with provider 'ldap'")
+	}
+	if opts.BindDN != "" && opts.BindPassword == "" {
+		return nil, errors.New("value for bindPassword is required in config for auth with provider 'ldap' when bindDN is set")
+	}
+	if opts.RequestTimeout < time.Second {
+		opts.RequestTimeout = 10 * time.Second
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP server URL: %w", err)
+	}
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid LDAP server URL '%s'", opts.URL)
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if opts.StartTLS {
+			return nil, errors.New("StartTLS cannot be used with 'ldaps' URLs")
+		}
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("invalid scheme '%s' for LDAP server URL: must be 'ldap' or 'ldaps'", u.Scheme)
+	}
+
+	userFilter := opts.UserFilter
+	if userFilter == "" {
+		userFilter = ldapDefaultUserFilter
+	}
+	if !strings.Contains(userFilter, ldapUsernamePlaceholder) {
+		return nil, fmt.Errorf("user filter must contain the '%s' placeholder", ldapUsernamePlaceholder)
+	}
+	_, err = ldap.CompileFilter(strings.ReplaceAll(userFilter, ldapUsernamePlaceholder, "user"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid user filter: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: u.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	}
+	if opts.TLSSkipVerify {
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+	} else if len(opts.TLSCACertificate) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(opts.TLSCACertificate)
+	}
+
+	const providerType = "ldap"
+	return &LDAP{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "LDAP",
+				Name:        providerType,
+				Color:       "neutral",
+			},
+		},
+		address:        net.JoinHostPort(u.Hostname(), port),
+		useTLS:         u.Scheme == "ldaps",
+		startTLS:       opts.StartTLS,
+		tlsConfig:      tlsConfig,
+		bindDN:         opts.BindDN,
+		bindPassword:   opts.BindPassword,
+		baseDN:         opts.BaseDN,
+		userFilter:     userFilter,
+		attributes:     opts.AttributeMapping,
+		groupsFullDN:   opts.GroupsFullDN,
+		requestTimeout: opts.RequestTimeout,
+		dial:           (&net.Dialer{}).DialContext,
+	}, nil
+}
+
+func (a *LDAP) GetProviderType() string {
+	return "ldap"
+}
+
+// FormAuth authenticates the user by searching for their entry in the directory, then binding with their DN and password.
+func (a *LDAP) FormAuth(ctx context.Context, username string, password string) (*user.Profile, error) {
+	// Reject empty passwords, as many servers treat a bind with an empty password as a successful unauthenticated bind
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.requestTimeout)
+	defer cancel()
+
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the LDAP server: %w", err)
+	}
+	defer conn.Close()
+
+	// Bind with the service account, if configured
+	if a.bindDN != "" {
+		err = conn.Bind(a.bindDN, a.bindPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind with the service account: %w", err)
+		}
+	}
+
+	// Search for the user
+	// We ask for up to 2 entries so we can detect when the filter matches more than one user
+	res, err := ldapSearch(conn, ldap.NewSearchRequest(
+		a.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(a.requestTimeout.Seconds()), false,
+		a.userSearchFilter(username), a.searchAttributes(), nil,
+	))
+	switch {
+	case (err == nil && len(res.Entries) > 1) || ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded):
+		return nil, fmt.Errorf("search for user '%s' returned more than one entry", username)
+	case err != nil:
+		return nil, fmt.Errorf("failed to search for user: %w", err)
+	case len(res.Entries) == 0 || res.Entries[0].DN == "":
+		return nil, fmt.Errorf("%w: user '%s' not found", ErrInvalidCredentials, username)
+	}
+	entry := res.Entries[0]
+
+	// Verify the password by binding as the user
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to bind as user: %w", err)
+	}
+
+	return a.profileFromEntry(entry), nil
+}
+
+// ldapSearch performs the search request, returning an error if the response can't be decoded
+// go-ldap panics on some malformed search results, so this recovers from panics.
+func ldapSearch(conn *ldap.Conn, req *ldap.SearchRequest) (res *ldap.SearchResult, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			res = nil
+			err = fmt.Errorf("invalid search response from the LDAP server: %v", r)
+		}
+	}()
+
+	return conn.Search(req)
+}
+
+// userSearchFilter returns the filter used to search for the user
+// The username is escaped as per RFC 4515, so it can't change the structure of the filter
+func (a *LDAP) userSearchFilter(username string) string {
+	return strings.ReplaceAll(a.userFilter, ldapUsernamePlaceholder, ldap.EscapeFilter(username))
+}
+
+func (a *LDAP) connect(ctx context.Context) (*ldap.Conn, error) {
+	conn, err := a.dial(ctx, "tcp", a.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the context's deadline to all operations on the connection
+	deadline, ok := ctx.Deadline()
+	if ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if a.useTLS {
+		tlsConn := tls.Client(conn, a.tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	lc := ldap.NewConn(conn, a.useTLS)
+	lc.SetTimeout(a.requestTimeout)
+	lc.Start()
+	if a.startTLS {
+		err = lc.StartTLS(a.tlsConfig)
+		if err != nil {
+			_ = lc.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+
+	return lc, nil
+}
+
+// searchAttributes returns the list of attributes to request when searching for the user
+func (a *LDAP) searchAttributes() []string {
+	res := make([]string, 0, 8)
+	add := func(configured string, defaults []string) {
+		if configured != "" {
+			res = append(res, configured)
+		} else {
+			res = append(res, defaults...)
+		}
+	}
+	add(a.attributes.ID, ldapDefaultIDAttributes)
+	add(a.attributes.Name, ldapDefaultNameAttributes)
+	add("", ldapDefaultFirstNameAttributes)
+	add("", ldapDefaultLastNameAttributes)
+	add(a.attributes.Email, ldapDefaultEmailAttributes)
+	add(a.attributes.Groups, ldapDefaultGroupsAttributes)
+	return res
+}
+
+func (a *LDAP) profileFromEntry(entry *ldap.Entry) *user.Profile {
+	getAttr := func(configured string, defaults []string) []string {
+		if configured != "" {
+			return entry.GetEqualFoldAttributeValues(configured)
+		}
+		for _, name := range defaults {
+			vals := entry.GetEqualFoldAttributeValues(name)
+			if len(vals) > 0 {
+				return vals
+			}
+		}
+		return nil
+	}
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+		ID:       first(getAttr(a.attributes.ID, ldapDefaultIDAttributes)),
+	}
+	if profile.ID == "" {
+		profile.ID = entry.DN
+	}
+
+	profile.Name = user.ProfileName{
+		FullName: first(getAttr(a.attributes.Name, ldapDefaultNameAttributes)),
+		First:    first(getAttr("", ldapDefaultFirstNameAttributes)),
+		Last:     first(getAttr("", ldapDefaultLastNameAttributes)),
+	}
+	profile.Name.PopulateFullName()
+
+	email := first(getAttr(a.attributes.Email, ldapDefaultEmailAttributes))
+	if email != "" {
+		profile.Email = &user.ProfileEmail{
+			Value: email,
+		}
+	}
+
+	groups := getAttr(a.attributes.Groups, ldapDefaultGroupsAttributes)
+	if len(groups) > 0 {
+		profile.Groups = make([]string, len(groups))
+		for i, g := range groups {
+			if a.groupsFullDN {
+				profile.Groups[i] = g
+			} else {
+				profile.Groups[i] = ldapFirstRDNValue(g)
+			}
+		}
+	}
+
+	return profile
+}
+
+// ldapFirstRDNValue returns the value of the first RDN of a DN, such as "Admins" for "CN=Admins,OU=Groups,DC=example,DC=com"
+// If the value is not a DN, it's returned as-is
+func ldapFirstRDNValue(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+// Compile-time interface assertion
+var _ FormProvider = &LDAP{}
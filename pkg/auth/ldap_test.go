@@ -0,0 +1,713 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// OID of the StartTLS extended operation
+	ldapOIDStartTLS = "1.3.6.1.4.1.1466.20037"
+
+	testLDAPBaseDN          = "ou=people,dc=example,dc=com"
+	testLDAPServiceDN       = "cn=service,dc=example,dc=com"
+	testLDAPServicePassword = "service-password"
+)
+
+func TestLDAPUserSearchFilter(t *testing.T) {
+	provider, err := NewLDAP(NewLDAPOptions{
+		URL:        "ldap://ldap.example.com",
+		BaseDN:     testLDAPBaseDN,
+		UserFilter: "(uid={username})",
+	})
+	require.NoError(t, err)
+
+	// Usernames are escaped as per RFC 4515
+	tests := []struct {
+		username string
+		filter   string
+	}{
+		{username: "jdoe", filter: `(uid=jdoe)`},
+		{username: "*", filter: `(uid=\2a)`},
+		{username: "jdoe)(uid=*", filter: `(uid=jdoe\29\28uid=\2a)`},
+		{username: `a\b`, filter: `(uid=a\5cb)`},
+		{username: "a\x00b", filter: `(uid=a\00b)`},
+		{username: "jösé", filter: `(uid=j\c3\b6s\c3\a9)`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.username, func(t *testing.T) {
+			filter := provider.userSearchFilter(tc.username)
+			assert.Equal(t, tc.filter, filter)
+
+			// The filter must be a single equality match on the username
+			packet, err := ldap.CompileFilter(filter)
+			require.NoError(t, err)
+			require.EqualValues(t, ldap.FilterEqualityMatch, packet.Tag)
+			require.Len(t, packet.Children, 2)
+			assert.Equal(t, tc.username, packet.Children[1].Data.String())
+		})
+	}
+}
+
+func TestLDAPFirstRDNValue(t *testing.T) {
+	assert.Equal(t, "Admins", ldapFirstRDNValue("CN=Admins,OU=Groups,DC=example,DC=com"))
+	assert.Equal(t, "Smith, Admins", ldapFirstRDNValue(`cn=Smith\, Admins,ou=groups,dc=example,dc=com`))
+	assert.Equal(t, "a,b", ldapFirstRDNValue(`cn=a\2Cb,dc=example`))
+	assert.Equal(t, "devs", ldapFirstRDNValue("cn=devs+gidNumber=100,dc=example"))
+	assert.Equal(t, "devs", ldapFirstRDNValue("cn = devs , dc=example"))
+	assert.Equal(t, "plain-group", ldapFirstRDNValue("plain-group"))
+}
+
+func TestLDAP(t *testing.T) {
+	entries := []testLDAPEntry{
+		{
+			dn:       testLDAPServiceDN,
+			password: testLDAPServicePassword,
+			attrs:    map[string][]string{"cn": {"service"}},
+		},
+		{
+			dn:       "uid=jdoe," + testLDAPBaseDN,
+			password: "secret",
+			attrs: map[string][]string{
+				"uid":       {"jdoe"},
+				"cn":        {"John Doe"},
+				"givenName": {"John"},
+				"sn":        {"Doe"},
+				"mail":      {"jdoe@example.com"},
+				"memberOf":  {"cn=developers,ou=groups,dc=example,dc=com", `cn=Smith\, Admins,ou=groups,dc=example,dc=com`},
+			},
+		},
+		{
+			dn:       "CN=Jane Roe," + testLDAPBaseDN,
+			password: "hunter2",
+			attrs: map[string][]string{
+				"sAMAccountName": {"jroe"},
+				"displayName":    {"Jane Roe"},
+				"mail":           {"jane.roe@example.com"},
+				"department":     {"Engineering"},
+			},
+		},
+		{
+			dn:       "uid=dup1," + testLDAPBaseDN,
+			password: "secret",
+			attrs:    map[string][]string{"uid": {"dup"}},
+		},
+		{
+			dn:       "uid=dup2," + testLDAPBaseDN,
+			password: "secret",
+			attrs:    map[string][]string{"uid": {"dup"}},
+		},
+	}
+	srv := newTestLDAPServer(t, entries, false)
+
+	newProvider := func(t *testing.T, modify func(o *NewLDAPOptions)) *LDAP {
+		t.Helper()
+		opts := NewLDAPOptions{
+			URL:          "ldap://" + srv.Addr(),
+			BindDN:       testLDAPServiceDN,
+			BindPassword: testLDAPServicePassword,
+			BaseDN:       testLDAPBaseDN,
+		}
+		if modify != nil {
+			modify(&opts)
+		}
+		provider, err := NewLDAP(opts)
+		require.NoError(t, err)
+		return provider
+	}
+
+	t.Run("success", func(t *testing.T) {
+		provider := newProvider(t, nil)
+		assert.Equal(t, "ldap", provider.GetProviderType())
+		assert.Equal(t, "LDAP", provider.GetProviderDisplayName())
+
+		profile, err := provider.FormAuth(t.Context(), "jdoe", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, "ldap", profile.Provider)
+		assert.Equal(t, "jdoe", profile.ID)
+		assert.Equal(t, "John Doe", profile.Name.FullName)
+		assert.Equal(t, "John", profile.Name.First)
+		assert.Equal(t, "Doe", profile.Name.Last)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "jdoe@example.com", profile.Email.Value)
+		assert.False(t, profile.Email.Verified)
+		assert.Equal(t, []string{"developers", "Smith, Admins"}, profile.Groups)
+	})
+
+	t.Run("Active Directory user", func(t *testing.T) {
+		profile, err := newProvider(t, nil).FormAuth(t.Context(), "jroe", "hunter2")
+		require.NoError(t, err)
+		assert.Equal(t, "jroe", profile.ID)
+		assert.Equal(t, "Jane Roe", profile.Name.FullName)
+		assert.Empty(t, profile.Groups)
+	})
+
+	t.Run("groups with full DN", func(t *testing.T) {
+		profile, err := newProvider(t, func(o *NewLDAPOptions) {
+			o.GroupsFullDN = true
+		}).FormAuth(t.Context(), "jdoe", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, entries[1].attrs["memberOf"], profile.Groups)
+	})
+
+	t.Run("custom filter and attributes", func(t *testing.T) {
+		profile, err := newProvider(t, func(o *NewLDAPOptions) {
+			o.UserFilter = "(&(mail={username})(displayName=*))"
+			o.AttributeMapping = LDAPAttributeMapping{
+				ID:     "mail",
+				Groups: "department",
+			}
+		}).FormAuth(t.Context(), "jane.roe@example.com", "hunter2")
+		require.NoError(t, err)
+		assert.Equal(t, "jane.roe@example.com", profile.ID)
+		assert.Equal(t, []string{"Engineering"}, profile.Groups)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := newProvider(t, nil).FormAuth(t.Context(), "jdoe", "wrong")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		_, err := newProvider(t, nil).FormAuth(t.Context(), "nobody", "secret")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("empty password is rejected without binding", func(t *testing.T) {
+		before := srv.binds.Load()
+		_, err := newProvider(t, nil).FormAuth(t.Context(), "jdoe", "")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		assert.Equal(t, before, srv.binds.Load())
+	})
+
+	t.Run("filter injection", func(t *testing.T) {
+		_, err := newProvider(t, nil).FormAuth(t.Context(), "*", "secret")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		_, err = newProvider(t, nil).FormAuth(t.Context(), "jdoe)(uid=*", "secret")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("multiple entries", func(t *testing.T) {
+		_, err := newProvider(t, nil).FormAuth(t.Context(), "dup", "secret")
+		require.ErrorContains(t, err, "more than one entry")
+		require.NotErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("wrong service account password", func(t *testing.T) {
+		_, err := newProvider(t, func(o *NewLDAPOptions) {
+			o.BindPassword = "wrong"
+		}).FormAuth(t.Context(), "jdoe", "secret")
+		require.ErrorContains(t, err, "failed to bind with the service account")
+		require.NotErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("anonymous search not allowed", func(t *testing.T) {
+		_, err := newProvider(t, func(o *NewLDAPOptions) {
+			o.BindDN = ""
+			o.BindPassword = ""
+		}).FormAuth(t.Context(), "jdoe", "secret")
+		require.ErrorContains(t, err, "failed to search for user")
+	})
+
+	t.Run("StartTLS", func(t *testing.T) {
+		profile, err := newProvider(t, func(o *NewLDAPOptions) {
+			o.StartTLS = true
+			o.TLSCACertificate = srv.caPEM
+		}).FormAuth(t.Context(), "jdoe", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, "jdoe", profile.ID)
+	})
+
+	t.Run("server unreachable", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+
+		_, err = newProvider(t, func(o *NewLDAPOptions) {
+			o.URL = "ldap://" + addr
+		}).FormAuth(t.Context(), "jdoe", "secret")
+		require.ErrorContains(t, err, "failed to connect to the LDAP server")
+	})
+}
+
+func TestLDAPImplicitTLS(t *testing.T) {
+	srv := newTestLDAPServer(t, []testLDAPEntry{
+		{dn: testLDAPServiceDN, password: testLDAPServicePassword},
+		{dn: "uid=jdoe," + testLDAPBaseDN, password: "secret", attrs: map[string][]string{"uid": {"jdoe"}}},
+	}, true)
+
+	opts := NewLDAPOptions{
+		URL:          "ldaps://" + srv.Addr(),
+		BindDN:       testLDAPServiceDN,
+		BindPassword: testLDAPServicePassword,
+		BaseDN:       testLDAPBaseDN,
+	}
+
+	t.Run("trusted certificate", func(t *testing.T) {
+		o := opts
+		o.TLSCACertificate = srv.caPEM
+		provider, err := NewLDAP(o)
+		require.NoError(t, err)
+
+		profile, err := provider.FormAuth(t.Context(), "jdoe", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, "jdoe", profile.ID)
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		provider, err := NewLDAP(opts)
+		require.NoError(t, err)
+
+		_, err = provider.FormAuth(t.Context(), "jdoe", "secret")
+		require.ErrorContains(t, err, "TLS handshake failed")
+	})
+}
+
+func TestLDAPMalformedResponses(t *testing.T) {
+	message := func(id int64, op *ber.Packet) []byte {
+		msg := ber.NewSequence("LDAP message")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "message ID"))
+		if op != nil {
+			msg.AppendChild(op)
+		}
+		return msg.Bytes()
+	}
+	bindSuccess := func(id int64) []byte {
+		res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "bind response")
+		res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultSuccess), "result code"))
+		res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched DN"))
+		res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnostic message"))
+		return message(id, res)
+	}
+
+	tests := []struct {
+		name      string
+		responses []func(id int64) []byte
+		err       string
+	}{
+		{
+			name: "truncated message",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte { return bindSuccess(id)[:8] },
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "truncated length",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte { return []byte{0x30, 0x84, 0x00} },
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "length larger than the message",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte { return []byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff, 0x02, 0x01, 0x01} },
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "not a sequence",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte { return []byte{0x04, 0x03, 'a', 'b', 'c'} },
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "missing operation",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte { return message(id, nil) },
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "bind response without result code",
+			responses: []func(id int64) []byte{
+				func(id int64) []byte {
+					return message(id, ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "bind response"))
+				},
+			},
+			err: "failed to bind with the service account",
+		},
+		{
+			name: "search entry without DN",
+			responses: []func(id int64) []byte{
+				bindSuccess,
+				func(id int64) []byte {
+					return message(id, ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "search result entry"))
+				},
+			},
+			err: "failed to search for user",
+		},
+		{
+			name: "search entry with invalid DN",
+			responses: []func(id int64) []byte{
+				bindSuccess,
+				func(id int64) []byte {
+					entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "search result entry")
+					entry.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(1), "DN"))
+					entry.AppendChild(ber.NewSequence("attributes"))
+					return message(id, entry)
+				},
+			},
+			err: "failed to search for user",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := newTestLDAPRawServer(t, tc.responses)
+			provider, err := NewLDAP(NewLDAPOptions{
+				URL:            "ldap://" + addr,
+				BindDN:         testLDAPServiceDN,
+				BindPassword:   testLDAPServicePassword,
+				BaseDN:         testLDAPBaseDN,
+				RequestTimeout: 2 * time.Second,
+			})
+			require.NoError(t, err)
+
+			_, err = provider.FormAuth(t.Context(), "jdoe", "secret")
+			require.ErrorContains(t, err, tc.err)
+			require.NotErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestNewLDAPInvalidOptions(t *testing.T) {
+	valid := NewLDAPOptions{
+		URL:    "ldap://ldap.example.com",
+		BaseDN: testLDAPBaseDN,
+	}
+	_, err := NewLDAP(valid)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(o *NewLDAPOptions)
+		err    string
+	}{
+		{name: "missing URL", modify: func(o *NewLDAPOptions) { o.URL = "" }, err: "value for url is required"},
+		{name: "missing base DN", modify: func(o *NewLDAPOptions) { o.BaseDN = "" }, err: "value for baseDN is required"},
+		{name: "invalid scheme", modify: func(o *NewLDAPOptions) { o.URL = "https://ldap.example.com" }, err: "invalid scheme"},
+		{name: "URL with path", modify: func(o *NewLDAPOptions) { o.URL = "ldap://ldap.example.com/dc=example" }, err: "invalid LDAP server URL"},
+		{name: "StartTLS with ldaps", modify: func(o *NewLDAPOptions) { o.URL = "ldaps://ldap.example.com"; o.StartTLS = true }, err: "StartTLS cannot be used"},
+		{name: "bind DN without password", modify: func(o *NewLDAPOptions) { o.BindDN = testLDAPServiceDN }, err: "value for bindPassword is required"},
+		{name: "filter without placeholder", modify: func(o *NewLDAPOptions) { o.UserFilter = "(uid=jdoe)" }, err: "must contain the '{username}' placeholder"},
+		{name: "invalid filter", modify: func(o *NewLDAPOptions) { o.UserFilter = "(uid={username}" }, err: "invalid user filter"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := valid
+			tc.modify(&o)
+			_, err := NewLDAP(o)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// getAttr returns the values of the attribute, matching its name case-insensitively
+func (e testLDAPEntry) getAttr(name string) (string, []string) {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, name) {
+			return k, v
+		}
+	}
+	return "", nil
+}
+
+// testLDAPServer is an in-process LDAP server that supports simple binds, searches, and StartTLS
+// Searches are only allowed after binding with the service account
+type testLDAPServer struct {
+	ln        net.Listener
+	entries   []testLDAPEntry
+	tlsConfig *tls.Config
+	caPEM     []byte
+	binds     atomic.Int64
+}
+
+func newTestLDAPServer(t *testing.T, entries []testLDAPEntry, implicitTLS bool) *testLDAPServer {
+	t.Helper()
+
+	// Generate a self-signed certificate for TLS
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldap.example.com"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err)
+
+	srv := &testLDAPServer{
+		entries: entries,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			MinVersion:   tls.VersionTLS12,
+		},
+		caPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+
+	srv.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if implicitTLS {
+		srv.ln = tls.NewListener(srv.ln, srv.tlsConfig)
+	}
+	t.Cleanup(func() {
+		_ = srv.ln.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := srv.ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.handle(conn)
+		}
+	}()
+
+	return srv
+}
+
+func (srv *testLDAPServer) Addr() string {
+	return srv.ln.Addr().String()
+}
+
+func (srv *testLDAPServer) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	write := func(id int64, op *ber.Packet) {
+		msg := ber.NewSequence("LDAP message")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "message ID"))
+		msg.AppendChild(op)
+		_, _ = conn.Write(msg.Bytes())
+	}
+	result := func(tag ber.Tag, code int64) *ber.Packet {
+		res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+		res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "result code"))
+		res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched DN"))
+		res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnostic message"))
+		return res
+	}
+
+	var boundDN string
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		id, _ := msg.Children[0].Value.(int64)
+		op := msg.Children[1]
+		fields := op.Children
+
+		switch op.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationExtendedRequest:
+			if len(fields) == 0 || fields[0].Data.String() != ldapOIDStartTLS {
+				write(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			write(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			tlsConn := tls.Server(conn, srv.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+		case ldap.ApplicationBindRequest:
+			srv.binds.Add(1)
+			dn, password := fields[1].Data.String(), fields[2].Data.String()
+			var code int64 = ldap.LDAPResultInvalidCredentials
+			switch {
+			case dn == "" && password == "":
+				code = ldap.LDAPResultSuccess
+			case password != "":
+				for _, e := range srv.entries {
+					if strings.EqualFold(e.dn, dn) && e.password == password {
+						code = ldap.LDAPResultSuccess
+					}
+				}
+			}
+			if code == ldap.LDAPResultSuccess {
+				boundDN = dn
+			}
+			write(id, result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			if boundDN != testLDAPServiceDN {
+				write(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+
+			baseDN := strings.ToLower(fields[0].Data.String())
+			sizeLimit, _ := fields[3].Value.(int64)
+
+			var (
+				n    int64
+				code int64 = ldap.LDAPResultSuccess
+			)
+			for _, e := range srv.entries {
+				if !strings.HasSuffix(strings.ToLower(e.dn), baseDN) || !matchTestLDAPFilter(fields[6], e) {
+					continue
+				}
+				if sizeLimit > 0 && n >= sizeLimit {
+					code = ldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				n++
+
+				attrs := ber.NewSequence("attributes")
+				for _, req := range fields[7].Children {
+					name, vals := e.getAttr(req.Data.String())
+					if len(vals) == 0 {
+						continue
+					}
+					attr := ber.NewSequence("attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+					for _, v := range vals {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+					}
+					attr.AppendChild(set)
+					attrs.AppendChild(attr)
+				}
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "search result entry")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+				entry.AppendChild(attrs)
+				write(id, entry)
+			}
+			write(id, result(ldap.ApplicationSearchResultDone, code))
+		default:
+			return
+		}
+	}
+}
+
+// matchTestLDAPFilter evaluates a BER-encoded search filter against the entry
+func matchTestLDAPFilter(el *ber.Packet, e testLDAPEntry) bool {
+	switch el.Tag {
+	case ldap.FilterAnd, ldap.FilterOr:
+		for _, c := range el.Children {
+			m := matchTestLDAPFilter(c, e)
+			if el.Tag == ldap.FilterAnd && !m {
+				return false
+			} else if el.Tag == ldap.FilterOr && m {
+				return true
+			}
+		}
+		return el.Tag == ldap.FilterAnd
+	case ldap.FilterNot:
+		return !matchTestLDAPFilter(el.Children[0], e)
+	case ldap.FilterPresent:
+		_, vals := e.getAttr(el.Data.String())
+		return len(vals) > 0
+	case ldap.FilterEqualityMatch:
+		_, vals := e.getAttr(el.Children[0].Data.String())
+		for _, v := range vals {
+			if strings.EqualFold(v, el.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		_, vals := e.getAttr(el.Children[0].Data.String())
+	VALUES:
+		for _, v := range vals {
+			rest := strings.ToLower(v)
+			for _, s := range el.Children[1].Children {
+				sub := strings.ToLower(s.Data.String())
+				switch s.Tag {
+				case ldap.FilterSubstringsInitial:
+					if !strings.HasPrefix(rest, sub) {
+						continue VALUES
+					}
+					rest = rest[len(sub):]
+				case ldap.FilterSubstringsAny:
+					i := strings.Index(rest, sub)
+					if i < 0 {
+						continue VALUES
+					}
+					rest = rest[i+len(sub):]
+				case ldap.FilterSubstringsFinal:
+					if !strings.HasSuffix(rest, sub) {
+						continue VALUES
+					}
+					rest = ""
+				}
+			}
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// newTestLDAPRawServer starts a server that replies to each request with the next response, without validating it
+// After all responses are sent, the connection is closed
+func newTestLDAPRawServer(t *testing.T, responses []func(id int64) []byte) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+				for _, res := range responses {
+					msg, err := ber.ReadPacket(conn)
+					if err != nil || len(msg.Children) == 0 {
+						return
+					}
+					id, _ := msg.Children[0].Value.(int64)
+					_, err = conn.Write(res(id))
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
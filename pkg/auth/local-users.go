@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/italypaleale/go-kit/fsnotify"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+// LocalUsers manages authentication with a list of users defined in the configuration or in a htpasswd-style file.
+// Users enter their username and password in a login form.
+type LocalUsers struct {
+	baseProvider
+
+	usersFile string
+	inline    []LocalUser
+	log       *slog.Logger
+
+	lock  sync.RWMutex
+	users map[string]localUserEntry
+	// Function used to verify passwords of users that don't exist, which takes as long as verifying passwords of existing users
+	dummyVerify func(password []byte) bool
+}
+
+// LocalUser is a user for the LocalUsers provider.
+type LocalUser struct {
+	// Username
+	Username string
+	// Hash of the password, using bcrypt or argon2id
+	PasswordHash string
+	// Optional full name
+	Name string
+	// Optional email address
+	Email string
+	// Optional list of groups
+	Groups []string
+}
+
+type localUserEntry struct {
+	LocalUser
+
+	verify func(password []byte) bool
+}
+
+// NewLocalUsersOptions is the options for NewLocalUsers
+type NewLocalUsersOptions struct {
+	// List of users
+	Users []LocalUser
+	// Path to a htpasswd-style file containing users
+	// Each line has the format "username:hash", optionally followed by ":group1,group2"
+	// The file is reloaded automatically when it changes
+	UsersFile string
+}
+
+// NewLocalUsers returns a new LocalUsers provider
+// If a users file is set, it is watched for changes until the context is canceled
+func NewLocalUsers(ctx context.Context, opts NewLocalUsersOptions) (*LocalUsers, error) {
+	if len(opts.Users) == 0 && opts.UsersFile == "" {
+		return nil, errors.New("at least one of users and usersFile is required in config for auth with provider 'localUsers'")
+	}
+
+	const providerType = "localusers"
+	a := &LocalUsers{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Local account",
+				Name:        providerType,
+				Color:       "neutral",
+			},
+		},
+		usersFile: opts.UsersFile,
+		inline:    opts.Users,
+		log:       slog.With("scope", "localUsers"),
+	}
+
+	err := a.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if a.usersFile != "" {
+		err = a.watch(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func (a *LocalUsers) GetProviderType() string {
+	return "localusers"
+}
+
+// FormAuth authenticates the user by verifying the password against the stored hash.
+func (a *LocalUsers) FormAuth(_ context.Context, username string, password string) (*user.Profile, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	a.lock.RLock()
+	entry, ok := a.users[username]
+	dummyVerify := a.dummyVerify
+	a.lock.RUnlock()
+	if !ok {
+		// Verify the password anyway, so the response time doesn't reveal whether the user exists
+		_ = dummyVerify([]byte(password))
+		return nil, fmt.Errorf("%w: user '%s' not found", ErrInvalidCredentials, username)
+	}
+
+	if !entry.verify([]byte(password)) {
+		return nil, fmt.Errorf("%w: password for user '%s' does not match", ErrInvalidCredentials, username)
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+		ID:       entry.Username,
+		Name: user.ProfileName{
+			FullName:          entry.Name,
+			PreferredUsername: entry.Username,
+		},
+	}
+	if entry.Email != "" {
+		profile.Email = &user.ProfileEmail{
+			Value: entry.Email,
+		}
+	}
+	if len(entry.Groups) > 0 {
+		profile.Groups = append([]string(nil), entry.Groups...)
+	}
+
+	return profile, nil
+}
+
+// Reload loads the list of users from the configuration and, if set, from the users file.
+// If there's an error, the list of users currently loaded is not changed.
+func (a *LocalUsers) Reload() error {
+	users := make(map[string]localUserEntry, len(a.inline))
+	add := func(u LocalUser, source string) error {
+		if u.Username == "" || strings.ContainsAny(u.Username, ":\r\n") {
+			return fmt.Errorf("invalid username '%s' in %s", u.Username, source)
+		}
+		_, exists := users[u.Username]
+		if exists {
+			return fmt.Errorf("duplicate user '%s' in %s", u.Username, source)
+		}
+		verify, err := localUsersPasswordVerifier(u.PasswordHash)
+		if err != nil {
+			return fmt.Errorf("invalid password hash for user '%s' in %s: %w", u.Username, source, err)
+		}
+		users[u.Username] = localUserEntry{LocalUser: u, verify: verify}
+		return nil
+	}
+
+	for _, u := range a.inline {
+		err := add(u, "users list")
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.usersFile != "" {
+		fileUsers, err := parseLocalUsersFile(a.usersFile)
+		if err != nil {
+			return err
+		}
+		for _, u := range fileUsers {
+			err = add(u, "users file")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	dummyVerify := localUsersDummyVerifier(users)
+
+	a.lock.Lock()
+	a.users = users
+	a.dummyVerify = dummyVerify
+	a.lock.Unlock()
+
+	return nil
+}
+
+// Watch starts watching (in background) for changes to the users file, and triggers a reload when that happens.
+func (a *LocalUsers) watch(ctx context.Context) error {
+	// Watch the folder rather than the file, so we can detect when the file is replaced, as it happens with Kubernetes secrets
+	watcher, err := fsnotify.WatchFolder(ctx, filepath.Dir(a.usersFile))
+	if err != nil {
+		return fmt.Errorf("failed to start watching for changes to the users file: %w", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-watcher:
+				err := a.Reload()
+				if err != nil {
+					// Log errors only, and keep using the users that were loaded previously
+					a.log.ErrorContext(ctx, "Failed to reload users file", slog.String("path", a.usersFile), slog.Any("error", err))
+					continue
+				}
+				a.log.InfoContext(ctx, "Users file has been reloaded", slog.String("path", a.usersFile))
+
+			case <-ctx.Done():
+				// Stop on context cancellation
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// parseLocalUsersFile parses a htpasswd-style file
+// Lines have the format "username:hash" or "username:hash:group1,group2"; empty lines and lines starting with "#" are ignored
+func parseLocalUsersFile(path string) ([]LocalUser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file '%s': %w", path, err)
+	}
+
+	var (
+		users []LocalUser
+		n     int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid line %d in users file '%s': must have the format 'username:hash'", n, path)
+		}
+
+		u := LocalUser{
+			Username:     parts[0],
+			PasswordHash: parts[1],
+		}
+		if len(parts) == 3 {
+			for g := range strings.SplitSeq(parts[2], ",") {
+				g = strings.TrimSpace(g)
+				if g != "" {
+					u.Groups = append(u.Groups, g)
+				}
+			}
+		}
+		users = append(users, u)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file '%s': %w", path, err)
+	}
+
+	return users, nil
+}
+
+// localUsersPasswordVerifier returns a function that verifies passwords against the hash
+// Supported hashes are bcrypt ("$2a$", "$2b$", "$2y$") and argon2id in the PHC string format ("$argon2id$v=19$m=...,t=...,p=...$salt$hash")
+func localUsersPasswordVerifier(hash string) (func(password []byte) bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return nil, err
+		}
+		h := []byte(hash)
+		return func(password []byte) bool {
+			return bcrypt.CompareHashAndPassword(h, password) == nil
+		}, nil
+
+	case strings.HasPrefix(hash, "$argon2id$"):
+		var (
+			version     int
+			memory      uint32
+			iterations  uint32
+			parallelism uint8
+		)
+		parts := strings.Split(hash, "$")
+		if len(parts) != 6 {
+			return nil, errors.New("invalid argon2id hash")
+		}
+		_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+		if err != nil || version != argon2.Version {
+			return nil, errors.New("unsupported argon2id version")
+		}
+		_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism)
+		if err != nil || memory == 0 || iterations == 0 || parallelism == 0 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return nil, errors.New("invalid argon2id salt")
+		}
+		dk, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil || len(dk) == 0 {
+			return nil, errors.New("invalid argon2id key")
+		}
+		return func(password []byte) bool {
+			computed := argon2.IDKey(password, salt, iterations, memory, parallelism, uint32(len(dk))) //nolint:gosec
+			return subtle.ConstantTimeCompare(computed, dk) == 1
+		}, nil
+
+	default:
+		return nil, errors.New("unsupported hash algorithm: must be bcrypt or argon2id")
+	}
+}
+
+// localUsersDummyVerifier returns the function used to verify passwords when the user doesn't exist
+// To make the response time the same as for existing users, it uses the verifier of a user whose hash has the most common algorithm and parameters (ties are broken by username)
+func localUsersDummyVerifier(users map[string]localUserEntry) func(password []byte) bool {
+	counts := make(map[string]int, len(users))
+	var (
+		selected string
+		maxCount int
+	)
+	for _, username := range slices.Sorted(maps.Keys(users)) {
+		params := localUsersHashParams(users[username].PasswordHash)
+		counts[params]++
+		if counts[params] > maxCount {
+			selected = username
+			maxCount = counts[params]
+		}
+	}
+
+	if selected == "" {
+		dummyHash := localUsersDummyHash()
+		return func(password []byte) bool {
+			return bcrypt.CompareHashAndPassword(dummyHash, password) == nil
+		}
+	}
+	return users[selected].verify
+}
+
+// localUsersHashParams returns the algorithm and parameters of a password hash, which determine how long it takes to verify a password, without the salt and the key
+func localUsersHashParams(hash string) string {
+	parts := strings.Split(hash, "$")
+	if strings.HasPrefix(hash, "$argon2id$") && len(parts) == 6 {
+		// "$argon2id$v=19$m=...,t=...,p=..." and the length of the key
+		return strings.Join(parts[:4], "$") + "$" + strconv.Itoa(len(parts[5]))
+	}
+	if len(parts) >= 3 {
+		// bcrypt: "$2b$10"
+		return strings.Join(parts[:3], "$")
+	}
+	return hash
+}
+
+// localUsersDummyHash returns a bcrypt hash used to compare passwords when the user doesn't exist and there are no users
+var localUsersDummyHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("traefik-forward-auth"), bcrypt.DefaultCost)
+	return h
+})
+
+// Compile-time interface assertion
+var _ FormProvider = &LocalUsers{}
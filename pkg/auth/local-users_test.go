@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testBcryptHash(t *testing.T, password string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(h)
+}
+
+func testArgon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	dk := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return "$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(dk)
+}
+
+func TestLocalUsers(t *testing.T) {
+	usersFile := filepath.Join(t.TempDir(), "htpasswd")
+	err := os.WriteFile(usersFile, []byte(
+		"# Users\n"+
+			"\n"+
+			"bob:"+testArgon2idHash("bob-password")+"\n"+
+			"carol:"+testBcryptHash(t, "carol-password")+":ops, admins\n",
+	), 0o600)
+	require.NoError(t, err)
+
+	p, err := NewLocalUsers(t.Context(), NewLocalUsersOptions{
+		Users: []LocalUser{
+			{
+				Username:     "alice",
+				PasswordHash: testBcryptHash(t, "alice-password"),
+				Name:         "Alice Smith",
+				Email:        "alice@example.com",
+				Groups:       []string{"admins"},
+			},
+		},
+		UsersFile: usersFile,
+	})
+	require.NoError(t, err)
+	p.SetProviderMetadata(ProviderMetadata{Name: "local"})
+
+	t.Run("inline user", func(t *testing.T) {
+		profile, err := p.FormAuth(t.Context(), "alice", "alice-password")
+		require.NoError(t, err)
+		assert.Equal(t, "local", profile.Provider)
+		assert.Equal(t, "alice", profile.ID)
+		assert.Equal(t, "Alice Smith", profile.Name.FullName)
+		assert.Equal(t, "alice", profile.Name.PreferredUsername)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "alice@example.com", profile.Email.Value)
+		assert.False(t, profile.Email.Verified)
+		assert.Equal(t, []string{"admins"}, profile.Groups)
+	})
+
+	t.Run("file user with argon2id hash", func(t *testing.T) {
+		profile, err := p.FormAuth(t.Context(), "bob", "bob-password")
+		require.NoError(t, err)
+		assert.Equal(t, "bob", profile.ID)
+		assert.Nil(t, profile.Email)
+		assert.Empty(t, profile.Groups)
+	})
+
+	t.Run("file user with groups", func(t *testing.T) {
+		profile, err := p.FormAuth(t.Context(), "carol", "carol-password")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ops", "admins"}, profile.Groups)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			username string
+			password string
+		}{
+			{name: "wrong bcrypt password", username: "alice", password: "wrong"},
+			{name: "wrong argon2id password", username: "bob", password: "wrong"},
+			{name: "unknown user", username: "mallory", password: "alice-password"},
+			{name: "usernames are case-sensitive", username: "Alice", password: "alice-password"},
+			{name: "empty password", username: "alice", password: ""},
+			{name: "empty username", username: "", password: "alice-password"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := p.FormAuth(t.Context(), tt.username, tt.password)
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			})
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		err := os.WriteFile(usersFile, []byte("dave:"+testBcryptHash(t, "dave-password")+"\n"), 0o600)
+		require.NoError(t, err)
+		require.NoError(t, p.Reload())
+
+		_, err = p.FormAuth(t.Context(), "dave", "dave-password")
+		require.NoError(t, err)
+		_, err = p.FormAuth(t.Context(), "bob", "bob-password")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		// Inline users are kept
+		_, err = p.FormAuth(t.Context(), "alice", "alice-password")
+		require.NoError(t, err)
+	})
+
+	t.Run("failed reload keeps the current users", func(t *testing.T) {
+		err := os.WriteFile(usersFile, []byte("erin:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o600)
+		require.NoError(t, err)
+		require.ErrorContains(t, p.Reload(), "unsupported hash algorithm")
+
+		_, err = p.FormAuth(t.Context(), "dave", "dave-password")
+		require.NoError(t, err)
+	})
+}
+
+func TestNewLocalUsersInvalidOptions(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	tests := []struct {
+		name   string
+		opts   func(t *testing.T) NewLocalUsersOptions
+		errMsg string
+	}{
+		{
+			name:   "no users",
+			opts:   func(t *testing.T) NewLocalUsersOptions { return NewLocalUsersOptions{} },
+			errMsg: "at least one of users and usersFile is required",
+		},
+		{
+			name: "unsupported hash",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{Users: []LocalUser{{Username: "alice", PasswordHash: "$apr1$abc$def"}}}
+			},
+			errMsg: "unsupported hash algorithm",
+		},
+		{
+			name: "invalid bcrypt hash",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{Users: []LocalUser{{Username: "alice", PasswordHash: "$2y$10$tooshort"}}}
+			},
+			errMsg: "invalid password hash for user 'alice'",
+		},
+		{
+			name: "invalid argon2id hash",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{Users: []LocalUser{{Username: "alice", PasswordHash: "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5"}}}
+			},
+			errMsg: "invalid argon2id parameters",
+		},
+		{
+			name: "empty username",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{Users: []LocalUser{{Username: "", PasswordHash: testBcryptHash(t, "password")}}}
+			},
+			errMsg: "invalid username",
+		},
+		{
+			name: "duplicate user",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{
+					Users:     []LocalUser{{Username: "alice", PasswordHash: testBcryptHash(t, "password")}},
+					UsersFile: writeFile(t, "alice:"+testBcryptHash(t, "password")+"\n"),
+				}
+			},
+			errMsg: "duplicate user 'alice' in users file",
+		},
+		{
+			name: "invalid line in file",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{UsersFile: writeFile(t, "# comment\nalice\n")}
+			},
+			errMsg: "invalid line 2",
+		},
+		{
+			name: "missing file",
+			opts: func(t *testing.T) NewLocalUsersOptions {
+				return NewLocalUsersOptions{UsersFile: filepath.Join(t.TempDir(), "missing")}
+			},
+			errMsg: "failed to read users file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLocalUsers(t.Context(), tt.opts(t))
+			require.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestLocalUsersDummyVerifier(t *testing.T) {
+	newUsers := func(t *testing.T, users ...LocalUser) map[string]localUserEntry {
+		t.Helper()
+		res := make(map[string]localUserEntry, len(users))
+		for _, u := range users {
+			verify, err := localUsersPasswordVerifier(u.PasswordHash)
+			require.NoError(t, err)
+			res[u.Username] = localUserEntry{LocalUser: u, verify: verify}
+		}
+		return res
+	}
+
+	t.Run("uses the most common argon2id parameters", func(t *testing.T) {
+		verify := localUsersDummyVerifier(newUsers(t,
+			LocalUser{Username: "alice", PasswordHash: testBcryptHash(t, "alice-password")},
+			LocalUser{Username: "bob", PasswordHash: testArgon2idHash("bob-password")},
+			LocalUser{Username: "carol", PasswordHash: testArgon2idHash("carol-password")},
+		))
+
+		// The dummy verifier uses the hash of one of the argon2id users, so verifying takes as long as for them
+		assert.True(t, verify([]byte("bob-password")) || verify([]byte("carol-password")))
+		assert.False(t, verify([]byte("alice-password")))
+	})
+
+	t.Run("uses the most common bcrypt cost", func(t *testing.T) {
+		verify := localUsersDummyVerifier(newUsers(t,
+			LocalUser{Username: "alice", PasswordHash: testBcryptHash(t, "alice-password")},
+			LocalUser{Username: "bob", PasswordHash: testArgon2idHash("bob-password")},
+			LocalUser{Username: "carol", PasswordHash: testBcryptHash(t, "carol-password")},
+		))
+
+		assert.True(t, verify([]byte("alice-password")) || verify([]byte("carol-password")))
+		assert.False(t, verify([]byte("bob-password")))
+	})
+
+	t.Run("no users", func(t *testing.T) {
+		verify := localUsersDummyVerifier(nil)
+		assert.False(t, verify([]byte("password")))
+	})
+}
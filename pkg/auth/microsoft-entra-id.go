@@ -134,6 +134,7 @@ func NewMicrosoftEntraID(ctx context.Context, opts NewMicrosoftEntraIDOptions) (
 		Token:         "https://login.microsoftonline.com/" + opts.TenantID + "/oauth2/v2.0/token",
 		UserInfo:      "https://graph.microsoft.com/oidc/userinfo",
 		JWKSUri:       "https://login.microsoftonline.com/" + opts.TenantID + "/discovery/v2.0/keys",
+		EndSession:    "https://login.microsoftonline.com/" + opts.TenantID + "/oauth2/v2.0/logout",
 	})
 	if err != nil {
 		return nil, err
@@ -157,5 +158,9 @@ func (a *MicrosoftEntraID) PopulateAdditionalClaims(token jwt.Token, setClaimFn
 	}
 }
 
-// Compile-time interface assertion
-var _ OAuth2Provider = &MicrosoftEntraID{}
+// Compile-time interface assertions
+var (
+	_ OAuth2Provider            = &MicrosoftEntraID{}
+	_ LogoutProvider            = &MicrosoftEntraID{}
+	_ BackchannelLogoutProvider = &MicrosoftEntraID{}
+)
@@ -23,6 +23,12 @@ import (
 
 const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
 
+// ErrTokenRequestRejected is returned when the token endpoint rejects a grant with the "invalid_grant" error, for example because a refresh token was revoked or has expired
+var ErrTokenRequestRejected = errors.New("the identity provider rejected the token request")
+
+// ErrLogoutTokenNotForProvider is returned when a logout token was issued by a different identity provider, or for a different client
+var ErrLogoutTokenNotForProvider = errors.New("the logout token was not issued for this provider")
+
 // oAuth2 is a Provider for authenticating with OAuth2.
 // This Provider cannot be used directly: other providers can embed this struct and implement OAuth2RetrieveProfile.
 type oAuth2 struct {
@@ -57,6 +63,8 @@ type OAuth2Endpoints struct {
 	UserInfo string `json:"userinfo_endpoint"`
 	// JWKS URL — only required by providers that verify ID tokens (OIDC)
 	JWKSUri string `json:"jwks_uri"`
+	// End session URL — optional, used for RP-initiated logout (OIDC)
+	EndSession string `json:"end_session_endpoint"`
 }
 
 type clientAssertionProviderFn func(context.Context) (string, error)
@@ -107,27 +115,6 @@ func NewOAuth2(providerType string, providerMetadata ProviderMetadata, opts NewO
 		reqTimeout = 10 * time.Second
 	}
 
-	// Get the HTTP transport
-	httpTransport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
-	if opts.TLSSkipVerify {
-		httpTransport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true, //nolint:gosec
-			MinVersion:         tls.VersionTLS12,
-		}
-	} else if len(opts.TLSCACertificate) > 0 {
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(opts.TLSCACertificate)
-		httpTransport.TLSClientConfig = &tls.Config{
-			RootCAs:    caCertPool,
-			MinVersion: tls.VersionTLS12,
-		}
-	}
-
-	// Update the transport for the HTTP client to include tracing information
-	httpClient := &http.Client{
-		Transport: otelhttp.NewTransport(httpTransport),
-	}
-
 	p = oAuth2{
 		baseProvider: baseProvider{
 			metadata: providerMetadata,
@@ -137,7 +124,7 @@ func NewOAuth2(providerType string, providerMetadata ProviderMetadata, opts NewO
 		providerType:   providerType,
 		tokenIssuer:    opts.TokenIssuer,
 		scopes:         scopes,
-		httpClient:     httpClient,
+		httpClient:     newProviderHTTPClient(opts.TLSSkipVerify, opts.TLSCACertificate),
 		requestTimeout: reqTimeout,
 		pkceKey:        opts.PKCEKey,
 
@@ -146,6 +133,28 @@ func NewOAuth2(providerType string, providerMetadata ProviderMetadata, opts NewO
 	return p, nil
 }
 
+// newProviderHTTPClient returns a HTTP client for connecting to an identity provider, which includes tracing information
+func newProviderHTTPClient(tlsSkipVerify bool, tlsCACertificate []byte) *http.Client {
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	if tlsSkipVerify {
+		httpTransport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+			MinVersion:         tls.VersionTLS12,
+		}
+	} else if len(tlsCACertificate) > 0 {
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(tlsCACertificate)
+		httpTransport.TLSClientConfig = &tls.Config{
+			RootCAs:    caCertPool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(httpTransport),
+	}
+}
+
 func (a *oAuth2) SetEndpoints(endpoints OAuth2Endpoints) error {
 	if !endpoints.Valid() {
 		return errors.New("all endpoints must be specified")
@@ -219,6 +228,35 @@ func (a *oAuth2) OAuth2ExchangeCode(ctx context.Context, state string, code stri
 		data.Add("code_verifier", a.getPKCECodeVerifier(state, redirectURL))
 	}
 
+	return a.requestToken(ctx, data)
+}
+
+func (a *oAuth2) OAuth2RefreshToken(ctx context.Context, refreshToken string) (OAuth2AccessToken, error) {
+	if refreshToken == "" {
+		return OAuth2AccessToken{}, errors.New("parameter refreshToken is required")
+	}
+
+	data := url.Values{
+		"refresh_token": []string{refreshToken},
+		"client_id":     []string{a.config.ClientID},
+		"grant_type":    []string{"refresh_token"},
+	}
+
+	at, err := a.requestToken(ctx, data)
+	if err != nil {
+		return OAuth2AccessToken{}, err
+	}
+
+	// Identity providers that don't rotate refresh tokens do not return a new one: in that case, the current one remains valid
+	if at.RefreshToken == "" {
+		at.RefreshToken = refreshToken
+	}
+
+	return at, nil
+}
+
+// requestToken invokes the token endpoint with the grant in data, adding the client credentials
+func (a *oAuth2) requestToken(ctx context.Context, data url.Values) (OAuth2AccessToken, error) {
 	// Add the client secret if not using client assertions
 	if a.config.ClientSecret != "" {
 		data.Set("client_secret", a.config.ClientSecret)
@@ -253,10 +291,19 @@ func (a *oAuth2) OAuth2ExchangeCode(ctx context.Context, state string, code stri
 	if res.StatusCode != http.StatusOK {
 		// Try reading the response body (limit to 4KB)
 		body, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		err = fmt.Errorf("invalid response status code: %d", res.StatusCode)
 		if len(body) > 0 {
-			return OAuth2AccessToken{}, fmt.Errorf("invalid response status code: %d. Response: %s", res.StatusCode, string(body))
+			err = fmt.Errorf("invalid response status code: %d. Response: %s", res.StatusCode, string(body))
+		}
+
+		// Only the "invalid_grant" error means that the grant (such as a refresh token) was rejected, for example because it was revoked or it has expired
+		// Other errors, such as "invalid_client", indicate an issue with our own configuration or with the identity provider, which doesn't invalidate the grant
+		// See RFC 6749, section 5.2
+		var errRes oAuth2ErrorResponse
+		if json.Unmarshal(body, &errRes) == nil && errRes.Error == "invalid_grant" {
+			return OAuth2AccessToken{}, fmt.Errorf("%w: %w", ErrTokenRequestRejected, err)
 		}
-		return OAuth2AccessToken{}, fmt.Errorf("invalid response status code: %d", res.StatusCode)
+		return OAuth2AccessToken{}, err
 	}
 
 	var tokenResponse oAuth2TokenResponse
@@ -290,6 +337,12 @@ type oAuth2TokenResponse struct {
 	IDToken      string `json:"id_token"`
 }
 
+// oAuth2ErrorResponse is the error response from the token endpoint
+type oAuth2ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
 func (a *oAuth2) OAuth2RetrieveProfile(ctx context.Context, at OAuth2AccessToken) (profile *user.Profile, err error) {
 	// This method needs to be implemented in structs that embed OAuth2
 	panic("Method OAuth2RetrieveProfile must be implemented by a struct inheriting OAuth2")
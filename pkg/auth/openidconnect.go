@@ -13,11 +13,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v5"
+	"github.com/italypaleale/go-kit/ttlcache"
 	"github.com/lestrrat-go/jwx/v4/jwk"
 	"github.com/lestrrat-go/jwx/v4/jws"
 	"github.com/lestrrat-go/jwx/v4/jwt"
@@ -34,6 +36,8 @@ const (
 	jwksTTL = 15 * time.Minute
 	// Bounds how often we retry after a fetch failure
 	jwksNegativeCacheTTL = 30 * time.Second
+	// Event that must be included in the "events" claim of logout tokens
+	backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
 )
 
 // OpenIDConnect manages authentication with a generic OpenID Connect provider.
@@ -47,6 +51,10 @@ type OpenIDConnect struct {
 	// This is nil when no JWKS URI is configured
 	// In that case OAuth2RetrieveProfile falls back to invoking the UserInfo endpoint if set
 	jwks *jwksFetcher
+
+	// IDs ("jti" claim) of the logout tokens that were already used, which are kept until the tokens expire to prevent replays
+	usedLogoutTokensLock sync.Mutex
+	usedLogoutTokens     *ttlcache.Cache[string, struct{}]
 }
 
 // jwksFetcher fetches and caches a JWKS over HTTP
@@ -262,7 +270,11 @@ func NewOpenIDConnect(ctx context.Context, opts NewOpenIDConnectOptions) (*OpenI
 	oidc := &OpenIDConnect{
 		oAuth2:          oauth2,
 		profileModifier: opts.profileModifier,
+		usedLogoutTokens: ttlcache.NewCache[string, struct{}](&ttlcache.CacheOptions{
+			CleanupInterval: time.Minute,
+		}),
 	}
+	context.AfterFunc(ctx, oidc.usedLogoutTokens.Stop)
 
 	// JWKS is required for the public OIDC entrypoint: ID tokens must be verifiable
 	// The discovery document is required to include `jwks_uri` per OpenID Connect Discovery 1.0
@@ -277,7 +289,7 @@ func NewOpenIDConnect(ctx context.Context, opts NewOpenIDConnectOptions) (*OpenI
 
 // newOpenIDConnectInternal returns a new OpenIDConnect provider
 // It is meant to be used by structs that embed OpenIDConnect
-func newOpenIDConnectInternal(_ context.Context, providerType string, providerMetadata ProviderMetadata, opts NewOpenIDConnectOptions, endpoints OAuth2Endpoints) (*OpenIDConnect, error) {
+func newOpenIDConnectInternal(ctx context.Context, providerType string, providerMetadata ProviderMetadata, opts NewOpenIDConnectOptions, endpoints OAuth2Endpoints) (*OpenIDConnect, error) {
 	if opts.ClientID == "" {
 		return nil, fmt.Errorf("value for clientId is required in config for auth with provider '%s'", providerType)
 	}
@@ -323,7 +335,11 @@ func newOpenIDConnectInternal(_ context.Context, providerType string, providerMe
 	oidc := &OpenIDConnect{
 		oAuth2:          oauth2,
 		profileModifier: opts.profileModifier,
+		usedLogoutTokens: ttlcache.NewCache[string, struct{}](&ttlcache.CacheOptions{
+			CleanupInterval: time.Minute,
+		}),
 	}
+	context.AfterFunc(ctx, oidc.usedLogoutTokens.Stop)
 
 	// If a JWKS URI is provided, configure a fetcher so we can verify ID-token signatures
 	// When unset, the provider falls back to UserInfo-based profile retrieval
@@ -438,7 +454,123 @@ func (a *OpenIDConnect) OAuth2RetrieveProfile(ctx context.Context, at OAuth2Acce
 	return profile, nil
 }
 
+// LogoutURL returns the URL of the identity provider's end session endpoint, for OpenID Connect RP-Initiated Logout.
+// If the identity provider doesn't have an end session endpoint, it returns an empty string.
+func (a *OpenIDConnect) LogoutURL(idTokenHint string, postLogoutRedirectURI string) (string, error) {
+	if a.endpoints.EndSession == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(a.endpoints.EndSession)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse end session endpoint URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("client_id", a.config.ClientID)
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
+	if postLogoutRedirectURI != "" {
+		q.Set("post_logout_redirect_uri", postLogoutRedirectURI)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// ValidateLogoutToken validates a logout token sent by the identity provider, for OpenID Connect Back-Channel Logout.
+// The logout token must be signed with a key in the identity provider's JWKS.
+func (a *OpenIDConnect) ValidateLogoutToken(ctx context.Context, logoutToken string) (LogoutTokenClaims, error) {
+	// We can only validate logout tokens if we have a JWKS
+	if a.tokenIssuer == "" || a.jwks == nil {
+		return LogoutTokenClaims{}, ErrLogoutTokenNotForProvider
+	}
+
+	// Before fetching the JWKS, check that the token was issued by this identity provider and for this client
+	// This avoids making requests to the identity provider for tokens that are meant for other providers
+	unverified, err := jwt.ParseInsecure([]byte(logoutToken))
+	if err != nil {
+		return LogoutTokenClaims{}, fmt.Errorf("failed to parse logout token: %w", err)
+	}
+	iss, _ := unverified.Issuer()
+	aud, _ := unverified.Audience()
+	if iss != a.tokenIssuer || !slices.Contains(aud, a.config.ClientID) {
+		return LogoutTokenClaims{}, ErrLogoutTokenNotForProvider
+	}
+
+	set, err := a.jwks.Get(ctx)
+	if err != nil {
+		return LogoutTokenClaims{}, fmt.Errorf("failed to fetch JWKS for logout token verification: %w", err)
+	}
+
+	// Parse and verify the logout token
+	// Per OIDC Back-Channel Logout 1.0 section 2.4, the "iat", "exp", and "jti" claims are required
+	token, err := jwt.Parse(
+		[]byte(logoutToken),
+		jwt.WithKeySet(set, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithIssuer(a.tokenIssuer),
+		jwt.WithAudience(a.config.ClientID),
+		jwt.WithAcceptableSkew(idTokenClockSkew),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithRequiredClaim(jwt.JwtIDKey),
+	)
+	if err != nil {
+		return LogoutTokenClaims{}, fmt.Errorf("failed to parse logout token: %w", err)
+	}
+
+	// The "events" claim must contain the back-channel logout event
+	// This, together with the absence of the "nonce" claim, prevents ID tokens from being used as logout tokens
+	events, err := jwt.Get[map[string]any](token, "events")
+	if err != nil {
+		return LogoutTokenClaims{}, errors.New("logout token does not contain a valid 'events' claim")
+	}
+	if _, ok := events[backchannelLogoutEvent]; !ok {
+		return LogoutTokenClaims{}, errors.New("logout token does not contain the back-channel logout event")
+	}
+	if token.Has("nonce") {
+		return LogoutTokenClaims{}, errors.New("logout token must not contain a 'nonce' claim")
+	}
+
+	// At least one of "sub" and "sid" is required
+	var claims LogoutTokenClaims
+	claims.Subject, _ = token.Subject()
+	claims.SessionID, _ = jwt.Get[string](token, "sid")
+	if claims.Subject == "" && claims.SessionID == "" {
+		return LogoutTokenClaims{}, errors.New("logout token must contain at least one of the 'sub' and 'sid' claims")
+	}
+
+	// Reject logout tokens that were already used (section 2.6)
+	// IDs are remembered until the token expires (plus the allowed clock skew), after which the token is rejected anyway
+	jti, _ := token.JwtID()
+	exp, _ := token.Expiration()
+	a.usedLogoutTokensLock.Lock()
+	defer a.usedLogoutTokensLock.Unlock()
+	_, used := a.usedLogoutTokens.Get(jti)
+	if used {
+		return LogoutTokenClaims{}, fmt.Errorf("logout token with ID '%s' was already used", jti)
+	}
+	a.usedLogoutTokens.Set(jti, struct{}{}, time.Until(exp)+idTokenClockSkew)
+
+	return claims, nil
+}
+
 func fetchOIDCEndpoints(ctx context.Context, tokenIssuer string, client *http.Client, timeout time.Duration) (endpoints OAuth2Endpoints, err error) {
+	endpoints, err = fetchOIDCDiscoveryDocument(ctx, tokenIssuer, client, timeout)
+	if err != nil {
+		return endpoints, err
+	}
+
+	if !endpoints.Valid() {
+		return endpoints, errors.New("invalid openid-configuration document: not all required endpoints found")
+	}
+
+	return endpoints, nil
+}
+
+// fetchOIDCDiscoveryDocument fetches the openid-configuration document for the issuer, without validating that it contains the endpoints required for signing users in
+func fetchOIDCDiscoveryDocument(ctx context.Context, tokenIssuer string, client *http.Client, timeout time.Duration) (endpoints OAuth2Endpoints, err error) {
 	var reqURL string
 	if strings.HasSuffix(tokenIssuer, "/") {
 		reqURL = tokenIssuer + ".well-known/openid-configuration"
@@ -471,10 +603,6 @@ func fetchOIDCEndpoints(ctx context.Context, tokenIssuer string, client *http.Cl
 		return endpoints, fmt.Errorf("failed to parse response from openid-configuration document: %w", err)
 	}
 
-	if !endpoints.Valid() {
-		return endpoints, errors.New("invalid openid-configuration document: not all required endpoints found")
-	}
-
 	return endpoints, nil
 }
 
@@ -578,5 +706,9 @@ func computeAtHash(alg string, accessToken string) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
 }
 
-// Compile-time interface assertion
-var _ OAuth2Provider = &OpenIDConnect{}
+// Compile-time interface assertions
+var (
+	_ OAuth2Provider            = &OpenIDConnect{}
+	_ LogoutProvider            = &OpenIDConnect{}
+	_ BackchannelLogoutProvider = &OpenIDConnect{}
+)
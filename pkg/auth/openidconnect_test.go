@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -101,6 +102,108 @@ func TestOpenIDConnectExchangeCodeAndRetrieveProfileFromUserInfo(t *testing.T) {
 	assert.Equal(t, "user-1", profile.ID)
 }
 
+func TestOpenIDConnectRefreshToken(t *testing.T) {
+	provider, err := newOpenIDConnectInternal(
+		t.Context(),
+		"openidconnect",
+		ProviderMetadata{Name: "openidconnect"},
+		NewOpenIDConnectOptions{
+			ClientID:     "cid",
+			ClientSecret: "secret",
+		},
+		// #nosec G101 - No credentials
+		OAuth2Endpoints{
+			Authorization: "https://idp.example.com/authorize",
+			Token:         "https://idp.example.com/token",
+			UserInfo:      "https://idp.example.com/userinfo",
+		},
+	)
+	require.NoError(t, err)
+
+	provider.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.String() != "https://idp.example.com/token" {
+				return nil, assert.AnError
+			}
+
+			body, readErr := io.ReadAll(req.Body)
+			if readErr != nil {
+				return nil, readErr
+			}
+			vals, parseErr := url.ParseQuery(string(body))
+			if parseErr != nil {
+				return nil, parseErr
+			}
+			if vals.Get("grant_type") != "refresh_token" || vals.Get("client_secret") != "secret" {
+				return nil, assert.AnError
+			}
+
+			var resBody string
+			status := http.StatusOK
+			switch vals.Get("refresh_token") {
+			case "rt-rotate":
+				resBody = `{"access_token":"access-2","expires_in":3600,"refresh_token":"rt-rotated"}`
+			case "rt-static":
+				resBody = `{"access_token":"access-3","expires_in":3600}`
+			case "rt-invalid-client":
+				status = http.StatusUnauthorized
+				resBody = `{"error":"invalid_client","error_description":"client authentication failed"}`
+			case "rt-invalid-request":
+				status = http.StatusBadRequest
+				resBody = `{"error":"invalid_request"}`
+			case "rt-no-json":
+				status = http.StatusBadRequest
+				resBody = `Bad Request`
+			case "rt-unavailable":
+				status = http.StatusServiceUnavailable
+			default:
+				status = http.StatusBadRequest
+				resBody = `{"error":"invalid_grant"}`
+			}
+			return &http.Response{
+				StatusCode: status,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(resBody)),
+			}, nil
+		}),
+	}
+
+	t.Run("refresh token is rotated", func(t *testing.T) {
+		at, err := provider.OAuth2RefreshToken(t.Context(), "rt-rotate")
+		require.NoError(t, err)
+		assert.Equal(t, "access-2", at.AccessToken)
+		assert.Equal(t, "rt-rotated", at.RefreshToken)
+	})
+
+	t.Run("refresh token is not rotated", func(t *testing.T) {
+		at, err := provider.OAuth2RefreshToken(t.Context(), "rt-static")
+		require.NoError(t, err)
+		assert.Equal(t, "access-3", at.AccessToken)
+		assert.Equal(t, "rt-static", at.RefreshToken)
+	})
+
+	t.Run("refresh token is rejected", func(t *testing.T) {
+		_, err := provider.OAuth2RefreshToken(t.Context(), "rt-revoked")
+		require.Error(t, err)
+		require.ErrorIs(t, err, ErrTokenRequestRejected)
+		assert.ErrorContains(t, err, "invalid_grant")
+	})
+
+	t.Run("errors that don't reject the refresh token", func(t *testing.T) {
+		for _, rt := range []string{"rt-invalid-client", "rt-invalid-request", "rt-no-json", "rt-unavailable"} {
+			_, err := provider.OAuth2RefreshToken(t.Context(), rt)
+			require.Error(t, err, rt)
+			assert.NotErrorIs(t, err, ErrTokenRequestRejected, rt)
+		}
+	})
+
+	t.Run("empty refresh token", func(t *testing.T) {
+		_, err := provider.OAuth2RefreshToken(t.Context(), "")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrTokenRequestRejected)
+	})
+}
+
 func TestOpenIDConnectRetrieveProfileFromIDToken(t *testing.T) {
 	signer := newTestSigningKey(t)
 
@@ -403,7 +506,7 @@ func TestFetchOIDCEndpoints(t *testing.T) {
 				return
 			}
 
-			_, _ = w.Write([]byte(`{"authorization_endpoint":"https://idp.example.com/auth","token_endpoint":"https://idp.example.com/token","userinfo_endpoint":"https://idp.example.com/userinfo"}`))
+			_, _ = w.Write([]byte(`{"authorization_endpoint":"https://idp.example.com/auth","token_endpoint":"https://idp.example.com/token","userinfo_endpoint":"https://idp.example.com/userinfo","end_session_endpoint":"https://idp.example.com/logout"}`))
 		}),
 	)
 	defer ts.Close()
@@ -413,4 +516,224 @@ func TestFetchOIDCEndpoints(t *testing.T) {
 	assert.Equal(t, "https://idp.example.com/auth", endpoints.Authorization)
 	assert.Equal(t, "https://idp.example.com/token", endpoints.Token)
 	assert.Equal(t, "https://idp.example.com/userinfo", endpoints.UserInfo)
+	assert.Equal(t, "https://idp.example.com/logout", endpoints.EndSession)
+}
+
+func TestOpenIDConnectLogoutURL(t *testing.T) {
+	newProvider := func(t *testing.T, endSession string) *OpenIDConnect {
+		t.Helper()
+
+		provider, err := newOpenIDConnectInternal(
+			t.Context(),
+			"openidconnect",
+			ProviderMetadata{Name: "openidconnect"},
+			NewOpenIDConnectOptions{
+				ClientID:     "cid",
+				ClientSecret: "secret",
+			},
+			// #nosec G101 - No credentials
+			OAuth2Endpoints{
+				Authorization: "https://idp.example.com/authorize",
+				Token:         "https://idp.example.com/token",
+				UserInfo:      "https://idp.example.com/userinfo",
+				EndSession:    endSession,
+			},
+		)
+		require.NoError(t, err)
+		return provider
+	}
+
+	t.Run("with end session endpoint", func(t *testing.T) {
+		provider := newProvider(t, "https://idp.example.com/logout?foo=bar")
+
+		logoutURL, err := provider.LogoutURL("my-id-token", "https://auth.example.com/portals/main")
+		require.NoError(t, err)
+		u, err := url.Parse(logoutURL)
+		require.NoError(t, err)
+		assert.Equal(t, "idp.example.com", u.Host)
+		assert.Equal(t, "/logout", u.Path)
+
+		q := u.Query()
+		assert.Equal(t, "bar", q.Get("foo"))
+		assert.Equal(t, "cid", q.Get("client_id"))
+		assert.Equal(t, "my-id-token", q.Get("id_token_hint"))
+		assert.Equal(t, "https://auth.example.com/portals/main", q.Get("post_logout_redirect_uri"))
+	})
+
+	t.Run("without ID token hint", func(t *testing.T) {
+		provider := newProvider(t, "https://idp.example.com/logout")
+
+		logoutURL, err := provider.LogoutURL("", "https://auth.example.com/portals/main")
+		require.NoError(t, err)
+		u, err := url.Parse(logoutURL)
+		require.NoError(t, err)
+		assert.False(t, u.Query().Has("id_token_hint"))
+	})
+
+	t.Run("without end session endpoint", func(t *testing.T) {
+		provider := newProvider(t, "")
+
+		logoutURL, err := provider.LogoutURL("my-id-token", "https://auth.example.com/portals/main")
+		require.NoError(t, err)
+		assert.Empty(t, logoutURL)
+	})
+}
+
+func TestOpenIDConnectValidateLogoutToken(t *testing.T) {
+	signer := newTestSigningKey(t)
+
+	// #nosec G101 - No credentials
+	provider, err := newOpenIDConnectInternal(t.Context(),
+		"openidconnect",
+		ProviderMetadata{Name: "openidconnect"},
+		NewOpenIDConnectOptions{
+			ClientID:     "cid",
+			ClientSecret: "secret",
+			TokenIssuer:  "https://issuer.example.com",
+		},
+		OAuth2Endpoints{
+			Authorization: "https://idp.example.com/authorize",
+			Token:         "https://idp.example.com/token",
+			UserInfo:      "https://idp.example.com/userinfo",
+			JWKSUri:       "https://idp.example.com/jwks",
+		},
+	)
+	require.NoError(t, err)
+
+	var jwksRequests int
+	provider.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.String() == "https://idp.example.com/jwks" {
+				jwksRequests++
+				return signer.serveJWKS(), nil
+			}
+			return nil, assert.AnError
+		}),
+	}
+
+	// Each logout token has a different ID, because tokens can't be reused
+	var logoutTokenCount int
+	logoutClaims := func(modify func(claims map[string]any)) map[string]any {
+		logoutTokenCount++
+		now := time.Now().Unix()
+		claims := map[string]any{
+			"iss": "https://issuer.example.com",
+			"aud": "cid",
+			"sub": "sub-1",
+			"sid": "sid-1",
+			"iat": now,
+			"exp": now + 120,
+			"jti": "logout-" + strconv.Itoa(logoutTokenCount),
+			"events": map[string]any{
+				"http://schemas.openid.net/event/backchannel-logout": map[string]any{},
+			},
+		}
+		if modify != nil {
+			modify(claims)
+		}
+		return claims
+	}
+
+	t.Run("valid logout token", func(t *testing.T) {
+		claims, err := provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(nil)))
+		require.NoError(t, err)
+		assert.Equal(t, "sub-1", claims.Subject)
+		assert.Equal(t, "sid-1", claims.SessionID)
+	})
+
+	t.Run("logout token with sid only", func(t *testing.T) {
+		claims, err := provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(func(claims map[string]any) {
+			delete(claims, "sub")
+		})))
+		require.NoError(t, err)
+		assert.Empty(t, claims.Subject)
+		assert.Equal(t, "sid-1", claims.SessionID)
+	})
+
+	t.Run("replayed logout token", func(t *testing.T) {
+		token := signer.SignClaims(t, logoutClaims(nil))
+		_, err := provider.ValidateLogoutToken(t.Context(), token)
+		require.NoError(t, err)
+
+		_, err = provider.ValidateLogoutToken(t.Context(), token)
+		require.ErrorContains(t, err, "was already used")
+
+		// A different token with the same ID is rejected too
+		_, err = provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(func(claims map[string]any) {
+			claims["jti"] = "logout-" + strconv.Itoa(logoutTokenCount-1)
+			claims["sub"] = "sub-2"
+		})))
+		require.ErrorContains(t, err, "was already used")
+	})
+
+	t.Run("token for another provider", func(t *testing.T) {
+		before := jwksRequests
+
+		_, err := provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(func(claims map[string]any) {
+			claims["iss"] = "https://other.example.com"
+		})))
+		require.ErrorIs(t, err, ErrLogoutTokenNotForProvider)
+
+		_, err = provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(func(claims map[string]any) {
+			claims["aud"] = "other-client"
+		})))
+		require.ErrorIs(t, err, ErrLogoutTokenNotForProvider)
+
+		// The JWKS is not fetched for tokens meant for other providers
+		assert.Equal(t, before, jwksRequests)
+	})
+
+	t.Run("invalid logout tokens", func(t *testing.T) {
+		tests := map[string]func(claims map[string]any){
+			"missing events": func(claims map[string]any) {
+				delete(claims, "events")
+			},
+			"wrong event": func(claims map[string]any) {
+				claims["events"] = map[string]any{"http://example.com/other-event": map[string]any{}}
+			},
+			"contains nonce": func(claims map[string]any) {
+				claims["nonce"] = "abc"
+			},
+			"missing sub and sid": func(claims map[string]any) {
+				delete(claims, "sub")
+				delete(claims, "sid")
+			},
+			"missing iat": func(claims map[string]any) {
+				delete(claims, "iat")
+			},
+			"missing exp": func(claims map[string]any) {
+				delete(claims, "exp")
+			},
+			"missing jti": func(claims map[string]any) {
+				delete(claims, "jti")
+			},
+			"expired": func(claims map[string]any) {
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+		}
+		for name, modify := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := provider.ValidateLogoutToken(t.Context(), signer.SignClaims(t, logoutClaims(modify)))
+				require.Error(t, err)
+				require.NotErrorIs(t, err, ErrLogoutTokenNotForProvider)
+			})
+		}
+	})
+
+	t.Run("unsigned logout token", func(t *testing.T) {
+		token, err := buildUnsignedJWT(logoutClaims(nil))
+		require.NoError(t, err)
+
+		_, err = provider.ValidateLogoutToken(t.Context(), token)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrLogoutTokenNotForProvider)
+	})
+
+	t.Run("signed with unknown key", func(t *testing.T) {
+		other := newTestSigningKey(t)
+
+		_, err := provider.ValidateLogoutToken(t.Context(), other.SignClaims(t, logoutClaims(nil)))
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrLogoutTokenNotForProvider)
+	})
 }
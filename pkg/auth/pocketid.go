@@ -88,6 +88,7 @@ func NewPocketID(ctx context.Context, opts NewPocketIDOptions) (*PocketID, error
 		Token:         opts.Endpoint + "/api/oidc/token",
 		UserInfo:      opts.Endpoint + "/api/oidc/userinfo",
 		JWKSUri:       opts.Endpoint + "/.well-known/jwks.json",
+		EndSession:    opts.Endpoint + "/api/oidc/end-session",
 	})
 	if err != nil {
 		return nil, err
@@ -100,5 +101,9 @@ func NewPocketID(ctx context.Context, opts NewPocketIDOptions) (*PocketID, error
 	return a, nil
 }
 
-// Compile-time interface assertion
-var _ OAuth2Provider = &PocketID{}
+// Compile-time interface assertions
+var (
+	_ OAuth2Provider            = &PocketID{}
+	_ LogoutProvider            = &PocketID{}
+	_ BackchannelLogoutProvider = &PocketID{}
+)
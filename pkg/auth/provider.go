@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -47,6 +48,20 @@ type SeamlessProvider interface {
 	SeamlessAuth(r *http.Request) (*user.Profile, error)
 }
 
+// RequestAuthProvider is the interface that represents an auth provider that can authenticate each request on its own, with credentials that clients present on every request, such as TLS client certificates.
+// When there's no session, these providers authenticate requests to the portal's root directly, without redirecting clients or issuing a session cookie.
+// Providers that don't implement any other interface, such as those using bearer tokens, are not shown in the sign-in page.
+type RequestAuthProvider interface {
+	Provider
+
+	// AuthenticateRequest authenticates the HTTP request, and returns the user's profile.
+	// If the request doesn't contain credentials for the provider, the error wraps ErrNoCredentials.
+	AuthenticateRequest(r *http.Request) (*user.Profile, error)
+}
+
+// ErrNoCredentials is returned by request auth providers when the request doesn't contain credentials for the provider
+var ErrNoCredentials = errors.New("request does not contain credentials")
+
 // OAuth2Provider is the interface that represents an auth provider that is based on OAuth2.
 type OAuth2Provider interface {
 	Provider
@@ -55,10 +70,91 @@ type OAuth2Provider interface {
 	OAuth2AuthorizeURL(state string, redirectURL string) (string, error)
 	// OAuth2ExchangeCode an authorization code for an access token
 	OAuth2ExchangeCode(ctx context.Context, state string, code string, redirectURL string) (OAuth2AccessToken, error)
+	// OAuth2RefreshToken exchanges a refresh token for a new access token
+	// If the identity provider rejects the refresh token, the error wraps ErrTokenRequestRejected
+	OAuth2RefreshToken(ctx context.Context, refreshToken string) (OAuth2AccessToken, error)
 	// OAuth2RetrieveProfile retrieves the user's profile, using the id_token (if present) or requesting it from the user info endpoint.
 	OAuth2RetrieveProfile(ctx context.Context, at OAuth2AccessToken) (*user.Profile, error)
 }
 
+// SAMLProvider is the interface that represents an auth provider that is based on SAML 2.0, where the application acts as Service Provider.
+type SAMLProvider interface {
+	Provider
+
+	// SAMLMetadata returns the metadata document for the Service Provider.
+	SAMLMetadata(acsURL string) ([]byte, error)
+	// SAMLAuthnRequestURL returns the URL where to redirect users to for authentication, using the HTTP-Redirect binding.
+	SAMLAuthnRequestURL(relayState string, acsURL string) (string, error)
+	// SAMLValidateResponse validates a response received with the HTTP-POST binding, and returns the user's profile.
+	SAMLValidateResponse(samlResponse string, relayState string, acsURL string) (*user.Profile, error)
+}
+
+// FormProvider is the interface that represents an auth provider that authenticates users with the username and password they enter in a login form.
+type FormProvider interface {
+	Provider
+
+	// FormAuth authenticates the user with the username and password, and returns the user's profile.
+	// If the credentials are not valid, the error wraps ErrInvalidCredentials.
+	FormAuth(ctx context.Context, username string, password string) (*user.Profile, error)
+}
+
+// ErrInvalidCredentials is returned by form providers when the username or password is not valid
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// WebAuthnProvider is the interface that represents an auth provider that authenticates users with passkeys, using WebAuthn.
+// Origins have the format "scheme://host", and options are encoded as JSON with binary values encoded as base64url.
+type WebAuthnProvider interface {
+	Provider
+
+	// WebAuthnLoginOptions returns the options for navigator.credentials.get() for the challenge.
+	WebAuthnLoginOptions(origin string, challenge []byte) ([]byte, error)
+	// WebAuthnFinishLogin validates the response of the authenticator to a sign-in request, and returns the user's profile.
+	// If the response is not valid, the error wraps ErrInvalidCredentials.
+	WebAuthnFinishLogin(ctx context.Context, origin string, challenge []byte, assertion WebAuthnAssertion) (*user.Profile, error)
+	// WebAuthnBeginRegistration starts the registration of a passkey, and returns the options for navigator.credentials.create().
+	// If the user exists and was registered after signing in with a different provider, the error wraps ErrWebAuthnUserConflict.
+	WebAuthnBeginRegistration(ctx context.Context, origin string, registrant WebAuthnRegistrant) ([]byte, error)
+	// WebAuthnFinishRegistration validates the response of the authenticator to a registration request, and stores the new credential.
+	// If the response is not valid, the error wraps ErrInvalidCredentials.
+	WebAuthnFinishRegistration(ctx context.Context, origin string, attestation WebAuthnAttestation) (WebAuthnUser, error)
+	// WebAuthnCreateInvite creates an invite that allows registering a passkey for the user, and returns the invite token.
+	WebAuthnCreateInvite(ctx context.Context, u WebAuthnUser) (token string, expiresAt time.Time, err error)
+	// WebAuthnGetInvite returns the user an invite was created for.
+	// If the invite doesn't exist or has expired, the error wraps ErrWebAuthnNotFound.
+	WebAuthnGetInvite(ctx context.Context, token string) (WebAuthnUser, error)
+	// WebAuthnDeleteUser deletes a user and all their passkeys, returning the number of passkeys deleted.
+	// If the user doesn't exist, the error wraps ErrWebAuthnNotFound.
+	WebAuthnDeleteUser(ctx context.Context, userID string) (int, error)
+}
+
+// LogoutProvider is the interface that represents an auth provider that can sign users out of the identity provider, such as with OpenID Connect RP-Initiated Logout.
+type LogoutProvider interface {
+	Provider
+
+	// LogoutURL returns the URL where to redirect users to for signing out of the identity provider.
+	// The ID token hint is optional, and users are redirected to postLogoutRedirectURI after they have been signed out.
+	// If the provider doesn't support logout, it returns an empty string.
+	LogoutURL(idTokenHint string, postLogoutRedirectURI string) (string, error)
+}
+
+// BackchannelLogoutProvider is the interface that represents an auth provider that can receive logout tokens from the identity provider, such as with OpenID Connect Back-Channel Logout.
+type BackchannelLogoutProvider interface {
+	Provider
+
+	// ValidateLogoutToken validates a logout token sent by the identity provider, and returns the claims identifying the sessions to terminate.
+	// If the logout token wasn't issued for this provider, the error wraps ErrLogoutTokenNotForProvider.
+	ValidateLogoutToken(ctx context.Context, logoutToken string) (LogoutTokenClaims, error)
+}
+
+// LogoutTokenClaims contains the claims of a validated logout token.
+// At least one of the fields is set.
+type LogoutTokenClaims struct {
+	// Subject of the user at the identity provider ("sub" claim)
+	Subject string
+	// ID of the session at the identity provider ("sid" claim)
+	SessionID string
+}
+
 // OAuth2AccessToken is a struct that represents an access token.
 type OAuth2AccessToken struct {
 	Provider     string
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// This file contains helpers for working with the XML documents used by SAML.
+// XML Signatures are verified with goxmldsig, and after a signature is verified only the element returned by the validator must be used, which prevents signature wrapping attacks.
+
+// Identifier of the SHA-1 digest algorithm, which is not supported
+// Signatures that use SHA-1 are rejected by crypto/x509 already
+const xmlDigestSHA1 = "http://www.w3.org/2000/09/xmldsig#sha1"
+
+// errSAMLNotSigned is returned by verifySAMLSignature when the element doesn't contain a signature
+var errSAMLNotSigned = errors.New("element is not signed")
+
+// parseSAMLXML parses an XML document and returns its root element.
+// Documents that don't round-trip through encoding/xml, or that contain a DTD or more than one root element, are rejected.
+func parseSAMLXML(data []byte) (*etree.Element, error) {
+	// encoding/xml can parse some malformed documents in ways that change their meaning after being serialized again, which would affect signatures
+	err := xrv.Validate(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XML document: %w", err)
+	}
+
+	doc := etree.NewDocument()
+	doc.ReadSettings.ValidateInput = true
+	err = doc.ReadFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XML document: %w", err)
+	}
+
+	var root *etree.Element
+	for _, tok := range doc.Child {
+		switch t := tok.(type) {
+		case *etree.Directive:
+			return nil, errors.New("invalid XML document: DTDs are not allowed")
+		case *etree.Element:
+			if root != nil {
+				return nil, errors.New("invalid XML document: more than one root element")
+			}
+			root = t
+		}
+	}
+	if root == nil {
+		return nil, errors.New("invalid XML document: no root element")
+	}
+
+	// Detach the root from the document so it has no parent
+	doc.RemoveChild(root)
+	return root, nil
+}
+
+// verifySAMLSignature verifies the enveloped signature of the element, whose Reference must point to the element itself.
+// It returns the signed element, which is parsed from the canonicalized bytes covered by the signature; callers must use only the returned element, and not the one that was passed.
+// If the element doesn't contain a signature, it returns errSAMLNotSigned.
+func verifySAMLSignature(el *etree.Element, certs []*x509.Certificate) (*etree.Element, error) {
+	sigs := samlChildren(el, dsig.Namespace, dsig.SignatureTag)
+	switch len(sigs) {
+	case 0:
+		return nil, errSAMLNotSigned
+	case 1:
+		// All good
+	default:
+		return nil, errors.New("element contains more than one signature")
+	}
+
+	// Changing the digest algorithm invalidates the signature, so this can be checked before the signature is verified
+	for _, ref := range samlChildren(samlChild(sigs[0], dsig.Namespace, "SignedInfo"), dsig.Namespace, "Reference") {
+		if samlAttr(samlChild(ref, dsig.Namespace, "DigestMethod"), "Algorithm") == xmlDigestSHA1 {
+			return nil, errors.New("SHA-1 digests are not supported")
+		}
+	}
+
+	// Copy the element together with the namespaces declared by its ancestors
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build namespace context: %w", err)
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detach element: %w", err)
+	}
+
+	// The IdP can have more than one signing certificate, for example while keys are rotated
+	var validateErr error
+	for _, cert := range certs {
+		vc := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+			Roots: []*x509.Certificate{cert},
+		})
+		// Certificates in the IdP metadata are only containers for the public keys, so their validity period is not enforced
+		vc.Clock = dsig.NewFakeClockAt(cert.NotBefore)
+
+		var signed *etree.Element
+		signed, validateErr = vc.Validate(detached)
+		if validateErr == nil {
+			return signed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("signature is not valid: %w", validateErr)
+}
+
+// samlIs returns true if the element has the given namespace and local name
+func samlIs(el *etree.Element, namespace string, local string) bool {
+	return el.Tag == local && el.NamespaceURI() == namespace
+}
+
+// samlChildren returns the child elements with the given namespace and local name
+// It's safe to call on a nil element
+func samlChildren(el *etree.Element, namespace string, local string) []*etree.Element {
+	if el == nil {
+		return nil
+	}
+	var res []*etree.Element
+	for _, c := range el.ChildElements() {
+		if samlIs(c, namespace, local) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// samlChild returns the first child element with the given namespace and local name, or nil if there's none
+// It's safe to call on a nil element
+func samlChild(el *etree.Element, namespace string, local string) *etree.Element {
+	if el == nil {
+		return nil
+	}
+	for _, c := range el.ChildElements() {
+		if samlIs(c, namespace, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// samlAttr returns the value of the attribute with the given name and no namespace prefix
+// It's safe to call on a nil element
+func samlAttr(el *etree.Element, name string) string {
+	if el == nil {
+		return ""
+	}
+	for _, a := range el.Attr {
+		if a.Space == "" && a.Key == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// samlText returns the text content of the element, trimmed.
+// All text nodes are concatenated, so comments inside the text (which are not covered by signatures) can't be used to truncate values.
+func samlText(el *etree.Element) string {
+	var b strings.Builder
+	for _, tok := range el.Child {
+		if cd, ok := tok.(*etree.CharData); ok {
+			b.WriteString(cd.Data)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func stripXMLWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,659 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/cenkalti/backoff/v5"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	samlNamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlNamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlNamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlBindingRedirect    = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlBindingPOST        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlConfirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// Acceptable clock skew when validating the times in SAML assertions
+	samlClockSkew = 90 * time.Second
+	// Maximum size of the IdP metadata document
+	samlMaxMetadataSize = 4 << 20
+)
+
+// Default names of the attributes used to populate the user profile
+// The names include the LDAP attributes (with their names and OIDs) and the claims used by AD FS and Microsoft Entra ID
+var (
+	samlDefaultNameAttributes = []string{
+		"displayName",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"cn",
+		"urn:oid:2.5.4.3",
+	}
+	samlDefaultFirstNameAttributes = []string{
+		"givenName",
+		"urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	}
+	samlDefaultLastNameAttributes = []string{
+		"sn",
+		"surname",
+		"urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	}
+	samlDefaultEmailAttributes = []string{
+		"mail",
+		"email",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	samlDefaultGroupsAttributes = []string{
+		"groups",
+		"memberOf",
+		"isMemberOf",
+		"urn:oid:1.3.6.1.4.1.5923.1.5.1.1",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+		"http://schemas.xmlsoap.org/claims/Group",
+	}
+)
+
+// SAML manages authentication with a SAML 2.0 Identity Provider, acting as a Service Provider.
+// AuthnRequests are sent with the HTTP-Redirect binding, and responses are received with the HTTP-POST binding.
+type SAML struct {
+	baseProvider
+
+	entityID     string
+	nameIDFormat string
+	idp          samlIdPMetadata
+	attributes   SAMLAttributeMapping
+}
+
+// SAMLAttributeMapping contains the names of the attributes used to populate the user profile.
+// Attributes are matched by their Name or FriendlyName.
+// When a value is empty, a list of commonly-used attribute names is used.
+type SAMLAttributeMapping struct {
+	// Name of the attribute with the user ID
+	// If empty, the NameID of the assertion's subject is used
+	ID string
+	// Name of the attribute with the user's full name
+	Name string
+	// Name of the attribute with the user's email address
+	Email string
+	// Name of the attribute with the list of groups
+	Groups string
+}
+
+type samlIdPMetadata struct {
+	entityID string
+	ssoURL   string
+	certs    []*x509.Certificate
+}
+
+// NewSAMLOptions is the options for NewSAML
+type NewSAMLOptions struct {
+	// Entity ID of the Service Provider
+	EntityID string
+	// IdP metadata document
+	// One of IdPMetadata and IdPMetadataURL is required
+	IdPMetadata []byte
+	// URL where to fetch the IdP metadata document from
+	IdPMetadataURL string
+	// Format of the NameID to request, such as "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	// If empty, the Identity Provider can use any format
+	NameIDFormat string
+	// Mapping from the attributes in the assertion to the user profile
+	AttributeMapping SAMLAttributeMapping
+	// Request timeout for fetching the IdP metadata
+	// Defaults to 10s
+	RequestTimeout time.Duration
+	// Skip validating TLS certificates when fetching the IdP metadata
+	TLSSkipVerify bool
+	// Optional, PEM-encoded CA certificate used when fetching the IdP metadata
+	TLSCACertificate []byte
+}
+
+// NewSAML returns a new SAML provider
+// If the IdP metadata is loaded from a URL, this fetches it.
+func NewSAML(ctx context.Context, opts NewSAMLOptions) (*SAML, error) {
+	if opts.EntityID == "" {
+		return nil, errors.New("value for entityID is required in config for auth with provider 'saml'")
+	}
+	if (len(opts.IdPMetadata) == 0) == (opts.IdPMetadataURL == "") {
+		return nil, errors.New("exactly one of the IdP metadata document and the IdP metadata URL is required in config for auth with provider 'saml'")
+	}
+	if opts.RequestTimeout < time.Second {
+		opts.RequestTimeout = 10 * time.Second
+	}
+
+	metadataDoc := opts.IdPMetadata
+	if opts.IdPMetadataURL != "" {
+		// Fetch the metadata document, retrying in case of failures
+		httpClient := newProviderHTTPClient(opts.TLSSkipVerify, opts.TLSCACertificate)
+		bo := backoff.NewExponentialBackOff()
+		bo.InitialInterval = time.Second
+		bo.MaxInterval = 30 * time.Second
+		var err error
+		metadataDoc, err = backoff.Retry(ctx, func() ([]byte, error) {
+			return fetchSAMLMetadata(ctx, opts.IdPMetadataURL, httpClient, opts.RequestTimeout)
+		}, backoff.WithBackOff(bo))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	idp, err := parseSAMLIdPMetadata(metadataDoc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+	}
+
+	const providerType = "saml"
+	return &SAML{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "SAML",
+				Name:        providerType,
+				Color:       "sky",
+			},
+		},
+		entityID:     opts.EntityID,
+		nameIDFormat: opts.NameIDFormat,
+		idp:          idp,
+		attributes:   opts.AttributeMapping,
+	}, nil
+}
+
+func (a *SAML) GetProviderType() string {
+	return "saml"
+}
+
+// SAMLMetadata returns the metadata document for the Service Provider.
+func (a *SAML) SAMLMetadata(acsURL string) ([]byte, error) {
+	type acs struct {
+		Binding   string `xml:"Binding,attr"`
+		Location  string `xml:"Location,attr"`
+		Index     int    `xml:"index,attr"`
+		IsDefault bool   `xml:"isDefault,attr"`
+	}
+	type spSSODescriptor struct {
+		AuthnRequestsSigned        bool     `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool     `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string   `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormat               []string `xml:"md:NameIDFormat,omitempty"`
+		AssertionConsumerService   acs      `xml:"md:AssertionConsumerService"`
+	}
+	type entityDescriptor struct {
+		XMLName         xml.Name        `xml:"md:EntityDescriptor"`
+		XMLNS           string          `xml:"xmlns:md,attr"`
+		EntityID        string          `xml:"entityID,attr"`
+		SPSSODescriptor spSSODescriptor `xml:"md:SPSSODescriptor"`
+	}
+
+	ed := entityDescriptor{
+		XMLNS:    samlNamespaceMetadata,
+		EntityID: a.entityID,
+		SPSSODescriptor: spSSODescriptor{
+			AuthnRequestsSigned:        false,
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: samlNamespaceProtocol,
+			AssertionConsumerService: acs{
+				Binding:   samlBindingPOST,
+				Location:  acsURL,
+				Index:     0,
+				IsDefault: true,
+			},
+		},
+	}
+	if a.nameIDFormat != "" {
+		ed.SPSSODescriptor.NameIDFormat = []string{a.nameIDFormat}
+	}
+
+	out, err := xml.MarshalIndent(ed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize metadata: %w", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// SAMLAuthnRequestURL returns the URL where to redirect users to for authentication, which contains an AuthnRequest sent with the HTTP-Redirect binding.
+// The relay state is returned by the Identity Provider together with the response, and it's used to compute the ID of the AuthnRequest.
+func (a *SAML) SAMLAuthnRequestURL(relayState string, acsURL string) (string, error) {
+	type nameIDPolicy struct {
+		Format      string `xml:"Format,attr,omitempty"`
+		AllowCreate bool   `xml:"AllowCreate,attr"`
+	}
+	type authnRequest struct {
+		XMLName                     xml.Name     `xml:"samlp:AuthnRequest"`
+		XMLNSProtocol               string       `xml:"xmlns:samlp,attr"`
+		XMLNSAssertion              string       `xml:"xmlns:saml,attr"`
+		ID                          string       `xml:"ID,attr"`
+		Version                     string       `xml:"Version,attr"`
+		IssueInstant                string       `xml:"IssueInstant,attr"`
+		Destination                 string       `xml:"Destination,attr"`
+		AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+		ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+		Issuer                      string       `xml:"saml:Issuer"`
+		NameIDPolicy                nameIDPolicy `xml:"samlp:NameIDPolicy"`
+	}
+
+	req := authnRequest{
+		XMLNSProtocol:               samlNamespaceProtocol,
+		XMLNSAssertion:              samlNamespaceAssertion,
+		ID:                          samlRequestID(relayState),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 a.idp.ssoURL,
+		AssertionConsumerServiceURL: acsURL,
+		ProtocolBinding:             samlBindingPOST,
+		Issuer:                      a.entityID,
+		NameIDPolicy: nameIDPolicy{
+			Format:      a.nameIDFormat,
+			AllowCreate: true,
+		},
+	}
+	reqXML, err := xml.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize AuthnRequest: %w", err)
+	}
+
+	// The HTTP-Redirect binding uses DEFLATE compression, then base64 encoding
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", fmt.Errorf("failed to create compressor: %w", err)
+	}
+	_, err = w.Write(reqXML)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress AuthnRequest: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to compress AuthnRequest: %w", err)
+	}
+
+	u, err := url.Parse(a.idp.ssoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SSO URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", relayState)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// SAMLValidateResponse validates the base64-encoded SAML response received with the HTTP-POST binding, and returns the user profile from the assertion.
+// The response must be for the AuthnRequest sent with the same relay state, and either the response or the assertion must be signed by the Identity Provider.
+func (a *SAML) SAMLValidateResponse(samlResponse string, relayState string, acsURL string) (*user.Profile, error) {
+	data, err := base64.StdEncoding.DecodeString(stripXMLWhitespace(samlResponse))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding for SAML response: %w", err)
+	}
+
+	res, err := parseSAMLXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !samlIs(res, samlNamespaceProtocol, "Response") {
+		return nil, errors.New("document is not a SAML response")
+	}
+
+	// If the response is signed, continue with the signed element only
+	// The assertion is a child of the response, so it's covered by the response's signature too
+	responseSigned := false
+	signedRes, err := verifySAMLSignature(res, a.idp.certs)
+	switch {
+	case err == nil:
+		res = signedRes
+		responseSigned = true
+	case !errors.Is(err, errSAMLNotSigned):
+		return nil, fmt.Errorf("invalid response signature: %w", err)
+	}
+
+	// Validate the response
+	expectRequestID := samlRequestID(relayState)
+	if samlAttr(res, "InResponseTo") != expectRequestID {
+		return nil, errors.New("response is not for the expected AuthnRequest")
+	}
+	dest := samlAttr(res, "Destination")
+	if dest != "" && dest != acsURL {
+		return nil, fmt.Errorf("response destination '%s' does not match the assertion consumer service URL", dest)
+	}
+	issuer := samlChild(res, samlNamespaceAssertion, "Issuer")
+	if issuer != nil && samlText(issuer) != a.idp.entityID {
+		return nil, errors.New("response issuer does not match the IdP entity ID")
+	}
+	statusCode := samlChild(samlChild(res, samlNamespaceProtocol, "Status"), samlNamespaceProtocol, "StatusCode")
+	if statusCode == nil {
+		return nil, errors.New("response does not contain a status code")
+	} else if samlAttr(statusCode, "Value") != samlStatusSuccess {
+		return nil, fmt.Errorf("authentication failed with status '%s'", samlAttr(statusCode, "Value"))
+	}
+
+	if len(samlChildren(res, samlNamespaceAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := samlChildren(res, samlNamespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// If the response isn't signed, the assertion must be, and only the signed element is used
+	if !responseSigned {
+		assertion, err = verifySAMLSignature(assertion, a.idp.certs)
+		switch {
+		case errors.Is(err, errSAMLNotSigned):
+			return nil, errors.New("neither the response nor the assertion is signed")
+		case err != nil:
+			return nil, fmt.Errorf("invalid assertion signature: %w", err)
+		}
+	}
+
+	err = a.validateAssertion(assertion, expectRequestID, acsURL, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion: %w", err)
+	}
+
+	return a.profileFromAssertion(assertion)
+}
+
+func (a *SAML) validateAssertion(assertion *etree.Element, expectRequestID string, acsURL string, now time.Time) error {
+	issuer := samlChild(assertion, samlNamespaceAssertion, "Issuer")
+	if issuer == nil || samlText(issuer) != a.idp.entityID {
+		return errors.New("issuer does not match the IdP entity ID")
+	}
+
+	// There must be a bearer subject confirmation for this request
+	subject := samlChild(assertion, samlNamespaceAssertion, "Subject")
+	if subject == nil {
+		return errors.New("assertion does not contain a subject")
+	}
+	confirmed := false
+	for _, sc := range samlChildren(subject, samlNamespaceAssertion, "SubjectConfirmation") {
+		if samlAttr(sc, "Method") != samlConfirmationBearer {
+			continue
+		}
+		data := samlChild(sc, samlNamespaceAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		notOnOrAfter, err := parseSAMLTime(samlAttr(data, "NotOnOrAfter"))
+		if err != nil || notOnOrAfter.IsZero() || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			continue
+		}
+		if samlAttr(data, "Recipient") != acsURL {
+			continue
+		}
+		inResponseTo := samlAttr(data, "InResponseTo")
+		if inResponseTo != "" && inResponseTo != expectRequestID {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return errors.New("assertion does not contain a valid bearer subject confirmation")
+	}
+
+	// Validate the conditions
+	conditions := samlChild(assertion, samlNamespaceAssertion, "Conditions")
+	if conditions == nil {
+		return errors.New("assertion does not contain conditions")
+	}
+	notBefore, err := parseSAMLTime(samlAttr(conditions, "NotBefore"))
+	if err != nil {
+		return err
+	}
+	if !notBefore.IsZero() && now.Add(samlClockSkew).Before(notBefore) {
+		return errors.New("assertion is not yet valid")
+	}
+	notOnOrAfter, err := parseSAMLTime(samlAttr(conditions, "NotOnOrAfter"))
+	if err != nil {
+		return err
+	}
+	if !notOnOrAfter.IsZero() && !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+		return errors.New("assertion has expired")
+	}
+
+	// Each AudienceRestriction must include the entity ID of the Service Provider
+	restrictions := samlChildren(conditions, samlNamespaceAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("assertion does not contain an audience restriction")
+	}
+	for _, ar := range restrictions {
+		found := false
+		for _, aud := range samlChildren(ar, samlNamespaceAssertion, "Audience") {
+			if samlText(aud) == a.entityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("assertion audience does not include the Service Provider's entity ID")
+		}
+	}
+
+	return nil
+}
+
+func (a *SAML) profileFromAssertion(assertion *etree.Element) (*user.Profile, error) {
+	// Collect all attributes
+	attrs := map[string][]string{}
+	for _, stmt := range samlChildren(assertion, samlNamespaceAssertion, "AttributeStatement") {
+		for _, attr := range samlChildren(stmt, samlNamespaceAssertion, "Attribute") {
+			var values []string
+			for _, v := range samlChildren(attr, samlNamespaceAssertion, "AttributeValue") {
+				val := samlText(v)
+				if val != "" {
+					values = append(values, val)
+				}
+			}
+			for _, name := range []string{samlAttr(attr, "Name"), samlAttr(attr, "FriendlyName")} {
+				if name != "" {
+					attrs[name] = append(attrs[name], values...)
+				}
+			}
+		}
+	}
+	getAttr := func(configured string, defaults []string) []string {
+		if configured != "" {
+			return attrs[configured]
+		}
+		for _, name := range defaults {
+			if len(attrs[name]) > 0 {
+				return attrs[name]
+			}
+		}
+		return nil
+	}
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+	}
+
+	if a.attributes.ID != "" {
+		profile.ID = first(attrs[a.attributes.ID])
+	} else {
+		nameID := samlChild(samlChild(assertion, samlNamespaceAssertion, "Subject"), samlNamespaceAssertion, "NameID")
+		if nameID != nil {
+			profile.ID = samlText(nameID)
+		}
+	}
+	if profile.ID == "" {
+		return nil, errors.New("assertion does not contain the user ID")
+	}
+
+	profile.Name = user.ProfileName{
+		FullName: first(getAttr(a.attributes.Name, samlDefaultNameAttributes)),
+		First:    first(getAttr("", samlDefaultFirstNameAttributes)),
+		Last:     first(getAttr("", samlDefaultLastNameAttributes)),
+	}
+	profile.Name.PopulateFullName()
+
+	email := first(getAttr(a.attributes.Email, samlDefaultEmailAttributes))
+	if email != "" {
+		profile.Email = &user.ProfileEmail{
+			Value: email,
+		}
+	}
+
+	groups := getAttr(a.attributes.Groups, samlDefaultGroupsAttributes)
+	if len(groups) > 0 {
+		profile.Groups = slices.Clone(groups)
+	}
+
+	return profile, nil
+}
+
+// samlRequestID returns the ID of the AuthnRequest for the relay state.
+// IDs must start with a letter or underscore.
+func samlRequestID(relayState string) string {
+	h := sha256.Sum256([]byte("tfa-saml-request:" + relayState))
+	return "_" + hex.EncodeToString(h[:20])
+}
+
+// parseSAMLTime parses a time in the xs:dateTime format; an empty value returns a zero time
+func parseSAMLTime(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s': %w", val, err)
+	}
+	return t, nil
+}
+
+func fetchSAMLMetadata(ctx context.Context, metadataURL string, client *http.Client, timeout time.Duration) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request for IdP metadata: %w", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request IdP metadata: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to request IdP metadata: invalid response status code '%d'", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, samlMaxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IdP metadata: %w", err)
+	}
+	return data, nil
+}
+
+// parseSAMLIdPMetadata parses the metadata document of the Identity Provider
+// The document can contain an EntityDescriptor, or an EntitiesDescriptor with a single Identity Provider
+func parseSAMLIdPMetadata(data []byte) (res samlIdPMetadata, err error) {
+	root, err := parseSAMLXML(data)
+	if err != nil {
+		return res, err
+	}
+
+	var entities []*etree.Element
+	switch {
+	case samlIs(root, samlNamespaceMetadata, "EntityDescriptor"):
+		entities = []*etree.Element{root}
+	case samlIs(root, samlNamespaceMetadata, "EntitiesDescriptor"):
+		entities = samlChildren(root, samlNamespaceMetadata, "EntityDescriptor")
+	default:
+		return res, errors.New("document does not contain an EntityDescriptor")
+	}
+
+	var idpDescriptor *etree.Element
+	for _, ed := range entities {
+		d := samlChild(ed, samlNamespaceMetadata, "IDPSSODescriptor")
+		if d == nil {
+			continue
+		}
+		if idpDescriptor != nil {
+			return res, errors.New("document contains more than one identity provider")
+		}
+		idpDescriptor = d
+		res.entityID = samlAttr(ed, "entityID")
+	}
+	if idpDescriptor == nil {
+		return res, errors.New("document does not contain an IDPSSODescriptor")
+	}
+	if res.entityID == "" {
+		return res, errors.New("EntityDescriptor does not have an entityID")
+	}
+
+	for _, sso := range samlChildren(idpDescriptor, samlNamespaceMetadata, "SingleSignOnService") {
+		if samlAttr(sso, "Binding") == samlBindingRedirect {
+			res.ssoURL = samlAttr(sso, "Location")
+			break
+		}
+	}
+	if res.ssoURL == "" {
+		return res, errors.New("identity provider does not support the HTTP-Redirect binding for single sign-on")
+	}
+
+	for _, kd := range samlChildren(idpDescriptor, samlNamespaceMetadata, "KeyDescriptor") {
+		if samlAttr(kd, "use") == "encryption" {
+			continue
+		}
+		keyInfo := samlChild(kd, dsig.Namespace, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, x509Data := range samlChildren(keyInfo, dsig.Namespace, "X509Data") {
+			for _, certEl := range samlChildren(x509Data, dsig.Namespace, "X509Certificate") {
+				der, err := base64.StdEncoding.DecodeString(stripXMLWhitespace(samlText(certEl)))
+				if err != nil {
+					return res, fmt.Errorf("invalid signing certificate encoding: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return res, fmt.Errorf("invalid signing certificate: %w", err)
+				}
+				res.certs = append(res.certs, cert)
+			}
+		}
+	}
+	if len(res.certs) == 0 {
+		return res, errors.New("identity provider does not have any signing certificate")
+	}
+
+	return res, nil
+}
+
+// Compile-time interface assertion
+var _ SAMLProvider = &SAML{}
@@ -0,0 +1,464 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSAMLEntityID = "https://auth.example.com/saml"
+	testSAMLIdPID    = "https://idp.example.com/metadata"
+	testSAMLACSURL   = "https://auth.example.com/portals/main/saml/acs"
+)
+
+type testSAMLIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestSAMLIdP(t testing.TB) *testSAMLIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testSAMLIdP{key: key, cert: cert}
+}
+
+// Metadata returns the IdP metadata document, which lists the IdP's certificate after any additional one
+func (idp *testSAMLIdP) Metadata(additionalCerts ...*x509.Certificate) []byte {
+	keyDescriptors := ""
+	for _, cert := range append(additionalCerts, idp.cert) {
+		keyDescriptors += `
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data>
+          <ds:X509Certificate>` + base64.StdEncoding.EncodeToString(cert.Raw) + `</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>`
+	}
+
+	return []byte(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testSAMLIdPID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">` + keyDescriptors + `
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso?tenant=1"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`)
+}
+
+// Sign returns the XML document with an enveloped signature added to the element with the given ID
+func (idp *testSAMLIdP) Sign(t testing.TB, doc string, id string) string {
+	t.Helper()
+
+	root, err := parseSAMLXML([]byte(doc))
+	require.NoError(t, err)
+	el := root
+	if samlAttr(root, "ID") != id {
+		el = root.FindElement(".//[@ID='" + id + "']")
+	}
+	require.NotNil(t, el)
+
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	require.NoError(t, err)
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	require.NoError(t, err)
+
+	sc, err := dsig.NewSigningContext(idp.key, [][]byte{idp.cert.Raw})
+	require.NoError(t, err)
+	sc.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := sc.SignEnveloped(detached)
+	require.NoError(t, err)
+
+	if parent := el.Parent(); parent != nil {
+		parent.InsertChildAt(el.Index(), signed)
+		parent.RemoveChild(el)
+	} else {
+		root = signed
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(root)
+	res, err := out.WriteToString()
+	require.NoError(t, err)
+	return res
+}
+
+type testSAMLResponseOpts struct {
+	inResponseTo string
+	audience     string
+	recipient    string
+	notOnOrAfter time.Time
+	issuer       string
+	nameID       string
+}
+
+func newTestSAMLResponse(o testSAMLResponseOpts) string {
+	now := time.Now().UTC()
+	if o.audience == "" {
+		o.audience = testSAMLEntityID
+	}
+	if o.recipient == "" {
+		o.recipient = testSAMLACSURL
+	}
+	if o.notOnOrAfter.IsZero() {
+		o.notOnOrAfter = now.Add(5 * time.Minute)
+	}
+	if o.issuer == "" {
+		o.issuer = testSAMLIdPID
+	}
+	if o.nameID == "" {
+		o.nameID = "jdoe"
+	}
+
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_resp1" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `" Destination="` + testSAMLACSURL + `" InResponseTo="` + o.inResponseTo + `">` +
+		`<saml:Issuer>` + o.issuer + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		`<saml:Assertion xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="_assert1" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `">` +
+		`<saml:Issuer>` + o.issuer + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">` + o.nameID + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="` + o.inResponseTo + `" NotOnOrAfter="` + o.notOnOrAfter.Format(time.RFC3339) + `" Recipient="` + o.recipient + `"/></saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(time.RFC3339) + `" NotOnOrAfter="` + o.notOnOrAfter.Format(time.RFC3339) + `"><saml:AudienceRestriction><saml:Audience>` + o.audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"><saml:AttributeValue xsi:type="xs:string">jdoe@example.com</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="urn:oid:2.16.840.1.113730.3.1.241" FriendlyName="displayName"><saml:AttributeValue>Jane Doe</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="memberOf"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>users</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="employeeNumber"><saml:AttributeValue>12345</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement>` +
+		`</saml:Assertion></samlp:Response>`
+}
+
+func encodeTestSAMLResponse(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func TestSAML(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+
+	provider, err := NewSAML(t.Context(), NewSAMLOptions{
+		EntityID:    testSAMLEntityID,
+		IdPMetadata: idp.Metadata(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "saml", provider.GetProviderType())
+	assert.Equal(t, "https://idp.example.com/sso?tenant=1", provider.idp.ssoURL)
+
+	const relayState = "saml~state~nonce"
+	requestID := samlRequestID(relayState)
+
+	t.Run("metadata", func(t *testing.T) {
+		md, err := provider.SAMLMetadata(testSAMLACSURL)
+		require.NoError(t, err)
+
+		root, err := parseSAMLXML(md)
+		require.NoError(t, err)
+		require.True(t, samlIs(root, samlNamespaceMetadata, "EntityDescriptor"))
+		assert.Equal(t, testSAMLEntityID, samlAttr(root, "entityID"))
+		acs := samlChild(samlChild(root, samlNamespaceMetadata, "SPSSODescriptor"), samlNamespaceMetadata, "AssertionConsumerService")
+		require.NotNil(t, acs)
+		assert.Equal(t, samlBindingPOST, samlAttr(acs, "Binding"))
+		assert.Equal(t, testSAMLACSURL, samlAttr(acs, "Location"))
+	})
+
+	t.Run("AuthnRequest URL", func(t *testing.T) {
+		authURL, err := provider.SAMLAuthnRequestURL(relayState, testSAMLACSURL)
+		require.NoError(t, err)
+
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, "https://idp.example.com/sso", u.Scheme+"://"+u.Host+u.Path)
+		q := u.Query()
+		assert.Equal(t, "1", q.Get("tenant"))
+		assert.Equal(t, relayState, q.Get("RelayState"))
+
+		compressed, err := base64.StdEncoding.DecodeString(q.Get("SAMLRequest"))
+		require.NoError(t, err)
+		reqXML, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		require.NoError(t, err)
+
+		req, err := parseSAMLXML(reqXML)
+		require.NoError(t, err)
+		require.True(t, samlIs(req, samlNamespaceProtocol, "AuthnRequest"))
+		assert.Equal(t, requestID, samlAttr(req, "ID"))
+		assert.Equal(t, testSAMLACSURL, samlAttr(req, "AssertionConsumerServiceURL"))
+		assert.Equal(t, "https://idp.example.com/sso?tenant=1", samlAttr(req, "Destination"))
+		assert.Equal(t, testSAMLEntityID, samlText(samlChild(req, samlNamespaceAssertion, "Issuer")))
+	})
+
+	t.Run("signed assertion", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		profile, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.NoError(t, err)
+
+		assert.Equal(t, "saml", profile.Provider)
+		assert.Equal(t, "jdoe", profile.ID)
+		assert.Equal(t, "Jane Doe", profile.Name.FullName)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "jdoe@example.com", profile.Email.Value)
+		assert.Equal(t, []string{"admins", "users"}, profile.Groups)
+	})
+
+	t.Run("signed response", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_resp1")
+		profile, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.NoError(t, err)
+		assert.Equal(t, "jdoe", profile.ID)
+	})
+
+	t.Run("attribute mapping", func(t *testing.T) {
+		p := *provider
+		p.attributes = SAMLAttributeMapping{ID: "employeeNumber", Groups: "none"}
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		profile, err := p.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.NoError(t, err)
+		assert.Equal(t, "12345", profile.ID)
+		assert.Empty(t, profile.Groups)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		doc := newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID})
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "neither the response nor the assertion is signed")
+	})
+
+	t.Run("tampered assertion", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		doc = strings.Replace(doc, ">jdoe</saml:NameID>", ">admin</saml:NameID>", 1)
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "invalid assertion signature")
+	})
+
+	t.Run("SHA-1 digest", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		doc = strings.Replace(doc, "http://www.w3.org/2001/04/xmlenc#sha256", xmlDigestSHA1, 1)
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "SHA-1 digests are not supported")
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := newTestSAMLIdP(t)
+		doc := other.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "signature is not valid")
+	})
+
+	t.Run("signature wrapping", func(t *testing.T) {
+		signed := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		start := strings.Index(signed, "<saml:Assertion ")
+		end := strings.Index(signed, "</saml:Assertion>") + len("</saml:Assertion>")
+		signedAssertion := signed[start:end]
+
+		t.Run("assertion moved out of the signed reference", func(t *testing.T) {
+			// Move the signed assertion inside an extension and add an unsigned assertion
+			evil := strings.Replace(signedAssertion, ">jdoe</saml:NameID>", ">admin</saml:NameID>", 1)
+			evil = strings.Replace(evil, `ID="_assert1"`, `ID="_evil"`, 1)
+			doc := signed[:start] + `<samlp:Extensions>` + signedAssertion + `</samlp:Extensions>` + evil + signed[end:]
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "invalid assertion signature")
+		})
+
+		t.Run("duplicate ID", func(t *testing.T) {
+			// The evil assertion keeps the ID and the signature of the signed one, which is moved inside an extension
+			evil := strings.Replace(signedAssertion, ">jdoe</saml:NameID>", ">admin</saml:NameID>", 1)
+			doc := signed[:start] + `<samlp:Extensions>` + signedAssertion + `</samlp:Extensions>` + evil + signed[end:]
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "invalid assertion signature")
+		})
+
+		t.Run("duplicate assertions", func(t *testing.T) {
+			evil := strings.Replace(newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, nameID: "admin"}), "</samlp:Response>", "", 1)
+			evil = evil[strings.Index(evil, "<saml:Assertion "):]
+			doc := signed[:start] + evil + signed[start:]
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "exactly one assertion")
+		})
+
+		t.Run("signed assertion inside the signature", func(t *testing.T) {
+			// The evil assertion has the same ID, and the signed assertion is moved into an Object of its signature
+			evil := strings.Replace(signedAssertion, "</ds:Signature>", "<ds:Object>"+signedAssertion+"</ds:Object></ds:Signature>", 1)
+			evil = strings.Replace(evil, ">jdoe</saml:NameID>", ">admin</saml:NameID>", 1)
+			doc := signed[:start] + evil + signed[end:]
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "invalid assertion signature")
+		})
+
+		t.Run("signed response moved out of the signed reference", func(t *testing.T) {
+			// Wrap a signed response inside an unsigned one, which contains an unsigned assertion
+			signedRes := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_resp1")
+			evil := newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, nameID: "admin"})
+			evil = strings.Replace(evil, `ID="_resp1"`, `ID="_evil"`, 1)
+			evil = strings.Replace(evil, "<saml:Assertion ", `<samlp:Extensions>`+signedRes+`</samlp:Extensions><saml:Assertion `, 1)
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(evil), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "neither the response nor the assertion is signed")
+		})
+
+		t.Run("tampered signed response", func(t *testing.T) {
+			doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_resp1")
+			doc = strings.Replace(doc, ">jdoe</saml:NameID>", ">admin</saml:NameID>", 1)
+			_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+			require.ErrorContains(t, err, "invalid response signature")
+		})
+	})
+
+	t.Run("comment inside NameID", func(t *testing.T) {
+		// Comments are not covered by the signature, so they must not truncate the value
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, nameID: "admin@example.com.evil.com"}), "_assert1")
+		doc = strings.Replace(doc, ">admin@example.com.evil.com<", ">admin@example.com<!---->.evil.com<", 1)
+		profile, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.NoError(t, err)
+		assert.Equal(t, "admin@example.com.evil.com", profile.ID)
+	})
+
+	t.Run("multiple signing certificates", func(t *testing.T) {
+		other := newTestSAMLIdP(t)
+		p, err := NewSAML(t.Context(), NewSAMLOptions{
+			EntityID:    testSAMLEntityID,
+			IdPMetadata: idp.Metadata(other.cert),
+		})
+		require.NoError(t, err)
+		require.Len(t, p.idp.certs, 2)
+
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		profile, err := p.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.NoError(t, err)
+		assert.Equal(t, "jdoe", profile.ID)
+
+		doc = newTestSAMLIdP(t).Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1")
+		_, err = p.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "signature is not valid")
+	})
+
+	t.Run("wrong InResponseTo", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: samlRequestID("other")}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "not for the expected AuthnRequest")
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, audience: "https://other.example.com"}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "audience")
+	})
+
+	t.Run("wrong recipient", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, recipient: "https://other.example.com/acs"}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "bearer subject confirmation")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, notOnOrAfter: time.Now().Add(-10 * time.Minute)}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.Error(t, err)
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		doc := idp.Sign(t, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID, issuer: "https://evil.example.com"}), "_assert1")
+		_, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		require.ErrorContains(t, err, "issuer")
+	})
+}
+
+func TestNewSAMLInvalidOptions(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+
+	_, err := NewSAML(t.Context(), NewSAMLOptions{IdPMetadata: idp.Metadata()})
+	require.ErrorContains(t, err, "entityID")
+
+	_, err = NewSAML(t.Context(), NewSAMLOptions{EntityID: testSAMLEntityID})
+	require.ErrorContains(t, err, "IdP metadata")
+
+	_, err = NewSAML(t.Context(), NewSAMLOptions{
+		EntityID:    testSAMLEntityID,
+		IdPMetadata: []byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"><md:IDPSSODescriptor/></md:EntityDescriptor>`),
+	})
+	require.ErrorContains(t, err, "HTTP-Redirect")
+}
+
+func TestParseSAMLXML(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		root, err := parseSAMLXML([]byte(`<?xml version="1.0"?><!-- comment --><a:Root xmlns:a="urn:a"><a:Child x="1">text</a:Child></a:Root>`))
+		require.NoError(t, err)
+		require.True(t, samlIs(root, "urn:a", "Root"))
+		child := samlChild(root, "urn:a", "Child")
+		require.NotNil(t, child)
+		assert.Equal(t, "1", samlAttr(child, "x"))
+		assert.Equal(t, "text", samlText(child))
+		assert.Nil(t, root.Parent())
+	})
+
+	t.Run("DTD rejected", func(t *testing.T) {
+		_, err := parseSAMLXML([]byte(`<!DOCTYPE foo [<!ENTITY x "y">]><foo>&x;</foo>`))
+		require.Error(t, err)
+	})
+
+	t.Run("more than one root", func(t *testing.T) {
+		_, err := parseSAMLXML([]byte(`<foo/><bar/>`))
+		require.Error(t, err)
+	})
+
+	t.Run("no root", func(t *testing.T) {
+		_, err := parseSAMLXML([]byte(`<!-- comment -->`))
+		require.Error(t, err)
+	})
+
+	t.Run("does not round-trip", func(t *testing.T) {
+		_, err := parseSAMLXML([]byte(`<Root><x::Element></::Element></Root>`))
+		require.Error(t, err)
+	})
+}
+
+func FuzzSAMLValidateResponse(f *testing.F) {
+	idp := newTestSAMLIdP(f)
+	provider, err := NewSAML(f.Context(), NewSAMLOptions{
+		EntityID:    testSAMLEntityID,
+		IdPMetadata: idp.Metadata(),
+	})
+	require.NoError(f, err)
+
+	const relayState = "saml~state~nonce"
+	requestID := samlRequestID(relayState)
+	f.Add(idp.Sign(f, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_assert1"))
+	f.Add(idp.Sign(f, newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}), "_resp1"))
+	f.Add(newTestSAMLResponse(testSAMLResponseOpts{inResponseTo: requestID}))
+
+	f.Fuzz(func(t *testing.T, doc string) {
+		profile, err := provider.SAMLValidateResponse(encodeTestSAMLResponse(doc), relayState, testSAMLACSURL)
+		if err != nil {
+			return
+		}
+
+		// Any response that is accepted must contain the data signed by the IdP
+		assert.Equal(t, "jdoe", profile.ID)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "jdoe@example.com", profile.Email.Value)
+	})
+}
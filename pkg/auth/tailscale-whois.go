@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -175,7 +176,8 @@ func (a *TailscaleWhois) SeamlessAuth(r *http.Request) (*user.Profile, error) {
 			capValues, ok := info.CapMap[tailcfg.PeerCapability(capName)]
 			if ok && len(capValues) > 0 {
 				// Add with https:// prefix as the key
-				profile.AdditionalClaims["https://"+capName] = capValues
+				// Values are decoded so they have the same shape they have after being read from the session token, and nested properties can be referenced in conditions
+				profile.AdditionalClaims["https://"+capName] = decodeTailscaleCapValues(capValues)
 			}
 		}
 	}
@@ -238,6 +240,22 @@ func (a *TailscaleWhois) PopulateAdditionalClaims(token jwt.Token, setClaimFn fu
 	}
 }
 
+// decodeTailscaleCapValues decodes the JSON values of a peer capability
+// Values that can't be decoded are included as strings
+func decodeTailscaleCapValues(capValues []tailcfg.RawMessage) []any {
+	res := make([]any, len(capValues))
+	for i, v := range capValues {
+		var decoded any
+		err := json.Unmarshal([]byte(v), &decoded)
+		if err != nil {
+			res[i] = string(v)
+			continue
+		}
+		res[i] = decoded
+	}
+	return res
+}
+
 // Interface that covers tailscale.Client
 // Used for mocking in tests
 type tailscaleWhoIsClient interface {
@@ -259,3 +259,40 @@ func TestTailscaleWhoisValidateRequestClaimsMultiHopXFF(t *testing.T) {
 		})
 	}
 }
+
+func TestTailscaleWhoisSeamlessAuthCapabilities(t *testing.T) {
+	const sourceIP = "100.64.0.1"
+
+	provider, err := NewTailscaleWhois(NewTailscaleWhoisOptions{
+		CapabilityNames: []string{"example.com/cap/app"},
+		tsClient: &mockTailscaleWhoIsClient{
+			whoIsFn: func(_ context.Context, _ string) (*apitype.WhoIsResponse, error) {
+				return &apitype.WhoIsResponse{
+					Node: &tailcfg.Node{
+						Name:     "device-1.mytailnet.ts.net.",
+						Hostinfo: (&tailcfg.Hostinfo{}).View(),
+					},
+					UserProfile: &tailcfg.UserProfile{
+						LoginName: "alice@example.com",
+					},
+					CapMap: tailcfg.PeerCapMap{
+						"example.com/cap/app": []tailcfg.RawMessage{`{"role":"admin","envs":["prod"]}`},
+					},
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.Header.Set(headerXForwardedFor, sourceIP)
+
+	profile, err := provider.SeamlessAuth(req)
+	require.NoError(t, err)
+
+	// Values are decoded, so nested properties can be referenced with claim paths
+	assert.Equal(t, []any{
+		map[string]any{"role": "admin", "envs": []any{"prod"}},
+	}, profile.AdditionalClaims["https://example.com/cap/app"])
+	assert.Equal(t, "admin", profile.Get(`["https://example.com/cap/app"][0].role`))
+}
@@ -0,0 +1,119 @@
+//go:build unit
+
+package auth
+
+// This file is only built when the "unit" tag is set
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// TestCertificateAuthority is a CA that issues client certificates, for testing
+type TestCertificateAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// TestClientCertificate contains the properties of a client certificate issued by TestCertificateAuthority
+type TestClientCertificate struct {
+	CommonName          string
+	OrganizationalUnits []string
+	EmailAddresses      []string
+	URIs                []string
+	NotAfter            time.Time
+}
+
+// NewTestCertificateAuthority returns a new TestCertificateAuthority with a random key
+func NewTestCertificateAuthority(name string) *TestCertificateAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	return &TestCertificateAuthority{cert: cert, key: key}
+}
+
+// PEM returns the PEM-encoded certificate of the CA
+func (ca *TestCertificateAuthority) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// Issue returns a new client certificate signed by the CA
+func (ca *TestCertificateAuthority) Issue(props TestClientCertificate) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		panic(err)
+	}
+
+	notAfter := props.NotAfter
+	if notAfter.IsZero() {
+		notAfter = time.Now().Add(time.Hour)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         props.CommonName,
+			OrganizationalUnit: props.OrganizationalUnits,
+		},
+		EmailAddresses: props.EmailAddresses,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range props.URIs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			panic(err)
+		}
+		tpl.URIs = append(tpl.URIs, parsed)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert
+}
+
+// TraefikClientCertificateHeader returns the value of the header set by Traefik's PassTLSClientCert middleware for the certificate
+func TraefikClientCertificateHeader(cert *x509.Certificate) string {
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(cert.Raw))
+}
@@ -71,10 +71,32 @@ func (a *TestProviderOAuth2) OAuth2ExchangeCode(ctx context.Context, state strin
 	}
 
 	return OAuth2AccessToken{
-		Provider: a.GetProviderType(),
-		IDToken:  idToken, // Name of the user template
-		Expires:  time.Now().Add(time.Hour),
-		Scopes:   []string{"test"},
+		Provider:     a.GetProviderType(),
+		IDToken:      idToken, // Name of the user template
+		Expires:      time.Now().Add(time.Hour),
+		Scopes:       []string{"test"},
+		RefreshToken: "refresh~" + idToken,
+	}, nil
+}
+
+// OAuth2RefreshToken accepts refresh tokens in the format "refresh~<template>", where template is the name of a user template, as supported by getTestUserProfile
+// The refresh token "refresh~revoked-user" is rejected as if it had been revoked by the IdP
+func (a *TestProviderOAuth2) OAuth2RefreshToken(ctx context.Context, refreshToken string) (OAuth2AccessToken, error) {
+	template, ok := strings.CutPrefix(refreshToken, "refresh~")
+	if !ok || template == "" {
+		return OAuth2AccessToken{}, errors.New("invalid refresh token")
+	}
+
+	if template == "revoked-user" {
+		return OAuth2AccessToken{}, fmt.Errorf("%w: invalid_grant", ErrTokenRequestRejected)
+	}
+
+	return OAuth2AccessToken{
+		Provider:     a.GetProviderType(),
+		IDToken:      template,
+		Expires:      time.Now().Add(time.Hour),
+		Scopes:       []string{"test"},
+		RefreshToken: refreshToken,
 	}, nil
 }
 
@@ -86,6 +108,35 @@ func (a *TestProviderOAuth2) OAuth2RetrieveProfile(ctx context.Context, at OAuth
 	return profile, nil
 }
 
+// LogoutURL returns the URL of the fake IdP's end session endpoint
+func (a *TestProviderOAuth2) LogoutURL(idTokenHint string, postLogoutRedirectURI string) (string, error) {
+	params := url.Values{
+		"client_id":                []string{"test-client-id"},
+		"id_token_hint":            []string{idTokenHint},
+		"post_logout_redirect_uri": []string{postLogoutRedirectURI},
+	}
+
+	return "https://idp.example.com/oauth2/logout?" + params.Encode(), nil
+}
+
+// ValidateLogoutToken accepts logout tokens in the format "logout~<sub>~<sid>", where either sub or sid can be empty
+// Tokens in other formats are considered as issued for other providers
+func (a *TestProviderOAuth2) ValidateLogoutToken(ctx context.Context, logoutToken string) (LogoutTokenClaims, error) {
+	parts := strings.Split(logoutToken, "~")
+	if len(parts) != 3 || parts[0] != "logout" {
+		return LogoutTokenClaims{}, ErrLogoutTokenNotForProvider
+	}
+
+	if parts[1] == "" && parts[2] == "" {
+		return LogoutTokenClaims{}, errors.New("logout token must contain at least one of sub and sid")
+	}
+
+	return LogoutTokenClaims{
+		Subject:   parts[1],
+		SessionID: parts[2],
+	}, nil
+}
+
 // TestProviderSeamless is a test Provider that implements seamless auth
 type TestProviderSeamless struct {
 	baseProvider
@@ -124,10 +175,133 @@ func (a *TestProviderSeamless) SeamlessAuth(r *http.Request) (*user.Profile, err
 	return profile, nil
 }
 
+// TestProviderRequestAuth is a test Provider that authenticates each request
+type TestProviderRequestAuth struct {
+	baseProvider
+}
+
+func NewTestProviderRequestAuth() *TestProviderRequestAuth {
+	return &TestProviderRequestAuth{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Test Request Auth",
+				Name:        "testrequestauth",
+			},
+		},
+	}
+}
+
+func (a *TestProviderRequestAuth) GetProviderType() string {
+	return "testrequestauth"
+}
+
+func (a *TestProviderRequestAuth) AuthenticateRequest(r *http.Request) (*user.Profile, error) {
+	// This test provider uses the user passed as X-Request-User to authenticate, containing the template
+	template := r.Header.Get("X-Request-User")
+	if template == "" {
+		return nil, ErrNoCredentials
+	}
+
+	if template == "bad-user" {
+		return nil, errors.New("unauthorized")
+	}
+
+	profile := getTestUserProfile(template, a.GetProviderName())
+	if profile == nil {
+		return nil, fmt.Errorf("cannot find template for user '%s'", template)
+	}
+	return profile, nil
+}
+
+// TestProviderSAML is a test Provider that implements SAML with a fake IdP
+type TestProviderSAML struct {
+	baseProvider
+}
+
+func NewTestProviderSAML() *TestProviderSAML {
+	return &TestProviderSAML{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Test SAML",
+				Name:        "testsaml",
+			},
+		},
+	}
+}
+
+func (a *TestProviderSAML) GetProviderType() string {
+	return "testsaml"
+}
+
+func (a *TestProviderSAML) SAMLMetadata(acsURL string) ([]byte, error) {
+	return []byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="test-sp"><SPSSODescriptor><AssertionConsumerService Location="` + acsURL + `"/></SPSSODescriptor></EntityDescriptor>`), nil
+}
+
+func (a *TestProviderSAML) SAMLAuthnRequestURL(relayState string, acsURL string) (string, error) {
+	if relayState == "" {
+		return "", errors.New("parameter relayState is required")
+	}
+
+	params := url.Values{
+		"SAMLRequest": []string{"test-request~" + acsURL},
+		"RelayState":  []string{relayState},
+	}
+
+	return "https://idp.example.com/saml/sso?" + params.Encode(), nil
+}
+
+// SAMLValidateResponse accepts responses in the format "<template>~<acsURL>", where template is the name of a user template, as supported by getTestUserProfile
+func (a *TestProviderSAML) SAMLValidateResponse(samlResponse string, relayState string, acsURL string) (*user.Profile, error) {
+	template, responseACSURL, ok := strings.Cut(samlResponse, "~")
+	if !ok || responseACSURL != acsURL {
+		return nil, errors.New("invalid response")
+	}
+
+	profile := getTestUserProfile(template, a.GetProviderName())
+	if profile == nil {
+		return nil, fmt.Errorf("cannot find template for user '%s'", template)
+	}
+	return profile, nil
+}
+
+// TestProviderForm is a test Provider that implements form-based auth
+type TestProviderForm struct {
+	baseProvider
+}
+
+func NewTestProviderForm() *TestProviderForm {
+	return &TestProviderForm{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Test Form",
+				Name:        "testform",
+			},
+		},
+	}
+}
+
+func (a *TestProviderForm) GetProviderType() string {
+	return "testform"
+}
+
+// FormAuth uses the username as the name of a user template, as supported by getTestUserProfile, and accepts "password" as the only valid password
+func (a *TestProviderForm) FormAuth(ctx context.Context, username string, password string) (*user.Profile, error) {
+	profile := getTestUserProfile(username, a.GetProviderName())
+	if profile == nil || password != "password" {
+		return nil, ErrInvalidCredentials
+	}
+	return profile, nil
+}
+
 // Compile-time interface assertions
 var (
-	_ OAuth2Provider   = &TestProviderOAuth2{}
-	_ SeamlessProvider = &TestProviderSeamless{}
+	_ OAuth2Provider            = &TestProviderOAuth2{}
+	_ LogoutProvider            = &TestProviderOAuth2{}
+	_ BackchannelLogoutProvider = &TestProviderOAuth2{}
+	_ SeamlessProvider          = &TestProviderSeamless{}
+	_ RequestAuthProvider       = &TestProviderRequestAuth{}
+	_ SAMLProvider              = &TestProviderSAML{}
+	_ FormProvider              = &TestProviderForm{}
 )
 
 func getTestUserProfile(template string, provider string) *user.Profile {
@@ -0,0 +1,161 @@
+//go:build unit
+
+package auth
+
+// This file is only built when the "unit" tag is set
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// TestWebAuthnAuthenticator is a software authenticator that can be used to test WebAuthn ceremonies
+// It has a single ES256 credential, which is created by Register
+type TestWebAuthnAuthenticator struct {
+	// Signature counter, which is incremented at every sign-in
+	SignCount uint32
+	// ID of the credential
+	CredentialID []byte
+	// User handle the credential was registered for
+	UserHandle []byte
+	// If true, the authenticator doesn't set the "user verified" flag
+	NoUserVerification bool
+
+	key *ecdsa.PrivateKey
+}
+
+func NewTestWebAuthnAuthenticator() *TestWebAuthnAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	credID := make([]byte, 16)
+	_, _ = rand.Read(credID)
+
+	return &TestWebAuthnAuthenticator{
+		CredentialID: credID,
+		key:          key,
+	}
+}
+
+// Register creates the credential, responding to the options for navigator.credentials.create()
+func (a *TestWebAuthnAuthenticator) Register(optionsJSON []byte, origin string) (WebAuthnAttestation, error) {
+	var opts struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	err := json.Unmarshal(optionsJSON, &opts)
+	if err != nil {
+		return WebAuthnAttestation{}, err
+	}
+	a.UserHandle, err = base64.RawURLEncoding.DecodeString(opts.User.ID)
+	if err != nil {
+		return WebAuthnAttestation{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	pub, err := a.key.PublicKey.Bytes()
+	if err != nil {
+		return WebAuthnAttestation{}, err
+	}
+	coseKey, err := cbor.Marshal(map[int]any{
+		1:  webauthncose.EllipticKey,
+		3:  webauthncose.AlgES256,
+		-1: webauthncose.P256,
+		-2: pub[1:33],
+		-3: pub[33:65],
+	})
+	if err != nil {
+		return WebAuthnAttestation{}, err
+	}
+
+	// Attested credential data: AAGUID (all zeros), credential ID length, credential ID, and public key
+	authData := a.authData(opts.RP.ID, protocol.FlagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID))) //nolint:gosec
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, coseKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return WebAuthnAttestation{}, err
+	}
+
+	return WebAuthnAttestation{
+		ClientDataJSON:    testWebAuthnClientData("webauthn.create", opts.Challenge, origin),
+		AttestationObject: attestationObject,
+	}, nil
+}
+
+// Login signs in with the credential, responding to the options for navigator.credentials.get()
+func (a *TestWebAuthnAuthenticator) Login(optionsJSON []byte, origin string) (WebAuthnAssertion, error) {
+	var opts struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+	}
+	err := json.Unmarshal(optionsJSON, &opts)
+	if err != nil {
+		return WebAuthnAssertion{}, err
+	}
+
+	a.SignCount++
+	authData := a.authData(opts.RPID, 0)
+	clientDataJSON := testWebAuthnClientData("webauthn.get", opts.Challenge, origin)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return WebAuthnAssertion{}, err
+	}
+
+	return WebAuthnAssertion{
+		CredentialID:      a.CredentialID,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         sig,
+		UserHandle:        a.UserHandle,
+	}, nil
+}
+
+func (a *TestWebAuthnAuthenticator) authData(rpID string, flags protocol.AuthenticatorFlags) []byte {
+	flags |= protocol.FlagUserPresent
+	if !a.NoUserVerification {
+		flags |= protocol.FlagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := make([]byte, 0, 37)
+	authData = append(authData, rpIDHash[:]...)
+	authData = append(authData, byte(flags))
+	authData = binary.BigEndian.AppendUint32(authData, a.SignCount)
+	return authData
+}
+
+func testWebAuthnClientData(typ string, challenge string, origin string) []byte {
+	cd, _ := json.Marshal(protocol.CollectedClientData{
+		Type:      protocol.CeremonyType(typ),
+		Challenge: challenge,
+		Origin:    origin,
+	})
+	return cd
+}
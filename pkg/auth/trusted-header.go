@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/lestrrat-go/jwx/v4/jwt"
+	"github.com/lestrrat-go/jwx/v4/jwt/openid"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+// TrustedHeader is a Provider that authenticates users with the identity asserted by another authenticating proxy in front of the application, such as Cloudflare Access or a SSO gateway.
+// The identity is read from a header containing a signed JWT, which is verified against a JWKS, or from plain headers that are accepted from trusted proxies only.
+type TrustedHeader struct {
+	baseProvider
+
+	jwtHeader      string
+	tokenIssuer    string
+	tokenAudience  string
+	jwks           *jwksFetcher
+	userHeader     string
+	nameHeader     string
+	emailHeader    string
+	groupsHeader   string
+	trustedProxies []netip.Prefix
+
+	httpClient *http.Client
+}
+
+// NewTrustedHeaderOptions is the options for NewTrustedHeader
+type NewTrustedHeaderOptions struct {
+	// Name of the header containing a signed JWT with the user's identity, such as "Cf-Access-Jwt-Assertion"
+	// Exactly one of JWTHeader and UserHeader must be set
+	JWTHeader string
+	// URL of the JWKS containing the keys used to verify the JWT
+	// Required when JWTHeader is set
+	JWKSURL string
+	// Expected value for the "iss" claim of the JWT
+	// If empty, the issuer is not validated
+	TokenIssuer string
+	// Expected value for the "aud" claim of the JWT
+	// Required when JWTHeader is set
+	TokenAudience string
+
+	// Name of the header containing the user ID
+	// Exactly one of JWTHeader and UserHeader must be set
+	UserHeader string
+	// Name of the header containing the user's full name
+	NameHeader string
+	// Name of the header containing the user's email address
+	EmailHeader string
+	// Name of the header containing the user's groups, as a comma-separated list
+	GroupsHeader string
+
+	// List of IP ranges, in CIDR notation, of the proxies that are allowed to set the headers
+	// Required when UserHeader is set, and optional when JWTHeader is set
+	TrustedProxies []string
+
+	// Skip validating TLS certificates when connecting to the JWKS URL
+	TLSSkipVerify bool
+	// Optional PEM-encoded CA certificate to trust when connecting to the JWKS URL
+	TLSCACertificate []byte
+	// Request timeout for fetching the JWKS
+	// Defaults to 10s
+	RequestTimeout time.Duration
+}
+
+// NewTrustedHeader returns a new TrustedHeader provider
+func NewTrustedHeader(opts NewTrustedHeaderOptions) (*TrustedHeader, error) {
+	a := &TrustedHeader{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Trusted header",
+				Name:        "trustedheader",
+				Color:       "slate",
+			},
+		},
+		jwtHeader:     opts.JWTHeader,
+		tokenIssuer:   opts.TokenIssuer,
+		tokenAudience: opts.TokenAudience,
+		userHeader:    opts.UserHeader,
+		nameHeader:    opts.NameHeader,
+		emailHeader:   opts.EmailHeader,
+		groupsHeader:  opts.GroupsHeader,
+		httpClient:    newProviderHTTPClient(opts.TLSSkipVerify, opts.TLSCACertificate),
+	}
+
+	var err error
+	a.trustedProxies, err = parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.jwtHeader != "" && a.userHeader != "":
+		return nil, errors.New("only one of the JWT header and the user header can be set")
+	case a.jwtHeader != "":
+		if a.nameHeader != "" || a.emailHeader != "" || a.groupsHeader != "" {
+			return nil, errors.New("the name, email, and groups headers can only be set when the user header is set")
+		}
+		if opts.JWKSURL == "" {
+			return nil, errors.New("the JWKS URL is required when the JWT header is set")
+		}
+		if a.tokenAudience == "" {
+			return nil, errors.New("the token audience is required when the JWT header is set")
+		}
+		a.jwks, err = newJWKSFetcher(opts.JWKSURL, a.GetHTTPClient, opts.RequestTimeout)
+		if err != nil {
+			return nil, err
+		}
+	case a.userHeader != "":
+		// Plain headers are not signed, so they must come from a trusted proxy
+		if len(a.trustedProxies) == 0 {
+			return nil, errors.New("at least one trusted proxy is required when the user header is set")
+		}
+	default:
+		return nil, errors.New("one of the JWT header and the user header is required")
+	}
+
+	return a, nil
+}
+
+func (a *TrustedHeader) GetProviderType() string {
+	return "trustedheader"
+}
+
+func (a *TrustedHeader) GetHTTPClient() *http.Client {
+	return a.httpClient
+}
+
+func (a *TrustedHeader) SeamlessAuth(r *http.Request) (*user.Profile, error) {
+	header := a.userHeader
+	if a.jwtHeader != "" {
+		header = a.jwtHeader
+	}
+
+	val := r.Header.Get(header)
+	if val == "" {
+		return nil, fmt.Errorf("request does not contain the header '%s'", header)
+	}
+
+	if len(a.trustedProxies) > 0 && !isTrustedProxy(a.trustedProxies, r.RemoteAddr) {
+		return nil, fmt.Errorf("header '%s' was sent by '%s', which is not a trusted proxy", header, r.RemoteAddr)
+	}
+
+	if a.jwtHeader != "" {
+		return a.profileFromJWT(r, val)
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+		ID:       val,
+	}
+	if a.nameHeader != "" {
+		profile.Name.FullName = r.Header.Get(a.nameHeader)
+	}
+	if a.emailHeader != "" {
+		email := r.Header.Get(a.emailHeader)
+		if email != "" {
+			profile.Email = &user.ProfileEmail{
+				Value: email,
+			}
+		}
+	}
+	if a.groupsHeader != "" {
+		for g := range strings.SplitSeq(r.Header.Get(a.groupsHeader), ",") {
+			g = strings.TrimSpace(g)
+			if g != "" {
+				profile.Groups = append(profile.Groups, g)
+			}
+		}
+	}
+
+	return profile, nil
+}
+
+func (a *TrustedHeader) profileFromJWT(r *http.Request, val string) (*user.Profile, error) {
+	set, err := a.jwks.Get(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS for token verification: %w", err)
+	}
+
+	parseOpts := []jwt.ParseOption{
+		jwt.WithKeySet(set, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithAudience(a.tokenAudience),
+		jwt.WithAcceptableSkew(idTokenClockSkew),
+		// Tokens without an expiration would be valid forever if leaked
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithToken(openid.New()),
+	}
+	if a.tokenIssuer != "" {
+		parseOpts = append(parseOpts, jwt.WithIssuer(a.tokenIssuer))
+	}
+	token, err := jwt.Parse([]byte(val), parseOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token in header '%s': %w", a.jwtHeader, err)
+	}
+	oidToken, ok := token.(openid.Token)
+	if !ok {
+		return nil, errors.New("failed to parse token: included claims cannot be cast to openid.Token")
+	}
+
+	profile, err := user.NewProfileFromOpenIDToken(oidToken, a.GetProviderName())
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims in token: %w", err)
+	}
+
+	return profile, nil
+}
+
+func (a *TrustedHeader) ValidateRequestClaims(r *http.Request, profile *user.Profile) error {
+	// The upstream proxy asserts the identity on every request, so we need to make sure it still matches the user the session was created for
+	current, err := a.SeamlessAuth(r)
+	if err != nil {
+		return err
+	}
+
+	if current.ID != profile.ID {
+		return fmt.Errorf("token was issued for user '%s', but the upstream proxy asserted user '%s'", profile.ID, current.ID)
+	}
+
+	return nil
+}
+
+// Compile-time interface assertion
+var _ SeamlessProvider = &TrustedHeader{}
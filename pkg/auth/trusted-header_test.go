@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTrustedHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   NewTrustedHeaderOptions
+		errMsg string
+	}{
+		{name: "JWT header", opts: NewTrustedHeaderOptions{JWTHeader: "Cf-Access-Jwt-Assertion", JWKSURL: "https://example.com/certs", TokenAudience: "aud"}},
+		{name: "user header", opts: NewTrustedHeaderOptions{UserHeader: "X-Forwarded-User", TrustedProxies: []string{"10.0.0.0/8"}}},
+		{name: "no header", opts: NewTrustedHeaderOptions{}, errMsg: "one of the JWT header and the user header is required"},
+		{name: "both headers", opts: NewTrustedHeaderOptions{JWTHeader: "X-Jwt", UserHeader: "X-User"}, errMsg: "only one of the JWT header and the user header"},
+		{name: "JWT header without JWKS URL", opts: NewTrustedHeaderOptions{JWTHeader: "X-Jwt", TokenAudience: "aud"}, errMsg: "JWKS URL is required"},
+		{name: "JWT header without audience", opts: NewTrustedHeaderOptions{JWTHeader: "X-Jwt", JWKSURL: "https://example.com/certs"}, errMsg: "token audience is required"},
+		{name: "JWT header with invalid JWKS URL", opts: NewTrustedHeaderOptions{JWTHeader: "X-Jwt", JWKSURL: "ftp://example.com/certs", TokenAudience: "aud"}, errMsg: "scheme must be http or https"},
+		{name: "JWT header with user headers", opts: NewTrustedHeaderOptions{JWTHeader: "X-Jwt", JWKSURL: "https://example.com/certs", TokenAudience: "aud", EmailHeader: "X-Email"}, errMsg: "can only be set when the user header is set"},
+		{name: "user header without trusted proxies", opts: NewTrustedHeaderOptions{UserHeader: "X-User"}, errMsg: "at least one trusted proxy is required"},
+		{name: "invalid trusted proxy", opts: NewTrustedHeaderOptions{UserHeader: "X-User", TrustedProxies: []string{"nope"}}, errMsg: "invalid trusted proxy 'nope'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewTrustedHeader(tt.opts)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "trustedheader", p.GetProviderType())
+			assert.Equal(t, "trustedheader", p.GetProviderName())
+		})
+	}
+}
+
+func TestTrustedHeaderPlainHeaders(t *testing.T) {
+	p, err := NewTrustedHeader(NewTrustedHeaderOptions{
+		UserHeader:     "X-Forwarded-User",
+		NameHeader:     "X-Forwarded-Name",
+		EmailHeader:    "X-Forwarded-Email",
+		GroupsHeader:   "X-Forwarded-Groups",
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	require.NoError(t, err)
+
+	newRequest := func(remoteAddr string, userID string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req.Header.Set("X-Forwarded-User", userID)
+			req.Header.Set("X-Forwarded-Name", "Alice Smith")
+			req.Header.Set("X-Forwarded-Email", "alice@example.com")
+			req.Header.Set("X-Forwarded-Groups", "admins, engineering,")
+		}
+		return req
+	}
+
+	t.Run("request from trusted proxy", func(t *testing.T) {
+		profile, err := p.SeamlessAuth(newRequest("10.1.2.3:1234", "alice"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "trustedheader", profile.Provider)
+		assert.Equal(t, "alice", profile.ID)
+		assert.Equal(t, "Alice Smith", profile.Name.FullName)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "alice@example.com", profile.Email.Value)
+		assert.Equal(t, []string{"admins", "engineering"}, profile.Groups)
+	})
+
+	t.Run("request from untrusted client", func(t *testing.T) {
+		_, err := p.SeamlessAuth(newRequest("192.168.1.1:1234", "alice"))
+		require.ErrorContains(t, err, "not a trusted proxy")
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		_, err := p.SeamlessAuth(newRequest("10.1.2.3:1234", ""))
+		require.ErrorContains(t, err, "request does not contain the header 'X-Forwarded-User'")
+	})
+
+	t.Run("validate request claims", func(t *testing.T) {
+		profile, err := p.SeamlessAuth(newRequest("10.1.2.3:1234", "alice"))
+		require.NoError(t, err)
+
+		require.NoError(t, p.ValidateRequestClaims(newRequest("10.1.2.3:1234", "alice"), profile))
+
+		err = p.ValidateRequestClaims(newRequest("10.1.2.3:1234", "bob"), profile)
+		require.ErrorContains(t, err, "upstream proxy asserted user 'bob'")
+
+		err = p.ValidateRequestClaims(newRequest("10.1.2.3:1234", ""), profile)
+		require.ErrorContains(t, err, "request does not contain the header")
+
+		err = p.ValidateRequestClaims(newRequest("192.168.1.1:1234", "alice"), profile)
+		require.ErrorContains(t, err, "not a trusted proxy")
+	})
+}
+
+func TestTrustedHeaderJWT(t *testing.T) {
+	key := newTestSigningKey(t)
+
+	newProvider := func(t *testing.T, opts NewTrustedHeaderOptions) *TrustedHeader {
+		t.Helper()
+		opts.JWTHeader = "Cf-Access-Jwt-Assertion"
+		opts.JWKSURL = "https://myteam.cloudflareaccess.com/cdn-cgi/access/certs"
+		opts.TokenIssuer = "https://myteam.cloudflareaccess.com"
+		opts.TokenAudience = "my-app"
+		p, err := NewTrustedHeader(opts)
+		require.NoError(t, err)
+
+		p.httpClient = &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/cdn-cgi/access/certs", r.URL.Path)
+				return key.serveJWKS(), nil
+			}),
+		}
+		return p
+	}
+
+	validClaims := func(sub string) map[string]any {
+		return map[string]any{
+			"iss":   "https://myteam.cloudflareaccess.com",
+			"aud":   []string{"my-app"},
+			"sub":   sub,
+			"email": "alice@example.com",
+			"iat":   time.Now().Add(-time.Minute).Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	newRequest := func(remoteAddr string, token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Cf-Access-Jwt-Assertion", token)
+		}
+		return req
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		p := newProvider(t, NewTrustedHeaderOptions{})
+
+		profile, err := p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, validClaims("alice-id"))))
+		require.NoError(t, err)
+		assert.Equal(t, "trustedheader", profile.Provider)
+		assert.Equal(t, "alice-id", profile.ID)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "alice@example.com", profile.Email.Value)
+	})
+
+	t.Run("token from trusted proxy only", func(t *testing.T) {
+		p := newProvider(t, NewTrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+		token := key.SignClaims(t, validClaims("alice-id"))
+
+		_, err := p.SeamlessAuth(newRequest("10.1.2.3:1234", token))
+		require.NoError(t, err)
+
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", token))
+		require.ErrorContains(t, err, "not a trusted proxy")
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		p := newProvider(t, NewTrustedHeaderOptions{})
+
+		wrongAudience := validClaims("alice-id")
+		wrongAudience["aud"] = []string{"other-app"}
+		_, err := p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, wrongAudience)))
+		require.ErrorContains(t, err, "failed to parse token in header 'Cf-Access-Jwt-Assertion'")
+
+		wrongIssuer := validClaims("alice-id")
+		wrongIssuer["iss"] = "https://other.cloudflareaccess.com"
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, wrongIssuer)))
+		require.ErrorContains(t, err, "failed to parse token")
+
+		expired := validClaims("alice-id")
+		expired["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, expired)))
+		require.ErrorContains(t, err, "failed to parse token")
+
+		noExpiration := validClaims("alice-id")
+		delete(noExpiration, "exp")
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, noExpiration)))
+		require.ErrorContains(t, err, "failed to parse token")
+		require.ErrorContains(t, err, "exp")
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", signClaimsWithKey(t, otherKey, validClaims("alice-id"))))
+		require.ErrorContains(t, err, "failed to parse token")
+
+		unsigned, err := buildUnsignedJWT(validClaims("alice-id"))
+		require.NoError(t, err)
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", unsigned))
+		require.ErrorContains(t, err, "failed to parse token")
+
+		_, err = p.SeamlessAuth(newRequest("192.168.1.1:1234", ""))
+		require.ErrorContains(t, err, "request does not contain the header 'Cf-Access-Jwt-Assertion'")
+	})
+
+	t.Run("validate request claims", func(t *testing.T) {
+		p := newProvider(t, NewTrustedHeaderOptions{})
+
+		profile, err := p.SeamlessAuth(newRequest("192.168.1.1:1234", key.SignClaims(t, validClaims("alice-id"))))
+		require.NoError(t, err)
+
+		// A new token for the same user is accepted
+		err = p.ValidateRequestClaims(newRequest("192.168.1.1:1234", key.SignClaims(t, validClaims("alice-id"))), profile)
+		require.NoError(t, err)
+
+		err = p.ValidateRequestClaims(newRequest("192.168.1.1:1234", key.SignClaims(t, validClaims("bob-id"))), profile)
+		require.ErrorContains(t, err, "upstream proxy asserted user 'bob-id'")
+
+		err = p.ValidateRequestClaims(newRequest("192.168.1.1:1234", ""), profile)
+		require.ErrorContains(t, err, "request does not contain the header")
+	})
+}
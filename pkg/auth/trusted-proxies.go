@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// parseTrustedProxies parses a list of IP ranges in CIDR notation
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	res := make([]netip.Prefix, len(list))
+	for i, v := range list {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", v, err)
+		}
+		res[i] = prefix.Masked()
+	}
+	return res, nil
+}
+
+// isTrustedProxy returns true if the remote address of a request, which includes the port, is in one of the trusted IP ranges
+func isTrustedProxy(trustedProxies []netip.Prefix, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
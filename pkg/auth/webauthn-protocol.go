@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// This file contains helpers for working with the WebAuthn protocol.
+// Responses from authenticators are parsed and verified with go-webauthn, while the ceremonies and the storage of credentials are implemented by the provider.
+
+// Minimum length of the modulus of RS256 keys, in bytes
+const webAuthnMinRSAModulusLength = 256
+
+// webAuthnCredentialParams contains the algorithms supported for credentials' public keys
+var webAuthnCredentialParams = []protocol.CredentialParameter{
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256},
+}
+
+// parseWebAuthnAssertion parses the response of the authenticator to a sign-in request
+func parseWebAuthnAssertion(assertion WebAuthnAssertion) (*protocol.ParsedCredentialAssertionData, error) {
+	credentialID := protocol.URLEncodedBase64(assertion.CredentialID)
+	car := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: protocol.PublicKeyCredential{
+			Credential: protocol.Credential{
+				ID:   credentialID.String(),
+				Type: string(protocol.PublicKeyCredentialType),
+			},
+			RawID: credentialID,
+		},
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{
+				ClientDataJSON: assertion.ClientDataJSON,
+			},
+			AuthenticatorData: assertion.AuthenticatorData,
+			Signature:         assertion.Signature,
+			UserHandle:        assertion.UserHandle,
+		},
+	}
+	return car.Parse()
+}
+
+// parseWebAuthnAttestation parses the response of the authenticator to a registration request
+func parseWebAuthnAttestation(attestation WebAuthnAttestation) (*protocol.ParsedAttestationResponse, error) {
+	ar := protocol.AuthenticatorAttestationResponse{
+		AuthenticatorResponse: protocol.AuthenticatorResponse{
+			ClientDataJSON: attestation.ClientDataJSON,
+		},
+		AttestationObject: attestation.AttestationObject,
+	}
+	return ar.Parse()
+}
+
+// checkWebAuthnPublicKey checks that a COSE-encoded public key can be used to verify assertions
+// In addition to the checks performed by go-webauthn, RS256 keys must have a modulus of at least 2048 bits
+func checkWebAuthnPublicKey(coseKey []byte) error {
+	key, err := webauthncose.ParsePublicKey(coseKey)
+	if err != nil {
+		return fmt.Errorf("invalid credential public key: %w", err)
+	}
+	rsaKey, ok := key.(webauthncose.RSAPublicKeyData)
+	if ok && len(rsaKey.Modulus) < webAuthnMinRSAModulusLength {
+		return errors.New("invalid RS256 key: modulus must be at least 2048 bits")
+	}
+	return nil
+}
+
+// webAuthnVerifyError returns an error wrapping ErrInvalidCredentials for an error returned by go-webauthn
+// The library's errors contain the details about why verification failed in the "DevInfo" field and in the wrapped errors, so they're included in the message
+func webAuthnVerifyError(err error) error {
+	msg := err.Error()
+	var pErr *protocol.Error
+	for errors.As(err, &pErr) {
+		if pErr.DevInfo != "" {
+			msg += ": " + pErr.DevInfo
+		}
+		if pErr.Err == nil {
+			break
+		}
+		msg += ": " + pErr.Err.Error()
+		err = pErr.Err
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, msg)
+}
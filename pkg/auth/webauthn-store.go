@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	webAuthnUsersBucket       = []byte("users")
+	webAuthnCredentialsBucket = []byte("credentials")
+	webAuthnInvitesBucket     = []byte("invites")
+)
+
+// ErrWebAuthnNotFound is returned when a WebAuthn user or invite doesn't exist
+var ErrWebAuthnNotFound = errors.New("not found")
+
+// WebAuthnUser is a user who can register passkeys with a WebAuthn provider.
+type WebAuthnUser struct {
+	// ID of the user
+	ID string `json:"id"`
+	// Full name of the user
+	Name string `json:"name,omitempty"`
+	// Email address of the user
+	Email string `json:"email,omitempty"`
+	// True if the email address was verified
+	EmailVerified bool `json:"emailVerified,omitempty"`
+	// List of groups the user belongs to
+	Groups []string `json:"groups,omitempty"`
+}
+
+// webAuthnStoredUser is a user saved in the store
+type webAuthnStoredUser struct {
+	WebAuthnUser
+
+	// Random user handle, which is stored by authenticators in place of the user ID
+	Handle []byte `json:"handle"`
+	// Name of the provider the user was signed in with when they registered their first passkey, or "invite" if they used an invite
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// webAuthnCredential is a credential saved in the store
+type webAuthnCredential struct {
+	ID         []byte    `json:"id"`
+	UserID     string    `json:"userId"`
+	PublicKey  []byte    `json:"publicKey"`
+	SignCount  uint32    `json:"signCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitzero"`
+}
+
+// webAuthnInvite is an invite saved in the store
+type webAuthnInvite struct {
+	User      WebAuthnUser `json:"user"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+}
+
+// webAuthnStore keeps users, credentials, and invites for a WebAuthn provider in an embedded database on disk, using bbolt.
+type webAuthnStore struct {
+	db *bolt.DB
+}
+
+func newWebAuthnStore(path string) (*webAuthnStore, error) {
+	// The timeout prevents blocking forever if another process has the database open
+	db, err := bolt.Open(path, 0o600, &bolt.Options{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WebAuthn credentials database '%s': %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{webAuthnUsersBucket, webAuthnCredentialsBucket, webAuthnInvitesBucket} {
+			_, bErr := tx.CreateBucketIfNotExists(b)
+			if bErr != nil {
+				return bErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize WebAuthn credentials database: %w", err)
+	}
+
+	return &webAuthnStore{db: db}, nil
+}
+
+func (s *webAuthnStore) Close() error {
+	return s.db.Close()
+}
+
+// GetUser returns a user by ID
+func (s *webAuthnStore) GetUser(id string) (u webAuthnStoredUser, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(webAuthnUsersBucket), []byte(id), &u)
+	})
+	return u, err
+}
+
+// GetCredential returns a credential by ID
+func (s *webAuthnStore) GetCredential(id []byte) (cred webAuthnCredential, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(webAuthnCredentialsBucket), id, &cred)
+	})
+	return cred, err
+}
+
+// ListCredentialIDs returns the IDs of all credentials for a user
+func (s *webAuthnStore) ListCredentialIDs(userID string) ([][]byte, error) {
+	res := make([][]byte, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webAuthnCredentialsBucket).ForEach(func(k []byte, v []byte) error {
+			var cred webAuthnCredential
+			if json.Unmarshal(v, &cred) == nil && cred.UserID == userID {
+				res = append(res, append([]byte(nil), k...))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AddCredential saves a new credential, and creates or updates the user it belongs to
+// If the invite token hash is not empty, the invite is deleted in the same transaction; it's an error if the invite doesn't exist anymore
+func (s *webAuthnStore) AddCredential(u webAuthnStoredUser, cred webAuthnCredential, inviteHash []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if len(inviteHash) > 0 {
+			invites := tx.Bucket(webAuthnInvitesBucket)
+			if invites.Get(inviteHash) == nil {
+				return errors.New("invite has already been used")
+			}
+			err := invites.Delete(inviteHash)
+			if err != nil {
+				return err
+			}
+		}
+
+		creds := tx.Bucket(webAuthnCredentialsBucket)
+		if creds.Get(cred.ID) != nil {
+			return errors.New("credential is already registered")
+		}
+		err := putJSON(creds, cred.ID, cred)
+		if err != nil {
+			return err
+		}
+
+		return putJSON(tx.Bucket(webAuthnUsersBucket), []byte(u.ID), u)
+	})
+}
+
+// UpdateCredentialUsage updates the signature counter and the last use time of a credential
+func (s *webAuthnStore) UpdateCredentialUsage(id []byte, signCount uint32, lastUsedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webAuthnCredentialsBucket)
+		var cred webAuthnCredential
+		err := getJSON(bucket, id, &cred)
+		if err != nil {
+			return err
+		}
+		cred.SignCount = signCount
+		cred.LastUsedAt = lastUsedAt
+		return putJSON(bucket, id, cred)
+	})
+}
+
+// DeleteUser deletes a user and all their credentials, returning the number of credentials deleted
+func (s *webAuthnStore) DeleteUser(userID string) (n int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(webAuthnUsersBucket)
+		if users.Get([]byte(userID)) == nil {
+			return ErrWebAuthnNotFound
+		}
+
+		creds := tx.Bucket(webAuthnCredentialsBucket)
+
+		// Keys cannot be deleted while iterating with ForEach, so we collect them first
+		keys := make([][]byte, 0)
+		fErr := creds.ForEach(func(k []byte, v []byte) error {
+			var cred webAuthnCredential
+			if json.Unmarshal(v, &cred) == nil && cred.UserID == userID {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if fErr != nil {
+			return fErr
+		}
+		for _, k := range keys {
+			dErr := creds.Delete(k)
+			if dErr != nil {
+				return dErr
+			}
+		}
+		n = len(keys)
+
+		return users.Delete([]byte(userID))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// PutInvite saves an invite, also removing expired ones
+func (s *webAuthnStore) PutInvite(hash []byte, invite webAuthnInvite) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webAuthnInvitesBucket)
+
+		keys := make([][]byte, 0)
+		fErr := bucket.ForEach(func(k []byte, v []byte) error {
+			var i webAuthnInvite
+			if json.Unmarshal(v, &i) != nil || !i.ExpiresAt.After(now) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if fErr != nil {
+			return fErr
+		}
+		for _, k := range keys {
+			dErr := bucket.Delete(k)
+			if dErr != nil {
+				return dErr
+			}
+		}
+
+		return putJSON(bucket, hash, invite)
+	})
+}
+
+// GetInvite returns an invite that hasn't expired
+func (s *webAuthnStore) GetInvite(hash []byte) (invite webAuthnInvite, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(webAuthnInvitesBucket), hash, &invite)
+	})
+	if err != nil {
+		return webAuthnInvite{}, err
+	}
+	if !invite.ExpiresAt.After(time.Now()) {
+		return webAuthnInvite{}, ErrWebAuthnNotFound
+	}
+	return invite, nil
+}
+
+func getJSON(bucket *bolt.Bucket, key []byte, dest any) error {
+	val := bucket.Get(key)
+	if val == nil {
+		return ErrWebAuthnNotFound
+	}
+	return json.Unmarshal(val, dest)
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, val any) error {
+	enc, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, enc)
+}
@@ -0,0 +1,463 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/italypaleale/go-kit/ttlcache"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	// Timeout for WebAuthn ceremonies, which is also how long pending registrations are kept
+	webAuthnCeremonyTimeout = 5 * time.Minute
+	// Source for users who registered with an invite
+	webAuthnSourceInvite = "invite"
+)
+
+// WebAuthn manages authentication with passkeys, using the WebAuthn protocol.
+// Users register passkeys after signing in with another provider or with an invite created with the admin API, and the credentials are stored in an embedded database.
+type WebAuthn struct {
+	baseProvider
+
+	rpID                    string
+	userVerification        string
+	inviteLifetime          time.Duration
+	store                   *webAuthnStore
+	pendingLock             sync.Mutex
+	pendingRegistrations    *ttlcache.Cache[string, webAuthnPendingRegistration]
+	requireUserVerification bool
+}
+
+// NewWebAuthnOptions is the options for NewWebAuthn
+type NewWebAuthnOptions struct {
+	// Path to the file where credentials are stored
+	StorePath string
+	// ID of the Relying Party, which is the domain passkeys are bound to
+	// If empty, uses the hostname of the auth server
+	RPID string
+	// User verification requirement: "required", "preferred", or "discouraged"
+	// Defaults to "preferred"
+	UserVerification string
+	// Lifetime of invites
+	// Defaults to 7 days
+	InviteLifetime time.Duration
+}
+
+// WebAuthnAssertion contains the response of the authenticator to a sign-in request
+type WebAuthnAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// WebAuthnAttestation contains the response of the authenticator to a registration request
+type WebAuthnAttestation struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// WebAuthnRegistrant is the user who is registering a passkey
+type WebAuthnRegistrant struct {
+	// User to register the passkey for
+	User WebAuthnUser
+	// Name of the provider the user is signed in with, when registering from an existing session
+	Source string
+	// Token of the invite, when registering with an invite
+	InviteToken string
+}
+
+// ErrWebAuthnUserConflict is returned when registering a passkey for a user who was registered after signing in with a different provider
+var ErrWebAuthnUserConflict = errors.New("user was registered with a different source")
+
+type webAuthnPendingRegistration struct {
+	user       webAuthnStoredUser
+	inviteHash []byte
+}
+
+// NewWebAuthn returns a new WebAuthn provider
+// The credentials database is closed when the context is canceled
+func NewWebAuthn(ctx context.Context, opts NewWebAuthnOptions) (*WebAuthn, error) {
+	if opts.StorePath == "" {
+		return nil, errors.New("value for storePath is required in config for auth with provider 'webauthn'")
+	}
+	switch opts.UserVerification {
+	case "":
+		opts.UserVerification = "preferred"
+	case "required", "preferred", "discouraged":
+		// All good
+	default:
+		return nil, fmt.Errorf("invalid value for userVerification in config for auth with provider 'webauthn': '%s'", opts.UserVerification)
+	}
+	if opts.InviteLifetime <= 0 {
+		opts.InviteLifetime = 7 * 24 * time.Hour
+	}
+
+	store, err := newWebAuthnStore(opts.StorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	const providerType = "webauthn"
+	a := &WebAuthn{
+		baseProvider: baseProvider{
+			metadata: ProviderMetadata{
+				DisplayName: "Passkey",
+				Name:        providerType,
+				Color:       "indigo",
+			},
+		},
+		rpID:                    opts.RPID,
+		userVerification:        opts.UserVerification,
+		requireUserVerification: opts.UserVerification == "required",
+		inviteLifetime:          opts.InviteLifetime,
+		store:                   store,
+		pendingRegistrations: ttlcache.NewCache[string, webAuthnPendingRegistration](&ttlcache.CacheOptions{
+			CleanupInterval: time.Minute,
+		}),
+	}
+
+	context.AfterFunc(ctx, func() {
+		a.pendingRegistrations.Stop()
+		_ = a.store.Close()
+	})
+
+	return a, nil
+}
+
+func (a *WebAuthn) GetProviderType() string {
+	return "webauthn"
+}
+
+// WebAuthnLoginOptions returns the options for navigator.credentials.get(), encoded as JSON.
+// Binary values are encoded as base64url.
+func (a *WebAuthn) WebAuthnLoginOptions(origin string, challenge []byte) ([]byte, error) {
+	rpID, err := a.getRPID(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	// We use discoverable credentials, so allowCredentials is empty and users pick their passkey in the browser
+	return json.Marshal(map[string]any{
+		"challenge":        base64.RawURLEncoding.EncodeToString(challenge),
+		"rpId":             rpID,
+		"timeout":          webAuthnCeremonyTimeout.Milliseconds(),
+		"userVerification": a.userVerification,
+		"allowCredentials": []any{},
+	})
+}
+
+// WebAuthnFinishLogin validates the response of the authenticator to a sign-in request, and returns the user's profile.
+// If the response is not valid, the error wraps ErrInvalidCredentials.
+func (a *WebAuthn) WebAuthnFinishLogin(_ context.Context, origin string, challenge []byte, assertion WebAuthnAssertion) (*user.Profile, error) {
+	rpID, err := a.getRPID(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseWebAuthnAssertion(assertion)
+	if err != nil {
+		return nil, webAuthnVerifyError(err)
+	}
+
+	cred, err := a.store.GetCredential(assertion.CredentialID)
+	if errors.Is(err, ErrWebAuthnNotFound) {
+		return nil, fmt.Errorf("%w: credential not found", ErrInvalidCredentials)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credential: %w", err)
+	}
+
+	u, err := a.store.GetUser(cred.UserID)
+	if errors.Is(err, ErrWebAuthnNotFound) {
+		return nil, fmt.Errorf("%w: user '%s' not found", ErrInvalidCredentials, cred.UserID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, u.Handle) {
+		return nil, fmt.Errorf("%w: user handle does not match", ErrInvalidCredentials)
+	}
+
+	// Verify the client data, the authenticator data, and the signature
+	// Cross-origin requests are not allowed, and the user must always be present
+	err = parsed.Verify(
+		base64.RawURLEncoding.EncodeToString(challenge), rpID, "",
+		[]string{origin}, nil, nil, protocol.TopOriginExplicitVerificationMode, false,
+		a.requireUserVerification, true,
+		cred.PublicKey, protocol.SignaturePolicy{},
+	)
+	if err != nil {
+		return nil, webAuthnVerifyError(err)
+	}
+
+	// If the authenticator supports signature counters, the value must always increase
+	// A value that doesn't increase could indicate that the authenticator was cloned
+	signCount := parsed.Response.AuthenticatorData.Counter
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrInvalidCredentials)
+	}
+
+	err = a.store.UpdateCredentialUsage(cred.ID, signCount, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to update credential: %w", err)
+	}
+
+	profile := &user.Profile{
+		Provider: a.GetProviderName(),
+		ID:       u.ID,
+		Name: user.ProfileName{
+			FullName: u.Name,
+		},
+	}
+	if u.Email != "" {
+		profile.Email = &user.ProfileEmail{
+			Value:    u.Email,
+			Verified: u.EmailVerified,
+		}
+	}
+	if len(u.Groups) > 0 {
+		profile.Groups = append([]string(nil), u.Groups...)
+	}
+
+	return profile, nil
+}
+
+// WebAuthnBeginRegistration starts the registration of a passkey, and returns the options for navigator.credentials.create(), encoded as JSON.
+// Binary values are encoded as base64url.
+func (a *WebAuthn) WebAuthnBeginRegistration(_ context.Context, origin string, registrant WebAuthnRegistrant) ([]byte, error) {
+	rpID, err := a.getRPID(origin)
+	if err != nil {
+		return nil, err
+	}
+	if registrant.User.ID == "" {
+		return nil, errors.New("user ID is empty")
+	}
+
+	pending := webAuthnPendingRegistration{}
+	if registrant.InviteToken != "" {
+		pending.inviteHash = webAuthnInviteHash(registrant.InviteToken)
+	}
+
+	existing, err := a.store.GetUser(registrant.User.ID)
+	switch {
+	case errors.Is(err, ErrWebAuthnNotFound):
+		// New user
+		pending.user = webAuthnStoredUser{
+			WebAuthnUser: registrant.User,
+			Handle:       make([]byte, 32),
+			Source:       registrant.Source,
+			CreatedAt:    time.Now(),
+		}
+		if registrant.InviteToken != "" {
+			pending.user.Source = webAuthnSourceInvite
+		}
+		_, _ = rand.Read(pending.user.Handle)
+	case err != nil:
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	case registrant.Source == a.GetProviderName():
+		// User is signed in with a passkey and is adding another one: keep the user's details as-is
+		pending.user = existing
+	case registrant.InviteToken != "":
+		// Invites are created by admins, so they can replace the user's details
+		pending.user = existing
+		pending.user.WebAuthnUser = registrant.User
+	case registrant.Source == existing.Source:
+		// Refresh the user's details with the ones from the provider
+		pending.user = existing
+		pending.user.WebAuthnUser = registrant.User
+	default:
+		// Users with the same ID but signed in with a different provider could be different people
+		return nil, fmt.Errorf("%w: user '%s'", ErrWebAuthnUserConflict, registrant.User.ID)
+	}
+
+	excludeIDs, err := a.store.ListCredentialIDs(pending.user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credentials: %w", err)
+	}
+	exclude := make([]map[string]string, len(excludeIDs))
+	for i, id := range excludeIDs {
+		exclude[i] = map[string]string{
+			"type": "public-key",
+			"id":   base64.RawURLEncoding.EncodeToString(id),
+		}
+	}
+
+	challenge := make([]byte, 32)
+	_, _ = rand.Read(challenge)
+	challengeStr := base64.RawURLEncoding.EncodeToString(challenge)
+
+	userName := pending.user.Email
+	if userName == "" {
+		userName = pending.user.ID
+	}
+	displayName := pending.user.Name
+	if displayName == "" {
+		displayName = userName
+	}
+
+	opts, err := json.Marshal(map[string]any{
+		"challenge": challengeStr,
+		"rp": map[string]string{
+			"id":   rpID,
+			"name": a.GetProviderDisplayName(),
+		},
+		"user": map[string]string{
+			"id":          base64.RawURLEncoding.EncodeToString(pending.user.Handle),
+			"name":        userName,
+			"displayName": displayName,
+		},
+		"pubKeyCredParams":   webAuthnCredentialParams,
+		"timeout":            webAuthnCeremonyTimeout.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]any{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   a.userVerification,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.pendingRegistrations.Set(challengeStr, pending, webAuthnCeremonyTimeout)
+
+	return opts, nil
+}
+
+// WebAuthnFinishRegistration validates the response of the authenticator to a registration request, and stores the new credential.
+// If the response is not valid, the error wraps ErrInvalidCredentials.
+func (a *WebAuthn) WebAuthnFinishRegistration(_ context.Context, origin string, attestation WebAuthnAttestation) (WebAuthnUser, error) {
+	rpID, err := a.getRPID(origin)
+	if err != nil {
+		return WebAuthnUser{}, err
+	}
+
+	parsed, err := parseWebAuthnAttestation(attestation)
+	if err != nil {
+		return WebAuthnUser{}, webAuthnVerifyError(err)
+	}
+
+	// The challenge is validated by looking up the pending registration, so here we only check the type and origin
+	// This way, challenges are not consumed by responses that are for a different ceremony or origin
+	challenge := parsed.CollectedClientData.Challenge
+	err = parsed.CollectedClientData.Verify(challenge, protocol.CreateCeremony, []string{origin}, nil, nil, protocol.TopOriginExplicitVerificationMode, false)
+	if err != nil {
+		return WebAuthnUser{}, webAuthnVerifyError(err)
+	}
+
+	// Each challenge can be used only once
+	a.pendingLock.Lock()
+	pending, ok := a.pendingRegistrations.Get(challenge)
+	if ok {
+		a.pendingRegistrations.Delete(challenge)
+	}
+	a.pendingLock.Unlock()
+	if !ok {
+		return WebAuthnUser{}, fmt.Errorf("%w: registration not found or expired", ErrInvalidCredentials)
+	}
+
+	// Verify the authenticator data, that the key uses one of the algorithms we support, and the attestation statement
+	// We request the "none" attestation conveyance, so there's no metadata to validate attestation certificates with
+	clientDataHash := sha256.Sum256(attestation.ClientDataJSON)
+	ao := parsed.AttestationObject
+	err = ao.Verify(rpID, clientDataHash[:], a.requireUserVerification, true, nil, webAuthnCredentialParams, protocol.AttestationPolicy{}, protocol.SignaturePolicy{})
+	if err != nil {
+		return WebAuthnUser{}, webAuthnVerifyError(err)
+	}
+	if len(ao.AuthData.AttData.CredentialID) == 0 {
+		return WebAuthnUser{}, fmt.Errorf("%w: authenticator data does not contain a credential", ErrInvalidCredentials)
+	}
+	err = checkWebAuthnPublicKey(ao.AuthData.AttData.CredentialPublicKey)
+	if err != nil {
+		return WebAuthnUser{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	now := time.Now()
+	cred := webAuthnCredential{
+		ID:        slices.Clone(ao.AuthData.AttData.CredentialID),
+		UserID:    pending.user.ID,
+		PublicKey: slices.Clone(ao.AuthData.AttData.CredentialPublicKey),
+		SignCount: ao.AuthData.Counter,
+		CreatedAt: now,
+	}
+	err = a.store.AddCredential(pending.user, cred, pending.inviteHash)
+	if err != nil {
+		return WebAuthnUser{}, fmt.Errorf("failed to save credential: %w", err)
+	}
+
+	return pending.user.WebAuthnUser, nil
+}
+
+// WebAuthnCreateInvite creates an invite that allows registering a passkey for the user, and returns the invite token.
+func (a *WebAuthn) WebAuthnCreateInvite(_ context.Context, u WebAuthnUser) (token string, expiresAt time.Time, err error) {
+	if u.ID == "" {
+		return "", time.Time{}, errors.New("user ID is empty")
+	}
+
+	tokenBytes := make([]byte, 32)
+	_, _ = rand.Read(tokenBytes)
+	token = base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	// Store the hash of the token only
+	expiresAt = time.Now().Add(a.inviteLifetime).Truncate(time.Second)
+	err = a.store.PutInvite(webAuthnInviteHash(token), webAuthnInvite{
+		User:      u,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save invite: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// WebAuthnGetInvite returns the user an invite was created for.
+// If the invite doesn't exist or has expired, the error wraps ErrWebAuthnNotFound.
+func (a *WebAuthn) WebAuthnGetInvite(_ context.Context, token string) (WebAuthnUser, error) {
+	invite, err := a.store.GetInvite(webAuthnInviteHash(token))
+	if err != nil {
+		return WebAuthnUser{}, err
+	}
+	return invite.User, nil
+}
+
+// WebAuthnDeleteUser deletes a user and all their passkeys, returning the number of passkeys deleted.
+// If the user doesn't exist, the error wraps ErrWebAuthnNotFound.
+func (a *WebAuthn) WebAuthnDeleteUser(_ context.Context, userID string) (int, error) {
+	return a.store.DeleteUser(userID)
+}
+
+// getRPID returns the ID of the Relying Party, which defaults to the hostname of the origin
+func (a *WebAuthn) getRPID(origin string) (string, error) {
+	if a.rpID != "" {
+		return a.rpID, nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid origin '%s'", origin)
+	}
+	return u.Hostname(), nil
+}
+
+func webAuthnInviteHash(token string) []byte {
+	h := sha256.Sum256([]byte("webauthn-invite:" + token))
+	return h[:]
+}
+
+// Compile-time interface assertion
+var _ WebAuthnProvider = &WebAuthn{}
@@ -0,0 +1,482 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthn(t *testing.T) {
+	const origin = "https://auth.example.com"
+
+	p, err := NewWebAuthn(t.Context(), NewWebAuthnOptions{
+		StorePath: filepath.Join(t.TempDir(), "webauthn.db"),
+	})
+	require.NoError(t, err)
+	p.SetProviderMetadata(ProviderMetadata{Name: "passkey"})
+
+	register := func(t *testing.T, authn *TestWebAuthnAuthenticator, registrant WebAuthnRegistrant) (WebAuthnUser, error) {
+		t.Helper()
+		opts, err := p.WebAuthnBeginRegistration(t.Context(), origin, registrant)
+		require.NoError(t, err)
+		att, err := authn.Register(opts, origin)
+		require.NoError(t, err)
+		return p.WebAuthnFinishRegistration(t.Context(), origin, att)
+	}
+	login := func(t *testing.T, authn *TestWebAuthnAuthenticator, challenge []byte) WebAuthnAssertion {
+		t.Helper()
+		opts, err := p.WebAuthnLoginOptions(origin, challenge)
+		require.NoError(t, err)
+		assertion, err := authn.Login(opts, origin)
+		require.NoError(t, err)
+		return assertion
+	}
+
+	alice := NewTestWebAuthnAuthenticator()
+	challenge := []byte("challenge-1")
+
+	t.Run("register from a session", func(t *testing.T) {
+		u, err := register(t, alice, WebAuthnRegistrant{
+			User: WebAuthnUser{
+				ID:            "alice",
+				Name:          "Alice Smith",
+				Email:         "alice@example.com",
+				EmailVerified: true,
+				Groups:        []string{"admins"},
+			},
+			Source: "github",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", u.ID)
+	})
+
+	t.Run("login options", func(t *testing.T) {
+		opts, err := p.WebAuthnLoginOptions(origin, challenge)
+		require.NoError(t, err)
+
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal(opts, &decoded))
+		assert.Equal(t, "Y2hhbGxlbmdlLTE", decoded["challenge"])
+		assert.Equal(t, "auth.example.com", decoded["rpId"])
+		assert.Equal(t, "preferred", decoded["userVerification"])
+	})
+
+	t.Run("login", func(t *testing.T) {
+		profile, err := p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.NoError(t, err)
+		assert.Equal(t, "passkey", profile.Provider)
+		assert.Equal(t, "alice", profile.ID)
+		assert.Equal(t, "Alice Smith", profile.Name.FullName)
+		require.NotNil(t, profile.Email)
+		assert.Equal(t, "alice@example.com", profile.Email.Value)
+		assert.True(t, profile.Email.Verified)
+		assert.Equal(t, []string{"admins"}, profile.Groups)
+	})
+
+	t.Run("invalid assertions", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(a *WebAuthnAssertion)
+			errMsg string
+		}{
+			{
+				name: "unknown credential",
+				modify: func(a *WebAuthnAssertion) {
+					a.CredentialID = []byte("unknown")
+				},
+				errMsg: "credential not found",
+			},
+			{
+				name: "invalid signature",
+				modify: func(a *WebAuthnAssertion) {
+					a.Signature[len(a.Signature)-1] ^= 0xFF
+				},
+				errMsg: "Error validating the assertion signature",
+			},
+			{
+				name: "user handle does not match",
+				modify: func(a *WebAuthnAssertion) {
+					a.UserHandle = []byte("someone-else")
+				},
+				errMsg: "user handle does not match",
+			},
+			{
+				name: "wrong type",
+				modify: func(a *WebAuthnAssertion) {
+					a.ClientDataJSON = testWebAuthnClientData("webauthn.create", "Y2hhbGxlbmdlLTE", origin)
+				},
+				errMsg: "Error validating ceremony type",
+			},
+			{
+				name: "wrong challenge",
+				modify: func(a *WebAuthnAssertion) {
+					a.ClientDataJSON = testWebAuthnClientData("webauthn.get", "b3RoZXI", origin)
+				},
+				errMsg: "Error validating challenge",
+			},
+			{
+				name: "wrong origin",
+				modify: func(a *WebAuthnAssertion) {
+					a.ClientDataJSON = testWebAuthnClientData("webauthn.get", "Y2hhbGxlbmdlLTE", "https://evil.example.com")
+				},
+				errMsg: "Error validating origin",
+			},
+			{
+				name: "user not present",
+				modify: func(a *WebAuthnAssertion) {
+					a.AuthenticatorData[32] &^= byte(protocol.FlagUserPresent)
+				},
+				errMsg: "User presence required but flag not set by authenticator",
+			},
+			{
+				name: "RP ID hash does not match",
+				modify: func(a *WebAuthnAssertion) {
+					a.AuthenticatorData[0] ^= 0xFF
+				},
+				errMsg: "RP Hash mismatch",
+			},
+			{
+				name: "cross-origin",
+				modify: func(a *WebAuthnAssertion) {
+					a.ClientDataJSON = []byte(`{"type":"webauthn.get","challenge":"Y2hhbGxlbmdlLTE","origin":"` + origin + `","crossOrigin":true}`)
+				},
+				errMsg: "Error validating cross origin flag",
+			},
+			{
+				name: "truncated authenticator data",
+				modify: func(a *WebAuthnAssertion) {
+					a.AuthenticatorData = a.AuthenticatorData[:36]
+				},
+				errMsg: "Authenticator data length too short",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assertion := login(t, alice, challenge)
+				tt.modify(&assertion)
+				_, err := p.WebAuthnFinishLogin(t.Context(), origin, challenge, assertion)
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+				require.ErrorContains(t, err, tt.errMsg)
+			})
+		}
+	})
+
+	t.Run("signature counter must increase", func(t *testing.T) {
+		alice.SignCount = 0
+		_, err := p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		require.ErrorContains(t, err, "signature counter did not increase")
+
+		alice.SignCount = 100
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.NoError(t, err)
+
+		// Counter going backwards
+		alice.SignCount = 50
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		require.ErrorContains(t, err, "signature counter did not increase")
+
+		// Replaying an assertion with the same counter
+		alice.SignCount = 100
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		require.ErrorContains(t, err, "signature counter did not increase")
+
+		alice.SignCount = 200
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.NoError(t, err)
+	})
+
+	t.Run("registrations cannot be completed twice", func(t *testing.T) {
+		opts, err := p.WebAuthnBeginRegistration(t.Context(), origin, WebAuthnRegistrant{
+			User:   WebAuthnUser{ID: "alice"},
+			Source: "passkey",
+		})
+		require.NoError(t, err)
+
+		// The existing credential is excluded
+		var decoded struct {
+			ExcludeCredentials []map[string]string `json:"excludeCredentials"`
+		}
+		require.NoError(t, json.Unmarshal(opts, &decoded))
+		assert.Len(t, decoded.ExcludeCredentials, 1)
+
+		att, err := NewTestWebAuthnAuthenticator().Register(opts, origin)
+		require.NoError(t, err)
+		_, err = p.WebAuthnFinishRegistration(t.Context(), origin, att)
+		require.NoError(t, err)
+		_, err = p.WebAuthnFinishRegistration(t.Context(), origin, att)
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		require.ErrorContains(t, err, "registration not found or expired")
+	})
+
+	t.Run("invalid registrations", func(t *testing.T) {
+		// Modifies the authenticator data in the attestation object
+		modifyAuthData := func(t *testing.T, att *WebAuthnAttestation, modify func(authData []byte)) {
+			t.Helper()
+			var ao map[string]any
+			require.NoError(t, cbor.Unmarshal(att.AttestationObject, &ao))
+			authData, ok := ao["authData"].([]byte)
+			require.True(t, ok)
+			modify(authData)
+			var err error
+			att.AttestationObject, err = cbor.Marshal(ao)
+			require.NoError(t, err)
+		}
+
+		tests := []struct {
+			name   string
+			modify func(t *testing.T, att *WebAuthnAttestation)
+			errMsg string
+		}{
+			{
+				name: "wrong type",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					var cd protocol.CollectedClientData
+					require.NoError(t, json.Unmarshal(att.ClientDataJSON, &cd))
+					att.ClientDataJSON = testWebAuthnClientData("webauthn.get", cd.Challenge, origin)
+				},
+				errMsg: "Error validating ceremony type",
+			},
+			{
+				name: "wrong origin",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					var cd protocol.CollectedClientData
+					require.NoError(t, json.Unmarshal(att.ClientDataJSON, &cd))
+					att.ClientDataJSON = testWebAuthnClientData("webauthn.create", cd.Challenge, "https://evil.example.com")
+				},
+				errMsg: "Error validating origin",
+			},
+			{
+				name: "unknown challenge",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					att.ClientDataJSON = testWebAuthnClientData("webauthn.create", "b3RoZXI", origin)
+				},
+				errMsg: "registration not found or expired",
+			},
+			{
+				name: "RP ID hash does not match",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					modifyAuthData(t, att, func(authData []byte) {
+						authData[0] ^= 0xFF
+					})
+				},
+				errMsg: "RP Hash mismatch",
+			},
+			{
+				name: "user not present",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					modifyAuthData(t, att, func(authData []byte) {
+						authData[32] &^= byte(protocol.FlagUserPresent)
+					})
+				},
+				errMsg: "User presence required but flag not set by authenticator",
+			},
+			{
+				name: "attestation statement with the none format",
+				modify: func(t *testing.T, att *WebAuthnAttestation) {
+					var ao map[string]any
+					require.NoError(t, cbor.Unmarshal(att.AttestationObject, &ao))
+					ao["attStmt"] = map[string]any{"sig": []byte("signature")}
+					var err error
+					att.AttestationObject, err = cbor.Marshal(ao)
+					require.NoError(t, err)
+				},
+				errMsg: "Attestation format none with attestation present",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				opts, err := p.WebAuthnBeginRegistration(t.Context(), origin, WebAuthnRegistrant{
+					User:   WebAuthnUser{ID: "carol"},
+					Source: "github",
+				})
+				require.NoError(t, err)
+				att, err := NewTestWebAuthnAuthenticator().Register(opts, origin)
+				require.NoError(t, err)
+
+				tt.modify(t, &att)
+				_, err = p.WebAuthnFinishRegistration(t.Context(), origin, att)
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+				require.ErrorContains(t, err, tt.errMsg)
+			})
+		}
+
+		// No credential was saved
+		_, err := p.WebAuthnDeleteUser(t.Context(), "carol")
+		require.ErrorIs(t, err, ErrWebAuthnNotFound)
+	})
+
+	t.Run("different source", func(t *testing.T) {
+		_, err := p.WebAuthnBeginRegistration(t.Context(), origin, WebAuthnRegistrant{
+			User:   WebAuthnUser{ID: "alice"},
+			Source: "google",
+		})
+		require.ErrorIs(t, err, ErrWebAuthnUserConflict)
+	})
+
+	t.Run("invite", func(t *testing.T) {
+		token, expiresAt, err := p.WebAuthnCreateInvite(t.Context(), WebAuthnUser{ID: "bob", Name: "Bob"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.False(t, expiresAt.IsZero())
+
+		u, err := p.WebAuthnGetInvite(t.Context(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", u.ID)
+
+		bob := NewTestWebAuthnAuthenticator()
+		_, err = register(t, bob, WebAuthnRegistrant{User: u, InviteToken: token})
+		require.NoError(t, err)
+
+		profile, err := p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, bob, challenge))
+		require.NoError(t, err)
+		assert.Equal(t, "bob", profile.ID)
+		assert.Equal(t, "Bob", profile.Name.FullName)
+
+		// Invites can be used once only
+		_, err = p.WebAuthnGetInvite(t.Context(), token)
+		require.ErrorIs(t, err, ErrWebAuthnNotFound)
+		_, err = register(t, NewTestWebAuthnAuthenticator(), WebAuthnRegistrant{User: u, InviteToken: token})
+		require.ErrorContains(t, err, "invite has already been used")
+
+		_, err = p.WebAuthnGetInvite(t.Context(), "not-a-token")
+		require.ErrorIs(t, err, ErrWebAuthnNotFound)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		n, err := p.WebAuthnDeleteUser(t.Context(), "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, login(t, alice, challenge))
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		_, err = p.WebAuthnDeleteUser(t.Context(), "alice")
+		require.ErrorIs(t, err, ErrWebAuthnNotFound)
+	})
+}
+
+func TestNewWebAuthnInvalidOptions(t *testing.T) {
+	_, err := NewWebAuthn(t.Context(), NewWebAuthnOptions{})
+	require.ErrorContains(t, err, "value for storePath is required")
+
+	_, err = NewWebAuthn(t.Context(), NewWebAuthnOptions{
+		StorePath:        filepath.Join(t.TempDir(), "webauthn.db"),
+		UserVerification: "always",
+	})
+	require.ErrorContains(t, err, "invalid value for userVerification")
+}
+
+func TestWebAuthnUserVerificationRequired(t *testing.T) {
+	const origin = "https://auth.example.com"
+
+	p, err := NewWebAuthn(t.Context(), NewWebAuthnOptions{
+		StorePath:        filepath.Join(t.TempDir(), "webauthn.db"),
+		UserVerification: "required",
+	})
+	require.NoError(t, err)
+	p.SetProviderMetadata(ProviderMetadata{Name: "passkey"})
+
+	register := func(t *testing.T, authn *TestWebAuthnAuthenticator) error {
+		t.Helper()
+		opts, err := p.WebAuthnBeginRegistration(t.Context(), origin, WebAuthnRegistrant{
+			User:   WebAuthnUser{ID: "alice"},
+			Source: "github",
+		})
+		require.NoError(t, err)
+		att, err := authn.Register(opts, origin)
+		require.NoError(t, err)
+		_, err = p.WebAuthnFinishRegistration(t.Context(), origin, att)
+		return err
+	}
+	login := func(t *testing.T, authn *TestWebAuthnAuthenticator) error {
+		t.Helper()
+		challenge := []byte("challenge-1")
+		opts, err := p.WebAuthnLoginOptions(origin, challenge)
+		require.NoError(t, err)
+		assertion, err := authn.Login(opts, origin)
+		require.NoError(t, err)
+		_, err = p.WebAuthnFinishLogin(t.Context(), origin, challenge, assertion)
+		return err
+	}
+
+	alice := NewTestWebAuthnAuthenticator()
+	alice.NoUserVerification = true
+	err = register(t, alice)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.ErrorContains(t, err, "User verification required but flag not set by authenticator")
+
+	alice.NoUserVerification = false
+	require.NoError(t, register(t, alice))
+	require.NoError(t, login(t, alice))
+
+	// The signature is valid, but the user was not verified
+	alice.NoUserVerification = true
+	err = login(t, alice)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.ErrorContains(t, err, "User verification required but flag not set by authenticator")
+}
+
+func TestCheckWebAuthnPublicKey(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaE := big.NewInt(int64(rsaKey.E)).Bytes()
+
+	tests := []struct {
+		name   string
+		key    map[int]any
+		errMsg string
+	}{
+		{
+			name: "EdDSA",
+			key:  map[int]any{1: webauthncose.OctetKey, 3: webauthncose.AlgEdDSA, -1: webauthncose.Ed25519, -2: []byte(edPub)},
+		},
+		{
+			name: "RS256",
+			key:  map[int]any{1: webauthncose.RSAKey, 3: webauthncose.AlgRS256, -1: rsaKey.N.Bytes(), -2: rsaE},
+		},
+		{
+			name:   "ES256 with invalid point",
+			key:    map[int]any{1: webauthncose.EllipticKey, 3: webauthncose.AlgES256, -1: webauthncose.P256, -2: make([]byte, 32), -3: make([]byte, 32)},
+			errMsg: "invalid credential public key",
+		},
+		{
+			name:   "RS256 with short modulus",
+			key:    map[int]any{1: webauthncose.RSAKey, 3: webauthncose.AlgRS256, -1: rsaKey.N.Bytes()[:128], -2: rsaE},
+			errMsg: "modulus must be at least 2048 bits",
+		},
+		{
+			name:   "unsupported key type",
+			key:    map[int]any{1: webauthncose.Symmetric, 3: webauthncose.AlgES256},
+			errMsg: "invalid credential public key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := cbor.Marshal(tt.key)
+			require.NoError(t, err)
+
+			err = checkWebAuthnPublicKey(data)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -3,27 +3,38 @@ package config
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lestrrat-go/jwx/v4/jwa"
 	"github.com/lestrrat-go/jwx/v4/jwk"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils/validators"
 )
 
@@ -35,6 +46,16 @@ const (
 	PropertyProviderName = "provider.name"
 )
 
+// Actions for portal rules
+const (
+	// RuleActionAllow allows authenticated users, if they satisfy the rule's condition
+	RuleActionAllow = "allow"
+	// RuleActionDeny denies users who satisfy the rule's condition
+	RuleActionDeny = "deny"
+	// RuleActionPublic allows requests without authentication
+	RuleActionPublic = "public"
+)
+
 // Config is the struct containing configuration
 type Config struct {
 	// Configuration for the application's server
@@ -46,6 +67,15 @@ type Config struct {
 	// Tokens configuration
 	Tokens ConfigTokens `yaml:"tokens"`
 
+	// Server-side sessions configuration
+	Sessions ConfigSessions `yaml:"sessions"`
+
+	// Admin API configuration
+	Admin ConfigAdmin `yaml:"admin"`
+
+	// TOTP second factor configuration
+	TOTP ConfigTOTP `yaml:"totp"`
+
 	// Logs configuration
 	Logs ConfigLogs `yaml:"logs"`
 
@@ -53,6 +83,11 @@ type Config struct {
 	// +example "myportal"
 	DefaultPortal string `yaml:"defaultPortal"`
 
+	// Named authorization policies
+	// Each policy is an authorization condition, which can be referenced with the `policy` query string arg or the `X-Forward-Auth-Policy` header, or with the `Policy("name")` function in other conditions
+	// +example {"admins": "Group(\"admins\")", "admins-mfa": "Policy(\"admins\") && AMR(\"mfa\")"}
+	Policies map[string]string `yaml:"policies"`
+
 	// List of portals
 	// At least one configured portal and provider is required
 	// +required
@@ -164,6 +199,13 @@ type ConfigCookies struct {
 	// By default, this is false and cookies are sent on HTTPS endpoints only.
 	// +default false
 	Insecure bool `yaml:"insecure"`
+
+	// If true, session cookies are encrypted, so claims such as the user's email address, name, and groups can't be read by clients.
+	// Session tokens are encrypted using JWE, with a key derived from the token signing key.
+	// Note that encrypted session tokens can't be verified by other services using the keys published at `/.well-known/jwks.json`.
+	// Existing sessions remain valid when this option is changed.
+	// +default false
+	Encrypt bool `yaml:"encrypt"`
 }
 
 func (c ConfigCookies) CookieName(portalName string) string {
@@ -296,11 +338,117 @@ type ConfigTokens struct {
 	// This is an alternative to specifying `signingKey` tokens.directly.
 	SigningKeyFile string `yaml:"signingKeyFile"`
 
+	// List of keys used to sign tokens, which allows rotating keys without invalidating existing sessions.
+	// The first key is used to sign new tokens, and all keys are accepted when verifying tokens, until they are removed from the list.
+	// Each key must be at least 20 characters long. This is an alternative to specifying `signingKey`.
+	SigningKeys []string `yaml:"signingKeys"`
+
+	// Directory containing the keys used to sign tokens, one per file.
+	// Files are sorted by name: the first key is used to sign new tokens, and all keys are accepted when verifying tokens, until they are removed from the directory. Hidden files (whose name begins with a dot) are ignored.
+	// This is an alternative to specifying `signingKeys` directly, and it can be used with secrets mounted as directories, for example in Kubernetes.
+	// +example "/etc/traefik-forward-auth/signing-keys"
+	SigningKeysDir string `yaml:"signingKeysDir"`
+
+	// PEM-encoded private key used to sign session tokens with an asymmetric algorithm.
+	// Supported keys are ECDSA keys on the P-256 curve (tokens are signed with ES256) and Ed25519 keys (tokens are signed with EdDSA). Keys can be encoded as PKCS#8 or, for ECDSA keys, SEC 1.
+	// When set, the public key is published at `/.well-known/jwks.json`, so other services can verify session tokens without calling Traefik Forward Auth.
+	// If empty, session tokens are signed with HS256, using a key derived from `tokens.signingKey`.
+	// Note that state tokens are always signed with `tokens.signingKey`.
+	SessionSigningKeyPEM string `yaml:"sessionSigningKeyPEM"`
+
+	// File containing the PEM-encoded private key used to sign session tokens with an asymmetric algorithm.
+	// This is an alternative to specifying `sessionSigningKeyPEM` directly.
+	// +example "/etc/traefik-forward-auth/session-signing-key.pem"
+	SessionSigningKeyFile string `yaml:"sessionSigningKeyFile"`
+
+	// List of PEM-encoded private keys used to sign session tokens with an asymmetric algorithm, which allows rotating keys without invalidating existing sessions.
+	// The first key is used to sign new session tokens, and all keys are accepted when verifying them, until they are removed from the list. The public keys of all keys are published at `/.well-known/jwks.json`.
+	// This is an alternative to specifying `sessionSigningKeyPEM`.
+	SessionSigningKeysPEM []string `yaml:"sessionSigningKeysPEM"`
+
+	// Directory containing the PEM-encoded private keys used to sign session tokens with an asymmetric algorithm, one per file.
+	// Files are sorted by name: the first key is used to sign new session tokens, and all keys are accepted when verifying them, until they are removed from the directory. Hidden files (whose name begins with a dot) are ignored.
+	// This is an alternative to specifying `sessionSigningKeysPEM` directly, and it can be used with secrets mounted as directories, for example in Kubernetes.
+	// +example "/etc/traefik-forward-auth/session-signing-keys"
+	SessionSigningKeysDir string `yaml:"sessionSigningKeysDir"`
+
 	// Value for the audience claim to expect in session tokens used by Traefik Forward Auth.
 	// Defaults to a value based on the current environment, which is appropriate for the majority of cases. Most users should rely on the default value.
 	SessionTokenAudience string `yaml:"sessionTokenAudience"`
 }
 
+type ConfigSessions struct {
+	// Type of store used to keep track of sessions on the server.
+	// When a session store is enabled, each session token contains a session ID that is checked against the store, so sessions can be revoked before they expire.
+	// Supported values:
+	// - `""` (empty): sessions are not tracked on the server, and session tokens are valid until they expire
+	// - `memory`: sessions are stored in memory, and they are lost when Traefik Forward Auth is restarted
+	// - `bolt`: sessions are stored in an embedded database on disk, at the path set in `storePath`
+	// +default ""
+	Store string `yaml:"store"`
+
+	// Path to the database file used by the `bolt` session store.
+	// The file is created if it doesn't exist. It can only be used by one instance of Traefik Forward Auth at a time.
+	// +example "/data/sessions.db"
+	StorePath string `yaml:"storePath"`
+}
+
+type ConfigTOTP struct {
+	// Path to the database file where the TOTP secrets of users are stored.
+	// This is required when `requireTOTP` is enabled for at least one portal.
+	// The file is created if it doesn't exist. It must be on a persistent volume, and it can only be used by one instance of Traefik Forward Auth at a time.
+	// Secrets are stored unencrypted, so the file must be protected from unauthorized access.
+	// +example "/data/totp.db"
+	StorePath string `yaml:"storePath"`
+
+	// Name of the issuer that is displayed in authenticator apps.
+	// Defaults to the display name of the portal.
+	// +example "My company"
+	Issuer string `yaml:"issuer"`
+}
+
+type ConfigAdmin struct {
+	// If true, enables the admin API, available at `/api/admin`, which allows listing and revoking sessions.
+	// The admin API requires a session store, configured in `sessions.store`.
+	// Requests to the admin API must be authenticated with at least one of the methods configured in this section: a bearer token (`token` or `tokenFile`), a TLS client certificate (`clientCertificate`), or a session in a portal (`portal` and `condition`).
+	// +default false
+	Enabled bool `yaml:"enabled"`
+
+	// Static token that clients can pass in the `Authorization` header (as `Bearer <token>`) to authenticate with the admin API.
+	// The token must be at least 20 characters long.
+	Token string `yaml:"token"`
+
+	// File containing the static token used to authenticate with the admin API.
+	// This is an alternative to specifying `token` directly.
+	TokenFile string `yaml:"tokenFile"`
+
+	// If true, clients can authenticate with the admin API by presenting a valid TLS client certificate, signed by the CA configured for mTLS.
+	// Only the certificates listed in `clientCertificateSubjects` or `clientCertificateFingerprints` are accepted, and at least one of them must be set.
+	// This requires `server.tlsClientAuth` to be enabled.
+	// +default false
+	ClientCertificate bool `yaml:"clientCertificate"`
+
+	// List of subjects of the client certificates that can authenticate with the admin API, when `clientCertificate` is true.
+	// A certificate matches if its subject common name, or any of its subject alternative names (DNS names, email addresses, or URIs), is equal to a value in the list.
+	// +example ["admin-cli", "spiffe://example.com/admin"]
+	ClientCertificateSubjects []string `yaml:"clientCertificateSubjects"`
+
+	// List of SHA-256 fingerprints of the client certificates that can authenticate with the admin API, when `clientCertificate` is true.
+	// Fingerprints are hex-encoded, and they can contain colons as separators.
+	// +example ["5d41402abc4b2a76b9719d911017c592ae3a0d6b4ecb1b3c8a9e6f1c0e1f2a3b"]
+	ClientCertificateFingerprints []string `yaml:"clientCertificateFingerprints"`
+
+	// Name of a portal whose sessions can be used to authenticate with the admin API.
+	// Users must be signed in with the portal, and they must satisfy the condition in `condition`.
+	// +example "main"
+	Portal string `yaml:"portal"`
+
+	// Authorization condition that users signed in with the portal in `portal` must satisfy to access the admin API.
+	// This uses the same syntax as authorization conditions passed to the forward auth endpoint, and it is required when `portal` is set.
+	// +example 'Group("admins")'
+	Condition string `yaml:"condition"`
+}
+
 type ConfigPortal struct {
 	// Name of the portal, as used in the URL.
 	// +required
@@ -325,6 +473,40 @@ type ConfigPortal struct {
 	// If set, this overrides the default value configured in the `tokens` section for this portal.
 	SessionLifetime time.Duration `yaml:"sessionLifetime"`
 
+	// If set, sessions expire when they aren't used for this amount of time, even if their lifetime hasn't been reached yet.
+	// When a session is used and less than half of the idle timeout is left, the session cookie is re-issued with a new expiration, which is never after the end of the session's lifetime.
+	// When using Traefik, session cookies must be forwarded to the client with the `addAuthCookiesToResponse` option of the ForwardAuth middleware.
+	// If empty or zero, sessions don't have an idle timeout.
+	// +example "15m"
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+
+	// If true, sessions are renewed silently before they expire, using the refresh token returned by OAuth2-based providers.
+	// The refresh token is stored in the session cookie, encrypted, and it's used to request a new access token and user profile from the provider's token endpoint.
+	// If the identity provider rejects the refresh token (for example, because the user's account was disabled), the session is terminated.
+	// Providers that don't return a refresh token (or that aren't based on OAuth2) are not affected.
+	// When using Traefik, session cookies must be forwarded to the client with the `addAuthCookiesToResponse` option of the ForwardAuth middleware.
+	// +default false
+	SessionRefresh bool `yaml:"sessionRefresh"`
+
+	// When session refresh is enabled, sessions are renewed on requests received when the time left before the session expires is less than this value.
+	// The value is capped at half of the session lifetime.
+	// +default 15m
+	SessionRefreshWindow time.Duration `yaml:"sessionRefreshWindow"`
+
+	// If true, users who log out of the portal are signed out of the identity provider too, using OpenID Connect RP-Initiated Logout.
+	// This is supported by the `openIDConnect` (when the identity provider's discovery document includes an `end_session_endpoint`), `microsoftEntraID`, and `pocketID` providers, and it has no effect on other providers.
+	// The ID token returned by the identity provider is stored in the session cookie, so it can be passed to the identity provider as `id_token_hint`.
+	// After signing out, users are redirected to the portal's URL (for example, `https://auth.example.com/portals/main`), which must be allowed as post-logout redirect URI in the identity provider's configuration.
+	// +default false
+	ProviderLogout bool `yaml:"providerLogout"`
+
+	// If true, after signing in with any provider, users must enter a code from an authenticator app (TOTP) before their session is created.
+	// Users who haven't set up an authenticator app yet are asked to do so the first time they sign in.
+	// Sessions include the `amr` claim with the values `otp` and `mfa`, which can be checked in authorization conditions with `AMR("mfa")`.
+	// This requires `totp.storePath` to be set. Providers that only authenticate requests without a session, such as `bearerToken`, can't be used in portals that require TOTP.
+	// +default false
+	RequireTOTP bool `yaml:"requireTOTP"`
+
 	// URL to override the background image for the portal, size medium.
 	// The recommended size is 720x1080.
 	BackgroundMedium string `yaml:"backgroundMedium"`
@@ -336,6 +518,10 @@ type ConfigPortal struct {
 	// List of HTTP headers to add to the response.
 	Headers *[]ConfigPortalHeader `yaml:"headers"`
 
+	// List of rules to control access to the applications protected by the portal, based on the host, path, and method of each request.
+	// Rules are evaluated in order, and only the first one matching the request is applied. When no rule matches, all authenticated users are allowed.
+	Rules []ConfigPortalRule `yaml:"rules"`
+
 	// List of allowed authentication providers.
 	// At least one provider is required.
 	// +required
@@ -343,18 +529,36 @@ type ConfigPortal struct {
 }
 
 type ConfigPortalProvider struct {
+	// Use bearer tokens issued by an external OpenID Connect issuer as authentication provider, for non-browser clients
+	BearerToken *ProviderConfig_BearerToken `yaml:"bearerToken"`
+	// Use TLS client certificates as authentication provider
+	ClientCertificate *ProviderConfig_ClientCertificate `yaml:"clientCertificate"`
+	// Use a generic OAuth2 server as authentication provider
+	GenericOAuth2 *ProviderConfig_GenericOAuth2 `yaml:"genericOAuth2"`
 	// Use GitHub as authentication provider
 	GitHub *ProviderConfig_GitHub `yaml:"github"`
+	// Use GitLab as authentication provider
+	GitLab *ProviderConfig_GitLab `yaml:"gitlab"`
 	// Use Google as authentication provider
 	Google *ProviderConfig_Google `yaml:"google"`
+	// Use an LDAP directory, such as Active Directory, as authentication provider
+	LDAP *ProviderConfig_LDAP `yaml:"ldap"`
+	// Use a list of users defined in the configuration or in a htpasswd-style file as authentication provider
+	LocalUsers *ProviderConfig_LocalUsers `yaml:"localUsers"`
 	// Use MicrosoftEntraID as authentication provider
 	MicrosoftEntraID *ProviderConfig_MicrosoftEntraID `yaml:"microsoftEntraID"`
 	// Use OpenIDConnect as authentication provider
 	OpenIDConnect *ProviderConfig_OpenIDConnect `yaml:"openIDConnect"`
 	// Use TailscaleWhois as authentication provider
 	TailscaleWhois *ProviderConfig_TailscaleWhois `yaml:"tailscaleWhois"`
+	// Use the identity asserted in headers by an authenticating proxy, such as Cloudflare Access, as authentication provider
+	TrustedHeader *ProviderConfig_TrustedHeader `yaml:"trustedHeader"`
 	// Use PocketID as authentication provider
 	PocketID *ProviderConfig_PocketID `yaml:"pocketID"`
+	// Use a SAML 2.0 Identity Provider as authentication provider
+	SAML *ProviderConfig_SAML `yaml:"saml"`
+	// Use passkeys, with WebAuthn, as authentication provider
+	WebAuthn *ProviderConfig_WebAuthn `yaml:"webAuthn"`
 	// Name of a test provider
 	// Used in tests only
 	TestProvider *string `yaml:"testProvider" ignoredocs:"true"`
@@ -378,6 +582,40 @@ type ConfigPortalHeader struct {
 	Property string `yaml:"property"`
 }
 
+type ConfigPortalRule struct {
+	// Host the rule applies to, as sent by Traefik in the `X-Forwarded-Host` header.
+	// Supports glob patterns, such as `*.example.com`.
+	// If empty, the rule applies to all hosts.
+	// +example "app.example.com"
+	Host string `yaml:"host"`
+	// Prefix of the path the rule applies to, as sent by Traefik in the `X-Forwarded-Uri` header.
+	// Prefixes match whole path segments: for example, `/admin` matches `/admin` and `/admin/users`, but not `/administrator`.
+	// +example "/admin"
+	PathPrefix string `yaml:"pathPrefix"`
+	// Regular expression the path must match for the rule to apply.
+	// Paths are decoded and normalized before matching, so for example `/public/../admin` is matched as `/admin`.
+	// +example "^/api/v[0-9]+/"
+	PathRegex string `yaml:"pathRegex"`
+	// List of HTTP methods the rule applies to, as sent by Traefik in the `X-Forwarded-Method` header.
+	// If empty, the rule applies to all methods.
+	// +example ["POST", "DELETE"]
+	Methods []string `yaml:"methods"`
+	// Action to take for requests matching the rule:
+	// - `allow`: allows authenticated users who satisfy the condition, if any
+	// - `deny`: denies users who satisfy the condition, or all users if there's no condition
+	// - `public`: allows all requests, without requiring authentication
+	// +default "allow"
+	Action string `yaml:"action"`
+	// Authorization condition for the rule, using the same syntax as the `if` query string arg.
+	// Cannot be set when the action is `public`.
+	// +example 'Group("admins")'
+	Condition string `yaml:"condition"`
+
+	// Parsed values - internal
+	pathRegexp *regexp.Regexp
+	predicate  conditions.UserProfilePredicate
+}
+
 // ConfigDev includes options using during development only
 type ConfigDev struct {
 	// If true, disables caching on the client
@@ -386,10 +624,18 @@ type ConfigDev struct {
 
 // Internal properties
 type internal struct {
-	instanceID       string
-	configFileLoaded string // Path to the config file that was loaded
-	tokenSigningKey  jwk.Key
-	pkceKey          []byte
+	instanceID            string
+	configFileLoaded      string // Path to the config file that was loaded
+	tokenSigningKey       jwk.Key
+	tokenVerificationKeys jwk.Set
+	sessionKey            jwk.Key
+	sessionKeyAlg         jwa.SignatureAlgorithm
+	sessionPublicKeys     jwk.Set
+	sessionEncryptionKeys jwk.Set
+	pkceKey               []byte
+	refreshTokenKeys      [][]byte
+	adminToken            string
+	policies              *conditions.Policies
 }
 
 // String implements fmt.Stringer and prints out the config for debugging
@@ -413,6 +659,75 @@ func (c *Config) GetTokenSigningKey() jwk.Key {
 	return c.internal.tokenSigningKey
 }
 
+// GetTokenVerificationKeys returns the set of keys that are used to verify tokens signed with the token signing key
+// This includes the token signing key and any other key configured for verification only, each with its key ID
+func (c *Config) GetTokenVerificationKeys() jwk.Set {
+	return c.internal.tokenVerificationKeys
+}
+
+// GetSessionSigningKey returns the algorithm and the key used to sign session tokens
+// If no asymmetric key is configured, session tokens are signed with HS256 using the token signing key
+func (c *Config) GetSessionSigningKey() (jwa.SignatureAlgorithm, jwk.Key) {
+	if c.internal.sessionKey == nil {
+		return jwa.HS256(), c.internal.tokenSigningKey
+	}
+	return c.internal.sessionKeyAlg, c.internal.sessionKey
+}
+
+// GetSessionVerificationKeys returns the set of keys used to verify session tokens
+// If no asymmetric key is configured, these are the token verification keys
+func (c *Config) GetSessionVerificationKeys() jwk.Set {
+	if c.internal.sessionPublicKeys == nil {
+		return c.internal.tokenVerificationKeys
+	}
+	return c.internal.sessionPublicKeys
+}
+
+// GetSessionPublicKeys returns the set of public keys that can be used to verify session tokens
+// It returns nil if session tokens are signed with a symmetric key
+func (c *Config) GetSessionPublicKeys() jwk.Set {
+	return c.internal.sessionPublicKeys
+}
+
+// GetSessionEncryptionKey returns the key used to encrypt session tokens
+func (c *Config) GetSessionEncryptionKey() jwk.Key {
+	if c.internal.sessionEncryptionKeys == nil || c.internal.sessionEncryptionKeys.Len() == 0 {
+		return nil
+	}
+	key, _ := c.internal.sessionEncryptionKeys.Key(0)
+	return key
+}
+
+// GetSessionDecryptionKeys returns the set of keys that can decrypt session tokens, one for each token signing key
+// The first key is the one returned by GetSessionEncryptionKey
+func (c *Config) GetSessionDecryptionKeys() jwk.Set {
+	return c.internal.sessionEncryptionKeys
+}
+
+// GetRefreshTokenKey returns the key used to encrypt refresh tokens stored in session tokens
+func (c *Config) GetRefreshTokenKey() []byte {
+	if len(c.internal.refreshTokenKeys) == 0 {
+		return nil
+	}
+	return c.internal.refreshTokenKeys[0]
+}
+
+// GetRefreshTokenDecryptionKeys returns the keys that can decrypt refresh tokens stored in session tokens, one for each token signing key
+// The first key is the one returned by GetRefreshTokenKey
+func (c *Config) GetRefreshTokenDecryptionKeys() [][]byte {
+	return c.internal.refreshTokenKeys
+}
+
+// GetPolicies returns the compiled named authorization policies
+func (c *Config) GetPolicies() *conditions.Policies {
+	return c.internal.policies
+}
+
+// GetAdminToken returns the static token used to authenticate with the admin API, if any
+func (c *Config) GetAdminToken() string {
+	return c.internal.adminToken
+}
+
 // GetInstanceID returns the instance ID.
 func (c *Config) GetInstanceID() string {
 	return c.internal.instanceID
@@ -446,6 +761,12 @@ func (c *Config) Process(log *slog.Logger) (err error) {
 		return err
 	}
 
+	// Load the asymmetric key for session tokens, if any
+	err = c.SetSessionSigningKey()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -477,6 +798,36 @@ func (c *Config) Validate(logger *slog.Logger) error {
 		return errors.New("property 'tokens.sessionLifetime' is invalid: must be at least 1 minute")
 	}
 
+	// Session store
+	switch c.Sessions.Store {
+	case "", "memory":
+		// Nop
+	case "bolt":
+		if c.Sessions.StorePath == "" {
+			return errors.New("property 'sessions.storePath' is required when 'sessions.store' is 'bolt'")
+		}
+	default:
+		return errors.New("property 'sessions.store' is invalid: must be empty, 'memory', or 'bolt'")
+	}
+
+	// Authorization policies
+	// These are compiled before the admin API's configuration, whose condition can reference them
+	c.internal.policies, err = conditions.NewPolicies(c.Policies)
+	if err != nil {
+		return fmt.Errorf("property 'policies' is invalid: %w", err)
+	}
+
+	// Admin API
+	err = c.validateAdmin()
+	if err != nil {
+		return err
+	}
+
+	// TOTP
+	if c.TOTP.StorePath == "" && slices.ContainsFunc(c.Portals, func(p ConfigPortal) bool { return p.RequireTOTP }) {
+		return errors.New("property 'totp.storePath' is required when 'requireTOTP' is enabled for a portal")
+	}
+
 	// Parse portals' configurations and validate them
 	if len(c.Portals) == 0 {
 		return errors.New("at least one portal must be defined")
@@ -509,6 +860,81 @@ func (c *Config) Validate(logger *slog.Logger) error {
 	return nil
 }
 
+// validateAdmin validates the configuration for the admin API and loads the admin token
+func (c *Config) validateAdmin() error {
+	c.internal.adminToken = ""
+	if !c.Admin.Enabled {
+		return nil
+	}
+
+	if c.Sessions.Store == "" {
+		return errors.New("property 'sessions.store' is required when the admin API is enabled")
+	}
+
+	// Load the token, reading from file if needed
+	token := c.Admin.Token
+	if token == "" && c.Admin.TokenFile != "" {
+		b, err := os.ReadFile(c.Admin.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read admin token from file '%s': %w", c.Admin.TokenFile, err)
+		}
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			return fmt.Errorf("admin token file '%s' is empty", c.Admin.TokenFile)
+		}
+	}
+	if token != "" && len(token) < 20 {
+		return errors.New("property 'admin.token' is invalid: must be at least 20 characters")
+	}
+
+	if c.Admin.ClientCertificate {
+		if !c.Server.TLSClientAuth {
+			return errors.New("property 'admin.clientCertificate' requires 'server.tlsClientAuth' to be enabled")
+		}
+
+		// Every certificate signed by the CA is accepted during the TLS handshake, including those of Traefik and of users, so admins must be allow-listed
+		if len(c.Admin.ClientCertificateSubjects) == 0 && len(c.Admin.ClientCertificateFingerprints) == 0 {
+			return errors.New("property 'admin.clientCertificate' requires at least one value in 'admin.clientCertificateSubjects' or 'admin.clientCertificateFingerprints'")
+		}
+		for i, v := range c.Admin.ClientCertificateSubjects {
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("property 'admin.clientCertificateSubjects' is invalid: value at index %d is empty", i)
+			}
+		}
+		for i, v := range c.Admin.ClientCertificateFingerprints {
+			// Fingerprints are normalized to lowercase hex without separators
+			fp := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(v), ":", ""))
+			decoded, err := hex.DecodeString(fp)
+			if err != nil || len(decoded) != sha256.Size {
+				return fmt.Errorf("property 'admin.clientCertificateFingerprints' is invalid: value at index %d is not a hex-encoded SHA-256 fingerprint", i)
+			}
+			c.Admin.ClientCertificateFingerprints[i] = fp
+		}
+	} else if len(c.Admin.ClientCertificateSubjects) > 0 || len(c.Admin.ClientCertificateFingerprints) > 0 {
+		return errors.New("properties 'admin.clientCertificateSubjects' and 'admin.clientCertificateFingerprints' require 'admin.clientCertificate' to be enabled")
+	}
+
+	if c.Admin.Portal != "" {
+		if !slices.ContainsFunc(c.Portals, func(p ConfigPortal) bool { return p.Name == c.Admin.Portal }) {
+			return fmt.Errorf("property 'admin.portal' is invalid: portal '%s' does not exist in the configuration", c.Admin.Portal)
+		}
+		if c.Admin.Condition == "" {
+			return errors.New("property 'admin.condition' is required when 'admin.portal' is set")
+		}
+		_, err := c.internal.policies.NewPredicate(c.Admin.Condition)
+		if err != nil {
+			return fmt.Errorf("property 'admin.condition' is invalid: %w", err)
+		}
+	}
+
+	if token == "" && !c.Admin.ClientCertificate && c.Admin.Portal == "" {
+		return errors.New("at least one authentication method must be configured for the admin API: 'admin.token', 'admin.tokenFile', 'admin.clientCertificate', or 'admin.portal'")
+	}
+
+	c.internal.adminToken = token
+	return nil
+}
+
 // migrateLegacyDomainConfig handles the deprecated `cookies.domain` and `server.hostname` options
 // `cookies.domain` is migrated into a single-element `server.domains` (using `server.hostname` as the auth host when set)
 // `server.hostname` outside of the legacy migration path is ignored with a warning
@@ -677,6 +1103,20 @@ func (p *ConfigPortal) Parse(c *Config) error {
 		return errors.New("property 'tokens.sessionLifetime' is invalid: must be at least 1 minute (a zero or negative value uses the default for the server)")
 	}
 
+	// Validate the idle timeout
+	// A zero or negative value disables it
+	if p.IdleTimeout > 0 && p.IdleTimeout < time.Minute {
+		return errors.New("property 'idleTimeout' is invalid: must be at least 1 minute (a zero or negative value disables the idle timeout)")
+	}
+
+	// Validate the session refresh window
+	if p.SessionRefreshWindow <= 0 {
+		p.SessionRefreshWindow = 15 * time.Minute
+	}
+	if p.SessionRefreshWindow < 10*time.Second {
+		return errors.New("property 'sessionRefreshWindow' is invalid: must be at least 10 seconds")
+	}
+
 	// Ensure there's at least one provider
 	if len(p.Providers) == 0 {
 		return errors.New("at least one authentication provider must be configured")
@@ -706,6 +1146,14 @@ func (p *ConfigPortal) Parse(c *Config) error {
 		}
 	}
 
+	// Parse the rules
+	for i := range p.Rules {
+		err := p.Rules[i].Parse(c)
+		if err != nil {
+			return fmt.Errorf("invalid rule at index %d: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
@@ -723,12 +1171,30 @@ func (v *ConfigPortalProvider) Parse(c *Config) (err error) {
 
 	// At this point, we know one and only one of the switch cases will be true
 	switch {
+	case v.BearerToken != nil:
+		v.BearerToken.Name, err = sanitizeProviderName(v.BearerToken.Name)
+		v.configParsed = v.BearerToken
+	case v.ClientCertificate != nil:
+		v.ClientCertificate.Name, err = sanitizeProviderName(v.ClientCertificate.Name)
+		v.configParsed = v.ClientCertificate
+	case v.GenericOAuth2 != nil:
+		v.GenericOAuth2.Name, err = sanitizeProviderName(v.GenericOAuth2.Name)
+		v.configParsed = v.GenericOAuth2
 	case v.GitHub != nil:
 		v.GitHub.Name, err = sanitizeProviderName(v.GitHub.Name)
 		v.configParsed = v.GitHub
+	case v.GitLab != nil:
+		v.GitLab.Name, err = sanitizeProviderName(v.GitLab.Name)
+		v.configParsed = v.GitLab
 	case v.Google != nil:
 		v.Google.Name, err = sanitizeProviderName(v.Google.Name)
 		v.configParsed = v.Google
+	case v.LDAP != nil:
+		v.LDAP.Name, err = sanitizeProviderName(v.LDAP.Name)
+		v.configParsed = v.LDAP
+	case v.LocalUsers != nil:
+		v.LocalUsers.Name, err = sanitizeProviderName(v.LocalUsers.Name)
+		v.configParsed = v.LocalUsers
 	case v.MicrosoftEntraID != nil:
 		v.MicrosoftEntraID.Name, err = sanitizeProviderName(v.MicrosoftEntraID.Name)
 		v.configParsed = v.MicrosoftEntraID
@@ -738,9 +1204,18 @@ func (v *ConfigPortalProvider) Parse(c *Config) (err error) {
 	case v.TailscaleWhois != nil:
 		v.TailscaleWhois.Name, err = sanitizeProviderName(v.TailscaleWhois.Name)
 		v.configParsed = v.TailscaleWhois
+	case v.TrustedHeader != nil:
+		v.TrustedHeader.Name, err = sanitizeProviderName(v.TrustedHeader.Name)
+		v.configParsed = v.TrustedHeader
 	case v.PocketID != nil:
 		v.PocketID.Name, err = sanitizeProviderName(v.PocketID.Name)
 		v.configParsed = v.PocketID
+	case v.SAML != nil:
+		v.SAML.Name, err = sanitizeProviderName(v.SAML.Name)
+		v.configParsed = v.SAML
+	case v.WebAuthn != nil:
+		v.WebAuthn.Name, err = sanitizeProviderName(v.WebAuthn.Name)
+		v.configParsed = v.WebAuthn
 	case v.TestProvider != nil:
 		fn, ok := testProviderConfigFactory[*v.TestProvider]
 		if !ok {
@@ -784,6 +1259,78 @@ func (h *ConfigPortalHeader) Parse(c *Config) (err error) {
 	return nil
 }
 
+func (r *ConfigPortalRule) Parse(c *Config) (err error) {
+	// Reset the parsed values before anything
+	r.pathRegexp = nil
+	r.predicate = nil
+
+	if r.Host == "" && r.PathPrefix == "" && r.PathRegex == "" && len(r.Methods) == 0 {
+		return errors.New("at least one of the properties 'host', 'pathPrefix', 'pathRegex', and 'methods' is required")
+	}
+
+	// Host names are case-insensitive
+	if r.Host != "" {
+		r.Host = strings.ToLower(r.Host)
+		_, err = path.Match(r.Host, "")
+		if err != nil {
+			return fmt.Errorf("property 'host' is invalid: %w", err)
+		}
+	}
+
+	if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+		return errors.New("property 'pathPrefix' is invalid: must start with '/'")
+	}
+
+	if r.PathRegex != "" {
+		r.pathRegexp, err = regexp.Compile(r.PathRegex)
+		if err != nil {
+			return fmt.Errorf("property 'pathRegex' is invalid: %w", err)
+		}
+	}
+
+	for i, m := range r.Methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			return errors.New("property 'methods' is invalid: methods cannot be empty")
+		}
+		r.Methods[i] = m
+	}
+
+	r.Action = strings.ToLower(r.Action)
+	switch r.Action {
+	case "":
+		r.Action = RuleActionAllow
+	case RuleActionAllow, RuleActionDeny:
+		// All good
+	case RuleActionPublic:
+		if r.Condition != "" {
+			return errors.New("property 'condition' cannot be set when 'action' is 'public'")
+		}
+	default:
+		return errors.New("property 'action' is invalid: must be 'allow', 'deny', or 'public'")
+	}
+
+	// Conditions can reference the named policies, which are compiled before the portals
+	if r.Condition != "" {
+		r.predicate, err = c.internal.policies.NewPredicate(r.Condition)
+		if err != nil {
+			return fmt.Errorf("property 'condition' is invalid: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetPathRegexp returns the compiled regular expression for the rule's path, or nil if the rule doesn't have one
+func (r ConfigPortalRule) GetPathRegexp() *regexp.Regexp {
+	return r.pathRegexp
+}
+
+// GetPredicate returns the compiled predicate for the rule's condition, or nil if the rule doesn't have one
+func (r ConfigPortalRule) GetPredicate() conditions.UserProfilePredicate {
+	return r.predicate
+}
+
 func sanitizeProviderName(name string) (string, error) {
 	// Sanitize the provider name if set
 	if name != "" {
@@ -795,69 +1342,353 @@ func sanitizeProviderName(name string) (string, error) {
 	return name, nil
 }
 
-// SetTokenSigningKey parses the token signing key.
-// If it's empty, will generate a new one.
+// SetTokenSigningKey parses the token signing keys.
+// If no key is configured, will generate a new one.
 func (c *Config) SetTokenSigningKey(logger *slog.Logger) (err error) {
-	var tokenSigningKeyRaw []byte
-	b := []byte(c.Tokens.SigningKey)
+	keys, err := c.loadTokenSigningKeys()
+	if err != nil {
+		return err
+	}
+
+	var tokenSigningKeysRaw, sessionEncryptionKeysRaw [][]byte
+	if len(keys) == 0 {
+		if logger != nil {
+			logger.Debug("No 'tokens.signingKey' found in the configuration: a random one will be generated")
+		}
+
+		// Generate 128 random bytes
+		// First 32 are for the token signing key
+		// Next 32 are for the PKCE key
+		// Next 32 are for the refresh token encryption key
+		// Last 32 are for the session encryption key
+		buf := make([]byte, 128)
+		_, err = io.ReadFull(rand.Reader, buf)
+		if err != nil {
+			return fmt.Errorf("failed to generate random bytes: %w", err)
+		}
+
+		tokenSigningKeysRaw = [][]byte{buf[:32]}
+		c.internal.pkceKey = buf[32:64]
+		c.internal.refreshTokenKeys = [][]byte{buf[64:96]}
+		sessionEncryptionKeysRaw = [][]byte{buf[96:]}
+	} else {
+		tokenSigningKeysRaw = make([][]byte, len(keys))
+		c.internal.refreshTokenKeys = make([][]byte, len(keys))
+		sessionEncryptionKeysRaw = make([][]byte, len(keys))
+		for i, b := range keys {
+			// Ensure that the key is at least 20-character long (although ideally it's 32 or more, but enforcing some minimum standard)
+			if len(b) < 20 {
+				return errors.New("token signing key is too short: must be at least 20 characters")
+			}
+
+			// Compute a HMAC to ensure the key is 256-bit long
+			// We generate four keys: one for signing tokens, one for PKCE, one for encrypting refresh tokens, and one for encrypting session tokens
+			// The PKCE key is only used for in-flight authentication requests, so it's derived from the first key only
+			h := hmac.New(crypto.SHA256.New, b)
+			h.Write([]byte("tfa-token-signing-key"))
+			tokenSigningKeysRaw[i] = h.Sum(nil)
+
+			if i == 0 {
+				h = hmac.New(crypto.SHA256.New, b)
+				h.Write([]byte("tfa-pkce-key"))
+				c.internal.pkceKey = h.Sum(nil)
+			}
+
+			h = hmac.New(crypto.SHA256.New, b)
+			h.Write([]byte("tfa-refresh-token-key"))
+			c.internal.refreshTokenKeys[i] = h.Sum(nil)
+
+			h = hmac.New(crypto.SHA256.New, b)
+			h.Write([]byte("tfa-session-encryption-key"))
+			sessionEncryptionKeysRaw[i] = h.Sum(nil)
+		}
+	}
+
+	// Import the token signing keys as jwk.Key objects
+	// The first key is used for signing, and all keys are used for verifying tokens
+	set := jwk.NewSet()
+	for i, raw := range tokenSigningKeysRaw {
+		key, err := jwk.Import[jwk.Key](raw)
+		if err != nil {
+			return fmt.Errorf("failed to import token signing key as jwk.Key: %w", err)
+		}
 
-	// Try reading from file if present
-	if len(b) == 0 && c.Tokens.SigningKeyFile != "" {
-		b, err = os.ReadFile(c.Tokens.SigningKeyFile)
+		// Calculate the key ID, which is used to select the key when verifying tokens
+		kid := computeKeyId(raw)
+		_ = key.Set(jwk.KeyIDKey, kid)
+		_ = key.Set(jwk.AlgorithmKey, jwa.HS256())
+
+		if _, found := set.LookupKeyID(kid); found {
+			return fmt.Errorf("token signing key %d is a duplicate of another key", i)
+		}
+		err = set.AddKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to add token signing key to the key set: %w", err)
+		}
+
+		if i == 0 {
+			c.internal.tokenSigningKey = key
+		}
+	}
+	c.internal.tokenVerificationKeys = set
+
+	// Import the session encryption keys too
+	// The first key is used for encrypting, and all keys are used for decrypting session tokens
+	encSet := jwk.NewSet()
+	for _, raw := range sessionEncryptionKeysRaw {
+		key, err := jwk.Import[jwk.Key](raw)
+		if err != nil {
+			return fmt.Errorf("failed to import session encryption key as jwk.Key: %w", err)
+		}
+
+		_ = key.Set(jwk.KeyIDKey, computeKeyId(raw))
+		_ = key.Set(jwk.AlgorithmKey, jwa.DIRECT())
+
+		err = encSet.AddKey(key)
 		if err != nil {
-			return fmt.Errorf("failed to read token signing key from file '%s': %w", c.Tokens.SigningKeyFile, err)
+			return fmt.Errorf("failed to add session encryption key to the key set: %w", err)
 		}
+	}
+	c.internal.sessionEncryptionKeys = encSet
 
+	return nil
+}
+
+// loadTokenSigningKeys returns the token signing keys from the configuration, in order
+// Keys can be set with one of `tokens.signingKey`, `tokens.signingKeyFile`, `tokens.signingKeys`, or `tokens.signingKeysDir`
+func (c *Config) loadTokenSigningKeys() ([][]byte, error) {
+	var set int
+	for _, isSet := range []bool{c.Tokens.SigningKey != "", c.Tokens.SigningKeyFile != "", len(c.Tokens.SigningKeys) > 0, c.Tokens.SigningKeysDir != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of 'tokens.signingKey', 'tokens.signingKeyFile', 'tokens.signingKeys', and 'tokens.signingKeysDir' can be set")
+	}
+
+	switch {
+	case c.Tokens.SigningKey != "":
+		return [][]byte{[]byte(c.Tokens.SigningKey)}, nil
+
+	case c.Tokens.SigningKeyFile != "":
+		b, err := os.ReadFile(c.Tokens.SigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token signing key from file '%s': %w", c.Tokens.SigningKeyFile, err)
+		}
 		if len(b) == 0 {
-			return fmt.Errorf("token signing key file '%s' is empty", c.Tokens.SigningKeyFile)
+			return nil, fmt.Errorf("token signing key file '%s' is empty", c.Tokens.SigningKeyFile)
+		}
+		return [][]byte{b}, nil
+
+	case len(c.Tokens.SigningKeys) > 0:
+		keys := make([][]byte, len(c.Tokens.SigningKeys))
+		for i, k := range c.Tokens.SigningKeys {
+			if k == "" {
+				return nil, fmt.Errorf("token signing key %d in 'tokens.signingKeys' is empty", i)
+			}
+			keys[i] = []byte(k)
 		}
+		return keys, nil
+
+	case c.Tokens.SigningKeysDir != "":
+		return readKeysDir(c.Tokens.SigningKeysDir, "token signing key")
+
+	default:
+		return nil, nil
 	}
+}
 
-	// Ensure that the key is at least 20-character long (although ideally it's 32 or more, but enforcing some minimum standard)
-	if len(b) > 0 && len(b) < 20 {
-		return errors.New("token signing key is too short: must be at least 20 characters")
+// readKeysDir reads keys from all files in a directory, sorted by name
+// Hidden files (whose name begins with a dot) and sub-directories are ignored
+// The description of the keys, such as "token signing key", is used in error messages
+func readKeysDir(dir string, desc string) ([][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %ss from directory '%s': %w", desc, dir, err)
 	}
 
-	if len(b) == 0 {
-		if logger != nil {
-			logger.Debug("No 'tokens.signingKey' found in the configuration: a random one will be generated")
+	// Entries are already sorted by name
+	keys := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
 		}
 
-		// Generate 64 random bytes
-		// First 32 are for the token signing key
-		// Last 32 are for the PKCE key
-		buf := make([]byte, 64)
-		_, err = io.ReadFull(rand.Reader, buf)
+		// Use os.Stat to follow symlinks, such as those used by Kubernetes for mounted secrets
+		path := filepath.Join(dir, e.Name())
+		info, err := os.Stat(path)
 		if err != nil {
-			return fmt.Errorf("failed to generate random bytes: %w", err)
+			return nil, fmt.Errorf("failed to read %s file '%s': %w", desc, path, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
 		}
 
-		tokenSigningKeyRaw = buf[:32]
-		c.internal.pkceKey = buf[32:]
-	} else {
-		// Compute a HMAC to ensure the key is 256-bit long
-		// We generate two keys: one for signing tokens, and one for PKCE
-		h := hmac.New(crypto.SHA256.New, b)
-		h.Write([]byte("tfa-token-signing-key"))
-		tokenSigningKeyRaw = h.Sum(nil)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s file '%s': %w", desc, path, err)
+		}
+		if len(b) == 0 {
+			return nil, fmt.Errorf("%s file '%s' is empty", desc, path)
+		}
+		keys = append(keys, b)
+	}
 
-		h = hmac.New(crypto.SHA256.New, b)
-		h.Write([]byte("tfa-pkce-key"))
-		c.internal.pkceKey = h.Sum(nil)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("directory '%s' does not contain any %s", dir, desc)
 	}
 
-	// Import the token signing key as a jwk.Key
-	c.internal.tokenSigningKey, err = jwk.Import[jwk.Key](tokenSigningKeyRaw)
+	return keys, nil
+}
+
+// loadSessionSigningKeys returns the PEM-encoded session signing keys from the configuration, in order
+// Keys can be set with one of `tokens.sessionSigningKeyPEM`, `tokens.sessionSigningKeyFile`, `tokens.sessionSigningKeysPEM`, or `tokens.sessionSigningKeysDir`
+func (c *Config) loadSessionSigningKeys() ([][]byte, error) {
+	var set int
+	for _, isSet := range []bool{c.Tokens.SessionSigningKeyPEM != "", c.Tokens.SessionSigningKeyFile != "", len(c.Tokens.SessionSigningKeysPEM) > 0, c.Tokens.SessionSigningKeysDir != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of 'tokens.sessionSigningKeyPEM', 'tokens.sessionSigningKeyFile', 'tokens.sessionSigningKeysPEM', and 'tokens.sessionSigningKeysDir' can be set")
+	}
+
+	switch {
+	case c.Tokens.SessionSigningKeyPEM != "":
+		return [][]byte{[]byte(c.Tokens.SessionSigningKeyPEM)}, nil
+
+	case c.Tokens.SessionSigningKeyFile != "":
+		b, err := os.ReadFile(c.Tokens.SessionSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session signing key from file '%s': %w", c.Tokens.SessionSigningKeyFile, err)
+		}
+		if len(b) == 0 {
+			return nil, fmt.Errorf("session signing key file '%s' is empty", c.Tokens.SessionSigningKeyFile)
+		}
+		return [][]byte{b}, nil
+
+	case len(c.Tokens.SessionSigningKeysPEM) > 0:
+		keys := make([][]byte, len(c.Tokens.SessionSigningKeysPEM))
+		for i, k := range c.Tokens.SessionSigningKeysPEM {
+			if k == "" {
+				return nil, fmt.Errorf("session signing key %d in 'tokens.sessionSigningKeysPEM' is empty", i)
+			}
+			keys[i] = []byte(k)
+		}
+		return keys, nil
+
+	case c.Tokens.SessionSigningKeysDir != "":
+		return readKeysDir(c.Tokens.SessionSigningKeysDir, "session signing key")
+
+	default:
+		return nil, nil
+	}
+}
+
+// SetSessionSigningKey loads the private keys used to sign session tokens with an asymmetric algorithm, if any.
+// The first key is used to sign new session tokens, while the public keys of all keys are used to verify them.
+func (c *Config) SetSessionSigningKey() error {
+	c.internal.sessionKey = nil
+	c.internal.sessionKeyAlg = jwa.EmptySignatureAlgorithm()
+	c.internal.sessionPublicKeys = nil
+
+	keys, err := c.loadSessionSigningKeys()
 	if err != nil {
-		return fmt.Errorf("failed to import token signing key as jwk.Key: %w", err)
+		return err
 	}
 
-	// Calculate the key ID
-	_ = c.internal.tokenSigningKey.Set(jwk.KeyIDKey, computeKeyId(tokenSigningKeyRaw))
+	// If there's no key, session tokens are signed with the token signing key
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pubSet := jwk.NewSet()
+	for i, b := range keys {
+		alg, key, err := parseSessionSigningKey(b)
+		if err != nil {
+			return fmt.Errorf("invalid session signing key %d: %w", i, err)
+		}
+
+		// Set the key ID to the thumbprint of the key, which is the same for the private and public key
+		err = jwk.AssignKeyID(key)
+		if err != nil {
+			return fmt.Errorf("failed to compute ID of session signing key %d: %w", i, err)
+		}
+		_ = key.Set(jwk.AlgorithmKey, alg)
+		_ = key.Set(jwk.KeyUsageKey, jwk.ForSignature)
+
+		kid, _ := key.KeyID()
+		if _, exists := pubSet.LookupKeyID(kid); exists {
+			return fmt.Errorf("session signing key %d is a duplicate of another key", i)
+		}
+
+		pub, err := key.PublicKey()
+		if err != nil {
+			return fmt.Errorf("failed to get public key from session signing key %d: %w", i, err)
+		}
+		err = pubSet.AddKey(pub)
+		if err != nil {
+			return fmt.Errorf("failed to add session signing key %d to the key set: %w", i, err)
+		}
+
+		// The first key is used to sign new tokens
+		if i == 0 {
+			c.internal.sessionKey = key
+			c.internal.sessionKeyAlg = alg
+		}
+	}
+
+	c.internal.sessionPublicKeys = pubSet
 
 	return nil
 }
 
+// parseSessionSigningKey parses a PEM-encoded private key for signing session tokens, and returns it together with the signing algorithm
+func parseSessionSigningKey(b []byte) (jwa.SignatureAlgorithm, jwk.Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return jwa.EmptySignatureAlgorithm(), nil, errors.New("failed to decode PEM block")
+	}
+
+	var (
+		raw any
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		raw, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return jwa.EmptySignatureAlgorithm(), nil, fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return jwa.EmptySignatureAlgorithm(), nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	var alg jwa.SignatureAlgorithm
+	switch k := raw.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return jwa.EmptySignatureAlgorithm(), nil, errors.New("unsupported curve for ECDSA key: only P-256 is supported")
+		}
+		alg = jwa.ES256()
+	case ed25519.PrivateKey:
+		alg = jwa.EdDSA()
+	default:
+		return jwa.EmptySignatureAlgorithm(), nil, fmt.Errorf("unsupported key type %T: only ECDSA P-256 and Ed25519 keys are supported", raw)
+	}
+
+	key, err := jwk.Import[jwk.Key](raw)
+	if err != nil {
+		return jwa.EmptySignatureAlgorithm(), nil, fmt.Errorf("failed to import key: %w", err)
+	}
+
+	return alg, key, nil
+}
+
 // Returns the key ID from a key
 func computeKeyId(k []byte) string {
 	h := sha256.Sum256(k)
@@ -2,11 +2,22 @@ package config
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/lestrrat-go/jwx/v4/jwa"
 	"github.com/lestrrat-go/jwx/v4/jwk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -223,6 +234,160 @@ func TestValidateConfig(t *testing.T) {
 		require.ErrorContains(t, err, "at least one portal must be defined")
 	})
 
+	t.Run("fails when session store is invalid", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Sessions.Store = "redis"
+		}))
+
+		err := config.Validate(log)
+		require.Error(t, err)
+		require.ErrorContains(t, err, "property 'sessions.store' is invalid")
+	})
+
+	t.Run("fails when bolt session store has no path", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Sessions.Store = "bolt"
+			c.Sessions.StorePath = ""
+		}))
+
+		err := config.Validate(log)
+		require.Error(t, err)
+		require.ErrorContains(t, err, "property 'sessions.storePath' is required")
+	})
+
+	t.Run("fails when portal requires TOTP without a store path", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Portals[0].RequireTOTP = true
+			c.TOTP.StorePath = ""
+		}))
+
+		err := config.Validate(log)
+		require.Error(t, err)
+		require.ErrorContains(t, err, "property 'totp.storePath' is required")
+	})
+
+	t.Run("policies", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Policies = map[string]string{
+				"admins":     `Group("admins")`,
+				"mfa-admins": `Policy("admins") && AMR("mfa")`,
+			}
+		}))
+
+		err := config.Validate(log)
+		require.NoError(t, err)
+		_, ok := config.GetPolicies().Get("mfa-admins")
+		assert.True(t, ok)
+	})
+
+	t.Run("fails when a policy is invalid", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Policies = map[string]string{
+				"admins": `Group("admins") || Policy("nope")`,
+			}
+		}))
+
+		err := config.Validate(log)
+		require.Error(t, err)
+		require.ErrorContains(t, err, "property 'policies' is invalid")
+		require.ErrorContains(t, err, "policy 'nope' is not defined")
+	})
+
+	t.Run("portal rules", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			rule   ConfigPortalRule
+			errMsg string
+		}{
+			{name: "valid with path prefix", rule: ConfigPortalRule{PathPrefix: "/admin", Condition: `Policy("admins")`}},
+			{name: "valid public rule", rule: ConfigPortalRule{Host: "*.example.com", PathRegex: "^/public/", Action: "PUBLIC"}},
+			{name: "valid deny rule", rule: ConfigPortalRule{Methods: []string{"delete"}, Action: "deny"}},
+			{name: "no match properties", rule: ConfigPortalRule{Condition: `Group("admins")`}, errMsg: "at least one of the properties"},
+			{name: "invalid host", rule: ConfigPortalRule{Host: "[example.com"}, errMsg: "property 'host' is invalid"},
+			{name: "invalid path prefix", rule: ConfigPortalRule{PathPrefix: "admin"}, errMsg: "property 'pathPrefix' is invalid"},
+			{name: "invalid path regex", rule: ConfigPortalRule{PathRegex: "^/(admin"}, errMsg: "property 'pathRegex' is invalid"},
+			{name: "empty method", rule: ConfigPortalRule{Methods: []string{" "}}, errMsg: "property 'methods' is invalid"},
+			{name: "invalid action", rule: ConfigPortalRule{PathPrefix: "/", Action: "block"}, errMsg: "property 'action' is invalid"},
+			{name: "public rule with condition", rule: ConfigPortalRule{PathPrefix: "/", Action: "public", Condition: `Group("admins")`}, errMsg: "property 'condition' cannot be set"},
+			{name: "invalid condition", rule: ConfigPortalRule{PathPrefix: "/", Condition: "Group("}, errMsg: "property 'condition' is invalid"},
+			{name: "condition references undefined policy", rule: ConfigPortalRule{PathPrefix: "/", Condition: `Policy("nope")`}, errMsg: "policy 'nope' is not defined"},
+			{name: "condition is not a boolean", rule: ConfigPortalRule{PathPrefix: "/", Condition: "false"}, errMsg: "condition does not return a boolean"},
+			{name: "condition is a string", rule: ConfigPortalRule{PathPrefix: "/", Action: "deny", Condition: `"email"`}, errMsg: "condition does not return a boolean"},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Cleanup(SetTestConfig(func(c *Config) {
+					c.Policies = map[string]string{
+						"admins": `Group("admins")`,
+					}
+					c.Portals[0].Rules = []ConfigPortalRule{tc.rule}
+				}))
+
+				err := config.Validate(log)
+				if tc.errMsg != "" {
+					require.Error(t, err)
+					require.ErrorContains(t, err, "invalid rule at index 0")
+					require.ErrorContains(t, err, tc.errMsg)
+					return
+				}
+				require.NoError(t, err)
+
+				// Actions are normalized
+				rule := config.Portals[0].Rules[0]
+				assert.Contains(t, []string{RuleActionAllow, RuleActionDeny, RuleActionPublic}, rule.Action)
+				assert.Equal(t, tc.rule.PathRegex != "", rule.GetPathRegexp() != nil)
+				assert.Equal(t, tc.rule.Condition != "", rule.GetPredicate() != nil)
+			})
+		}
+	})
+
+	t.Run("admin API", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			admin  ConfigAdmin
+			mtls   bool
+			store  string
+			errMsg string
+		}{
+			{name: "valid with token", admin: ConfigAdmin{Enabled: true, Token: "0123456789abcdefghij"}, store: "memory"},
+			{name: "valid with portal", admin: ConfigAdmin{Enabled: true, Portal: "github1", Condition: `Group("admins")`}, store: "memory"},
+			{name: "requires session store", admin: ConfigAdmin{Enabled: true, Token: "0123456789abcdefghij"}, errMsg: "property 'sessions.store' is required"},
+			{name: "requires an authentication method", admin: ConfigAdmin{Enabled: true}, store: "memory", errMsg: "at least one authentication method"},
+			{name: "token too short", admin: ConfigAdmin{Enabled: true, Token: "short"}, store: "memory", errMsg: "property 'admin.token' is invalid"},
+			{name: "client certificate requires mTLS", admin: ConfigAdmin{Enabled: true, ClientCertificate: true}, store: "memory", errMsg: "requires 'server.tlsClientAuth'"},
+			{name: "client certificate requires an allowlist", admin: ConfigAdmin{Enabled: true, ClientCertificate: true}, mtls: true, store: "memory", errMsg: "requires at least one value in 'admin.clientCertificateSubjects'"},
+			{name: "valid with client certificate subjects", admin: ConfigAdmin{Enabled: true, ClientCertificate: true, ClientCertificateSubjects: []string{"admin-cli"}}, mtls: true, store: "memory"},
+			{name: "valid with client certificate fingerprints", admin: ConfigAdmin{Enabled: true, ClientCertificate: true, ClientCertificateFingerprints: []string{strings.Repeat("AB:", 31) + "AB"}}, mtls: true, store: "memory"},
+			{name: "empty client certificate subject", admin: ConfigAdmin{Enabled: true, ClientCertificate: true, ClientCertificateSubjects: []string{" "}}, mtls: true, store: "memory", errMsg: "property 'admin.clientCertificateSubjects' is invalid"},
+			{name: "invalid client certificate fingerprint", admin: ConfigAdmin{Enabled: true, ClientCertificate: true, ClientCertificateFingerprints: []string{"abcd"}}, mtls: true, store: "memory", errMsg: "property 'admin.clientCertificateFingerprints' is invalid"},
+			{name: "allowlist without client certificate", admin: ConfigAdmin{Enabled: true, Token: "0123456789abcdefghij", ClientCertificateSubjects: []string{"admin-cli"}}, store: "memory", errMsg: "require 'admin.clientCertificate' to be enabled"},
+			{name: "portal does not exist", admin: ConfigAdmin{Enabled: true, Portal: "nope", Condition: `Group("admins")`}, store: "memory", errMsg: "portal 'nope' does not exist"},
+			{name: "portal requires condition", admin: ConfigAdmin{Enabled: true, Portal: "github1"}, store: "memory", errMsg: "property 'admin.condition' is required"},
+			{name: "invalid condition", admin: ConfigAdmin{Enabled: true, Portal: "github1", Condition: "Group("}, store: "memory", errMsg: "property 'admin.condition' is invalid"},
+			{name: "condition is not a boolean", admin: ConfigAdmin{Enabled: true, Portal: "github1", Condition: "false"}, store: "memory", errMsg: "condition does not return a boolean"},
+			{name: "condition references undefined policy", admin: ConfigAdmin{Enabled: true, Portal: "github1", Condition: `Policy("admins")`}, store: "memory", errMsg: "policy 'admins' is not defined"},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Cleanup(SetTestConfig(func(c *Config) {
+					c.Admin = tc.admin
+					c.Sessions.Store = tc.store
+					c.Server.TLSClientAuth = tc.mtls
+				}))
+
+				err := config.Validate(log)
+				if tc.errMsg == "" {
+					require.NoError(t, err)
+					assert.Equal(t, tc.admin.Token, config.GetAdminToken())
+				} else {
+					require.ErrorContains(t, err, tc.errMsg)
+				}
+			})
+		}
+	})
+
 	t.Run("fails when portal has invalid name", func(t *testing.T) {
 		t.Cleanup(SetTestConfig(func(c *Config) {
 			c.Portals = []ConfigPortal{
@@ -411,6 +576,19 @@ func TestSetTokenSigningKey(t *testing.T) {
 		tskRaw, err := jwk.Export[[]byte](tsk)
 		require.NoError(t, err)
 		assert.Equal(t, "ab5150d6fd45693503c863ff3fb6e5c51890efbc094bef810d8ae79f5139aa81", hex.EncodeToString(tskRaw))
+
+		// Derived keys must be different from the token signing key and from each other
+		rtk := config.GetRefreshTokenKey()
+		require.Len(t, rtk, 32)
+		assert.NotEqual(t, tskRaw, rtk)
+		assert.NotEqual(t, config.internal.pkceKey, rtk)
+
+		sek, err := jwk.Export[[]byte](config.GetSessionEncryptionKey())
+		require.NoError(t, err)
+		require.Len(t, sek, 32)
+		assert.NotEqual(t, tskRaw, sek)
+		assert.NotEqual(t, rtk, sek)
+		assert.NotEqual(t, config.internal.pkceKey, sek)
 	})
 
 	t.Run("tokenSigningKey not present", func(t *testing.T) {
@@ -437,6 +615,334 @@ func TestSetTokenSigningKey(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotEqual(t, tsk1Raw, tsk2Raw)
 	})
+
+	assertVerificationKeys := func(t *testing.T, expectLen int) {
+		t.Helper()
+
+		set := config.GetTokenVerificationKeys()
+		require.Equal(t, expectLen, set.Len())
+
+		// The first key is the signing key
+		first, _ := set.Key(0)
+		assert.Equal(t, config.GetTokenSigningKey(), first)
+		assert.Len(t, config.GetRefreshTokenDecryptionKeys(), expectLen)
+		assert.Equal(t, expectLen, config.GetSessionDecryptionKeys().Len())
+		assert.Equal(t, config.GetRefreshTokenKey(), config.GetRefreshTokenDecryptionKeys()[0])
+
+		// Each key has a different ID and the HS256 algorithm
+		kids := map[string]struct{}{}
+		for i := range set.Len() {
+			key, _ := set.Key(i)
+			kid, ok := key.KeyID()
+			require.True(t, ok)
+			kids[kid] = struct{}{}
+			alg, _ := key.Algorithm()
+			assert.Equal(t, jwa.HS256().String(), alg.String())
+		}
+		assert.Len(t, kids, expectLen)
+	}
+
+	t.Run("signingKeys list", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SigningKey = ""
+			c.Tokens.SigningKeys = []string{"hello-world-1234567890", "previous-key-1234567890"}
+		}))
+
+		err := config.SetTokenSigningKey(logger)
+		require.NoError(t, err)
+
+		// The first key is the same as when it's set in signingKey
+		tskRaw, err := jwk.Export[[]byte](config.GetTokenSigningKey())
+		require.NoError(t, err)
+		assert.Equal(t, "ab5150d6fd45693503c863ff3fb6e5c51890efbc094bef810d8ae79f5139aa81", hex.EncodeToString(tskRaw))
+
+		assertVerificationKeys(t, 2)
+	})
+
+	t.Run("signingKeysDir", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "2-previous"), []byte("previous-key-1234567890"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "1-current"), []byte("hello-world-1234567890"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("hidden-key-1234567890"), 0o600))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o700))
+
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SigningKey = ""
+			c.Tokens.SigningKeysDir = dir
+		}))
+
+		err := config.SetTokenSigningKey(logger)
+		require.NoError(t, err)
+
+		tskRaw, err := jwk.Export[[]byte](config.GetTokenSigningKey())
+		require.NoError(t, err)
+		assert.Equal(t, "ab5150d6fd45693503c863ff3fb6e5c51890efbc094bef810d8ae79f5139aa81", hex.EncodeToString(tskRaw))
+
+		assertVerificationKeys(t, 2)
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		emptyDir := t.TempDir()
+
+		tests := map[string]struct {
+			updater func(c *Config)
+			errMsg  string
+		}{
+			"multiple options": {
+				updater: func(c *Config) {
+					c.Tokens.SigningKey = "hello-world-1234567890"
+					c.Tokens.SigningKeys = []string{"previous-key-1234567890"}
+				},
+				errMsg: "only one of",
+			},
+			"key too short": {
+				updater: func(c *Config) {
+					c.Tokens.SigningKeys = []string{"hello-world-1234567890", "short"}
+				},
+				errMsg: "token signing key is too short",
+			},
+			"empty key": {
+				updater: func(c *Config) {
+					c.Tokens.SigningKeys = []string{"hello-world-1234567890", ""}
+				},
+				errMsg: "is empty",
+			},
+			"duplicate keys": {
+				updater: func(c *Config) {
+					c.Tokens.SigningKeys = []string{"hello-world-1234567890", "hello-world-1234567890"}
+				},
+				errMsg: "duplicate",
+			},
+			"empty directory": {
+				updater: func(c *Config) {
+					c.Tokens.SigningKeysDir = emptyDir
+				},
+				errMsg: "does not contain any token signing key",
+			},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				t.Cleanup(SetTestConfig(func(c *Config) {
+					c.Tokens.SigningKey = ""
+					tc.updater(c)
+				}))
+
+				err := config.SetTokenSigningKey(logger)
+				require.ErrorContains(t, err, tc.errMsg)
+			})
+		}
+	})
+}
+
+func TestSetSessionSigningKey(t *testing.T) {
+	encodePKCS8 := func(t *testing.T, key any) string {
+		t.Helper()
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("no key", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SigningKey = "hello-world-1234567890"
+		}))
+		require.NoError(t, config.SetTokenSigningKey(nil))
+
+		err := config.SetSessionSigningKey()
+		require.NoError(t, err)
+
+		assert.Nil(t, config.GetSessionPublicKeys())
+		alg, key := config.GetSessionSigningKey()
+		assert.Equal(t, jwa.HS256(), alg)
+		assert.Equal(t, config.GetTokenSigningKey(), key)
+		assert.Equal(t, config.GetTokenVerificationKeys(), config.GetSessionVerificationKeys())
+	})
+
+	t.Run("ECDSA P-256 key", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeyPEM = encodePKCS8(t, ecKey)
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.NoError(t, err)
+
+		alg, key := config.GetSessionSigningKey()
+		assert.Equal(t, jwa.ES256(), alg)
+		isPrivate, err := jwk.IsPrivateKey(key)
+		require.NoError(t, err)
+		assert.True(t, isPrivate)
+
+		pubs := config.GetSessionPublicKeys()
+		require.NotNil(t, pubs)
+		require.Equal(t, 1, pubs.Len())
+		pub, _ := pubs.Key(0)
+		isPrivate, err = jwk.IsPrivateKey(pub)
+		require.NoError(t, err)
+		assert.False(t, isPrivate)
+
+		// Key IDs must match
+		kid, ok := key.KeyID()
+		require.True(t, ok)
+		require.NotEmpty(t, kid)
+		pubKid, _ := pub.KeyID()
+		assert.Equal(t, kid, pubKid)
+		pubAlg, _ := pub.Algorithm()
+		assert.Equal(t, jwa.ES256().String(), pubAlg.String())
+
+		verificationKeys := config.GetSessionVerificationKeys()
+		require.Equal(t, 1, verificationKeys.Len())
+		verificationKey, ok := verificationKeys.LookupKeyID(kid)
+		require.True(t, ok)
+		assert.Equal(t, pub, verificationKey)
+	})
+
+	t.Run("ECDSA P-256 key in SEC 1 format from file", func(t *testing.T) {
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		require.NoError(t, err)
+		keyFile := filepath.Join(t.TempDir(), "key.pem")
+		err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+		require.NoError(t, err)
+
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeyFile = keyFile
+		}))
+
+		err = config.SetSessionSigningKey()
+		require.NoError(t, err)
+
+		alg, _ := config.GetSessionSigningKey()
+		assert.Equal(t, jwa.ES256(), alg)
+	})
+
+	t.Run("Ed25519 key", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeyPEM = encodePKCS8(t, edKey)
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.NoError(t, err)
+
+		alg, _ := config.GetSessionSigningKey()
+		assert.Equal(t, jwa.EdDSA(), alg)
+		require.NotNil(t, config.GetSessionPublicKeys())
+	})
+
+	// Checks that the first key is used for signing, and that the public keys of all keys are used for verification
+	assertRotatedKeys := func(t *testing.T) {
+		t.Helper()
+
+		alg, key := config.GetSessionSigningKey()
+		assert.Equal(t, jwa.EdDSA(), alg)
+		kid, _ := key.KeyID()
+
+		expectPub, err := jwk.Import[jwk.Key](ecKey.Public())
+		require.NoError(t, err)
+		require.NoError(t, jwk.AssignKeyID(expectPub))
+		ecKid, _ := expectPub.KeyID()
+
+		pubs := config.GetSessionPublicKeys()
+		require.NotNil(t, pubs)
+		require.Equal(t, 2, pubs.Len())
+		_, ok := pubs.LookupKeyID(kid)
+		assert.True(t, ok)
+		_, ok = pubs.LookupKeyID(ecKid)
+		assert.True(t, ok)
+		assert.Equal(t, pubs, config.GetSessionVerificationKeys())
+	}
+
+	t.Run("rotate keys with list", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeysPEM = []string{encodePKCS8(t, edKey), encodePKCS8(t, ecKey)}
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.NoError(t, err)
+		assertRotatedKeys(t)
+	})
+
+	t.Run("rotate keys with directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "1-new.pem"), []byte(encodePKCS8(t, edKey)), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "2-old.pem"), []byte(encodePKCS8(t, ecKey)), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("not-a-key"), 0o600))
+
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeysDir = dir
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.NoError(t, err)
+		assertRotatedKeys(t)
+	})
+
+	t.Run("empty directory", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeysDir = t.TempDir()
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.ErrorContains(t, err, "does not contain any session signing key")
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeysPEM = []string{encodePKCS8(t, ecKey), encodePKCS8(t, ecKey)}
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.ErrorContains(t, err, "session signing key 1 is a duplicate")
+	})
+
+	t.Run("multiple options set", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeyPEM = encodePKCS8(t, ecKey)
+			c.Tokens.SessionSigningKeysPEM = []string{encodePKCS8(t, edKey)}
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.ErrorContains(t, err, "only one of")
+	})
+
+	t.Run("unsupported keys", func(t *testing.T) {
+		p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			pem    string
+			errMsg string
+		}{
+			"ECDSA P-384": {pem: encodePKCS8(t, p384Key), errMsg: "only P-256 is supported"},
+			"RSA":         {pem: encodePKCS8(t, rsaKey), errMsg: "unsupported key type"},
+			"not PEM":     {pem: "not-a-pem-key", errMsg: "failed to decode PEM block"},
+			"public key":  {pem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("foo")})), errMsg: "unsupported PEM block type"},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				t.Cleanup(SetTestConfig(func(c *Config) {
+					c.Tokens.SessionSigningKeyPEM = tc.pem
+				}))
+
+				err := config.SetSessionSigningKey()
+				require.ErrorContains(t, err, tc.errMsg)
+			})
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Cleanup(SetTestConfig(func(c *Config) {
+			c.Tokens.SessionSigningKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+		}))
+
+		err := config.SetSessionSigningKey()
+		require.ErrorContains(t, err, "failed to read session signing key from file")
+	})
 }
 
 func TestSplitAuthHost(t *testing.T) {
@@ -0,0 +1,93 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_BearerToken is the configuration for the bearer token provider
+// +name bearertoken
+// +displayName Bearer token
+type ProviderConfig_BearerToken struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-bearer-token"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "GitHub Actions"
+	DisplayName string `yaml:"displayName"`
+	// Issuer of the tokens
+	// The OpenID Connect configuration document will be fetched at `<token-issuer>/.well-known/openid-configuration`, and it must include the `jwks_uri`
+	// +example "https://token.actions.githubusercontent.com"
+	// +required
+	TokenIssuer string `yaml:"tokenIssuer"`
+	// Expected value for the audience ("aud" claim) of the tokens
+	// +example "https://auth.example.com"
+	// +required
+	TokenAudience string `yaml:"tokenAudience"`
+	// Timeout for network requests to the issuer
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, skips validating TLS certificates when connecting to the issuer.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when connecting to the issuer.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when connecting to the issuer.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "githubactions"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "slate"
+	Color string `yaml:"color"`
+}
+
+func (p *ProviderConfig_BearerToken) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	var (
+		err              error
+		tlsCACertificate []byte
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	return auth.NewBearerToken(ctx, auth.NewBearerTokenOptions{
+		TokenIssuer:      p.TokenIssuer,
+		TokenAudience:    p.TokenAudience,
+		RequestTimeout:   p.RequestTimeout,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+	})
+}
+
+func (p *ProviderConfig_BearerToken) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_BearerToken) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
@@ -0,0 +1,110 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_ClientCertificate is the configuration for the client certificate provider
+// +name clientcertificate
+// +displayName Client certificate
+type ProviderConfig_ClientCertificate struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-client-certificate"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Client certificate"
+	DisplayName string `yaml:"displayName"`
+	// Where the client certificate is read from. Allowed values are:
+	// - `tls`: the certificate presented by the client on the TLS connection to Traefik Forward Auth, which requires `server.tlsClientAuth` to be enabled
+	// - `header`: a header containing the certificate, set by a trusted proxy such as Traefik's PassTLSClientCert middleware
+	// +default "tls"
+	Source string `yaml:"source"`
+	// Name of the header containing the client certificate, when `source` is `header`
+	// +default "X-Forwarded-Tls-Client-Cert"
+	Header string `yaml:"header"`
+	// List of IP ranges, in CIDR notation, of the proxies that are allowed to set the header containing the client certificate
+	// Required when `source` is `header`
+	// +example ["10.0.0.0/8"]
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// Optional PEM-encoded CA certificate used to verify client certificates passed in the header, when `source` is `header`
+	// If not set, certificates in the header are trusted as long as they're within their validity period, as they're assumed to have been verified by the proxy
+	CACertificatePEM string `yaml:"caCertificatePEM"`
+	// Optional path to a file containing the PEM-encoded CA certificate used to verify client certificates passed in the header
+	// This is an alternative to `caCertificatePEM`
+	// +example "/etc/traefik-forward-auth/clients-ca.pem"
+	CACertificatePath string `yaml:"caCertificatePath"`
+	// Field of the certificate used as user ID. Allowed values are:
+	// - `cn`: the common name in the certificate's subject
+	// - `email`: the first email address in the certificate's subject alternative names
+	// - `uri`: the first URI in the certificate's subject alternative names, such as a SPIFFE ID
+	// +default "cn"
+	UserIDFrom string `yaml:"userIdFrom"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "key"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "slate"
+	Color string `yaml:"color"`
+
+	config *Config
+}
+
+func (p *ProviderConfig_ClientCertificate) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	opts := auth.NewClientCertificateOptions{
+		UserIDFrom: p.UserIDFrom,
+	}
+
+	switch p.Source {
+	case "", "tls":
+		if p.config != nil && !p.config.Server.TLSClientAuth {
+			return nil, errors.New("reading the certificate from the TLS connection requires 'server.tlsClientAuth' to be enabled")
+		}
+	case "header":
+		opts.Header = p.Header
+		if opts.Header == "" {
+			opts.Header = "X-Forwarded-Tls-Client-Cert"
+		}
+		opts.TrustedProxies = p.TrustedProxies
+
+		switch {
+		case p.CACertificatePEM != "" && p.CACertificatePath != "":
+			return nil, errors.New("cannot pass both 'caCertificatePEM' and 'caCertificatePath'")
+		case p.CACertificatePEM != "":
+			opts.CACertificate = []byte(p.CACertificatePEM)
+		case p.CACertificatePath != "":
+			var err error
+			opts.CACertificate, err = os.ReadFile(p.CACertificatePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate from '%s': %w", p.CACertificatePath, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("value for 'source' is invalid: '%s'", p.Source)
+	}
+
+	return auth.NewClientCertificate(opts)
+}
+
+func (p *ProviderConfig_ClientCertificate) SetConfigObject(c *Config) {
+	p.config = c
+}
+
+func (p *ProviderConfig_ClientCertificate) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
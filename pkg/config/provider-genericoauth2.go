@@ -0,0 +1,169 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_GenericOAuth2 is the configuration for the generic OAuth2 provider
+// +name genericoauth2
+// +displayName Generic OAuth2
+type ProviderConfig_GenericOAuth2 struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-oauth2-auth"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Discord"
+	DisplayName string `yaml:"displayName"`
+	// URL of the authorization endpoint
+	// +required
+	// +example "https://discord.com/oauth2/authorize"
+	AuthorizationURL string `yaml:"authorizationURL"`
+	// URL of the token endpoint
+	// +required
+	// +example "https://discord.com/api/oauth2/token"
+	TokenURL string `yaml:"tokenURL"`
+	// URL of the user info endpoint, which returns a JSON object with the user's profile
+	// The endpoint is invoked with the access token as bearer token
+	// +required
+	// +example "https://discord.com/api/users/@me"
+	UserInfoURL string `yaml:"userInfoURL"`
+	// Client ID for the OAuth2 application
+	// +required
+	// +example "your-client-id"
+	ClientID string `yaml:"clientID"`
+	// Client secret for the OAuth2 application
+	// One of `clientSecret` and `clientSecretFile` is required.
+	// +required
+	// +example "your-client-secret"
+	ClientSecret string `yaml:"clientSecret"`
+	// File containing the client secret for the OAuth2 application
+	// This is an alternative to passing the secret as `clientSecret`
+	// One of `clientSecret` and `clientSecretFile` is required.
+	// +example "/var/run/secrets/traefik-forward-auth/oauth2/client-secret"
+	ClientSecretFile string `yaml:"clientSecretFile"`
+	// OAuth2 scopes to request
+	// +default "openid profile email"
+	// +example "identify email"
+	Scopes string `yaml:"scopes"`
+	// Path of the user ID in the response of the user info endpoint
+	// Paths use a subset of the JSONPath syntax, for example `id`, `data.user.id`, `emails[0].value`, or `["https://example.com/user_id"]`
+	// If empty, uses the `sub` property, or the `id` property if `sub` is not set
+	// +example "id"
+	IDPath string `yaml:"idPath"`
+	// Path of the user's full name in the response of the user info endpoint
+	// If empty, uses the `name` property
+	// +example "global_name"
+	NamePath string `yaml:"namePath"`
+	// Path of the user's email address in the response of the user info endpoint
+	// If empty, uses the `email` property
+	// +example "email"
+	EmailPath string `yaml:"emailPath"`
+	// Path of the list of groups in the response of the user info endpoint
+	// The value can be a string or an array of strings; the path can contain a wildcard to collect values from an array of objects, for example `teams[*].name`
+	// If empty, uses the `groups` property
+	// +example "teams[*].name"
+	GroupsPath string `yaml:"groupsPath"`
+	// Path of the URL of the user's picture in the response of the user info endpoint
+	// If empty, uses the `picture` property
+	// +example "avatar_url"
+	PicturePath string `yaml:"picturePath"`
+	// Timeout for network requests for OAuth2 auth
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, enables the use of PKCE during the code exchange.
+	// +default false
+	EnablePKCE bool `yaml:"enablePKCE"`
+	// If true, skips validating TLS certificates when connecting to the OAuth2 server.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when connecting to the OAuth2 server.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when connecting to the OAuth2 server.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "discord"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "indigo"
+	Color string `yaml:"color"`
+
+	config *Config
+}
+
+func (p *ProviderConfig_GenericOAuth2) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	var pkceKey []byte
+	if p.EnablePKCE {
+		pkceKey = p.config.internal.pkceKey
+	}
+
+	var (
+		tlsCACertificate []byte
+		err              error
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	opts := auth.NewGenericOAuth2Options{
+		AuthorizationURL: p.AuthorizationURL,
+		TokenURL:         p.TokenURL,
+		UserInfoURL:      p.UserInfoURL,
+		ClientID:         p.ClientID,
+		ClientSecret:     p.ClientSecret,
+		Scopes:           p.Scopes,
+		RequestTimeout:   p.RequestTimeout,
+		PKCEKey:          pkceKey,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+		ClaimMapping: auth.GenericOAuth2ClaimMapping{
+			ID:      p.IDPath,
+			Name:    p.NamePath,
+			Email:   p.EmailPath,
+			Groups:  p.GroupsPath,
+			Picture: p.PicturePath,
+		},
+	}
+
+	// Load the client secret from file when it has not already been provided directly
+	if opts.ClientSecret == "" {
+		err = populateSecretFromFile(&opts.ClientSecret, p.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.NewGenericOAuth2(opts)
+}
+
+func (p *ProviderConfig_GenericOAuth2) SetConfigObject(c *Config) {
+	p.config = c
+}
+
+func (p *ProviderConfig_GenericOAuth2) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
@@ -37,6 +37,10 @@ type ProviderConfig_GitHub struct {
 	// Timeout for network requests for GitHub auth
 	// +default "10s"
 	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, requests the `read:org` scope, and includes the organizations and teams the user is a member of in the list of groups, in the format `org` and `org/team`.
+	// These can be used in authorization conditions, for example `Group("acme/platform")`.
+	// +default false
+	IncludeGroups bool `yaml:"includeGroups"`
 	// Optional icon for the provider
 	// Defaults to the standard icon for the provider
 	// +example "github"
@@ -53,6 +57,7 @@ func (p *ProviderConfig_GitHub) GetAuthProvider(_ context.Context) (auth.Provide
 		ClientID:       p.ClientID,
 		ClientSecret:   p.ClientSecret,
 		RequestTimeout: p.RequestTimeout,
+		IncludeGroups:  p.IncludeGroups,
 	})
 }
 
@@ -0,0 +1,128 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_GitLab is the configuration for the GitLab provider
+// +name gitlab
+// +displayName GitLab
+type ProviderConfig_GitLab struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-gitlab-auth"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "GitLab"
+	DisplayName string `yaml:"displayName"`
+	// Base URL of the GitLab instance
+	// Set this when using a self-hosted GitLab instance
+	// +default "https://gitlab.com"
+	Endpoint string `yaml:"endpoint"`
+	// Client ID for the GitLab application
+	// +required
+	// +example "your-client-id"
+	ClientID string `yaml:"clientID"`
+	// Client secret for the GitLab application
+	// One of `clientSecret` and `clientSecretFile` is required.
+	// +required
+	// +example "your-client-secret"
+	ClientSecret string `yaml:"clientSecret"`
+	// File containing the client secret for the GitLab application
+	// This is an alternative to passing the secret as `clientSecret`
+	// One of `clientSecret` and `clientSecretFile` is required.
+	// +example "/var/run/secrets/traefik-forward-auth/gitlab/client-secret"
+	ClientSecretFile string `yaml:"clientSecretFile"`
+	// Timeout for network requests for GitLab auth
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// OAuth2 scopes to request
+	// +default "openid profile email"
+	Scopes string `yaml:"scopes"`
+	// If true, enables the use of PKCE during the code exchange.
+	// +default false
+	EnablePKCE bool `yaml:"enablePKCE"`
+	// If true, skips validating TLS certificates when connecting to the GitLab instance.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when connecting to the GitLab instance.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when connecting to the GitLab instance.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// Defaults to the standard icon for the provider
+	// +example "gitlab"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "orange"
+	Color string `yaml:"color"`
+
+	config *Config
+}
+
+func (p *ProviderConfig_GitLab) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	var pkceKey []byte
+	if p.EnablePKCE {
+		pkceKey = p.config.internal.pkceKey
+	}
+
+	var (
+		tlsCACertificate []byte
+		err              error
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	opts := auth.NewGitLabOptions{
+		Endpoint:         p.Endpoint,
+		ClientID:         p.ClientID,
+		ClientSecret:     p.ClientSecret,
+		RequestTimeout:   p.RequestTimeout,
+		Scopes:           p.Scopes,
+		PKCEKey:          pkceKey,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+	}
+
+	// Load the client secret from file when it has not already been provided directly
+	if opts.ClientSecret == "" {
+		err = populateSecretFromFile(&opts.ClientSecret, p.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.NewGitLab(ctx, opts)
+}
+
+func (p *ProviderConfig_GitLab) SetConfigObject(c *Config) {
+	p.config = c
+}
+
+func (p *ProviderConfig_GitLab) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
@@ -0,0 +1,156 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_LDAP is the configuration for the LDAP provider
+// +name ldap
+// +displayName LDAP
+type ProviderConfig_LDAP struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-ldap-auth"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Active Directory"
+	DisplayName string `yaml:"displayName"`
+	// URL of the LDAP server
+	// The scheme must be `ldap` or `ldaps` (LDAP over TLS)
+	// +required
+	// +example "ldaps://ldap.example.com"
+	URL string `yaml:"url"`
+	// If true, upgrades the connection to TLS using StartTLS
+	// This can only be used with URLs with the `ldap` scheme
+	// +default false
+	StartTLS bool `yaml:"startTLS"`
+	// DN of the account used to search for users
+	// If empty, searches are performed after an anonymous bind
+	// +example "cn=traefik-forward-auth,ou=services,dc=example,dc=com"
+	BindDN string `yaml:"bindDN"`
+	// Password of the account used to search for users
+	// One of `bindPassword` and `bindPasswordFile` is required when `bindDN` is set.
+	// +example "your-bind-password"
+	BindPassword string `yaml:"bindPassword"`
+	// File containing the password of the account used to search for users
+	// This is an alternative to passing the password as `bindPassword`
+	// One of `bindPassword` and `bindPasswordFile` is required when `bindDN` is set.
+	// +example "/var/run/secrets/traefik-forward-auth/ldap/bind-password"
+	BindPasswordFile string `yaml:"bindPasswordFile"`
+	// Base DN for searching users
+	// +required
+	// +example "ou=people,dc=example,dc=com"
+	BaseDN string `yaml:"baseDN"`
+	// Filter used to search for users
+	// The `{username}` placeholder is replaced with the username entered by the user, after escaping it
+	// +default "(|(uid={username})(sAMAccountName={username}))"
+	// +example "(&(objectClass=user)(sAMAccountName={username}))"
+	UserFilter string `yaml:"userFilter"`
+	// Name of the attribute containing the user ID
+	// If empty, uses the `uid` or `sAMAccountName` attributes, or the user's DN if neither is set
+	// +example "uid"
+	IDAttribute string `yaml:"idAttribute"`
+	// Name of the attribute containing the user's full name
+	// If empty, uses the `displayName` or `cn` attributes, or `givenName` and `sn`
+	// +example "displayName"
+	NameAttribute string `yaml:"nameAttribute"`
+	// Name of the attribute containing the user's email address
+	// If empty, uses the `mail` attribute
+	// +example "mail"
+	EmailAttribute string `yaml:"emailAttribute"`
+	// Name of the attribute containing the list of groups
+	// If empty, uses the `memberOf` attribute
+	// +example "memberOf"
+	GroupsAttribute string `yaml:"groupsAttribute"`
+	// If true, groups in the user profile contain the full DN of each group, such as `cn=admins,ou=groups,dc=example,dc=com`
+	// Otherwise, they contain the value of the first component of the DN only, such as `admins`
+	// +default false
+	GroupsFullDN bool `yaml:"groupsFullDN"`
+	// Timeout for network requests for LDAP auth
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, skips validating TLS certificates when connecting to the LDAP server.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when connecting to the LDAP server.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when connecting to the LDAP server.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "microsoft"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "blue"
+	Color string `yaml:"color"`
+}
+
+func (p *ProviderConfig_LDAP) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	var (
+		tlsCACertificate []byte
+		err              error
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	opts := auth.NewLDAPOptions{
+		URL:          p.URL,
+		StartTLS:     p.StartTLS,
+		BindDN:       p.BindDN,
+		BindPassword: p.BindPassword,
+		BaseDN:       p.BaseDN,
+		UserFilter:   p.UserFilter,
+		AttributeMapping: auth.LDAPAttributeMapping{
+			ID:     p.IDAttribute,
+			Name:   p.NameAttribute,
+			Email:  p.EmailAttribute,
+			Groups: p.GroupsAttribute,
+		},
+		GroupsFullDN:     p.GroupsFullDN,
+		RequestTimeout:   p.RequestTimeout,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+	}
+
+	// Load the bind password from file when it has not already been provided directly
+	if opts.BindPassword == "" {
+		err = populateSecretFromFile(&opts.BindPassword, p.BindPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.NewLDAP(opts)
+}
+
+func (p *ProviderConfig_LDAP) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_LDAP) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
@@ -0,0 +1,87 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_LocalUsers is the configuration for the local users provider
+// +name localusers
+// +displayName Local users
+type ProviderConfig_LocalUsers struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-local-users"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Emergency access"
+	DisplayName string `yaml:"displayName"`
+	// List of users
+	// Each user has a `username` and a `passwordHash` (bcrypt or argon2id), and optionally a `name`, an `email`, and a list of `groups`
+	// At least one of `users` and `usersFile` is required.
+	// +example [{"username": "admin", "passwordHash": "$2y$10$...", "groups": ["admins"]}]
+	Users []LocalUserConfig `yaml:"users"`
+	// Path to a htpasswd-style file containing users
+	// Each line has the format `username:hash`, optionally followed by a comma-separated list of groups as `username:hash:group1,group2`
+	// Passwords must be hashed with bcrypt or argon2id. The file is reloaded automatically when it changes.
+	// At least one of `users` and `usersFile` is required.
+	// +example "/etc/traefik-forward-auth/htpasswd"
+	UsersFile string `yaml:"usersFile"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "raspberry-pi"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "red"
+	Color string `yaml:"color"`
+}
+
+// LocalUserConfig is a user for the local users provider
+type LocalUserConfig struct {
+	// Username
+	Username string `yaml:"username"`
+	// Hash of the password, using bcrypt (such as the output of `htpasswd -nbB`) or argon2id (in the PHC string format)
+	PasswordHash string `yaml:"passwordHash"`
+	// Full name of the user
+	Name string `yaml:"name"`
+	// Email address of the user
+	Email string `yaml:"email"`
+	// List of groups the user belongs to
+	Groups []string `yaml:"groups"`
+}
+
+func (p *ProviderConfig_LocalUsers) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	users := make([]auth.LocalUser, len(p.Users))
+	for i, u := range p.Users {
+		users[i] = auth.LocalUser{
+			Username:     u.Username,
+			PasswordHash: u.PasswordHash,
+			Name:         u.Name,
+			Email:        u.Email,
+			Groups:       u.Groups,
+		}
+	}
+
+	return auth.NewLocalUsers(ctx, auth.NewLocalUsersOptions{
+		Users:     users,
+		UsersFile: p.UsersFile,
+	})
+}
+
+func (p *ProviderConfig_LocalUsers) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_LocalUsers) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
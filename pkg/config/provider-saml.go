@@ -0,0 +1,143 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_SAML is the configuration for the SAML 2.0 provider
+// +name saml
+// +displayName SAML
+type ProviderConfig_SAML struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-saml-auth"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Corporate SSO"
+	DisplayName string `yaml:"displayName"`
+	// Entity ID of Traefik Forward Auth as a Service Provider
+	// This must match the identifier configured in the Identity Provider, and it's usually a URL
+	// +required
+	// +example "https://auth.example.com/portals/main"
+	EntityID string `yaml:"entityID"`
+	// URL where to fetch the metadata document of the Identity Provider
+	// The metadata is fetched when Traefik Forward Auth starts.
+	// One of `idpMetadataURL`, `idpMetadataFile`, and `idpMetadata` is required.
+	// +example "https://adfs.example.com/FederationMetadata/2007-06/FederationMetadata.xml"
+	IdPMetadataURL string `yaml:"idpMetadataURL"`
+	// Path to a file containing the metadata document of the Identity Provider
+	// One of `idpMetadataURL`, `idpMetadataFile`, and `idpMetadata` is required.
+	// +example "/etc/traefik-forward-auth/idp-metadata.xml"
+	IdPMetadataFile string `yaml:"idpMetadataFile"`
+	// Metadata document of the Identity Provider, as an XML string
+	// One of `idpMetadataURL`, `idpMetadataFile`, and `idpMetadata` is required.
+	IdPMetadata string `yaml:"idpMetadata"`
+	// Format of the NameID to request from the Identity Provider
+	// If empty, the Identity Provider can choose the format
+	// +example "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormat string `yaml:"nameIDFormat"`
+	// Name of the attribute containing the user ID
+	// Attributes are matched by their Name or FriendlyName
+	// If empty, uses the NameID of the assertion's subject
+	// +example "uid"
+	IDAttribute string `yaml:"idAttribute"`
+	// Name of the attribute containing the user's full name
+	// If empty, uses commonly-used attributes such as `displayName`, or `givenName` and `sn`
+	// +example "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name"
+	NameAttribute string `yaml:"nameAttribute"`
+	// Name of the attribute containing the user's email address
+	// If empty, uses commonly-used attributes such as `mail` and `email`
+	// +example "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"
+	EmailAttribute string `yaml:"emailAttribute"`
+	// Name of the attribute containing the list of groups
+	// If empty, uses commonly-used attributes such as `groups` and `memberOf`
+	// +example "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"
+	GroupsAttribute string `yaml:"groupsAttribute"`
+	// Timeout for network requests for fetching the metadata of the Identity Provider
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, skips validating TLS certificates when fetching the metadata of the Identity Provider.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when fetching the metadata of the Identity Provider.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when fetching the metadata of the Identity Provider.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "microsoft"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "sky"
+	Color string `yaml:"color"`
+}
+
+func (p *ProviderConfig_SAML) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	var (
+		tlsCACertificate []byte
+		err              error
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	var metadata []byte
+	switch {
+	case p.IdPMetadata != "" && p.IdPMetadataFile != "":
+		return nil, errors.New("cannot pass both 'idpMetadata' and 'idpMetadataFile'")
+	case p.IdPMetadata != "":
+		metadata = []byte(p.IdPMetadata)
+	case p.IdPMetadataFile != "":
+		metadata, err = os.ReadFile(p.IdPMetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IdP metadata from '%s': %w", p.IdPMetadataFile, err)
+		}
+	}
+
+	return auth.NewSAML(ctx, auth.NewSAMLOptions{
+		EntityID:       p.EntityID,
+		IdPMetadata:    metadata,
+		IdPMetadataURL: p.IdPMetadataURL,
+		NameIDFormat:   p.NameIDFormat,
+		AttributeMapping: auth.SAMLAttributeMapping{
+			ID:     p.IDAttribute,
+			Name:   p.NameAttribute,
+			Email:  p.EmailAttribute,
+			Groups: p.GroupsAttribute,
+		},
+		RequestTimeout:   p.RequestTimeout,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+	})
+}
+
+func (p *ProviderConfig_SAML) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_SAML) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
@@ -0,0 +1,127 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_TrustedHeader is the configuration for the trusted header provider
+// +name trustedheader
+// +displayName Trusted header
+type ProviderConfig_TrustedHeader struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-trusted-header"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Cloudflare Access"
+	DisplayName string `yaml:"displayName"`
+	// Name of the header containing a signed JWT with the user's identity
+	// The JWT is verified against the keys in `jwksURL`
+	// One of `jwtHeader` and `userHeader` is required
+	// +example "Cf-Access-Jwt-Assertion"
+	JWTHeader string `yaml:"jwtHeader"`
+	// URL of the JWKS containing the keys used to verify the JWT
+	// Required when `jwtHeader` is set
+	// +example "https://myteam.cloudflareaccess.com/cdn-cgi/access/certs"
+	JWKSURL string `yaml:"jwksURL"`
+	// Expected value for the issuer ("iss" claim) of the JWT
+	// If empty, the issuer is not validated
+	// +example "https://myteam.cloudflareaccess.com"
+	TokenIssuer string `yaml:"tokenIssuer"`
+	// Expected value for the audience ("aud" claim) of the JWT
+	// For Cloudflare Access, this is the application's "AUD tag"
+	// Required when `jwtHeader` is set
+	// +example "4714c1358e65fe4b408ad6d432a5f878f08194bdb4752441fd56faefa9b2b6f2"
+	TokenAudience string `yaml:"tokenAudience"`
+	// Name of the header containing the user ID, which is not signed
+	// Headers that are not signed are accepted only from the proxies listed in `trustedProxies`
+	// One of `jwtHeader` and `userHeader` is required
+	// +example "X-Forwarded-User"
+	UserHeader string `yaml:"userHeader"`
+	// Name of the header containing the user's full name, when `userHeader` is set
+	// +example "X-Forwarded-Name"
+	NameHeader string `yaml:"nameHeader"`
+	// Name of the header containing the user's email address, when `userHeader` is set
+	// +example "X-Forwarded-Email"
+	EmailHeader string `yaml:"emailHeader"`
+	// Name of the header containing the user's groups as a comma-separated list, when `userHeader` is set
+	// +example "X-Forwarded-Groups"
+	GroupsHeader string `yaml:"groupsHeader"`
+	// List of IP ranges, in CIDR notation, of the proxies that are allowed to set the headers
+	// Required when `userHeader` is set, and optional when `jwtHeader` is set
+	// +example ["10.0.0.0/8"]
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// Timeout for network requests to fetch the JWKS
+	// +default "10s"
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// If true, skips validating TLS certificates when fetching the JWKS.
+	// +default false
+	TLSInsecureSkipVerify bool `yaml:"tlsInsecureSkipVerify"`
+	// Optional PEM-encoded CA certificate to trust when fetching the JWKS.
+	TLSCACertificatePEM string `yaml:"tlsCACertificatePEM"`
+	// Optional path to a CA certificate to trust when fetching the JWKS.
+	TLSCACertificatePath string `yaml:"tlsCACertificatePath"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "cloudflare"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "orange"
+	Color string `yaml:"color"`
+}
+
+func (p *ProviderConfig_TrustedHeader) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	var (
+		err              error
+		tlsCACertificate []byte
+	)
+	switch {
+	case p.TLSCACertificatePEM != "" && p.TLSCACertificatePath != "":
+		return nil, errors.New("cannot pass both 'tlsCACertificatePEM' and 'tlsCACertificatePath'")
+	case p.TLSCACertificatePEM != "":
+		tlsCACertificate = []byte(p.TLSCACertificatePEM)
+	case p.TLSCACertificatePath != "":
+		tlsCACertificate, err = os.ReadFile(p.TLSCACertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA certificate from '%s': %w", p.TLSCACertificatePath, err)
+		}
+	}
+
+	return auth.NewTrustedHeader(auth.NewTrustedHeaderOptions{
+		JWTHeader:        p.JWTHeader,
+		JWKSURL:          p.JWKSURL,
+		TokenIssuer:      p.TokenIssuer,
+		TokenAudience:    p.TokenAudience,
+		UserHeader:       p.UserHeader,
+		NameHeader:       p.NameHeader,
+		EmailHeader:      p.EmailHeader,
+		GroupsHeader:     p.GroupsHeader,
+		TrustedProxies:   p.TrustedProxies,
+		RequestTimeout:   p.RequestTimeout,
+		TLSSkipVerify:    p.TLSInsecureSkipVerify,
+		TLSCACertificate: tlsCACertificate,
+	})
+}
+
+func (p *ProviderConfig_TrustedHeader) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_TrustedHeader) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
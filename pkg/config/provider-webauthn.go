@@ -0,0 +1,71 @@
+//nolint:revive
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// ProviderConfig_WebAuthn is the configuration for the WebAuthn (passkeys) provider
+// +name webauthn
+// +displayName Passkeys (WebAuthn)
+type ProviderConfig_WebAuthn struct {
+	// Name of the authentication provider
+	// Defaults to the name of the provider type
+	// +example "my-passkeys"
+	Name string `yaml:"name"`
+	// Optional display name for the provider
+	// Defaults to the standard display name for the provider
+	// +example "Passkey"
+	DisplayName string `yaml:"displayName"`
+	// Path to the file where users and their passkeys are stored
+	// The file is created if it doesn't exist. It must be on a persistent volume, and it cannot be shared with other instances or other providers.
+	// +required
+	// +example "/var/lib/traefik-forward-auth/passkeys.db"
+	StorePath string `yaml:"storePath"`
+	// ID of the Relying Party, which is the domain passkeys are bound to
+	// This must be the hostname of the auth server, or a parent domain of it. Changing this value makes existing passkeys unusable.
+	// If empty, uses the hostname of the auth server.
+	// +example "example.com"
+	RPID string `yaml:"rpID"`
+	// Whether users must be verified by the authenticator, such as with a PIN or biometrics
+	// Allowed values: `required`, `preferred`, `discouraged`
+	// +default "preferred"
+	UserVerification string `yaml:"userVerification"`
+	// Lifetime of invites created with the admin API
+	// +default "168h"
+	InviteLifetime time.Duration `yaml:"inviteLifetime"`
+	// Optional icon for the provider
+	// By default, no icon is shown
+	// +example "apple"
+	Icon string `yaml:"icon"`
+	// Optional color scheme for the provider
+	// Allowed values include all color schemes available in Tailwind 4
+	// Defaults to the standard color for the provider
+	// +example "indigo"
+	Color string `yaml:"color"`
+}
+
+func (p *ProviderConfig_WebAuthn) GetAuthProvider(ctx context.Context) (auth.Provider, error) {
+	return auth.NewWebAuthn(ctx, auth.NewWebAuthnOptions{
+		StorePath:        p.StorePath,
+		RPID:             p.RPID,
+		UserVerification: p.UserVerification,
+		InviteLifetime:   p.InviteLifetime,
+	})
+}
+
+func (p *ProviderConfig_WebAuthn) SetConfigObject(_ *Config) {
+	// Nop for this provider
+}
+
+func (p *ProviderConfig_WebAuthn) GetProviderMetadata() auth.ProviderMetadata {
+	return auth.ProviderMetadata{
+		Name:        p.Name,
+		DisplayName: p.DisplayName,
+		Icon:        p.Icon,
+		Color:       p.Color,
+	}
+}
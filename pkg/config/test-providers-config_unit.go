@@ -16,6 +16,9 @@ func init() {
 	testProviderConfigFactory = map[string]func() ProviderConfig{
 		"testoauth2":   func() ProviderConfig { return &ProviderConfig_TestOAuth2{} },
 		"testseamless": func() ProviderConfig { return &ProviderConfig_TestSeamless{} },
+		"testrequest":  func() ProviderConfig { return &ProviderConfig_TestRequestAuth{} },
+		"testsaml":     func() ProviderConfig { return &ProviderConfig_TestSAML{} },
+		"testform":     func() ProviderConfig { return &ProviderConfig_TestForm{} },
 	}
 }
 
@@ -58,3 +61,39 @@ func (p *ProviderConfig_TestSeamless) GetAuthProvider(_ context.Context) (auth.P
 func (p *ProviderConfig_TestSeamless) SetConfigObject(_ *Config) {
 	// Nop
 }
+
+type ProviderConfig_TestRequestAuth struct {
+	testProviderConfigBase
+}
+
+func (p *ProviderConfig_TestRequestAuth) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	return auth.NewTestProviderRequestAuth(), nil
+}
+
+func (p *ProviderConfig_TestRequestAuth) SetConfigObject(_ *Config) {
+	// Nop
+}
+
+type ProviderConfig_TestSAML struct {
+	testProviderConfigBase
+}
+
+func (p *ProviderConfig_TestSAML) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	return auth.NewTestProviderSAML(), nil
+}
+
+func (p *ProviderConfig_TestSAML) SetConfigObject(_ *Config) {
+	// Nop
+}
+
+type ProviderConfig_TestForm struct {
+	testProviderConfigBase
+}
+
+func (p *ProviderConfig_TestForm) GetAuthProvider(_ context.Context) (auth.Provider, error) {
+	return auth.NewTestProviderForm(), nil
+}
+
+func (p *ProviderConfig_TestForm) SetConfigObject(_ *Config) {
+	// Nop
+}
@@ -96,7 +96,7 @@ func BenchmarkParseSessionToken(b *testing.B) {
 	token := benchSessionToken(b, portalName, cookieDomain, profile, time.Hour)
 
 	// Warm the cache
-	_, err := srv.parseSessionToken(token, portalName, cookieDomain)
+	_, err := srv.parseSessionToken(b.Context(), token, portalName, cookieDomain)
 	if err != nil {
 		b.Fatalf("failed to warm cache: %v", err)
 	}
@@ -104,7 +104,7 @@ func BenchmarkParseSessionToken(b *testing.B) {
 	b.ReportAllocs()
 
 	for b.Loop() {
-		_, err := srv.parseSessionToken(token, portalName, cookieDomain)
+		_, err := srv.parseSessionToken(b.Context(), token, portalName, cookieDomain)
 		if err != nil {
 			b.Fatalf("parseSessionToken failed: %v", err)
 		}
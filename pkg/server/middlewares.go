@@ -2,11 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/netip"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +23,7 @@ import (
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
 )
 
 // isValidHostHeader reports whether v is an acceptable value for the X-Forwarded-Host header.
@@ -143,6 +150,95 @@ func (s *Server) MiddlewareRequireClientCertificate(c *gin.Context) {
 	}
 }
 
+// MiddlewareRequireAdmin is a middleware that requires requests to be authenticated with one of the methods configured for the admin API.
+func (s *Server) MiddlewareRequireAdmin(c *gin.Context) {
+	const bearerPrefix = "bearer "
+	cfg := config.Get()
+
+	// Static token in the Authorization header
+	adminToken := cfg.GetAdminToken()
+	val := c.GetHeader("Authorization")
+	if adminToken != "" && len(val) > len(bearerPrefix) && strings.ToLower(val[0:len(bearerPrefix)]) == bearerPrefix {
+		if subtle.ConstantTimeCompare([]byte(val[len(bearerPrefix):]), []byte(adminToken)) == 1 {
+			return
+		}
+		AbortWithErrorJSON(c, NewResponseError(http.StatusUnauthorized, "Admin token is invalid"))
+		return
+	}
+
+	// TLS client certificate
+	// The certificate was already verified against the CA during the TLS handshake, as the server is configured with VerifyClientCertIfGiven
+	// The CA signs other certificates too, such as Traefik's and those of users, so the certificate must also be in the allowlist
+	// Certificates that aren't allowed can still be used together with another authentication method, such as a session
+	var certNotAllowed bool
+	if cfg.Admin.ClientCertificate && c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+		if isAdminCertificate(c.Request.TLS.PeerCertificates[0], cfg.Admin) {
+			return
+		}
+		certNotAllowed = true
+	}
+
+	// Session in the admin portal, for a user who satisfies the admin condition
+	if cfg.Admin.Portal != "" {
+		entry, _, err := s.loadSessionCookie(c, cfg.Admin.Portal)
+		if err == nil && entry.profile != nil {
+			ok, err := s.checkAuthzConditions(cfg.Admin.Condition, &conditions.EvalContext{
+				Profile:         entry.profile,
+				Request:         getDirectRequest(c),
+				SessionIssuedAt: entry.issuedAt(),
+			})
+			if err != nil {
+				AbortWithErrorJSON(c, fmt.Errorf("failed to check admin authorization condition: %w", err))
+				return
+			} else if !ok {
+				AbortWithErrorJSON(c, NewResponseError(http.StatusForbidden, "Access denied"))
+				return
+			}
+			return
+		}
+	}
+
+	if certNotAllowed {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusForbidden, "Client certificate is not allowed to access the admin API"))
+		return
+	}
+
+	AbortWithErrorJSON(c, NewResponseError(http.StatusUnauthorized, "Not authenticated"))
+}
+
+// isAdminCertificate returns true if the client certificate is in the allowlist for the admin API, by subject or by fingerprint
+func isAdminCertificate(cert *x509.Certificate, admin config.ConfigAdmin) bool {
+	if len(admin.ClientCertificateFingerprints) > 0 {
+		sum := sha256.Sum256(cert.Raw)
+		if slices.Contains(admin.ClientCertificateFingerprints, hex.EncodeToString(sum[:])) {
+			return true
+		}
+	}
+
+	if len(admin.ClientCertificateSubjects) > 0 {
+		if cert.Subject.CommonName != "" && slices.Contains(admin.ClientCertificateSubjects, cert.Subject.CommonName) {
+			return true
+		}
+		for _, v := range cert.DNSNames {
+			if slices.Contains(admin.ClientCertificateSubjects, v) {
+				return true
+			}
+		}
+		for _, v := range cert.EmailAddresses {
+			if slices.Contains(admin.ClientCertificateSubjects, v) {
+				return true
+			}
+		}
+		for _, v := range cert.URIs {
+			if slices.Contains(admin.ClientCertificateSubjects, v.String()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // MiddlewareProxyHeaders is a middleware that gets values for source IP and port from the headers set by Traefik.
 // It stops the request if the headers aren't set.
 // This middleware should be used first in the chain.
@@ -210,6 +306,41 @@ func (s *Server) MiddlewareProxyHeaders(c *gin.Context) {
 	}
 }
 
+// MiddlewarePortalRules is a middleware that finds the first rule of the portal matching the request forwarded by Traefik.
+// Requests matching a public rule are allowed right away, before the session is loaded; other rules are applied after the user is authenticated.
+func (s *Server) MiddlewarePortalRules(c *gin.Context) {
+	portal, err := s.getPortal(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	if len(portal.Rules) == 0 {
+		return
+	}
+
+	rule := matchPortalRule(portal.Rules, getForwardedRequest(c))
+	if rule == nil {
+		return
+	}
+	if rule == &ambiguousPathRule {
+		setLogMessage(c, "Forwarded path can't be matched against the portal's rules unambiguously")
+	}
+
+	if rule.action == config.RuleActionPublic {
+		c.Header(headerContentType, contentTypeTextPlain)
+		c.Writer.WriteHeader(http.StatusOK)
+		_, _ = c.Writer.WriteString("Authentication is not required for this request")
+		c.Abort()
+		return
+	}
+
+	rs := getRequestState(c)
+	if rs != nil {
+		rs.rule = rule
+	}
+}
+
 // MiddlewareLoadAuthCookie is a middleware that checks if the request contains a valid authentication token in the cookie.
 func (s *Server) MiddlewareLoadAuthCookie(c *gin.Context) {
 	portal, err := s.getPortal(c)
@@ -219,7 +350,7 @@ func (s *Server) MiddlewareLoadAuthCookie(c *gin.Context) {
 	}
 
 	// Get the cookie and parse it
-	profile, provider, err := s.getSessionCookie(c, portal.Name)
+	entry, cacheKey, err := s.loadSessionCookie(c, portal.Name)
 	if err != nil {
 		// The session cookie is present but couldn't be validated (e.g. it's expired or tampered with)
 		// We treat this the same as an unauthenticated request
@@ -238,12 +369,12 @@ func (s *Server) MiddlewareLoadAuthCookie(c *gin.Context) {
 	}
 
 	// If we don't have a valid session, stop here
-	if profile == nil || profile.ID == "" || provider == nil {
+	if entry.profile == nil || entry.profile.ID == "" || entry.provider == nil {
 		return
 	}
 
 	// Validate the session claims
-	err = provider.ValidateRequestClaims(c.Request, profile)
+	err = entry.provider.ValidateRequestClaims(c.Request, entry.profile)
 	if err != nil {
 		// If the claims are invalid for this session, delete the cookie and return a hard error
 		s.deleteSessionCookie(c, portal.Name)
@@ -251,12 +382,38 @@ func (s *Server) MiddlewareLoadAuthCookie(c *gin.Context) {
 		return
 	}
 
+	// Renew the session if it's about to expire
+	if portal.SessionRefresh {
+		renewedEntry, renewedCacheKey, refreshErr := s.refreshSession(c, portal, entry, cacheKey)
+		switch {
+		case errors.Is(refreshErr, auth.ErrTokenRequestRejected):
+			// The identity provider rejected the refresh token, for example because the user's account was disabled or the session was revoked
+			// We terminate the session, so the user needs to authenticate again
+			s.deleteSessionCookie(c, portal.Name)
+			s.requestLogger(c).InfoContext(c.Request.Context(),
+				"Session terminated because the identity provider rejected the refresh token",
+				slog.Any("error", refreshErr),
+			)
+			return
+		case refreshErr != nil:
+			// Other errors may be transient, so we keep the current session until it expires
+			s.requestLogger(c).WarnContext(c.Request.Context(),
+				"Failed to renew the session using the refresh token",
+				slog.Any("error", refreshErr),
+			)
+		default:
+			entry, cacheKey = renewedEntry, renewedCacheKey
+		}
+	}
+
 	// Set the claims in the request state
 	rs := getRequestState(c)
 	if rs != nil {
 		rs.authenticated = true
-		rs.profile = profile
-		rs.provider = provider
+		rs.profile = entry.profile
+		rs.provider = entry.provider
+		rs.session = entry
+		rs.sessionCacheKey = cacheKey
 	}
 }
 
@@ -8,6 +8,7 @@ import (
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
 )
 
 // requestStateKey is the key the request state is stored under in the request's context
@@ -34,6 +35,18 @@ type requestState struct {
 	provider      auth.Provider
 	authenticated bool
 
+	// Portal rule matching the request, set by MiddlewarePortalRules
+	// It is nil when the portal has no rules or none matches the request
+	rule *portalRule
+
+	// Properties of the request forwarded by Traefik, which rules and conditions are matched against
+	// It is computed the first time it's needed by getForwardedRequest
+	forwardedRequest *conditions.Request
+
+	// Cache entry for the session token and its key, used to re-issue the session cookie when the portal has an idle timeout
+	session         tokenCacheEntry
+	sessionCacheKey uint64
+
 	// Message for the request log line, used in place of the default one when set
 	logMessage string
 
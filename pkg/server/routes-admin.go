@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
+)
+
+// RouteGetAdminSessions is the handler for GET /api/admin/sessions
+// It returns the list of active sessions, which can be filtered with the "portal", "provider", "user", and "email" query string args
+func (s *Server) RouteGetAdminSessions(c *gin.Context) {
+	sessions, err := s.sessionStore.List(c.Request.Context(), getAdminSessionsFilter(c))
+	if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to list sessions: %w", err))
+		return
+	}
+
+	// Sort sessions by creation time, newest first
+	slices.SortFunc(sessions, func(a, b sessionstore.Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, GetAdminSessionsResponse{
+		Sessions: sessions,
+	})
+}
+
+// RouteDeleteAdminSessions is the handler for DELETE /api/admin/sessions
+// It revokes all sessions that match the "portal", "provider", "user", and "email" query string args
+// At least one filter is required, to avoid revoking all sessions by mistake
+func (s *Server) RouteDeleteAdminSessions(c *gin.Context) {
+	filter := getAdminSessionsFilter(c)
+	if filter.IsEmpty() {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "At least one of the query string args 'portal', 'provider', 'user', or 'email' is required"))
+		return
+	}
+
+	n, err := s.sessionStore.DeleteMatching(c.Request.Context(), filter)
+	if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to revoke sessions: %w", err))
+		return
+	}
+
+	s.requestLogger(c).InfoContext(c.Request.Context(), "Revoked sessions using the admin API",
+		slog.String("portal", filter.Portal),
+		slog.String("provider", filter.Provider),
+		slog.String("user", filter.UserID),
+		slog.String("email", filter.Email),
+		slog.Int("count", n),
+	)
+
+	c.JSON(http.StatusOK, DeleteAdminSessionsResponse{
+		Revoked: n,
+	})
+}
+
+// RouteDeleteAdminSession is the handler for DELETE /api/admin/sessions/:id
+// It revokes a single session
+func (s *Server) RouteDeleteAdminSession(c *gin.Context) {
+	id := c.Param("id")
+
+	session, err := s.sessionStore.Get(c.Request.Context(), id)
+	if errors.Is(err, sessionstore.ErrSessionNotFound) {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusNotFound, "Session not found"))
+		return
+	} else if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to retrieve session: %w", err))
+		return
+	}
+
+	err = s.sessionStore.Delete(c.Request.Context(), id)
+	if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to revoke session: %w", err))
+		return
+	}
+
+	s.requestLogger(c).InfoContext(c.Request.Context(), "Revoked session using the admin API",
+		slog.String("session", session.ID),
+		slog.String("portal", session.Portal),
+		slog.String("provider", session.Provider),
+		slog.String("user", session.UserID),
+	)
+
+	c.JSON(http.StatusOK, DeleteAdminSessionsResponse{
+		Revoked: 1,
+	})
+}
+
+// RoutePostAdminWebAuthnInvite is the handler for POST /api/admin/portals/:portal/providers/:provider/invites
+// It creates an invite that allows a user to register a passkey with a WebAuthn provider
+func (s *Server) RoutePostAdminWebAuthnInvite(c *gin.Context) {
+	portal, provider, err := s.getAdminWebAuthnProvider(c)
+	if err != nil {
+		AbortWithErrorJSON(c, err)
+		return
+	}
+
+	var req PostAdminWebAuthnInviteRequest
+	err = json.NewDecoder(io.LimitReader(c.Request.Body, 64<<10)).Decode(&req)
+	if err != nil {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "Request body is not valid JSON"))
+		return
+	}
+	if req.UserID == "" {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "The property 'userId' is required"))
+		return
+	}
+
+	token, expiresAt, err := provider.WebAuthnCreateInvite(c.Request.Context(), auth.WebAuthnUser{
+		ID:            req.UserID,
+		Name:          req.Name,
+		Email:         req.Email,
+		EmailVerified: req.EmailVerified,
+		Groups:        req.Groups,
+	})
+	if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to create invite: %w", err))
+		return
+	}
+
+	s.requestLogger(c).InfoContext(c.Request.Context(), "Created passkey invite using the admin API",
+		slog.String("portal", portal.Name),
+		slog.String("provider", provider.GetProviderName()),
+		slog.String("user", req.UserID),
+	)
+
+	c.JSON(http.StatusOK, PostAdminWebAuthnInviteResponse{
+		Token:     token,
+		Path:      path.Join("/", config.Get().Server.BasePath, "portals", portal.Name, "providers", provider.GetProviderName(), "register") + "?invite=" + token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RouteDeleteAdminWebAuthnUser is the handler for DELETE /api/admin/portals/:portal/providers/:provider/users/:user
+// It deletes a user and all their passkeys from a WebAuthn provider, and revokes the user's sessions with the provider
+func (s *Server) RouteDeleteAdminWebAuthnUser(c *gin.Context) {
+	portal, provider, err := s.getAdminWebAuthnProvider(c)
+	if err != nil {
+		AbortWithErrorJSON(c, err)
+		return
+	}
+	userID := c.Param("user")
+
+	n, err := provider.WebAuthnDeleteUser(c.Request.Context(), userID)
+	if errors.Is(err, auth.ErrWebAuthnNotFound) {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusNotFound, "User not found"))
+		return
+	} else if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to delete user: %w", err))
+		return
+	}
+
+	revoked, err := s.sessionStore.DeleteMatching(c.Request.Context(), sessionstore.Filter{
+		Portal:   portal.Name,
+		Provider: provider.GetProviderName(),
+		UserID:   userID,
+	})
+	if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to revoke sessions: %w", err))
+		return
+	}
+
+	s.requestLogger(c).InfoContext(c.Request.Context(), "Deleted passkey user using the admin API",
+		slog.String("portal", portal.Name),
+		slog.String("provider", provider.GetProviderName()),
+		slog.String("user", userID),
+		slog.Int("passkeys", n),
+		slog.Int("revoked", revoked),
+	)
+
+	c.JSON(http.StatusOK, DeleteAdminWebAuthnUserResponse{
+		Passkeys: n,
+		Revoked:  revoked,
+	})
+}
+
+// RouteDeleteAdminTOTPEnrollment is the handler for DELETE /api/admin/portals/:portal/providers/:provider/users/:user/totp
+// It removes the TOTP enrollment of a user, for example because they lost their device, so they are asked to set up an authenticator app the next time they sign in
+func (s *Server) RouteDeleteAdminTOTPEnrollment(c *gin.Context) {
+	portal, provider, err := s.getProvider(c)
+	if err != nil {
+		AbortWithErrorJSON(c, err)
+		return
+	}
+	if !portal.RequireTOTP {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusNotFound, "Portal does not require TOTP"))
+		return
+	}
+	userID := c.Param("user")
+
+	err = s.totpStore.Delete(c.Request.Context(), totp.EnrollmentKey(portal.Name, provider.GetProviderName(), userID))
+	if errors.Is(err, totp.ErrNotFound) {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusNotFound, "User does not have a TOTP enrollment"))
+		return
+	} else if err != nil {
+		AbortWithErrorJSON(c, fmt.Errorf("failed to delete TOTP enrollment: %w", err))
+		return
+	}
+
+	s.requestLogger(c).InfoContext(c.Request.Context(), "Deleted TOTP enrollment using the admin API",
+		slog.String("portal", portal.Name),
+		slog.String("provider", provider.GetProviderName()),
+		slog.String("user", userID),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) getAdminWebAuthnProvider(c *gin.Context) (*Portal, auth.WebAuthnProvider, error) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, ok := providerI.(auth.WebAuthnProvider)
+	if !ok {
+		return nil, nil, NewResponseError(http.StatusNotFound, "Auth provider does not support passkeys")
+	}
+	return portal, provider, nil
+}
+
+func getAdminSessionsFilter(c *gin.Context) sessionstore.Filter {
+	return sessionstore.Filter{
+		Portal:   c.Query("portal"),
+		Provider: c.Query("provider"),
+		UserID:   c.Query("user"),
+		Email:    c.Query("email"),
+	}
+}
+
+// GetAdminSessionsResponse is the response from RouteGetAdminSessions
+type GetAdminSessionsResponse struct {
+	Sessions []sessionstore.Session `json:"sessions"`
+}
+
+// DeleteAdminSessionsResponse is the response from RouteDeleteAdminSessions and RouteDeleteAdminSession
+type DeleteAdminSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// PostAdminWebAuthnInviteRequest is the request body for RoutePostAdminWebAuthnInvite
+type PostAdminWebAuthnInviteRequest struct {
+	UserID        string   `json:"userId"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	Groups        []string `json:"groups"`
+}
+
+// PostAdminWebAuthnInviteResponse is the response from RoutePostAdminWebAuthnInvite
+type PostAdminWebAuthnInviteResponse struct {
+	Token string `json:"token"`
+	// Path of the page where the user registers the passkey, which must be appended to the URL of the auth server
+	Path      string    `json:"path"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// DeleteAdminWebAuthnUserResponse is the response from RouteDeleteAdminWebAuthnUser
+type DeleteAdminWebAuthnUserResponse struct {
+	Passkeys int `json:"passkeys"`
+	Revoked  int `json:"revoked"`
+}
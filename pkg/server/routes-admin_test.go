@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestRoutesAdmin(t *testing.T) {
+	const adminToken = "test-admin-token-0123456789"
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Sessions.Store = "memory"
+		c.Admin = config.ConfigAdmin{
+			Enabled:   true,
+			Token:     adminToken,
+			Portal:    testPortalName,
+			Condition: `Group("admins")`,
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	cookieName := config.Get().Cookies.CookieName(testPortalName)
+
+	newSession := func(t *testing.T, userID string, groups ...string) string {
+		t.Helper()
+
+		profile := &user.Profile{
+			Provider: "testoauth2",
+			ID:       userID,
+			Email:    &user.ProfileEmail{Value: userID + "@example.com"},
+			Groups:   groups,
+		}
+		token, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+		return token
+	}
+
+	doRequest := func(t *testing.T, method string, path string, authorize func(req *http.Request)) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, method, fmt.Sprintf("http://localhost:%d/api/admin%s", testServerPort, path), nil)
+		require.NoError(t, err)
+		req.Header.Set(headerXForwardedHost, "example.com")
+		if authorize != nil {
+			authorize(req)
+		}
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	withToken := func(token string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	withSession := func(session string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: session}) //nolint:gosec
+		}
+	}
+
+	listSessions := func(t *testing.T, query string) GetAdminSessionsResponse {
+		t.Helper()
+
+		res := doRequest(t, http.MethodGet, "/sessions"+query, withToken(adminToken))
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var body GetAdminSessionsResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return body
+	}
+
+	// Create some sessions
+	adminSession := newSession(t, "admin-1", "admins")
+	user1Session := newSession(t, "user-1")
+	newSession(t, "user-1")
+	newSession(t, "user-2")
+
+	t.Run("requires authentication", func(t *testing.T) {
+		res := doRequest(t, http.MethodGet, "/sessions", nil)
+		closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, "/sessions", withToken("not-the-admin-token-0123456789"))
+		closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("session of a user who isn't an admin is forbidden", func(t *testing.T) {
+		res := doRequest(t, http.MethodGet, "/sessions", withSession(user1Session))
+		closeBody(res)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("session of an admin is allowed", func(t *testing.T) {
+		res := doRequest(t, http.MethodGet, "/sessions", withSession(adminSession))
+		closeBody(res)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("list sessions", func(t *testing.T) {
+		assert.Len(t, listSessions(t, "").Sessions, 4)
+		assert.Len(t, listSessions(t, "?portal="+testPortalName+"&provider=testoauth2").Sessions, 4)
+		assert.Empty(t, listSessions(t, "?portal=other").Sessions)
+
+		sessions := listSessions(t, "?user=user-1").Sessions
+		require.Len(t, sessions, 2)
+		for _, s := range sessions {
+			assert.Equal(t, "user-1", s.UserID)
+			assert.Equal(t, "user-1@example.com", s.Email)
+		}
+
+		assert.Len(t, listSessions(t, "?email=USER-2@example.com").Sessions, 1)
+	})
+
+	t.Run("revoke a session", func(t *testing.T) {
+		sessions := listSessions(t, "?user=user-2").Sessions
+		require.Len(t, sessions, 1)
+
+		res := doRequest(t, http.MethodDelete, "/sessions/"+sessions[0].ID, withToken(adminToken))
+		closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, listSessions(t, "?user=user-2").Sessions)
+
+		// Revoking the session again returns a 404
+		res = doRequest(t, http.MethodDelete, "/sessions/"+sessions[0].ID, withToken(adminToken))
+		closeBody(res)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("revoking sessions requires a filter", func(t *testing.T) {
+		res := doRequest(t, http.MethodDelete, "/sessions", withToken(adminToken))
+		closeBody(res)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Len(t, listSessions(t, "").Sessions, 3)
+	})
+
+	t.Run("revoke all sessions for a user", func(t *testing.T) {
+		res := doRequest(t, http.MethodDelete, "/sessions?user=user-1", withToken(adminToken))
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var body DeleteAdminSessionsResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, 2, body.Revoked)
+
+		// The revoked sessions can't be used anymore
+		_, err := srv.parseSessionToken(t.Context(), user1Session, testPortalName, "example.com")
+		require.ErrorIs(t, err, errSessionRevoked)
+	})
+}
+
+func TestMiddlewareRequireAdminClientCertificate(t *testing.T) {
+	ca := auth.NewTestCertificateAuthority("Test CA")
+	adminCert := ca.Issue(auth.TestClientCertificate{CommonName: "admin-cli"})
+	uriCert := ca.Issue(auth.TestClientCertificate{CommonName: "workload", URIs: []string{"spiffe://example.com/admin"}})
+	fingerprintCert := ca.Issue(auth.TestClientCertificate{CommonName: "break-glass"})
+	traefikCert := ca.Issue(auth.TestClientCertificate{CommonName: "traefik"})
+	userCert := ca.Issue(auth.TestClientCertificate{CommonName: "alice", EmailAddresses: []string{"alice@example.com"}})
+
+	sum := sha256.Sum256(fingerprintCert.Raw)
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Server.TLSClientAuth = true
+		c.Admin = config.ConfigAdmin{
+			Enabled:                       true,
+			ClientCertificate:             true,
+			ClientCertificateSubjects:     []string{"admin-cli", "spiffe://example.com/admin"},
+			ClientCertificateFingerprints: []string{hex.EncodeToString(sum[:])},
+		}
+	}))
+
+	srv := &Server{}
+	doRequest := func(cert *x509.Certificate) int {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "https://auth.example.com/api/admin/sessions", nil)
+		if cert != nil {
+			c.Request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		srv.MiddlewareRequireAdmin(c)
+		if !c.IsAborted() {
+			return http.StatusOK
+		}
+		return rec.Code
+	}
+
+	t.Run("certificate allowed by common name", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doRequest(adminCert))
+	})
+
+	t.Run("certificate allowed by URI", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doRequest(uriCert))
+	})
+
+	t.Run("certificate allowed by fingerprint", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doRequest(fingerprintCert))
+	})
+
+	t.Run("certificate from the same CA that isn't allowed", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, doRequest(traefikCert))
+		assert.Equal(t, http.StatusForbidden, doRequest(userCert))
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, doRequest(nil))
+	})
+}
@@ -5,8 +5,10 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v4/jwk"
 	"github.com/lestrrat-go/jwx/v4/jwt"
 
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 )
 
@@ -43,7 +45,7 @@ func (s *Server) RouteGetAPIVerify(c *gin.Context) {
 	}
 
 	// Parse the session token
-	token, err := s.parseSessionToken(val, portal.Name, cookieDomain)
+	token, err := s.parseSessionToken(c.Request.Context(), val, portal.Name, cookieDomain)
 	if err != nil {
 		AbortWithErrorJSON(c, NewInvalidTokenErrorf("Access token is invalid: %v", err))
 		return
@@ -65,6 +67,20 @@ func (s *Server) RouteGetAPIVerify(c *gin.Context) {
 	})
 }
 
+// RouteGetJWKS is the handler for GET /.well-known/jwks.json
+// It returns the public keys that can be used to verify session tokens, as a JWK set
+// This route is registered only when session tokens are signed with an asymmetric key
+func (s *Server) RouteGetJWKS(c *gin.Context) {
+	set := config.Get().GetSessionPublicKeys()
+	if set == nil {
+		set = jwk.NewSet()
+	}
+
+	// Allow clients to cache the response for a limited time only, so they can pick up new keys
+	c.Header("Cache-Control", "public, max-age=900")
+	c.JSON(http.StatusOK, set)
+}
+
 // GetAPIVerifyResponse is the response from RouteGetAPIVerify
 type GetAPIVerifyResponse struct {
 	Valid    bool      `json:"valid"`
@@ -2,13 +2,21 @@ package server
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
 	"github.com/lestrrat-go/jwx/v4/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -336,3 +344,160 @@ func TestRouteGetAPIVerify(t *testing.T) {
 		}
 	})
 }
+
+func TestRouteGetJWKS(t *testing.T) {
+	const portalName = "test1"
+
+	doRequest := func(t *testing.T, appClient *http.Client) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 10*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet,
+			fmt.Sprintf("http://localhost:%d/.well-known/jwks.json", testServerPort), nil)
+		require.NoError(t, err)
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("not available with symmetric keys", func(t *testing.T) {
+		srv, _ := newTestServer(t)
+		require.NotNil(t, srv)
+		startTestServer(t, srv)
+		appClient := clientForListener(srv.appListener)
+
+		res := doRequest(t, appClient)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("session tokens signed with ES256", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+		require.NoError(t, err)
+
+		t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+			c.Tokens.SessionSigningKeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		}))
+
+		srv, _ := newTestServer(t)
+		require.NotNil(t, srv)
+		startTestServer(t, srv)
+		appClient := clientForListener(srv.appListener)
+
+		// Get the JWKS
+		res := doRequest(t, appClient)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "public, max-age=900", res.Header.Get("Cache-Control"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		set, err := jwk.Parse(body)
+		require.NoError(t, err)
+		require.Equal(t, 1, set.Len())
+		key, _ := set.Key(0)
+		isPrivate, err := jwk.IsPrivateKey(key)
+		require.NoError(t, err)
+		assert.False(t, isPrivate)
+
+		// Create a session token, which must be verifiable with the JWKS
+		token, err := srv.newSessionToken(t.Context(), portalName, &user.Profile{Provider: "testoauth2", ID: "test-user-1"}, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		msg, err := jws.Parse([]byte(token))
+		require.NoError(t, err)
+		sigs := msg.Signatures()
+		require.Len(t, sigs, 1)
+		alg, _ := sigs[0].ProtectedHeaders().Algorithm()
+		assert.Equal(t, jwa.ES256(), alg)
+
+		parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(set), jwt.WithValidate(true))
+		require.NoError(t, err)
+		sub, _ := parsed.Subject()
+		assert.Equal(t, "test-user-1", sub)
+
+		// Traefik Forward Auth accepts the token too
+		_, err = srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+		require.NoError(t, err)
+
+		// Tokens signed with the (symmetric) token signing key are not accepted
+		cfg := config.Get()
+		audience := cfg.GetTokenAudienceClaim("example.com")
+		hsToken, err := jwt.NewBuilder().
+			Issuer(jwtIssuer + ":" + audience + ":" + portalName).
+			Audience([]string{audience}).
+			Subject("test-user-1").
+			Expiration(time.Now().Add(time.Hour)).
+			Build()
+		require.NoError(t, err)
+		hsTokenBytes, err := jwt.NewSerializer().
+			Sign(jwt.WithKey(jwa.HS256(), cfg.GetTokenSigningKey())).
+			Serialize(hsToken)
+		require.NoError(t, err)
+		_, err = srv.parseSessionToken(t.Context(), string(hsTokenBytes), portalName, "example.com")
+		require.Error(t, err)
+	})
+
+	t.Run("rotated session signing keys", func(t *testing.T) {
+		encodeKey := func(key any) string {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+			return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		}
+
+		newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		// Sign a token with the old key, before it's rotated
+		t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+			c.Tokens.SessionSigningKeyPEM = encodeKey(oldKey)
+		}))
+		srv, _ := newTestServer(t)
+		require.NotNil(t, srv)
+		oldToken, err := srv.newSessionToken(t.Context(), portalName, &user.Profile{Provider: "testoauth2", ID: "test-user-1"}, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		// Rotate the keys
+		t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+			c.Tokens.SessionSigningKeyPEM = ""
+			c.Tokens.SessionSigningKeysPEM = []string{encodeKey(newKey), encodeKey(oldKey)}
+		}))
+		srv, _ = newTestServer(t)
+		require.NotNil(t, srv)
+		startTestServer(t, srv)
+		appClient := clientForListener(srv.appListener)
+
+		// The JWKS contains both public keys
+		res := doRequest(t, appClient)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		set, err := jwk.Parse(body)
+		require.NoError(t, err)
+		require.Equal(t, 2, set.Len())
+
+		// Tokens signed with either key can be verified with the JWKS and are accepted
+		newToken, err := srv.newSessionToken(t.Context(), portalName, &user.Profile{Provider: "testoauth2", ID: "test-user-1"}, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+		for _, token := range []string{oldToken, newToken} {
+			_, err = jwt.Parse([]byte(token), jwt.WithKeySet(set), jwt.WithValidate(true))
+			require.NoError(t, err)
+			_, err = srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+			require.NoError(t, err)
+		}
+
+		// New tokens are signed with the first key
+		newPub, err := jwk.Import[jwk.Key](newKey.Public())
+		require.NoError(t, err)
+		_, err = jwt.Parse([]byte(newToken), jwt.WithKey(jwa.ES256(), newPub))
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+)
+
+func TestFormProviderLogin(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testform")},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	const loginPath = "/portals/test1/providers/testform/login"
+	proxyHeaders := testProxyHeaders{host: "example.com"}
+
+	// Starts the flow and returns the state parameter and the state cookies
+	startFlow := func(t *testing.T) (state string, stateCookies []string) {
+		t.Helper()
+
+		res1 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "example.com", uri: "/dashboard"}, nil)
+		defer closeBody(res1)
+		require.Equal(t, http.StatusSeeOther, res1.StatusCode)
+		signinURL := urlMustParse(t, res1.Header.Get("Location"))
+		stateCookies = res1.Header.Values("Set-Cookie")
+		require.NotEmpty(t, stateCookies)
+
+		res2 := doProxiedRequest(t, appClient, signinURL.RequestURI(), proxyHeaders, stateCookies)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusSeeOther, res2.StatusCode)
+		providerURL := urlMustParse(t, res2.Header.Get("Location"))
+		require.Equal(t, "/portals/test1/providers/testform", providerURL.Path)
+
+		return providerURL.Query().Get("state"), stateCookies
+	}
+
+	t.Run("login form", func(t *testing.T) {
+		state, stateCookies := startFlow(t)
+
+		res := doProxiedRequest(t, appClient, "/portals/test1/providers/testform?state="+url.QueryEscape(state), proxyHeaders, stateCookies)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get("Content-Security-Policy"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `action="https://example.com`+loginPath+`"`)
+		assert.Contains(t, string(body), `name="state" value="`+state+`"`)
+		assert.Contains(t, string(body), `name="password"`)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		state, stateCookies := startFlow(t)
+
+		res := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"state":    []string{state},
+			"username": []string{"test-user-1"},
+			"password": []string{"password"},
+		}, proxyHeaders, stateCookies)
+		defer closeBody(res)
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "https://example.com/dashboard", res.Header.Get("Location"))
+
+		sessionCookieName := config.Get().Cookies.CookieName("test1")
+		var sessionCookie string
+		for _, sc := range res.Header.Values("Set-Cookie") {
+			if strings.HasPrefix(sc, sessionCookieName+"=") {
+				sessionCookie = sc
+				break
+			}
+		}
+		require.NotEmpty(t, sessionCookie, "expected a Set-Cookie for %s in login response", sessionCookieName)
+
+		res2 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "example.com", uri: "/dashboard"}, []string{sessionCookie})
+		defer closeBody(res2)
+		require.Equal(t, http.StatusOK, res2.StatusCode)
+		assert.Equal(t, "test-user-1", res2.Header.Get("X-Forwarded-User"))
+	})
+
+	t.Run("wrong password shows the form again", func(t *testing.T) {
+		state, stateCookies := startFlow(t)
+
+		res := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"state":    []string{state},
+			"username": []string{"test-user-1"},
+			"password": []string{"wrong"},
+		}, proxyHeaders, stateCookies)
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Empty(t, res.Header.Values("Set-Cookie"), "state cookie must be kept so users can retry")
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Invalid username or password")
+		assert.Contains(t, string(body), `name="username" value="test-user-1"`)
+		assert.Contains(t, string(body), `name="state" value="`+state+`"`)
+	})
+
+	t.Run("too many failed attempts", func(t *testing.T) {
+		state, stateCookies := startFlow(t)
+		post := func(password string) *http.Response {
+			return doProxiedFormPost(t, appClient, loginPath, url.Values{
+				"state":    []string{state},
+				"username": []string{"test-user-2"},
+				"password": []string{password},
+			}, proxyHeaders, stateCookies)
+		}
+
+		for range loginMaxFailuresPerUser {
+			res := post("wrong")
+			closeBody(res)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+
+		// Further attempts are blocked, even with the correct password
+		res := post("password")
+		defer closeBody(res)
+		require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get("Retry-After"))
+		assert.Empty(t, res.Header.Values("Set-Cookie"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Too many failed attempts")
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		state, stateCookies := startFlow(t)
+
+		res := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"state":    []string{state[:len(state)-5] + "xxxxx"},
+			"username": []string{"test-user-1"},
+			"password": []string{"password"},
+		}, proxyHeaders, stateCookies)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("missing state cookie", func(t *testing.T) {
+		state, _ := startFlow(t)
+
+		res := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"state":    []string{state},
+			"username": []string{"test-user-1"},
+			"password": []string{"password"},
+		}, proxyHeaders, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("missing state parameter", func(t *testing.T) {
+		res := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"username": []string{"test-user-1"},
+			"password": []string{"password"},
+		}, proxyHeaders, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		res := doProxiedFormPost(t, appClient, "/portals/test1/providers/nope/login", url.Values{}, proxyHeaders, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
@@ -1,13 +1,25 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v4/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 )
 
 func TestRoutePostLogout(t *testing.T) {
@@ -51,3 +63,218 @@ func TestRoutePostLogout(t *testing.T) {
 		assert.Equal(t, "Error: Portal not found", rec.Body.String())
 	})
 }
+
+func TestRoutePostLogoutProviderLogout(t *testing.T) {
+	const portalName = "test1"
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].ProviderLogout = true
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	cookieName := config.Get().Cookies.CookieName(portalName)
+	portal := srv.portals[portalName]
+	require.True(t, portal.ProviderLogout)
+
+	newToken := func(t *testing.T, providerName string, idToken string) string {
+		t.Helper()
+
+		profile := &user.Profile{
+			Provider: providerName,
+			ID:       "test-user-1",
+			Name:     user.ProfileName{FullName: "Test User 1"},
+		}
+		claims, err := newSessionClaimsForAccessToken(portal, profile, auth.OAuth2AccessToken{IDToken: idToken})
+		require.NoError(t, err)
+		token, err := srv.newSessionToken(t.Context(), portalName, profile, claims, time.Hour, "example.com")
+		require.NoError(t, err)
+		return token
+	}
+
+	doLogout := func(t *testing.T, token string) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost,
+			fmt.Sprintf("http://localhost:%d/portals/%s/logout", testServerPort, portalName), nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: token}) //nolint:gosec
+		}
+		populateRequiredProxyHeaders(t, req)
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		closeBody(res)
+		return res
+	}
+
+	t.Run("session token includes the ID token", func(t *testing.T) {
+		token := newToken(t, "testoauth2", "my-id-token")
+
+		parsed, err := srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+		require.NoError(t, err)
+		idToken, _ := jwt.Get[string](parsed, idTokenClaim)
+		assert.Equal(t, "my-id-token", idToken)
+	})
+
+	t.Run("redirects to the identity provider", func(t *testing.T) {
+		res := doLogout(t, newToken(t, "testoauth2", "my-id-token"))
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+
+		loc := urlMustParse(t, res.Header.Get("Location"))
+		assert.Equal(t, "idp.example.com", loc.Host)
+		assert.Equal(t, "/oauth2/logout", loc.Path)
+		assert.Equal(t, "my-id-token", loc.Query().Get("id_token_hint"))
+		assert.Equal(t, "https://example.com/portals/test1", loc.Query().Get("post_logout_redirect_uri"))
+
+		// The session cookie is still deleted
+		var found bool
+		for _, c := range res.Cookies() {
+			if c.Name == cookieName {
+				found = true
+				assert.Empty(t, c.Value)
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("invalid session redirects to portal", func(t *testing.T) {
+		res := doLogout(t, "invalid-token")
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "https://example.com/portals/test1?logout=1", res.Header.Get("Location"))
+	})
+
+	t.Run("no session redirects to portal", func(t *testing.T) {
+		res := doLogout(t, "")
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "https://example.com/portals/test1?logout=1", res.Header.Get("Location"))
+	})
+}
+
+func TestRoutePostOAuth2BackchannelLogout(t *testing.T) {
+	const portalName = "test1"
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Sessions.Store = "memory"
+	}))
+
+	srv, logBuf := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	portal := srv.portals[portalName]
+
+	newSession := func(t *testing.T, userID string, providerSubject string, providerSessionID string) string {
+		t.Helper()
+
+		profile := &user.Profile{
+			Provider: "testoauth2",
+			ID:       userID,
+		}
+		claims := sessionClaims{
+			providerSubject:   providerSubject,
+			providerSessionID: providerSessionID,
+		}
+		token, err := srv.newSessionToken(t.Context(), portalName, profile, claims, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		parsed, err := srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+		require.NoError(t, err)
+		sessionID, _ := parsed.JwtID()
+		require.NotEmpty(t, sessionID)
+		return sessionID
+	}
+
+	sessionExists := func(t *testing.T, sessionID string) bool {
+		t.Helper()
+
+		_, err := srv.sessionStore.Get(t.Context(), sessionID)
+		if errors.Is(err, sessionstore.ErrSessionNotFound) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	doRequest := func(t *testing.T, form url.Values) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost,
+			fmt.Sprintf("http://localhost:%d/portals/%s/oauth2/backchannel-logout", testServerPort, portalName),
+			strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		populateRequiredProxyHeaders(t, req)
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		closeBody(res)
+		return res
+	}
+
+	t.Run("session claims include the subject and session ID from the ID token", func(t *testing.T) {
+		idToken, err := jwt.NewBuilder().
+			Subject("idp-sub").
+			Claim("sid", "idp-sid").
+			Build()
+		require.NoError(t, err)
+		idTokenBytes, err := jwt.NewSerializer().Serialize(idToken)
+		require.NoError(t, err)
+
+		claims, err := newSessionClaimsForAccessToken(portal, &user.Profile{Provider: "testoauth2", ID: "user-1"}, auth.OAuth2AccessToken{IDToken: string(idTokenBytes)})
+		require.NoError(t, err)
+		assert.Equal(t, "idp-sub", claims.providerSubject)
+		assert.Equal(t, "idp-sid", claims.providerSessionID)
+	})
+
+	t.Run("logout token with sid revokes the matching session", func(t *testing.T) {
+		s1 := newSession(t, "user-1", "sub-1", "sid-1")
+		s2 := newSession(t, "user-1", "sub-1", "sid-2")
+
+		res := doRequest(t, url.Values{"logout_token": {"logout~sub-1~sid-1"}})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+
+		assert.False(t, sessionExists(t, s1))
+		assert.True(t, sessionExists(t, s2))
+		assert.Contains(t, logBuf.String(), "Revoked sessions with back-channel logout")
+	})
+
+	t.Run("logout token with sub only revokes all sessions of the user", func(t *testing.T) {
+		s1 := newSession(t, "user-2", "sub-2", "sid-3")
+		s2 := newSession(t, "user-2", "sub-2", "sid-4")
+		s3 := newSession(t, "user-3", "sub-3", "sid-5")
+
+		res := doRequest(t, url.Values{"logout_token": {"logout~sub-2~"}})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		assert.False(t, sessionExists(t, s1))
+		assert.False(t, sessionExists(t, s2))
+		assert.True(t, sessionExists(t, s3))
+	})
+
+	t.Run("missing logout token", func(t *testing.T) {
+		res := doRequest(t, url.Values{})
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("invalid logout token", func(t *testing.T) {
+		res := doRequest(t, url.Values{"logout_token": {"logout~~"}})
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Contains(t, logBuf.String(), "Received an invalid logout token")
+	})
+
+	t.Run("logout token from another provider", func(t *testing.T) {
+		res := doRequest(t, url.Values{"logout_token": {"not-a-logout-token"}})
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+)
+
+// TestSAMLRoundTrip drives the full SAML flow in "dedicated sub-domain" mode:
+//
+//  1. Forward-auth call from the app → 303 to the sign-in page, with a state cookie
+//  2. Sign-in page → 303 to the provider start endpoint
+//  3. Provider start → 303 to the IdP with the AuthnRequest and RelayState
+//  4. Cross-site POST from the IdP to the ACS, without cookies → 200 with a page that re-submits the form
+//  5. Re-submitted POST, now with the state cookie → 303 to the original returnURL, with the session cookie
+//  6. Forward-auth call from the app, presenting the session cookie → 200 (authenticated)
+func TestSAMLRoundTrip(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Cookies.Domain = ""
+		c.Server.Domains = []config.ConfigServerDomain{
+			{Domain: "example.com", AuthHost: "auth.example.com"},
+		}
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testsaml")},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	const acsPath = "/portals/test1/saml/acs"
+	const acsURL = "https://auth.example.com" + acsPath
+
+	// Starts the flow and returns the RelayState and the state cookies
+	startFlow := func(t *testing.T) (relayState string, stateCookies []string) {
+		t.Helper()
+
+		res1 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "app.example.com", uri: "/dashboard?ref=email"}, nil)
+		defer closeBody(res1)
+		require.Equal(t, http.StatusSeeOther, res1.StatusCode)
+		signinURL := urlMustParse(t, res1.Header.Get("Location"))
+		stateCookies = res1.Header.Values("Set-Cookie")
+		require.NotEmpty(t, stateCookies)
+
+		res2 := doProxiedRequest(t, appClient, signinURL.RequestURI(), testProxyHeaders{host: "auth.example.com"}, stateCookies)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusSeeOther, res2.StatusCode)
+		providerURL := urlMustParse(t, res2.Header.Get("Location"))
+		require.Equal(t, "/portals/test1/providers/testsaml", providerURL.Path)
+
+		res3 := doProxiedRequest(t, appClient, providerURL.RequestURI(), testProxyHeaders{host: "auth.example.com"}, stateCookies)
+		defer closeBody(res3)
+		require.Equal(t, http.StatusSeeOther, res3.StatusCode)
+		idpURL := urlMustParse(t, res3.Header.Get("Location"))
+		require.Equal(t, "idp.example.com", idpURL.Host)
+		require.Equal(t, "test-request~"+acsURL, idpURL.Query().Get("SAMLRequest"))
+
+		relayState = idpURL.Query().Get("RelayState")
+		require.True(t, strings.HasPrefix(relayState, "testsaml~"))
+
+		return relayState, stateCookies
+	}
+
+	postACS := func(t *testing.T, form url.Values, setCookies []string) *http.Response {
+		t.Helper()
+		return doProxiedFormPost(t, appClient, acsPath, form, testProxyHeaders{host: "auth.example.com"}, setCookies)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		relayState, stateCookies := startFlow(t)
+		form := url.Values{
+			"SAMLResponse": []string{"test-user-1~" + acsURL},
+			"RelayState":   []string{relayState},
+		}
+
+		// The POST from the IdP is cross-site so it does not include the state cookie
+		res4 := postACS(t, form, nil)
+		defer closeBody(res4)
+		require.Equal(t, http.StatusOK, res4.StatusCode)
+		assert.Contains(t, res4.Header.Get("Content-Security-Policy"), "form-action 'self'")
+		body, err := io.ReadAll(res4.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `action="`+acsURL+`"`)
+		assert.Contains(t, string(body), `name="`+samlResubmitField+`"`)
+		assert.Empty(t, res4.Header.Values("Set-Cookie"))
+
+		// Re-submit the form from our own origin, this time with the cookies
+		form.Set(samlResubmitField, "1")
+		res5 := postACS(t, form, stateCookies)
+		defer closeBody(res5)
+		require.Equal(t, http.StatusSeeOther, res5.StatusCode)
+		assert.Equal(t, "https://app.example.com/dashboard?ref=email", res5.Header.Get("Location"))
+
+		sessionCookieName := config.Get().Cookies.CookieName("test1")
+		var sessionCookie string
+		for _, sc := range res5.Header.Values("Set-Cookie") {
+			if strings.HasPrefix(sc, sessionCookieName+"=") {
+				sessionCookie = sc
+				break
+			}
+		}
+		require.NotEmpty(t, sessionCookie, "expected a Set-Cookie for %s in ACS response", sessionCookieName)
+
+		res6 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "app.example.com", uri: "/dashboard?ref=email"}, []string{sessionCookie})
+		defer closeBody(res6)
+		require.Equal(t, http.StatusOK, res6.StatusCode)
+		assert.Equal(t, "test-user-1", res6.Header.Get("X-Forwarded-User"))
+	})
+
+	t.Run("state cookie missing after re-submit", func(t *testing.T) {
+		relayState, _ := startFlow(t)
+		res := postACS(t, url.Values{
+			"SAMLResponse":    []string{"test-user-1~" + acsURL},
+			"RelayState":      []string{relayState},
+			samlResubmitField: []string{"1"},
+		}, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		relayState, stateCookies := startFlow(t)
+		res := postACS(t, url.Values{
+			"SAMLResponse": []string{"bad-user~" + acsURL},
+			"RelayState":   []string{relayState},
+		}, stateCookies)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Location"))
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		relayState, stateCookies := startFlow(t)
+		res := postACS(t, url.Values{
+			"SAMLResponse": []string{"test-user-1~" + acsURL},
+			"RelayState":   []string{relayState[:len(relayState)-5] + "xxxxx"},
+		}, stateCookies)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("missing parameters", func(t *testing.T) {
+		res := postACS(t, url.Values{"RelayState": []string{"testsaml~a~b"}}, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("invalid relay state", func(t *testing.T) {
+		res := postACS(t, url.Values{
+			"SAMLResponse": []string{"test-user-1~" + acsURL},
+			"RelayState":   []string{"badformat"},
+		}, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		res := doProxiedRequest(t, appClient, "/portals/test1/saml/metadata/testsaml", testProxyHeaders{host: "auth.example.com"}, nil)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/samlmetadata+xml", res.Header.Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `Location="`+acsURL+`"`)
+	})
+
+	t.Run("metadata for unknown provider", func(t *testing.T) {
+		res := doProxiedRequest(t, appClient, "/portals/test1/saml/metadata/nope", testProxyHeaders{host: "auth.example.com"}, nil)
+		defer closeBody(res)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
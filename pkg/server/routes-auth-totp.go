@@ -0,0 +1,294 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+const (
+	totpCookieNamePrefix = "tf_totp"
+	// Maximum number of codes that can be entered for each sign-in
+	totpMaxAttempts = 5
+	// Provider name used for the rate limiter, so failures are counted separately from login forms
+	totpRateLimitProvider = "\x00totp"
+)
+
+// pendingTOTPSignIn is a sign-in that completed with the provider, and that is waiting for users to enter a TOTP code
+type pendingTOTPSignIn struct {
+	portal       string
+	profile      *user.Profile
+	claims       sessionClaims
+	returnURL    string
+	cookieDomain string
+	// Number of invalid codes entered
+	attempts atomic.Int32
+}
+
+// enrollmentKey returns the key for the user's TOTP enrollment in the store
+func (p *pendingTOTPSignIn) enrollmentKey() string {
+	return totp.EnrollmentKey(p.portal, p.profile.Provider, p.profile.ID)
+}
+
+// redirectToTOTP saves the sign-in until users enter a TOTP code, and redirects them to the page where they do that
+// This is used in place of setting the session cookie when the portal requires TOTP
+func (s *Server) redirectToTOTP(c *gin.Context, portal *Portal, profile *user.Profile, claims sessionClaims, returnURL string) {
+	cfg := config.Get()
+
+	cookieDomain, ok := cookieDomainForReturnURL(c, returnURL)
+	if !ok {
+		AbortWithError(c, errors.New("return URL host does not match any configured cookie domain"))
+		return
+	}
+
+	// The ID of the pending sign-in is stored in a cookie, so only this client can complete it
+	idBytes := make([]byte, 24)
+	_, err := io.ReadFull(rand.Reader, idBytes)
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to generate random data: %w", err))
+		return
+	}
+	id := base64.RawURLEncoding.EncodeToString(idBytes)
+
+	s.pendingTOTP.Set(id, &pendingTOTPSignIn{
+		portal:       portal.Name,
+		profile:      profile,
+		claims:       claims,
+		returnURL:    returnURL,
+		cookieDomain: cookieDomain,
+	}, portal.AuthenticationTimeout)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(totpCookieName(portal.Name), id, int(portal.AuthenticationTimeout.Seconds())-1, "/", cookieDomain, !cfg.Cookies.Insecure, true)
+
+	// Use a custom redirect code to write a response in the body
+	// We use a 303 redirect here so the client follows it with a GET request
+	totpURL := getPortalURI(c, portal.Name) + "/totp"
+	c.Header(headerLocation, totpURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to verification: ` + totpURL)
+}
+
+// RouteGetTOTP is the handler for GET /portals/:portal/totp
+// This displays the page where users enter a TOTP code, after signing in with a provider
+// Users who haven't set up an authenticator app yet are shown their secret too
+func (s *Server) RouteGetTOTP(c *gin.Context) {
+	portal, pending, _, err := s.getPendingTOTPSignIn(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	s.renderTOTPPage(c, http.StatusOK, portal, pending, "")
+}
+
+// RoutePostTOTP is the handler for POST /portals/:portal/totp
+// This validates the TOTP code and, if it's valid, creates the session
+// Requests are protected against CSRF by the cookie with the ID of the pending sign-in, which uses SameSite=Lax
+func (s *Server) RoutePostTOTP(c *gin.Context) {
+	portal, pending, id, err := s.getPendingTOTPSignIn(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// Block the attempt if there were too many failures for the user or from the client
+	var clientIP string
+	if rs := getRequestState(c); rs != nil {
+		clientIP = rs.clientIP
+	}
+	rateLimitUser := pending.profile.Provider + "\x00" + pending.profile.ID
+	if !s.loginRateLimiter.Allowed(portal.Name, totpRateLimitProvider, rateLimitUser, clientIP) {
+		setLogMessage(c, "TOTP verification blocked: too many failed attempts")
+		c.Header(headerRetryAfter, strconv.Itoa(int(loginFailuresWindow.Seconds())))
+		s.renderTOTPPage(c, http.StatusTooManyRequests, portal, pending, "Too many failed attempts. Please try again later.")
+		return
+	}
+
+	// Validate the code
+	// This also confirms the enrollment if users are setting up their authenticator app
+	code := strings.ReplaceAll(strings.TrimSpace(c.PostForm("code")), " ", "")
+	var valid bool
+	err = s.totpStore.Update(c.Request.Context(), pending.enrollmentKey(), func(e *totp.Enrollment, found bool) error {
+		if !found {
+			return totp.ErrNotFound
+		}
+
+		var step int64
+		step, valid = totp.Validate(e.Secret, code, time.Now(), e.LastStep)
+		if !valid {
+			return errTOTPInvalidCode
+		}
+		e.LastStep = step
+		e.Confirmed = true
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTOTPInvalidCode):
+		s.loginRateLimiter.RecordFailure(portal.Name, totpRateLimitProvider, rateLimitUser, clientIP)
+		setLogMessage(c, "TOTP verification failed: invalid code")
+
+		// After too many attempts, users must sign in again
+		if pending.attempts.Add(1) >= totpMaxAttempts {
+			s.pendingTOTP.Delete(id)
+			s.deleteTOTPCookie(c, portal.Name)
+			AbortWithError(c, NewResponseError(http.StatusUnauthorized, "Too many invalid codes: please sign in again"))
+			return
+		}
+
+		s.renderTOTPPage(c, http.StatusUnauthorized, portal, pending, "Invalid code")
+		return
+	case errors.Is(err, totp.ErrNotFound):
+		// The enrollment was removed after the page was displayed
+		AbortWithError(c, NewResponseError(http.StatusConflict, "Authenticator app is not set up: please reload the page"))
+		return
+	case err != nil:
+		AbortWithError(c, fmt.Errorf("failed to validate TOTP code: %w", err))
+		return
+	}
+	s.loginRateLimiter.RecordSuccess(portal.Name, totpRateLimitProvider, rateLimitUser, clientIP)
+
+	// The pending sign-in can be used once only
+	s.pendingTOTP.Delete(id)
+	s.deleteTOTPCookie(c, portal.Name)
+
+	// Record that the user completed a second factor
+	profile := *pending.profile
+	profile.AMR = slices.Clone(profile.AMR)
+	for _, v := range []string{"otp", "mfa"} {
+		if !slices.Contains(profile.AMR, v) {
+			profile.AMR = append(profile.AMR, v)
+		}
+	}
+
+	// Set the profile in the cookie
+	err = s.setSessionCookieForDomain(c, portal.Name, &profile, pending.claims, portal.SessionLifetime, pending.cookieDomain)
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
+		return
+	}
+
+	// Use a custom redirect code to write a response in the body
+	// We use a 303 redirect here so the client follows it with a GET request rather than re-sending the POST
+	c.Header(headerLocation, pending.returnURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to application: ` + pending.returnURL)
+}
+
+var errTOTPInvalidCode = errors.New("invalid TOTP code")
+
+// getPendingTOTPSignIn returns the portal and the pending sign-in for the cookie in the request, and the ID of the pending sign-in
+func (s *Server) getPendingTOTPSignIn(c *gin.Context) (*Portal, *pendingTOTPSignIn, string, error) {
+	portal, err := s.getPortal(c)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !portal.RequireTOTP {
+		return nil, nil, "", NewResponseError(http.StatusNotFound, "Portal does not require TOTP")
+	}
+
+	id, _ := c.Cookie(totpCookieName(portal.Name))
+	if id == "" {
+		return nil, nil, "", NewResponseError(http.StatusUnauthorized, "Sign-in not found or expired: please sign in again")
+	}
+	pending, ok := s.pendingTOTP.Get(id)
+	if !ok || pending.portal != portal.Name {
+		return nil, nil, "", NewResponseError(http.StatusUnauthorized, "Sign-in not found or expired: please sign in again")
+	}
+
+	return portal, pending, id, nil
+}
+
+// renderTOTPPage renders the signin page with the form to enter a TOTP code
+// If the user hasn't confirmed the enrollment yet, this creates it if needed, and includes the secret in the page
+func (s *Server) renderTOTPPage(c *gin.Context, status int, portal *Portal, pending *pendingTOTPSignIn, errMsg string) {
+	var secret string
+	err := s.totpStore.Update(c.Request.Context(), pending.enrollmentKey(), func(e *totp.Enrollment, found bool) error {
+		if found && e.Confirmed {
+			// Nothing to change: return an error so the transaction is rolled back
+			return errTOTPEnrollmentConfirmed
+		}
+		if !found {
+			var gErr error
+			e.Secret, gErr = totp.GenerateSecret()
+			if gErr != nil {
+				return gErr
+			}
+			e.CreatedAt = time.Now()
+		}
+		secret = e.Secret
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTOTPEnrollmentConfirmed) {
+		AbortWithError(c, fmt.Errorf("failed to retrieve TOTP enrollment: %w", err))
+		return
+	}
+
+	data := &signinTemplateData_TOTP{
+		Action: getPortalURI(c, portal.Name) + "/totp",
+		Error:  errMsg,
+	}
+	if secret != "" {
+		account := pending.profile.GetEmail()
+		if account == "" {
+			account = pending.profile.ID
+		}
+		issuer := config.Get().TOTP.Issuer
+		if issuer == "" {
+			issuer = portal.DisplayName
+		}
+
+		data.Account = account
+		data.Secret = formatTOTPSecret(secret)
+		//nolint:gosec
+		data.KeyURI = template.URL(totp.KeyURI(issuer, account, secret))
+	}
+
+	s.renderTOTPTemplate(c, status, portal, data)
+}
+
+var errTOTPEnrollmentConfirmed = errors.New("enrollment is confirmed")
+
+func (s *Server) deleteTOTPCookie(c *gin.Context, portalName string) {
+	cfg := config.Get()
+	cookieDomain, _, ok := cookieDomainForContext(c)
+	if !ok {
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(totpCookieName(portalName), "", -1, "/", cookieDomain, !cfg.Cookies.Insecure, true)
+}
+
+func totpCookieName(portalName string) string {
+	return totpCookieNamePrefix + "_" + portalName
+}
+
+// formatTOTPSecret splits the secret in groups of 4 characters, so it's easier to type
+func formatTOTPSecret(secret string) string {
+	var sb strings.Builder
+	for i := 0; i < len(secret); i += 4 {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(secret[i:min(i+4, len(secret))])
+	}
+	return sb.String()
+}
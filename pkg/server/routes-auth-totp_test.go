@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
+)
+
+var totpSecretRe = regexp.MustCompile(`<code class="login-form-secret">([^<]*)</code>`)
+
+func TestTOTPSecondFactor(t *testing.T) {
+	const (
+		adminToken = "test-admin-token-0123456789"
+		loginPath  = "/portals/test1/providers/testform/login"
+		totpPath   = "/portals/test1/totp"
+	)
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Sessions.Store = "memory"
+		c.Admin = config.ConfigAdmin{
+			Enabled: true,
+			Token:   adminToken,
+		}
+		c.TOTP.StorePath = filepath.Join(t.TempDir(), "totp.db")
+		c.Portals[0].RequireTOTP = true
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testform")},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	proxyHeaders := testProxyHeaders{host: "example.com"}
+	sessionCookieName := config.Get().Cookies.CookieName(testPortalName)
+
+	// Signs in with the form provider, and returns the cookie for the pending sign-in
+	signIn := func(t *testing.T, username string) []string {
+		t.Helper()
+
+		res1 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "example.com", uri: "/dashboard"}, nil)
+		defer closeBody(res1)
+		require.Equal(t, http.StatusSeeOther, res1.StatusCode)
+		signinURL := urlMustParse(t, res1.Header.Get("Location"))
+		stateCookies := res1.Header.Values("Set-Cookie")
+
+		res2 := doProxiedRequest(t, appClient, signinURL.RequestURI(), proxyHeaders, stateCookies)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusSeeOther, res2.StatusCode)
+		state := urlMustParse(t, res2.Header.Get("Location")).Query().Get("state")
+		require.NotEmpty(t, state)
+
+		res3 := doProxiedFormPost(t, appClient, loginPath, url.Values{
+			"state":    []string{state},
+			"username": []string{username},
+			"password": []string{"password"},
+		}, proxyHeaders, stateCookies)
+		defer closeBody(res3)
+		require.Equal(t, http.StatusSeeOther, res3.StatusCode)
+		assert.Equal(t, "https://example.com"+totpPath, res3.Header.Get("Location"))
+
+		var totpCookie string
+		for _, sc := range res3.Header.Values("Set-Cookie") {
+			assert.False(t, strings.HasPrefix(sc, sessionCookieName+"="), "session cookie must not be set before the TOTP code is entered")
+			if strings.HasPrefix(sc, totpCookieName(testPortalName)+"=") {
+				totpCookie = sc
+			}
+		}
+		require.NotEmpty(t, totpCookie)
+		return []string{totpCookie}
+	}
+
+	// Returns the secret shown in the page, or an empty string if there's none
+	getSecret := func(t *testing.T, cookies []string) string {
+		t.Helper()
+
+		res := doProxiedRequest(t, appClient, totpPath, proxyHeaders, cookies)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `name="code"`)
+
+		m := totpSecretRe.FindSubmatch(body)
+		if m == nil {
+			return ""
+		}
+		return html.UnescapeString(string(m[1]))
+	}
+
+	postCode := func(t *testing.T, cookies []string, code string) *http.Response {
+		t.Helper()
+		return doProxiedFormPost(t, appClient, totpPath, url.Values{"code": []string{code}}, proxyHeaders, cookies)
+	}
+
+	// Checks that the response sets a session cookie with the "mfa" authentication method
+	assertSession := func(t *testing.T, res *http.Response) {
+		t.Helper()
+
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "https://example.com/dashboard", res.Header.Get("Location"))
+
+		var sessionCookie string
+		for _, sc := range res.Header.Values("Set-Cookie") {
+			if strings.HasPrefix(sc, sessionCookieName+"=") {
+				sessionCookie = sc
+				break
+			}
+		}
+		require.NotEmpty(t, sessionCookie, "expected a Set-Cookie for %s in response", sessionCookieName)
+
+		res2 := doProxiedRequest(t, appClient, "/portals/test1/profile", proxyHeaders, []string{sessionCookie})
+		defer closeBody(res2)
+		require.Equal(t, http.StatusOK, res2.StatusCode)
+		body, err := io.ReadAll(res2.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Authentication methods: otp, mfa")
+	}
+
+	var (
+		secret   string
+		lastCode string
+	)
+
+	t.Run("enroll", func(t *testing.T) {
+		cookies := signIn(t, "test-user-1")
+
+		secret = getSecret(t, cookies)
+		require.NotEmpty(t, secret, "page should contain the secret for users who aren't enrolled")
+
+		// The same secret is shown until the enrollment is confirmed
+		assert.Equal(t, secret, getSecret(t, cookies))
+
+		res := postCode(t, cookies, "000000")
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Invalid code")
+
+		lastCode = totp.GenerateCode(secret, time.Now())
+		res2 := postCode(t, cookies, lastCode)
+		defer closeBody(res2)
+		assertSession(t, res2)
+
+		// The pending sign-in can't be used again
+		res3 := doProxiedRequest(t, appClient, totpPath, proxyHeaders, cookies)
+		defer closeBody(res3)
+		require.Equal(t, http.StatusUnauthorized, res3.StatusCode)
+	})
+
+	t.Run("sign in", func(t *testing.T) {
+		cookies := signIn(t, "test-user-1")
+
+		// The secret isn't shown after the enrollment is confirmed
+		assert.Empty(t, getSecret(t, cookies))
+
+		// Codes can't be replayed
+		res := postCode(t, cookies, lastCode)
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		// Use the code for the next period, which is accepted to allow for clock skew
+		res2 := postCode(t, cookies, totp.GenerateCode(secret, time.Now().Add(30*time.Second)))
+		defer closeBody(res2)
+		assertSession(t, res2)
+	})
+
+	t.Run("too many invalid codes", func(t *testing.T) {
+		cookies := signIn(t, "test-user-2")
+		require.NotEmpty(t, getSecret(t, cookies))
+
+		for range totpMaxAttempts - 1 {
+			res := postCode(t, cookies, "000000")
+			closeBody(res)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+
+		res := postCode(t, cookies, "000000")
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Too many invalid codes")
+
+		res2 := doProxiedRequest(t, appClient, totpPath, proxyHeaders, cookies)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusUnauthorized, res2.StatusCode)
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		res := postCode(t, nil, "000000")
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("admin deletes the enrollment", func(t *testing.T) {
+		doDelete := func(t *testing.T) *http.Response {
+			t.Helper()
+
+			reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+			t.Cleanup(reqCancel)
+			req, err := http.NewRequestWithContext(reqCtx, http.MethodDelete, fmt.Sprintf("http://localhost:%d/api/admin/portals/test1/providers/testform/users/test-user-1/totp", testServerPort), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			res, err := appClient.Do(req)
+			require.NoError(t, err)
+			return res
+		}
+
+		res := doDelete(t)
+		defer closeBody(res)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res2 := doDelete(t)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusNotFound, res2.StatusCode)
+
+		// Users are asked to set up an authenticator app again, with a new secret
+		cookies := signIn(t, "test-user-1")
+		newSecret := getSecret(t, cookies)
+		require.NotEmpty(t, newSecret)
+		assert.NotEqual(t, secret, newSecret)
+	})
+}
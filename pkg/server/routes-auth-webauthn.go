@@ -0,0 +1,256 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+)
+
+// Handles GET /portals/:portal/providers/:provider when using a WebAuthn provider
+// This displays the page where users sign in with their passkey
+func (s *Server) handleGetAuthProviderWebAuthn(c *gin.Context, status int, portal *Portal, stateCookieID string, nonce string, provider auth.WebAuthnProvider, errMsg string) {
+	// The challenge is derived from the state, so it's bound to the state cookie and we don't need to store it
+	opts, err := provider.WebAuthnLoginOptions(getWebAuthnOrigin(c, portal.Name), getWebAuthnLoginChallenge(stateCookieID, nonce))
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to get WebAuthn options: %w", err))
+		return
+	}
+
+	s.renderPasskeyTemplate(c, status, portal, provider, signinTemplateData_Passkey{
+		Mode:    "login",
+		Action:  getPortalURI(c, portal.Name) + "/providers/" + provider.GetProviderName() + "/assertion",
+		State:   stateCookieID + "~" + nonce,
+		Options: string(opts),
+		Error:   errMsg,
+	})
+}
+
+// RoutePostWebAuthnAssertion is the handler for POST /portals/:portal/providers/:provider/assertion
+// This authenticates users with the response of their authenticator to the sign-in request
+func (s *Server) RoutePostWebAuthnAssertion(c *gin.Context) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	provider, ok := providerI.(auth.WebAuthnProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusNotFound, "Auth provider does not support passkeys"))
+		return
+	}
+
+	// Validate the state parameter
+	// This also protects against CSRF, as the nonce in the form must match the one in the state cookie
+	stateParam := c.PostForm("state")
+	if stateParam == "" {
+		AbortWithError(c, NewResponseError(http.StatusBadRequest, "The parameter 'state' is required in the request body"))
+		return
+	}
+	content, stateCookieID, err := s.checkStateParam(c, portal, stateParam)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	var assertion auth.WebAuthnAssertion
+	err = decodeWebAuthnFormFields(c, map[string]*[]byte{
+		"credentialId":      &assertion.CredentialID,
+		"clientDataJSON":    &assertion.ClientDataJSON,
+		"authenticatorData": &assertion.AuthenticatorData,
+		"signature":         &assertion.Signature,
+	})
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	// The user handle is optional
+	if v := c.PostForm("userHandle"); v != "" {
+		assertion.UserHandle, err = base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			AbortWithError(c, NewResponseError(http.StatusBadRequest, "The parameter 'userHandle' is invalid"))
+			return
+		}
+	}
+
+	// Validate the assertion
+	profile, err := provider.WebAuthnFinishLogin(c.Request.Context(), getWebAuthnOrigin(c, portal.Name), getWebAuthnLoginChallenge(stateCookieID, content.nonce), assertion)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// Show the page again, so users can retry
+		setLogMessage(c, "WebAuthn authentication failed: "+err.Error())
+		s.handleGetAuthProviderWebAuthn(c, http.StatusUnauthorized, portal, stateCookieID, content.nonce, provider, "Could not sign in with this passkey")
+		return
+	} else if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to authenticate user: %w", err))
+		return
+	}
+
+	// Clear the state cookie for the portal
+	s.deleteStateCookies(c, portal.Name)
+
+	// If the portal requires TOTP, users must enter a code before the session is created
+	if portal.RequireTOTP {
+		s.redirectToTOTP(c, portal, profile, sessionClaims{}, content.returnURL)
+		return
+	}
+
+	// Set the profile in the cookie
+	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, sessionClaims{}, portal.SessionLifetime, content.returnURL)
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
+		return
+	}
+
+	// Use a custom redirect code to write a response in the body
+	// We use a 303 redirect here so the client follows it with a GET request rather than re-sending the POST
+	c.Header(headerLocation, content.returnURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to application: ` + content.returnURL)
+}
+
+// RouteGetWebAuthnRegister is the handler for GET /portals/:portal/providers/:provider/register
+// This displays the page where users register a passkey
+// Users must be signed in to the portal with any provider, or they must have an invite, which is passed in the "invite" query string arg
+func (s *Server) RouteGetWebAuthnRegister(c *gin.Context) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	provider, ok := providerI.(auth.WebAuthnProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusNotFound, "Auth provider does not support passkeys"))
+		return
+	}
+
+	var registrant auth.WebAuthnRegistrant
+	inviteToken := c.Query("invite")
+	if inviteToken != "" {
+		registrant.InviteToken = inviteToken
+		registrant.User, err = provider.WebAuthnGetInvite(c.Request.Context(), inviteToken)
+		if errors.Is(err, auth.ErrWebAuthnNotFound) {
+			AbortWithError(c, NewResponseError(http.StatusNotFound, "Invite not found or expired"))
+			return
+		} else if err != nil {
+			AbortWithError(c, fmt.Errorf("failed to retrieve invite: %w", err))
+			return
+		}
+	} else {
+		profile, sessionProvider := s.getProfileFromContext(c)
+		if profile == nil {
+			AbortWithError(c, NewResponseError(http.StatusUnauthorized, "You must be signed in, or use an invite, to register a passkey"))
+			return
+		}
+		registrant.Source = sessionProvider.GetProviderName()
+		registrant.User = auth.WebAuthnUser{
+			ID:     profile.ID,
+			Name:   profile.Name.FullName,
+			Groups: profile.Groups,
+		}
+		if profile.Email != nil {
+			registrant.User.Email = profile.Email.Value
+			registrant.User.EmailVerified = profile.Email.Verified
+		}
+	}
+
+	opts, err := provider.WebAuthnBeginRegistration(c.Request.Context(), getWebAuthnOrigin(c, portal.Name), registrant)
+	if errors.Is(err, auth.ErrWebAuthnUserConflict) {
+		setLogMessage(c, "WebAuthn registration failed: "+err.Error())
+		AbortWithError(c, NewResponseError(http.StatusConflict, "A user with the same ID has already registered a passkey after signing in with a different provider"))
+		return
+	} else if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to start passkey registration: %w", err))
+		return
+	}
+
+	userName := registrant.User.Email
+	if userName == "" {
+		userName = registrant.User.ID
+	}
+	s.renderPasskeyTemplate(c, http.StatusOK, portal, provider, signinTemplateData_Passkey{
+		Mode:     "register",
+		Action:   getPortalURI(c, portal.Name) + "/providers/" + provider.GetProviderName() + "/register",
+		Options:  string(opts),
+		UserName: userName,
+	})
+}
+
+// RoutePostWebAuthnRegister is the handler for POST /portals/:portal/providers/:provider/register
+// This stores the passkey created by the authenticator
+// The request doesn't need a session or a state cookie, as it's bound to the registration by the challenge
+func (s *Server) RoutePostWebAuthnRegister(c *gin.Context) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	provider, ok := providerI.(auth.WebAuthnProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusNotFound, "Auth provider does not support passkeys"))
+		return
+	}
+
+	var attestation auth.WebAuthnAttestation
+	err = decodeWebAuthnFormFields(c, map[string]*[]byte{
+		"clientDataJSON":    &attestation.ClientDataJSON,
+		"attestationObject": &attestation.AttestationObject,
+	})
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	u, err := provider.WebAuthnFinishRegistration(c.Request.Context(), getWebAuthnOrigin(c, portal.Name), attestation)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		setLogMessage(c, "WebAuthn registration failed: "+err.Error())
+		AbortWithError(c, NewResponseError(http.StatusBadRequest, "Could not register the passkey"))
+		return
+	} else if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to register passkey: %w", err))
+		return
+	}
+
+	setLogMessage(c, "Registered a passkey for user "+u.ID)
+	s.renderPasskeyTemplate(c, http.StatusOK, portal, provider, signinTemplateData_Passkey{
+		Mode:    "registered",
+		Message: "Your passkey has been registered. You can now use it to sign in.",
+		Link:    getPortalURI(c, portal.Name),
+	})
+}
+
+// decodeWebAuthnFormFields decodes the base64url-encoded values of required fields in the request body
+func decodeWebAuthnFormFields(c *gin.Context, fields map[string]*[]byte) (err error) {
+	for name, dest := range fields {
+		v := c.PostForm(name)
+		if v == "" {
+			return NewResponseErrorf(http.StatusBadRequest, "The parameter '%s' is required in the request body", name)
+		}
+		*dest, err = base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return NewResponseErrorf(http.StatusBadRequest, "The parameter '%s' is invalid", name)
+		}
+	}
+	return nil
+}
+
+// Get the challenge for WebAuthn sign-in requests, which is derived from the state
+func getWebAuthnLoginChallenge(stateCookieID string, nonce string) []byte {
+	h := sha256.Sum256([]byte("webauthn:" + stateCookieID + "~" + nonce))
+	return h[:]
+}
+
+// Get the origin of the auth server, which is checked by WebAuthn
+func getWebAuthnOrigin(c *gin.Context, portal string) string {
+	u, err := url.Parse(getPortalURI(c, portal))
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+var webAuthnOptionsRe = regexp.MustCompile(`data-webauthn-options="([^"]*)"`)
+
+func TestWebAuthnProvider(t *testing.T) {
+	const (
+		adminToken   = "test-admin-token-0123456789"
+		origin       = "https://example.com"
+		assertPath   = "/portals/test1/providers/passkey/assertion"
+		registerPath = "/portals/test1/providers/passkey/register"
+	)
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Sessions.Store = "memory"
+		c.Admin = config.ConfigAdmin{
+			Enabled: true,
+			Token:   adminToken,
+		}
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testoauth2")},
+			{WebAuthn: &config.ProviderConfig_WebAuthn{
+				Name:      "passkey",
+				StorePath: filepath.Join(t.TempDir(), "passkeys.db"),
+			}},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	proxyHeaders := testProxyHeaders{host: "example.com"}
+	sessionCookieName := config.Get().Cookies.CookieName(testPortalName)
+
+	// Returns the WebAuthn options in the page
+	getOptions := func(t *testing.T, res *http.Response) []byte {
+		t.Helper()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		m := webAuthnOptionsRe.FindSubmatch(body)
+		require.Len(t, m, 2, "page should contain the WebAuthn options")
+		return []byte(html.UnescapeString(string(m[1])))
+	}
+
+	// Registers a passkey on the page at the path
+	register := func(t *testing.T, authn *auth.TestWebAuthnAuthenticator, path string, setCookies []string) {
+		t.Helper()
+
+		res := doProxiedRequest(t, appClient, path, proxyHeaders, setCookies)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		att, err := authn.Register(getOptions(t, res), origin)
+		require.NoError(t, err)
+
+		res2 := doProxiedFormPost(t, appClient, registerPath, url.Values{
+			"clientDataJSON":    []string{base64.RawURLEncoding.EncodeToString(att.ClientDataJSON)},
+			"attestationObject": []string{base64.RawURLEncoding.EncodeToString(att.AttestationObject)},
+		}, proxyHeaders, nil)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusOK, res2.StatusCode)
+		body, err := io.ReadAll(res2.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Your passkey has been registered")
+	}
+
+	// Signs in with the passkey and returns the response
+	signIn := func(t *testing.T, authn *auth.TestWebAuthnAuthenticator) *http.Response {
+		t.Helper()
+
+		res1 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "example.com", uri: "/dashboard"}, nil)
+		defer closeBody(res1)
+		require.Equal(t, http.StatusSeeOther, res1.StatusCode)
+		state := urlMustParse(t, res1.Header.Get("Location")).Query().Get("state")
+		stateCookies := res1.Header.Values("Set-Cookie")
+		require.NotEmpty(t, state)
+
+		res2 := doProxiedRequest(t, appClient, "/portals/test1/providers/passkey?state="+url.QueryEscape(state), proxyHeaders, stateCookies)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusOK, res2.StatusCode)
+		assertion, err := authn.Login(getOptions(t, res2), origin)
+		require.NoError(t, err)
+
+		return doProxiedFormPost(t, appClient, assertPath, url.Values{
+			"state":             []string{state},
+			"credentialId":      []string{base64.RawURLEncoding.EncodeToString(assertion.CredentialID)},
+			"clientDataJSON":    []string{base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON)},
+			"authenticatorData": []string{base64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData)},
+			"signature":         []string{base64.RawURLEncoding.EncodeToString(assertion.Signature)},
+			"userHandle":        []string{base64.RawURLEncoding.EncodeToString(assertion.UserHandle)},
+		}, proxyHeaders, stateCookies)
+	}
+
+	doAdminRequest := func(t *testing.T, method string, path string, body any) *http.Response {
+		t.Helper()
+
+		var reqBody io.Reader
+		if body != nil {
+			enc, err := json.Marshal(body)
+			require.NoError(t, err)
+			reqBody = strings.NewReader(string(enc))
+		}
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		t.Cleanup(reqCancel)
+		req, err := http.NewRequestWithContext(reqCtx, method, fmt.Sprintf("http://localhost:%d/api/admin%s", testServerPort, path), reqBody)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	alice := auth.NewTestWebAuthnAuthenticator()
+
+	t.Run("registering requires a session or an invite", func(t *testing.T) {
+		res := doProxiedRequest(t, appClient, registerPath, proxyHeaders, nil)
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res2 := doProxiedRequest(t, appClient, registerPath+"?invite=not-valid", proxyHeaders, nil)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusNotFound, res2.StatusCode)
+	})
+
+	t.Run("register from a session", func(t *testing.T) {
+		token, err := srv.newSessionToken(t.Context(), testPortalName, &user.Profile{
+			Provider: "testoauth2",
+			ID:       "alice",
+			Name:     user.ProfileName{FullName: "Alice Smith"},
+			Email:    &user.ProfileEmail{Value: "alice@example.com", Verified: true},
+		}, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		register(t, alice, registerPath, []string{sessionCookieName + "=" + token})
+	})
+
+	t.Run("sign in", func(t *testing.T) {
+		res := signIn(t, alice)
+		defer closeBody(res)
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "https://example.com/dashboard", res.Header.Get("Location"))
+
+		var sessionCookie string
+		for _, sc := range res.Header.Values("Set-Cookie") {
+			if strings.HasPrefix(sc, sessionCookieName+"=") {
+				sessionCookie = sc
+				break
+			}
+		}
+		require.NotEmpty(t, sessionCookie, "expected a Set-Cookie for %s in response", sessionCookieName)
+
+		res2 := doProxiedRequest(t, appClient, "/portals/test1", testProxyHeaders{host: "example.com", uri: "/dashboard"}, []string{sessionCookie})
+		defer closeBody(res2)
+		require.Equal(t, http.StatusOK, res2.StatusCode)
+		assert.Equal(t, "alice", res2.Header.Get("X-Forwarded-User"))
+	})
+
+	t.Run("unknown passkey shows the page again", func(t *testing.T) {
+		res := signIn(t, auth.NewTestWebAuthnAuthenticator())
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Empty(t, res.Header.Values("Set-Cookie"), "state cookie must be kept so users can retry")
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Could not sign in with this passkey")
+	})
+
+	t.Run("invite", func(t *testing.T) {
+		res := doAdminRequest(t, http.MethodPost, "/portals/test1/providers/passkey/invites", PostAdminWebAuthnInviteRequest{
+			UserID: "bob",
+			Name:   "Bob",
+			Groups: []string{"ops"},
+		})
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var invite PostAdminWebAuthnInviteResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&invite))
+		assert.NotEmpty(t, invite.Token)
+		assert.Equal(t, registerPath+"?invite="+invite.Token, invite.Path)
+		assert.True(t, invite.ExpiresAt.After(time.Now()))
+
+		bob := auth.NewTestWebAuthnAuthenticator()
+		register(t, bob, invite.Path, nil)
+
+		res2 := signIn(t, bob)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusSeeOther, res2.StatusCode)
+
+		// The invite can't be used again
+		res3 := doProxiedRequest(t, appClient, invite.Path, proxyHeaders, nil)
+		defer closeBody(res3)
+		require.Equal(t, http.StatusNotFound, res3.StatusCode)
+	})
+
+	t.Run("invite requires a user ID", func(t *testing.T) {
+		res := doAdminRequest(t, http.MethodPost, "/portals/test1/providers/passkey/invites", PostAdminWebAuthnInviteRequest{})
+		defer closeBody(res)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("provider does not support passkeys", func(t *testing.T) {
+		res := doAdminRequest(t, http.MethodPost, "/portals/test1/providers/testoauth2/invites", PostAdminWebAuthnInviteRequest{UserID: "bob"})
+		defer closeBody(res)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		res := doAdminRequest(t, http.MethodDelete, "/portals/test1/providers/passkey/users/alice", nil)
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var deleted DeleteAdminWebAuthnUserResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&deleted))
+		assert.Equal(t, 1, deleted.Passkeys)
+		assert.Equal(t, 1, deleted.Revoked)
+
+		res2 := signIn(t, alice)
+		defer closeBody(res2)
+		require.Equal(t, http.StatusUnauthorized, res2.StatusCode)
+
+		res3 := doAdminRequest(t, http.MethodDelete, "/portals/test1/providers/passkey/users/alice", nil)
+		defer closeBody(res3)
+		require.Equal(t, http.StatusNotFound, res3.StatusCode)
+	})
+}
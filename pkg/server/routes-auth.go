@@ -5,8 +5,10 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
@@ -38,9 +41,25 @@ func (s *Server) RouteGetAuthRoot(c *gin.Context) {
 		return
 	}
 
+	// Try authenticating the request with the providers that don't need a session, such as those using client certificates
+	profile, provider, err = s.authenticateRequest(c, portal)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	} else if profile != nil {
+		s.handleAuthenticatedRoot(c, portal, provider, profile)
+		return
+	}
+
 	// We don't have a session, so redirect to the sign-in page
 	s.metrics.RecordAuthentication(false)
 
+	// If the portal doesn't have any provider users can sign in with, there's no sign-in page to redirect to
+	if len(portal.SigninProvidersList) == 0 {
+		AbortWithError(c, NewResponseError(http.StatusUnauthorized, "Not authenticated"))
+		return
+	}
+
 	// Get the return URL
 	returnURL := getReturnURL(c, portal.Name)
 
@@ -81,6 +100,35 @@ func (s *Server) RouteGetAuthRoot(c *gin.Context) {
 	_, _ = c.Writer.WriteString(`Redirecting to sign-in page: ` + signInURL)
 }
 
+// authenticateRequest tries authenticating the request with each provider in the portal that implements auth.RequestAuthProvider, in order
+// If no provider found credentials in the request, it returns a nil profile and no error
+func (s *Server) authenticateRequest(c *gin.Context, portal *Portal) (*user.Profile, auth.Provider, error) {
+	// When the portal requires TOTP, users can only be authenticated with a session
+	// Providers that can't be used to sign in are rejected in NewServer for these portals
+	if portal.RequireTOTP {
+		return nil, nil, nil
+	}
+
+	for _, providerName := range portal.ProvidersList {
+		provider, ok := portal.Providers[providerName].(auth.RequestAuthProvider)
+		if !ok {
+			continue
+		}
+
+		profile, err := provider.AuthenticateRequest(c.Request)
+		if errors.Is(err, auth.ErrNoCredentials) {
+			continue
+		} else if err != nil {
+			setLogMessage(c, "Request authentication failed with provider '"+providerName+"': "+err.Error())
+			return nil, nil, NewResponseError(http.StatusUnauthorized, "Not authenticated")
+		}
+
+		return profile, provider, nil
+	}
+
+	return nil, nil, nil
+}
+
 func (s *Server) handleAuthenticatedRoot(c *gin.Context, portal *Portal, provider auth.Provider, profile *user.Profile) {
 	// Check if there's any condition ("if" query string arg or "X-Forward-Auth-If" header) to check claims against, for AuthZ
 	cond := c.Query("if")
@@ -93,8 +141,55 @@ func (s *Server) handleAuthenticatedRoot(c *gin.Context, portal *Portal, provide
 		cond = condHeader
 	}
 
+	// Check if there's a named policy ("policy" query string arg or "X-Forward-Auth-Policy" header) to check claims against
+	// When both a condition and a policy are passed, both must be satisfied
+	policy := c.Query("policy")
+	policyHeader := headerValue(c.Request.Header, headerXForwardAuthPolicy)
+	if policy != "" && policyHeader != "" {
+		_ = c.Error(errors.New("policy passed in both 'policy' query string arg and '" + headerXForwardAuthPolicy + "' header"))
+		AbortWithError(c, NewResponseErrorf(http.StatusBadRequest, "Authorization policy passed in both 'policy' query string arg and '"+headerXForwardAuthPolicy+"' header"))
+		return
+	} else if policyHeader != "" {
+		policy = policyHeader
+	}
+
+	// Conditions are evaluated against the user's profile and the request forwarded by Traefik
+	// We only need the request's properties if there's anything to evaluate
+	rs := getRequestState(c)
+	var ec *conditions.EvalContext
+	if policy != "" || cond != "" || (rs != nil && rs.rule != nil) {
+		ec = &conditions.EvalContext{
+			Profile: profile,
+			Request: getForwardedRequest(c),
+		}
+		if rs != nil {
+			ec.SessionIssuedAt = rs.session.issuedAt()
+		}
+	}
+
+	if policy != "" {
+		predicate, ok := config.Get().GetPolicies().Get(policy)
+		if !ok {
+			_ = c.Error(fmt.Errorf("authorization policy '%s' is not defined", policy))
+			AbortWithError(c, NewResponseErrorf(http.StatusBadRequest, "Invalid authorization rules"))
+			return
+		} else if !predicate(ec) {
+			// The token is not authorized
+			s.metrics.RecordAuthentication(false)
+			AbortWithError(c, NewResponseErrorf(http.StatusForbidden, "Access denied per authorization rules"))
+			return
+		}
+	}
+
+	// Apply the portal's rule matching the request, if any
+	if rs != nil && rs.rule != nil && !rs.rule.allows(ec) {
+		s.metrics.RecordAuthentication(false)
+		AbortWithError(c, NewResponseErrorf(http.StatusForbidden, "Access denied per authorization rules"))
+		return
+	}
+
 	if cond != "" {
-		ok, err := s.checkAuthzConditions(cond, profile)
+		ok, err := s.checkAuthzConditions(cond, ec)
 
 		if err != nil {
 			// Errors indicate thins such as invalid condition
@@ -109,6 +204,18 @@ func (s *Server) handleAuthenticatedRoot(c *gin.Context, portal *Portal, provide
 		}
 	}
 
+	// If the portal has an idle timeout, extend the session as it's being used
+	if rs != nil {
+		err := s.extendIdleSession(c, portal, rs.session, rs.sessionCacheKey)
+		if err != nil {
+			// Keep the current session until it expires
+			s.requestLogger(c).WarnContext(c.Request.Context(),
+				"Failed to extend the session",
+				slog.Any("error", err),
+			)
+		}
+	}
+
 	// If we are here, we have a valid session, so respond with a 200 status code
 	// Include the user name in the response body in case a visitor is hitting the auth server directly
 	s.metrics.RecordAuthentication(true)
@@ -127,10 +234,11 @@ func (s *Server) handleAuthenticatedRoot(c *gin.Context, portal *Portal, provide
 	}
 }
 
-func (s *Server) checkAuthzConditions(cond string, profile *user.Profile) (bool, error) {
+func (s *Server) checkAuthzConditions(cond string, ec *conditions.EvalContext) (bool, error) {
 	var err error
 
 	// Get the predicate from the cache
+	// Predicates are keyed by the condition only: they don't capture anything about the request or the user, which are passed in the evaluation context, and functions that depend on the time read it when the predicate is evaluated
 	// Note: we use Get and Set separately, instead of atomic operations like GetOrCompute, because we need to be able to handle errors
 	// This means there's a chance that we may compute the same predicate twice, if two requests happen in parallel, but it's acceptable in this case
 	var predicate conditions.UserProfilePredicate
@@ -139,7 +247,8 @@ func (s *Server) checkAuthzConditions(cond string, profile *user.Profile) (bool,
 		predicate = cached.predicate
 		cached.lastUsed.Store(time.Now().Unix())
 	} else {
-		predicate, err = conditions.NewPredicate(cond)
+		// Conditions can reference the named policies defined in the configuration
+		predicate, err = config.Get().GetPolicies().NewPredicate(cond)
 		if err != nil {
 			return false, fmt.Errorf("authorization condition is not valid: %w", err)
 		}
@@ -153,7 +262,11 @@ func (s *Server) checkAuthzConditions(cond string, profile *user.Profile) (bool,
 	}
 
 	// Evaluate the condition
-	ok = predicate(profile)
+	// A nil predicate must never be treated as "no condition": it means the condition couldn't be compiled
+	if predicate == nil {
+		return false, errors.New("authorization condition is not valid: condition does not return a boolean")
+	}
+	ok = predicate(ec)
 	return ok, nil
 }
 
@@ -188,8 +301,8 @@ func (s *Server) RouteGetAuthSignin(c *gin.Context) {
 
 	// If there's a single provider, we redirect the user to that directly, unless AlwaysShowProvidersPage is true
 	// We also always display the signing page if the user just logged out
-	if len(portal.ProvidersList) == 1 && !portal.AlwaysShowSigninPage && !logoutBanner {
-		providerName := portal.ProvidersList[0]
+	if len(portal.SigninProvidersList) == 1 && !portal.AlwaysShowSigninPage && !logoutBanner {
+		providerName := portal.SigninProvidersList[0]
 		redirectURL := getPortalURI(c, portal.Name) + "/providers/" + providerName + "?state=" + stateCookieID + "~" + content.nonce
 		c.Header(headerLocation, redirectURL)
 		c.Header(headerContentType, contentTypeTextPlain)
@@ -209,9 +322,14 @@ func (s *Server) parseStateParamPreAuth(c *gin.Context, portal *Portal) (stateCo
 		return stateCookieContent{}, "", NewResponseError(http.StatusBadRequest, "The parameter 'state' is required in the query string")
 	}
 
+	return s.checkStateParam(c, portal, stateParam)
+}
+
+// checkStateParam validates a state parameter in the format "StateCookieID~Nonce" against the state cookie, returning the content of the cookie and its ID
+func (s *Server) checkStateParam(c *gin.Context, portal *Portal, stateParam string) (stateCookieContent, string, error) {
 	stateCookieID, expectedNonce, ok := strings.Cut(stateParam, "~")
 	if !ok {
-		return stateCookieContent{}, "", NewResponseError(http.StatusUnauthorized, "Query string parameter 'state' is invalid")
+		return stateCookieContent{}, "", NewResponseError(http.StatusUnauthorized, "Parameter 'state' is invalid")
 	}
 
 	// Get the state cookie
@@ -251,6 +369,14 @@ func (s *Server) RouteGetAuthProvider(c *gin.Context) {
 		s.handleGetAuthProviderOAuth2(c, portal, stateCookieID, content.nonce, provider)
 	case auth.SeamlessProvider:
 		s.handleGetAuthProviderSeamlessAuth(c, portal, content.returnURL, provider)
+	case auth.SAMLProvider:
+		s.handleGetAuthProviderSAML(c, portal, stateCookieID, content.nonce, provider)
+	case auth.FormProvider:
+		s.renderLoginFormTemplate(c, http.StatusOK, portal, provider, stateCookieID+"~"+content.nonce, "", "")
+	case auth.WebAuthnProvider:
+		s.handleGetAuthProviderWebAuthn(c, http.StatusOK, portal, stateCookieID, content.nonce, provider, "")
+	default:
+		AbortWithError(c, NewResponseError(http.StatusConflict, "Auth provider does not support signing in"))
 	}
 }
 
@@ -350,8 +476,21 @@ func (s *Server) RouteGetOAuth2Callback(c *gin.Context) {
 		return
 	}
 
+	// Include the refresh token in the session if session refresh is enabled
+	claims, err := newSessionClaimsForAccessToken(portal, profile, at)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// If the portal requires TOTP, users must enter a code before the session is created
+	if portal.RequireTOTP {
+		s.redirectToTOTP(c, portal, profile, claims, content.returnURL)
+		return
+	}
+
 	// Set the profile in the cookie
-	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, portal.SessionLifetime, content.returnURL)
+	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, claims, portal.SessionLifetime, content.returnURL)
 	if err != nil {
 		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
 		return
@@ -365,6 +504,215 @@ func (s *Server) RouteGetOAuth2Callback(c *gin.Context) {
 	_, _ = c.Writer.WriteString(`Redirecting to application: ` + content.returnURL)
 }
 
+// RoutePostAuthProviderLogin is the handler for POST /portals/:portal/providers/:provider/login
+// This authenticates users with the username and password submitted in the login form of a form provider
+func (s *Server) RoutePostAuthProviderLogin(c *gin.Context) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	provider, ok := providerI.(auth.FormProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusNotFound, "Auth provider does not support login forms"))
+		return
+	}
+
+	// Validate the state parameter
+	// This also protects against CSRF, as the nonce in the form must match the one in the state cookie
+	stateParam := c.PostForm("state")
+	if stateParam == "" {
+		AbortWithError(c, NewResponseError(http.StatusBadRequest, "The parameter 'state' is required in the request body"))
+		return
+	}
+	content, stateCookieID, err := s.checkStateParam(c, portal, stateParam)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// Block the attempt if there were too many failures for the user or from the client
+	username := strings.TrimSpace(c.PostForm("username"))
+	var clientIP string
+	if rs := getRequestState(c); rs != nil {
+		clientIP = rs.clientIP
+	}
+	providerName := provider.GetProviderName()
+	if !s.loginRateLimiter.Allowed(portal.Name, providerName, username, clientIP) {
+		setLogMessage(c, "Form authentication blocked: too many failed attempts")
+		c.Header(headerRetryAfter, strconv.Itoa(int(loginFailuresWindow.Seconds())))
+		s.renderLoginFormTemplate(c, http.StatusTooManyRequests, portal, provider, stateCookieID+"~"+content.nonce, username, "Too many failed attempts. Please try again later.")
+		return
+	}
+
+	// Authenticate the user
+	profile, err := provider.FormAuth(c.Request.Context(), username, c.PostForm("password"))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// Show the form again, so users can retry
+		s.loginRateLimiter.RecordFailure(portal.Name, providerName, username, clientIP)
+		setLogMessage(c, "Form authentication failed: "+err.Error())
+		s.renderLoginFormTemplate(c, http.StatusUnauthorized, portal, provider, stateCookieID+"~"+content.nonce, username, "Invalid username or password")
+		return
+	} else if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to authenticate user: %w", err))
+		return
+	}
+	s.loginRateLimiter.RecordSuccess(portal.Name, providerName, username, clientIP)
+
+	// Clear the state cookie for the portal
+	s.deleteStateCookies(c, portal.Name)
+
+	// If the portal requires TOTP, users must enter a code before the session is created
+	if portal.RequireTOTP {
+		s.redirectToTOTP(c, portal, profile, sessionClaims{}, content.returnURL)
+		return
+	}
+
+	// Set the profile in the cookie
+	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, sessionClaims{}, portal.SessionLifetime, content.returnURL)
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
+		return
+	}
+
+	// Use a custom redirect code to write a response in the body
+	// We use a 303 redirect here so the client follows it with a GET request rather than re-sending the POST
+	c.Header(headerLocation, content.returnURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to application: ` + content.returnURL)
+}
+
+// Handles GET /portals/:portal/providers/:provider when using a SAML provider
+// This redirects users to the SAML Identity Provider
+func (s *Server) handleGetAuthProviderSAML(c *gin.Context, portal *Portal, stateCookieID string, nonce string, provider auth.SAMLProvider) {
+	// The RelayState has the same format as the state parameter for OAuth2
+	relayState := provider.GetProviderName() + "~" + stateCookieID + "~" + nonce
+	authURL, err := provider.SAMLAuthnRequestURL(relayState, getSAMLACSURL(c, portal.Name))
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to get SAML request URL: %w", err))
+		return
+	}
+
+	// Use a custom redirect code to write a response in the body
+	c.Header(headerLocation, authURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to authentication server: ` + authURL)
+}
+
+// RoutePostSAMLACS is the handler for POST /portals/:portal/saml/acs
+// This is the Assertion Consumer Service, which receives the responses from SAML Identity Providers using the HTTP-POST binding
+func (s *Server) RoutePostSAMLACS(c *gin.Context) {
+	portal, err := s.getPortal(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// Ensure that we have the response and the relay state
+	samlResponse := c.PostForm("SAMLResponse")
+	relayState := c.PostForm("RelayState")
+	if samlResponse == "" || relayState == "" {
+		AbortWithError(c, NewResponseError(http.StatusBadRequest, "The parameters 'SAMLResponse' and 'RelayState' are required in the request body"))
+		return
+	}
+	// Format is: "Provider~StateCookieID~Nonce"
+	parts := strings.SplitN(relayState, "~", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		AbortWithError(c, NewResponseError(http.StatusUnauthorized, "Parameter 'RelayState' is invalid"))
+		return
+	}
+
+	// Get the state cookie
+	content, err := s.getStateCookie(c, portal, parts[1])
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("invalid state cookie: %w", err))
+		return
+	} else if content.nonce == "" {
+		// The state cookie uses SameSite=Lax, so browsers do not include it in the cross-site POST request from the Identity Provider
+		// In this case, we respond with a page that re-submits the form from our own origin, so the cookie is included
+		if c.PostForm(samlResubmitField) == "" {
+			s.renderSAMLPostTemplate(c, portal, samlResponse, relayState)
+			return
+		}
+		AbortWithError(c, NewResponseError(http.StatusUnauthorized, "State cookie not found"))
+		return
+	}
+
+	// Get the provider
+	providerI, ok := portal.Providers[parts[0]]
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusConflict, "Auth provider not found"))
+		return
+	}
+	provider, ok := providerI.(auth.SAMLProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusConflict, "Auth provider does not implement SAML"))
+		return
+	}
+
+	// Clear the state cookie for the portal
+	s.deleteStateCookies(c, portal.Name)
+
+	// Check if the nonce matches
+	if content.nonce != parts[2] {
+		AbortWithError(c, NewResponseError(http.StatusUnauthorized, "Parameters in state cookie do not match relay state"))
+		return
+	}
+
+	// Validate the response and get the user profile
+	profile, err := provider.SAMLValidateResponse(samlResponse, relayState, getSAMLACSURL(c, portal.Name))
+	if err != nil {
+		setLogMessage(c, "Invalid SAML response: "+err.Error())
+		AbortWithError(c, NewResponseError(http.StatusUnauthorized, "Invalid SAML response"))
+		return
+	}
+
+	// If the portal requires TOTP, users must enter a code before the session is created
+	if portal.RequireTOTP {
+		s.redirectToTOTP(c, portal, profile, sessionClaims{}, content.returnURL)
+		return
+	}
+
+	// Set the profile in the cookie
+	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, sessionClaims{}, portal.SessionLifetime, content.returnURL)
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
+		return
+	}
+
+	// Use a custom redirect code to write a response in the body
+	// We use a 303 redirect here so the client follows it with a GET request rather than re-sending the POST
+	c.Header(headerLocation, content.returnURL)
+	c.Header(headerContentType, contentTypeTextPlain)
+	c.Writer.WriteHeader(http.StatusSeeOther)
+	_, _ = c.Writer.WriteString(`Redirecting to application: ` + content.returnURL)
+}
+
+// RouteGetSAMLMetadata is the handler for GET /portals/:portal/saml/metadata/:provider
+// This returns the metadata document of the Service Provider, which can be used to configure the Identity Provider
+func (s *Server) RouteGetSAMLMetadata(c *gin.Context) {
+	portal, providerI, err := s.getProvider(c)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	provider, ok := providerI.(auth.SAMLProvider)
+	if !ok {
+		AbortWithError(c, NewResponseError(http.StatusNotFound, "Auth provider does not implement SAML"))
+		return
+	}
+
+	metadata, err := provider.SAMLMetadata(getSAMLACSURL(c, portal.Name))
+	if err != nil {
+		AbortWithError(c, fmt.Errorf("failed to get SAML metadata: %w", err))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
 // Handles GET /portals/:portal/providers/:provider when using a seamless auth provider
 // This performs seamless auth
 func (s *Server) handleGetAuthProviderSeamlessAuth(c *gin.Context, portal *Portal, returnURL string, provider auth.SeamlessProvider) {
@@ -381,8 +729,14 @@ func (s *Server) handleGetAuthProviderSeamlessAuth(c *gin.Context, portal *Porta
 	// Clear the state cookie for the portal
 	s.deleteStateCookies(c, portal.Name)
 
+	// If the portal requires TOTP, users must enter a code before the session is created
+	if portal.RequireTOTP {
+		s.redirectToTOTP(c, portal, profile, sessionClaims{}, returnURL)
+		return
+	}
+
 	// Set the profile in the cookie
-	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, portal.SessionLifetime, returnURL)
+	err = s.setSessionCookieForReturnURL(c, portal.Name, profile, sessionClaims{}, portal.SessionLifetime, returnURL)
 	if err != nil {
 		AbortWithError(c, fmt.Errorf("failed to set session cookie: %w", err))
 		return
@@ -405,10 +759,27 @@ func (s *Server) RoutePostLogout(c *gin.Context) {
 		return
 	}
 
+	// If enabled, get the URL to sign the user out of the identity provider too
+	// This must be done before the session is revoked, as it needs the ID token stored in the session
+	providerLogoutURL := s.getProviderLogoutURL(c, portal)
+
+	// Remove the session from the session store, so the session token can't be used anymore
+	s.revokeSessionCookie(c, portal.Name)
+
 	// Delete the state and session cookies
 	s.deleteSessionCookie(c, portal.Name)
 	s.deleteStateCookies(c, portal.Name)
 
+	// If we have a logout URL for the identity provider, redirect the user there
+	// After signing the user out, the identity provider redirects them back to the portal
+	if providerLogoutURL != "" {
+		c.Header(headerLocation, providerLogoutURL)
+		c.Header(headerContentType, contentTypeTextPlain)
+		c.Writer.WriteHeader(http.StatusSeeOther)
+		_, _ = c.Writer.WriteString(`You've been logged out. Redirecting to identity provider: ` + providerLogoutURL)
+		return
+	}
+
 	// Respond with a success message
 	portalURL := getPortalURI(c, portal.Name) + "?logout=1"
 	c.Header(headerLocation, portalURL)
@@ -417,6 +788,97 @@ func (s *Server) RoutePostLogout(c *gin.Context) {
 	_, _ = c.Writer.WriteString(`You've been logged out. Redirecting to portal: ` + portalURL)
 }
 
+// RoutePostOAuth2BackchannelLogout is the handler for POST /portals/:portal/oauth2/backchannel-logout
+// It receives logout tokens sent by identity providers with OpenID Connect Back-Channel Logout, and revokes the matching sessions
+// This route is registered only when the session store is enabled
+func (s *Server) RoutePostOAuth2BackchannelLogout(c *gin.Context) {
+	portal, err := s.getPortal(c)
+	if err != nil {
+		AbortWithErrorJSON(c, err)
+		return
+	}
+
+	// Per OIDC Back-Channel Logout 1.0 section 2.8, responses must not be cached
+	c.Header("Cache-Control", "no-store")
+
+	logoutToken := c.PostForm("logout_token")
+	if logoutToken == "" {
+		AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "The parameter 'logout_token' is required"))
+		return
+	}
+
+	// Find the provider that issued the logout token
+	for _, providerName := range portal.ProvidersList {
+		provider, ok := portal.Providers[providerName].(auth.BackchannelLogoutProvider)
+		if !ok {
+			continue
+		}
+
+		claims, err := provider.ValidateLogoutToken(c.Request.Context(), logoutToken)
+		if errors.Is(err, auth.ErrLogoutTokenNotForProvider) {
+			continue
+		} else if err != nil {
+			s.requestLogger(c).WarnContext(c.Request.Context(), "Received an invalid logout token", slog.String("provider", providerName), slog.Any("error", err))
+			AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "Logout token is invalid"))
+			return
+		}
+
+		// Revoke all sessions of the user for the provider; if the logout token contains a session ID, only the sessions matching it are revoked
+		// Filter always has the portal and provider set, so it's never empty
+		filter := sessionstore.Filter{
+			Portal:            portal.Name,
+			Provider:          providerName,
+			ProviderSubject:   claims.Subject,
+			ProviderSessionID: claims.SessionID,
+		}
+		n, err := s.sessionStore.DeleteMatching(c.Request.Context(), filter)
+		if err != nil {
+			AbortWithErrorJSON(c, fmt.Errorf("failed to revoke sessions: %w", err))
+			return
+		}
+
+		s.requestLogger(c).InfoContext(c.Request.Context(), "Revoked sessions with back-channel logout",
+			slog.String("portal", portal.Name),
+			slog.String("provider", providerName),
+			slog.String("subject", claims.Subject),
+			slog.String("sid", claims.SessionID),
+			slog.Int("count", n),
+		)
+
+		c.Status(http.StatusOK)
+		return
+	}
+
+	AbortWithErrorJSON(c, NewResponseError(http.StatusBadRequest, "Logout token was not issued by any provider of the portal"))
+}
+
+// getProviderLogoutURL returns the URL to sign the user out of the identity provider that issued the current session
+// It returns an empty string if provider logout is not enabled for the portal, if there's no valid session, or if the provider doesn't support logout
+func (s *Server) getProviderLogoutURL(c *gin.Context, portal *Portal) string {
+	if !portal.ProviderLogout {
+		return ""
+	}
+
+	entry, _, err := s.loadSessionCookie(c, portal.Name)
+	if err != nil || entry.token == nil {
+		return ""
+	}
+
+	provider, ok := entry.provider.(auth.LogoutProvider)
+	if !ok {
+		return ""
+	}
+
+	claims := sessionClaimsFromToken(entry.token)
+	logoutURL, err := provider.LogoutURL(claims.idToken, getPortalURI(c, portal.Name))
+	if err != nil {
+		s.requestLogger(c).WarnContext(c.Request.Context(), "Failed to get logout URL for the identity provider", slog.Any("error", err))
+		return ""
+	}
+
+	return logoutURL
+}
+
 func (s *Server) getProfileFromContext(c *gin.Context) (*user.Profile, auth.Provider) {
 	rs := getRequestState(c)
 	if rs == nil || !rs.authenticated {
@@ -467,6 +929,12 @@ func getOAuth2RedirectURI(c *gin.Context, portal string) string {
 	return getPortalURI(c, portal) + "/oauth2/callback"
 }
 
+// Get the URL of the SAML Assertion Consumer Service, where Identity Providers send responses to
+// The URL is specific to each portal
+func getSAMLACSURL(c *gin.Context, portal string) string {
+	return getPortalURI(c, portal) + "/saml/acs"
+}
+
 // Get the URI for a portal
 // In "dedicated sub-domain" mode the matched domain has a configured `authHost` that differs from the request host (Traefik Forward Auth lives at e.g. auth.example.com while apps live at app.example.com)
 // In "sub-path" mode the auth host equals the request host
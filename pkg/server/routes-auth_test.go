@@ -3,19 +3,26 @@ package server
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/alphadose/haxmap"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
 )
 
 func TestServerAuthRoutes(t *testing.T) {
@@ -454,6 +461,24 @@ func doProxiedRequest(t *testing.T, client *http.Client, path string, p testProx
 	return res
 }
 
+// doProxiedFormPost issues a POST request with a URL-encoded form body, X-Forwarded-* headers, and the given Set-Cookie strings as request cookies
+// Returns the response (caller must close the body)
+func doProxiedFormPost(t *testing.T, client *http.Client, path string, form url.Values, p testProxyHeaders, setCookies []string) *http.Response {
+	t.Helper()
+	reqCtx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, fmt.Sprintf("http://localhost:%d%s", testServerPort, path), strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	p.apply(req)
+	for _, sc := range setCookies {
+		req.Header.Add("Cookie", cookiePair(sc))
+	}
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	return res
+}
+
 // TestDedicatedSubdomainRedirects verifies that when an `authHost` is configured for the matched cookie domain, redirects to Traefik Forward Auth itself (sign-in page, OAuth2 callback) target the auth host rather than the app host
 // This is the "dedicated sub-domain" mode where Traefik Forward Auth runs at e.g. auth.example.com while apps run at app.example.com
 func TestDedicatedSubdomainRedirects(t *testing.T) {
@@ -851,33 +876,249 @@ func TestOAuth2CallbackRoundTrip(t *testing.T) {
 	assert.Equal(t, "test-user-1", res5.Header.Get("X-Forwarded-User"))
 }
 
+func TestRouteGetAuthRootPolicies(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Policies = map[string]string{
+			"users":       `Group("test-users")`,
+			"first-user":  `Policy("users") && ClaimEqual("id", "test-user-1")`,
+			"second-user": `Policy("users") && ClaimEqual("id", "test-user-2")`,
+		}
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testrequest")},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	doRequest := func(t *testing.T, uri string, query string, headers map[string]string) *http.Response {
+		t.Helper()
+		reqCtx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf("http://localhost:%d/portals/test1?%s", testServerPort, query), nil)
+		require.NoError(t, err)
+		testProxyHeaders{host: "example.com", uri: uri}.apply(req)
+		req.Header.Set("X-Request-User", "test-user-1")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	tests := []struct {
+		name       string
+		uri        string
+		query      string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "policy in query string", query: "policy=first-user", wantStatus: http.StatusOK},
+		{name: "policy in header", headers: map[string]string{"X-Forward-Auth-Policy": "first-user"}, wantStatus: http.StatusOK},
+		{name: "policy not satisfied", query: "policy=second-user", wantStatus: http.StatusForbidden},
+		{name: "undefined policy", query: "policy=nope", wantStatus: http.StatusBadRequest},
+		{name: "policy in both query string and header", query: "policy=first-user", headers: map[string]string{"X-Forward-Auth-Policy": "first-user"}, wantStatus: http.StatusBadRequest},
+		{name: "condition referencing a policy", query: "if=" + url.QueryEscape(`Policy("users")`), wantStatus: http.StatusOK},
+		{name: "condition referencing an undefined policy", query: "if=" + url.QueryEscape(`Policy("nope")`), wantStatus: http.StatusBadRequest},
+		{name: "policy and condition both satisfied", query: "policy=users&if=" + url.QueryEscape(`ClaimEqual("id", "test-user-1")`), wantStatus: http.StatusOK},
+		{name: "policy satisfied but not condition", query: "policy=users&if=" + url.QueryEscape(`ClaimEqual("id", "test-user-2")`), wantStatus: http.StatusForbidden},
+		{name: "condition on the client IP", query: "if=" + url.QueryEscape(`Policy("users") && ClientIPIn("1.1.1.0/24")`), wantStatus: http.StatusOK},
+		{name: "condition on the client IP not satisfied", query: "if=" + url.QueryEscape(`ClientIPIn("10.0.0.0/8")`), wantStatus: http.StatusForbidden},
+		{name: "condition on the forwarded request", query: "if=" + url.QueryEscape(`PathPrefix("/api") && Host("*.com") && HeaderEqual("X-Tenant", "acme")`), headers: map[string]string{"X-Tenant": "acme"}, wantStatus: http.StatusOK},
+		{name: "condition on the forwarded request not satisfied", query: "if=" + url.QueryEscape(`PathPrefix("/admin")`), wantStatus: http.StatusForbidden},
+		{name: "condition on the session age without a session", query: "if=" + url.QueryEscape(`SessionAge("<", "1h")`), wantStatus: http.StatusForbidden},
+		{name: "condition with an encoded slash in the URI", uri: "/api/v4/projects/group%2Fproject", query: "if=" + url.QueryEscape(`Group("test-users")`), wantStatus: http.StatusOK},
+		{name: "policy with an encoded slash in the URI", uri: "/api/v4/projects/group%2Fproject", query: "policy=first-user", wantStatus: http.StatusOK},
+		{name: "path condition with an encoded slash in the URI", uri: "/api/v4/projects/group%2Fproject", query: "if=" + url.QueryEscape(`PathPrefix("/api")`), wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := tt.uri
+			if uri == "" {
+				uri = "/api/items"
+			}
+			res := doRequest(t, uri, tt.query, tt.headers)
+			defer closeBody(res)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+		})
+	}
+}
+
+func TestRouteGetAuthRootRules(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testrequest")},
+		}
+		c.Portals[0].Rules = []config.ConfigPortalRule{
+			{PathPrefix: "/public", Action: config.RuleActionPublic},
+			{PathPrefix: "/admin", Condition: `ClaimEqual("id", "test-user-1")`},
+			{Host: "*.internal.example.com", Action: config.RuleActionDeny},
+			{PathRegex: "^/api/", Methods: []string{"delete"}, Action: config.RuleActionDeny, Condition: `ClaimEqual("id", "test-user-2")`},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	doRequest := func(t *testing.T, host string, uri string, method string, userID string) *http.Response {
+		t.Helper()
+		reqCtx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf("http://localhost:%d/portals/test1", testServerPort), nil)
+		require.NoError(t, err)
+		testProxyHeaders{host: host, uri: uri}.apply(req)
+		if method != "" {
+			req.Header.Set("X-Forwarded-Method", method)
+		}
+		if userID != "" {
+			req.Header.Set("X-Request-User", userID)
+		}
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		uri        string
+		method     string
+		userID     string
+		wantStatus int
+	}{
+		{name: "public path without authentication", uri: "/public/index.html", wantStatus: http.StatusOK},
+		{name: "public path with invalid credentials", uri: "/public", userID: "bad-user", wantStatus: http.StatusOK},
+		{name: "prefix matches whole segments", uri: "/publicity", wantStatus: http.StatusUnauthorized},
+		{name: "path traversal out of the public path", uri: "/public/../admin", userID: "test-user-2", wantStatus: http.StatusForbidden},
+		{name: "encoded path traversal out of the public path", uri: "/public/%2e%2e/admin", wantStatus: http.StatusUnauthorized},
+		{name: "encoded path traversal into the public path", uri: "/admin%2F..%2Fpublic", userID: "test-user-1", wantStatus: http.StatusForbidden},
+		{name: "encoded backslash traversal into the public path", uri: "/admin%5C..%5Cpublic", userID: "test-user-1", wantStatus: http.StatusForbidden},
+		{name: "double slash before the admin path", uri: "//admin", userID: "test-user-2", wantStatus: http.StatusForbidden},
+		{name: "admin path allowed", uri: "/admin/users?page=2", userID: "test-user-1", wantStatus: http.StatusOK},
+		{name: "admin path denied", uri: "/admin", userID: "test-user-2", wantStatus: http.StatusForbidden},
+		{name: "admin path requires authentication", uri: "/admin", wantStatus: http.StatusUnauthorized},
+		{name: "host denied", host: "app.internal.example.com:8443", uri: "/", userID: "test-user-1", wantStatus: http.StatusForbidden},
+		{name: "method denied for user", uri: "/api/items/1", method: "DELETE", userID: "test-user-2", wantStatus: http.StatusForbidden},
+		{name: "method allowed for other user", uri: "/api/items/1", method: "DELETE", userID: "test-user-1", wantStatus: http.StatusOK},
+		{name: "other method not matching", uri: "/api/items/1", method: "GET", userID: "test-user-2", wantStatus: http.StatusOK},
+		{name: "no rule matching", uri: "/", userID: "test-user-2", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := tt.host
+			if host == "" {
+				host = "example.com"
+			}
+			res := doRequest(t, host, tt.uri, tt.method, tt.userID)
+			defer closeBody(res)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+		})
+	}
+}
+
+func TestRouteGetAuthRootSessionAge(t *testing.T) {
+	const portalName = "test1"
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	cookieName := config.Get().Cookies.CookieName(portalName)
+	profile := createFullTestProfile()
+
+	newToken := func(t *testing.T, issuedAt time.Time) string {
+		t.Helper()
+		token, err := srv.newSessionToken(t.Context(), portalName, profile, sessionClaims{issuedAt: issuedAt}, time.Hour, "example.com")
+		require.NoError(t, err)
+		return token
+	}
+
+	doRequest := func(t *testing.T, token string, cond string) *http.Response {
+		t.Helper()
+		reqCtx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet,
+			fmt.Sprintf("http://localhost:%d/portals/%s?if=%s", testServerPort, portalName, url.QueryEscape(cond)), nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: token}) //nolint:gosec
+		populateRequiredProxyHeaders(t, req)
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		closeBody(res)
+		return res
+	}
+
+	recent := newToken(t, time.Time{})
+	old := newToken(t, time.Now().Add(-2*time.Hour))
+
+	tests := []struct {
+		name       string
+		token      string
+		cond       string
+		wantStatus int
+	}{
+		{name: "recent session", token: recent, cond: `SessionAge("<", "1h")`, wantStatus: http.StatusOK},
+		{name: "old session", token: old, cond: `SessionAge("<", "1h")`, wantStatus: http.StatusForbidden},
+		{name: "old session with greater than", token: old, cond: `SessionAge(">=", "90m")`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := doRequest(t, tt.token, tt.cond)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+		})
+	}
+}
+
 func TestCheckAuthzConditions(t *testing.T) {
 	// Create a test server with predicates cache
 	s := &Server{
 		predicates: haxmap.New[string, cachedPredicate](),
 	}
 
-	profile := &user.Profile{
-		ID: "123",
-		Email: &user.ProfileEmail{
-			Value:    "test@example.com",
-			Verified: true,
+	ec := &conditions.EvalContext{
+		Profile: &user.Profile{
+			ID: "123",
+			Email: &user.ProfileEmail{
+				Value:    "test@example.com",
+				Verified: true,
+			},
 		},
 	}
 
 	t.Run("Valid condition returns true", func(t *testing.T) {
-		ok, err := s.checkAuthzConditions(`ClaimEqual("email", "test@example.com")`, profile)
+		ok, err := s.checkAuthzConditions(`ClaimEqual("email", "test@example.com")`, ec)
 		require.NoError(t, err)
 		assert.True(t, ok)
 	})
 
 	t.Run("Invalid condition syntax returns error", func(t *testing.T) {
-		_, err := s.checkAuthzConditions(`"email" == "test@example.com"`, profile)
+		_, err := s.checkAuthzConditions(`"email" == "test@example.com"`, ec)
 		require.Error(t, err)
 	})
 
+	t.Run("Condition that is not a boolean returns error", func(t *testing.T) {
+		ok, err := s.checkAuthzConditions(`false`, ec)
+		require.ErrorContains(t, err, "condition does not return a boolean")
+		assert.False(t, ok)
+
+		// A nil predicate in the cache is never evaluated
+		s.predicates.Set("nil-predicate", cachedPredicate{lastUsed: &atomic.Int64{}})
+		ok, err = s.checkAuthzConditions("nil-predicate", ec)
+		require.ErrorContains(t, err, "condition does not return a boolean")
+		assert.False(t, ok)
+	})
+
 	t.Run("False condition returns false", func(t *testing.T) {
-		ok, err := s.checkAuthzConditions(`ClaimEqual("email", "other@example.com")`, profile)
+		ok, err := s.checkAuthzConditions(`ClaimEqual("email", "other@example.com")`, ec)
 		require.NoError(t, err)
 		assert.False(t, ok)
 	})
@@ -886,7 +1127,7 @@ func TestCheckAuthzConditions(t *testing.T) {
 		const cond = `ClaimEqual("email", "test@example.com")`
 
 		// First call should cache the predicate
-		ok1, err1 := s.checkAuthzConditions(cond, profile)
+		ok1, err1 := s.checkAuthzConditions(cond, ec)
 		require.NoError(t, err1)
 		assert.True(t, ok1)
 
@@ -898,7 +1139,7 @@ func TestCheckAuthzConditions(t *testing.T) {
 
 		// Second call should retrieve from cache
 		time.Sleep(1100 * time.Millisecond) // Sleep for more than 1 second to ensure unix timestamps differ
-		ok2, err2 := s.checkAuthzConditions(cond, profile)
+		ok2, err2 := s.checkAuthzConditions(cond, ec)
 		require.NoError(t, err2)
 		assert.True(t, ok2)
 
@@ -917,12 +1158,12 @@ func TestCheckAuthzConditions(t *testing.T) {
 		const cond2 = `ClaimEqual("email", "other@example.com")`
 
 		// Call with first condition
-		ok1, err1 := s.checkAuthzConditions(cond1, profile)
+		ok1, err1 := s.checkAuthzConditions(cond1, ec)
 		require.NoError(t, err1)
 		assert.True(t, ok1)
 
 		// Call with second condition
-		ok2, err2 := s.checkAuthzConditions(cond2, profile)
+		ok2, err2 := s.checkAuthzConditions(cond2, ec)
 		require.NoError(t, err2)
 		assert.False(t, ok2)
 
@@ -942,3 +1183,110 @@ func TestCheckAuthzConditions(t *testing.T) {
 		assert.Positive(t, cached2.lastUsed.Load())
 	})
 }
+
+// TestRouteGetAuthRootRequestAuth verifies that providers implementing auth.RequestAuthProvider authenticate requests to the root endpoint without a session
+func TestRouteGetAuthRootRequestAuth(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].Providers = []config.ConfigPortalProvider{
+			{TestProvider: new("testoauth2")},
+			{TestProvider: new("testrequest")},
+		}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	doRequest := func(t *testing.T, requestUser string) *http.Response {
+		t.Helper()
+		reqCtx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf("http://localhost:%d/portals/test1", testServerPort), nil)
+		require.NoError(t, err)
+		testProxyHeaders{host: "example.com", uri: "/api/items"}.apply(req)
+		if requestUser != "" {
+			req.Header.Set("X-Request-User", requestUser)
+		}
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		res := doRequest(t, "test-user-1")
+		defer closeBody(res)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "test-user-1", res.Header.Get("X-Forwarded-User"))
+		assert.Empty(t, res.Header.Values("Set-Cookie"), "no session cookie is issued")
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		res := doRequest(t, "bad-user")
+		defer closeBody(res)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("no credentials redirects to sign-in", func(t *testing.T) {
+		res := doRequest(t, "")
+		defer closeBody(res)
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Location"), "/portals/test1/signin")
+	})
+
+	t.Run("provider is not shown in the sign-in page", func(t *testing.T) {
+		portal, ok := srv.portals[testPortalName]
+		require.True(t, ok)
+		assert.Equal(t, []string{"testoauth2", "testrequestauth"}, portal.ProvidersList)
+		assert.Equal(t, []string{"testoauth2"}, portal.SigninProvidersList)
+	})
+
+	t.Run("no credentials without sign-in providers", func(t *testing.T) {
+		t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+			c.Portals[0].Providers = []config.ConfigPortalProvider{
+				{TestProvider: new("testrequest")},
+			}
+		}))
+		requestOnlySrv, _ := newTestServer(t)
+		require.NotNil(t, requestOnlySrv)
+		portal, ok := requestOnlySrv.portals[testPortalName]
+		require.True(t, ok)
+		assert.Empty(t, portal.SigninProvidersList)
+
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/portals/test1", nil)
+		c.Params = gin.Params{{Key: "portal", Value: testPortalName}}
+		requestOnlySrv.RouteGetAuthRoot(c)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("not allowed when the portal requires TOTP", func(t *testing.T) {
+		t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+			c.TOTP.StorePath = filepath.Join(t.TempDir(), "totp.db")
+			c.Portals[0].RequireTOTP = true
+			c.Portals[0].Providers = []config.ConfigPortalProvider{
+				{TestProvider: new("testoauth2")},
+				{TestProvider: new("testrequest")},
+			}
+		}))
+
+		cfg := config.Get()
+		require.NoError(t, cfg.Process(slog.New(slog.DiscardHandler)))
+		portals, err := GetPortalsConfig(t.Context(), cfg)
+		require.NoError(t, err)
+		totpStore, err := totp.NewStore(cfg.TOTP.StorePath)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = totpStore.Close()
+		})
+
+		_, err = NewServer(NewServerOpts{
+			Portals:   portals,
+			TOTPStore: totpStore,
+			log:       slog.New(slog.DiscardHandler),
+		})
+		require.ErrorContains(t, err, "portal 'test1' requires TOTP, but provider 'testrequestauth' only authenticates requests without a session")
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"reflect"
 	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
@@ -84,6 +85,10 @@ func (s *Server) RouteGetProfile(c *gin.Context) {
 		fmt.Fprint(c.Writer, "Role: "+profile.Roles[0]+"\n")
 	}
 
+	if len(profile.AMR) > 0 {
+		fmt.Fprint(c.Writer, "Authentication methods: "+strings.Join(profile.AMR, ", ")+"\n")
+	}
+
 	if len(profile.AdditionalClaims) > 0 {
 		fmt.Fprint(c.Writer, "Additional claims:\n")
 		printAdditionalClaimsText(c.Writer, profile.AdditionalClaims)
@@ -162,6 +167,7 @@ func (s *Server) RouteGetProfileJSON(c *gin.Context) {
 		Timezone         string             `json:"timezone,omitempty"`
 		Groups           []string           `json:"groups,omitempty"`
 		Roles            []string           `json:"roles,omitempty"`
+		AMR              []string           `json:"amr,omitempty"`
 		AdditionalClaims map[string]any     `json:"additionalClaims,omitempty"`
 	}
 	res := responseData{
@@ -192,6 +198,9 @@ func (s *Server) RouteGetProfileJSON(c *gin.Context) {
 	if len(profile.Roles) > 0 {
 		res.Roles = profile.Roles
 	}
+	if len(profile.AMR) > 0 {
+		res.AMR = profile.AMR
+	}
 	if len(profile.AdditionalClaims) > 0 {
 		res.AdditionalClaims = profile.AdditionalClaims
 	}
@@ -24,6 +24,9 @@ func GetPortalsConfig(ctx context.Context, conf *config.Config) (map[string]*Por
 			SessionLifetime:       p.SessionLifetime,
 			AuthenticationTimeout: p.AuthenticationTimeout,
 			AlwaysShowSigninPage:  p.AlwaysShowProvidersPage,
+			SessionRefresh:        p.SessionRefresh,
+			ProviderLogout:        p.ProviderLogout,
+			RequireTOTP:           p.RequireTOTP,
 		}
 
 		if portal.SessionLifetime <= 0 {
@@ -31,6 +34,14 @@ func GetPortalsConfig(ctx context.Context, conf *config.Config) (map[string]*Por
 			portal.SessionLifetime = conf.Tokens.SessionLifetime
 		}
 
+		// The idle timeout has no effect if it's not shorter than the session lifetime
+		if p.IdleTimeout > 0 && p.IdleTimeout < portal.SessionLifetime {
+			portal.IdleTimeout = p.IdleTimeout
+		}
+
+		// The refresh window is capped at half of the session lifetime, so sessions aren't renewed right after being created
+		portal.SessionRefreshWindow = min(p.SessionRefreshWindow, portal.SessionLifetime/2)
+
 		err = setPagesPortalConfig(p, portal)
 		if err != nil {
 			return nil, fmt.Errorf("configuration for portal '%s' is invalid: %w", p.Name, err)
@@ -40,12 +51,28 @@ func GetPortalsConfig(ctx context.Context, conf *config.Config) (map[string]*Por
 			name := p.GetProviderName()
 			portal.Providers[name] = p
 			portal.ProvidersList[i] = name
+
+			// Providers that only authenticate each request, such as bearer tokens, are not shown in the sign-in page
+			if isSigninProvider(p) {
+				portal.SigninProvidersList = append(portal.SigninProvidersList, name)
+			}
 		}
 
 		portal.Headers = getHeadersConfig(p)
+		portal.Rules = getRulesConfig(p)
 
 		portals[p.Name] = portal
 	}
 
 	return portals, nil
 }
+
+// isSigninProvider returns true if users can sign in with the provider from the sign-in page
+func isSigninProvider(p auth.Provider) bool {
+	switch p.(type) {
+	case auth.OAuth2Provider, auth.SeamlessProvider, auth.SAMLProvider, auth.FormProvider, auth.WebAuthnProvider:
+		return true
+	default:
+		return false
+	}
+}
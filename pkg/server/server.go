@@ -24,10 +24,13 @@ import (
 	"github.com/italypaleale/go-kit/ttlcache"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
 	"github.com/italypaleale/traefik-forward-auth/pkg/metrics"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
 )
 
@@ -39,15 +42,21 @@ const (
 	headerXForwardedPort        = "X-Forwarded-Port"
 	headerXForwardedProto       = "X-Forwarded-Proto"
 	headerXForwardedHost        = "X-Forwarded-Host"
+	headerXForwardedMethod      = "X-Forwarded-Method"
 	headerXForwardedServer      = "X-Forwarded-Server"
 	headerXForwardedURI         = "X-Forwarded-Uri"
 	headerXForwardedUser        = "X-Forwarded-User"
 	headerXAuthenticatedUser    = "X-Authenticated-User"
 	headerXForwardAuthIf        = "X-Forward-Auth-If"
+	headerXForwardAuthPolicy    = "X-Forward-Auth-Policy"
 	headerXRequestID            = "X-Request-Id"
+	headerRetryAfter            = "Retry-After"
 
 	contentTypeTextPlain = "text/plain; charset=utf-8"
 
+	// Name of the form field added when re-submitting a SAML response from our own origin
+	samlResubmitField = "tfa_resubmit"
+
 	maxHeaderBytes = 1 << 20 // 1MB
 )
 
@@ -60,6 +69,23 @@ type Server struct {
 	predicates *haxmap.Map[string, cachedPredicate]
 	tokenCache *ttlcache.Cache[uint64, tokenCacheEntry]
 
+	// Store that keeps track of sessions on the server
+	// This is nil if sessions are not tracked
+	sessionStore sessionstore.Store
+
+	// Store for the TOTP secrets of users
+	// This is nil if no portal requires TOTP
+	totpStore *totp.Store
+
+	// Keeps track of failed attempts to sign in with login forms
+	loginRateLimiter *loginRateLimiter
+
+	// Sign-ins that are waiting for users to enter a TOTP code, by ID
+	pendingTOTP *ttlcache.Cache[string, *pendingTOTPSignIn]
+
+	// Ensures each session is renewed only once, even when multiple requests are received concurrently
+	sessionRefreshes singleflight.Group
+
 	// Precomputed session cookie name for each portal
 	sessionCookieNames map[string]string
 
@@ -83,6 +109,8 @@ type Server struct {
 
 	// Hashed style.css name from the client build manifest
 	styleAsset string
+	// Hashed webauthn.js name from the client build manifest
+	webAuthnAsset string
 
 	// Server start time, used for Last-Modified headers
 	startTime time.Time
@@ -102,6 +130,14 @@ type NewServerOpts struct {
 	TraceProvider *sdkTrace.TracerProvider
 	Portals       map[string]*Portal
 
+	// Store that keeps track of sessions, so they can be revoked
+	// This is optional: if nil, sessions are not tracked on the server
+	SessionStore sessionstore.Store
+
+	// Store for the TOTP secrets of users
+	// This is required if any portal requires TOTP
+	TOTPStore *totp.Store
+
 	// Optional function to add test routes
 	// This is used in testing
 	addTestRoutes func(s *Server)
@@ -123,11 +159,17 @@ func NewServer(opts NewServerOpts) (*Server, error) {
 		metrics:       opts.Metrics,
 		traceProvider: opts.TraceProvider,
 		portals:       opts.Portals,
+		sessionStore:  opts.SessionStore,
+		totpStore:     opts.TOTPStore,
 		startTime:     time.Now().UTC(),
 		predicates:    haxmap.New[string, cachedPredicate](),
 		tokenCache: ttlcache.NewCache[uint64, tokenCacheEntry](&ttlcache.CacheOptions{
 			CleanupInterval: 2 * time.Minute,
 		}),
+		loginRateLimiter: newLoginRateLimiter(),
+		pendingTOTP: ttlcache.NewCache[string, *pendingTOTPSignIn](&ttlcache.CacheOptions{
+			CleanupInterval: time.Minute,
+		}),
 
 		addTestRoutes: opts.addTestRoutes,
 	}
@@ -139,6 +181,24 @@ func NewServer(opts NewServerOpts) (*Server, error) {
 		s.sessionCookieNames[name] = cookiesCfg.CookieName(name)
 	}
 
+	// Portals that require TOTP need the store for the secrets
+	// They also can't use providers that only authenticate each request on its own (such as bearer tokens), because those requests never go through the TOTP challenge
+	// Request auth providers that users can also sign in with, such as client certificates, are allowed: they're used only to sign in (followed by TOTP) in these portals
+	for _, p := range opts.Portals {
+		if !p.RequireTOTP {
+			continue
+		}
+		if s.totpStore == nil {
+			return nil, fmt.Errorf("portal '%s' requires TOTP, but the TOTP store is not configured", p.Name)
+		}
+		for _, name := range p.ProvidersList {
+			provider := p.Providers[name]
+			if _, ok := provider.(auth.RequestAuthProvider); ok && !isSigninProvider(provider) {
+				return nil, fmt.Errorf("portal '%s' requires TOTP, but provider '%s' only authenticates requests without a session and can't be used with TOTP", p.Name, name)
+			}
+		}
+	}
+
 	// Init the object
 	err := s.init(log)
 	if err != nil {
@@ -209,15 +269,27 @@ func (s *Server) initAppServer(log *slog.Logger) (err error) {
 	registerPortalRoutes := func(r *gin.RouterGroup) {
 		if r.BasePath() != "/" {
 			// For the root route, we add it with and without trailing slash to avoid Gin setting up a 301 (Permanent) redirect, which causes issues with forward auth
-			r.GET("", s.MiddlewareRequireClientCertificate, s.MiddlewareLoadAuthCookie, s.RouteGetAuthRoot)
+			r.GET("", s.MiddlewareRequireClientCertificate, s.MiddlewarePortalRules, s.MiddlewareLoadAuthCookie, s.RouteGetAuthRoot)
 		}
-		r.GET("/", s.MiddlewareRequireClientCertificate, s.MiddlewareLoadAuthCookie, s.RouteGetAuthRoot)
+		r.GET("/", s.MiddlewareRequireClientCertificate, s.MiddlewarePortalRules, s.MiddlewareLoadAuthCookie, s.RouteGetAuthRoot)
 		r.GET("/providers/:provider", s.MiddlewareLoadAuthCookie, s.RouteGetAuthProvider)
+		r.POST("/providers/:provider/login", s.RoutePostAuthProviderLogin)
+		r.POST("/providers/:provider/assertion", s.RoutePostWebAuthnAssertion)
+		r.GET("/providers/:provider/register", s.MiddlewareLoadAuthCookie, s.RouteGetWebAuthnRegister)
+		r.POST("/providers/:provider/register", s.RoutePostWebAuthnRegister)
 		r.GET("/oauth2/callback", codeFilterLogMw, s.RouteGetOAuth2Callback)
+		r.POST("/saml/acs", s.RoutePostSAMLACS)
+		r.GET("/saml/metadata/:provider", s.RouteGetSAMLMetadata)
 		r.GET("/signin", s.RouteGetAuthSignin)
 		r.GET("/profile", s.MiddlewareLoadAuthCookie, s.RouteGetProfile)
 		r.GET("/profile.json", s.MiddlewareLoadAuthCookie, s.RouteGetProfileJSON)
+		r.GET("/totp", s.RouteGetTOTP)
+		r.POST("/totp", s.RoutePostTOTP)
 		r.POST("/logout", s.RoutePostLogout)
+		if s.sessionStore != nil {
+			// Back-channel logout can only revoke sessions when the session store is enabled
+			r.POST("/oauth2/backchannel-logout", s.RoutePostOAuth2BackchannelLogout)
+		}
 	}
 	registerPortalRoutes(
 		s.appRouter.Group(path.Join(conf.Server.BasePath, "portals/:portal"), s.MiddlewareProxyHeaders),
@@ -240,6 +312,38 @@ func (s *Server) initAppServer(log *slog.Logger) (err error) {
 		registerAPIRoutes(s.appRouter.Group(path.Join(conf.Server.BasePath, "/api/portals/:portal")))
 	}
 
+	// JWKS route, which publishes the public keys used to verify session tokens
+	// This is registered only when session tokens are signed with asymmetric keys
+	// Like the API routes, it's available both with the basePath and without
+	if conf.GetSessionPublicKeys() != nil {
+		s.appRouter.GET("/.well-known/jwks.json", s.RouteGetJWKS)
+		if conf.Server.BasePath != "" && conf.Server.BasePath != "/" {
+			s.appRouter.GET(path.Join(conf.Server.BasePath, "/.well-known/jwks.json"), s.RouteGetJWKS)
+		}
+	}
+
+	// Admin API routes
+	// These are registered only when the admin API is enabled, and they require admin authentication
+	// Like the other API routes, they are available both with the basePath and without
+	if conf.Admin.Enabled {
+		if s.sessionStore == nil {
+			return errors.New("the admin API requires a session store")
+		}
+
+		registerAdminRoutes := func(r *gin.RouterGroup) {
+			r.GET("/sessions", s.RouteGetAdminSessions)
+			r.DELETE("/sessions", s.RouteDeleteAdminSessions)
+			r.DELETE("/sessions/:id", s.RouteDeleteAdminSession)
+			r.POST("/portals/:portal/providers/:provider/invites", s.RoutePostAdminWebAuthnInvite)
+			r.DELETE("/portals/:portal/providers/:provider/users/:user", s.RouteDeleteAdminWebAuthnUser)
+			r.DELETE("/portals/:portal/providers/:provider/users/:user/totp", s.RouteDeleteAdminTOTPEnrollment)
+		}
+		registerAdminRoutes(s.appRouter.Group("/api/admin", s.MiddlewareRequireAdmin))
+		if conf.Server.BasePath != "" && conf.Server.BasePath != "/" {
+			registerAdminRoutes(s.appRouter.Group(path.Join(conf.Server.BasePath, "/api/admin"), s.MiddlewareRequireAdmin))
+		}
+	}
+
 	// Test routes, that are enabled when running tests only
 	if s.addTestRoutes != nil {
 		s.addTestRoutes(s)
@@ -273,6 +377,12 @@ func (s *Server) Run(ctx context.Context) error {
 		if s.tokenCache != nil {
 			s.tokenCache.Stop()
 		}
+		if s.loginRateLimiter != nil {
+			s.loginRateLimiter.Stop()
+		}
+		if s.pendingTOTP != nil {
+			s.pendingTOTP.Stop()
+		}
 
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
 		err := s.appSrv.Shutdown(shutdownCtx)
@@ -508,13 +618,20 @@ type Portal struct {
 	DisplayName           string
 	Providers             map[string]auth.Provider
 	ProvidersList         []string
+	SigninProvidersList   []string
 	AuthenticationTimeout time.Duration
 	AlwaysShowSigninPage  bool
 	SessionLifetime       time.Duration
+	IdleTimeout           time.Duration
+	SessionRefresh        bool
+	SessionRefreshWindow  time.Duration
+	ProviderLogout        bool
+	RequireTOTP           bool
 	PagesBackgroundLarge  string
 	PagesBackgroundMedium string
 	PagesCSPHeader        func(nonce string) string
 	Headers               []AuthenticatedHeader
+	Rules                 []portalRule
 }
 
 type cachedPredicate struct {
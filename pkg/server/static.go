@@ -25,7 +25,8 @@ import (
 
 // clientManifest mirrors client/dist/manifest.json
 type clientManifest struct {
-	Style string `json:"style"`
+	Style    string `json:"style"`
+	WebAuthn string `json:"webauthn"`
 }
 
 func (s *Server) addStaticRoutes(basePath string) error {
@@ -71,6 +72,9 @@ func (s *Server) addStaticRoutes(basePath string) error {
 	// Add a route for the hashed style.css, pre-gzipped at build time
 	s.addStaticAssetRoute(basePath, s.styleAsset, "text/css", assetsFS, assetsHandler)
 
+	// Add a route for the hashed webauthn.js, pre-gzipped at build time
+	s.addStaticAssetRoute(basePath, s.webAuthnAsset, "application/javascript", assetsFS, assetsHandler)
+
 	return nil
 }
 
@@ -84,10 +88,11 @@ func (s *Server) loadClientManifest(assetsFS fs.FS) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse manifest.json: %w", err)
 	}
-	if m.Style == "" {
+	if m.Style == "" || m.WebAuthn == "" {
 		return errors.New("manifest.json is missing required entries")
 	}
 	s.styleAsset = m.Style
+	s.webAuthnAsset = m.WebAuthn
 	return nil
 }
 
@@ -200,6 +200,24 @@ func TestServerStaticAssets(t *testing.T) {
 		assert.Contains(t, string(body), ".layout")
 	})
 
+	t.Run("webauthn.js served gzipped when client accepts gzip", func(t *testing.T) {
+		require.True(t, strings.HasPrefix(srv.webAuthnAsset, "webauthn."), "webAuthnAsset should be hashed webauthn.<hash>.js")
+
+		res := doRequest(t, "/"+srv.webAuthnAsset, "gzip")
+		defer closeBody(res)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/javascript", res.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(res.Body)
+		require.NoError(t, err)
+		defer gz.Close()
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "navigator.credentials")
+	})
+
 	t.Run("icons.js gzipped with all icons by default", func(t *testing.T) {
 		res := doRequest(t, "/icons.js", "gzip")
 		defer closeBody(res)
@@ -15,12 +15,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lestrrat-go/jwx/v4/jwa"
 	"github.com/lestrrat-go/jwx/v4/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
+	"github.com/italypaleale/traefik-forward-auth/pkg/totp"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
 	"github.com/italypaleale/traefik-forward-auth/pkg/utils/bufconn"
@@ -80,9 +81,30 @@ func newTestServer(t *testing.T) (srv *Server, logBuf *utils.SafeBuffer) {
 	portals, err := GetPortalsConfig(t.Context(), cfg)
 	require.NoError(t, err)
 
+	// Init the session store, if any
+	sessionStore, err := sessionstore.New(cfg.Sessions.Store, cfg.Sessions.StorePath)
+	require.NoError(t, err)
+	if sessionStore != nil {
+		t.Cleanup(func() {
+			_ = sessionStore.Close()
+		})
+	}
+
+	// Init the TOTP store, if any
+	var totpStore *totp.Store
+	if cfg.TOTP.StorePath != "" {
+		totpStore, err = totp.NewStore(cfg.TOTP.StorePath)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = totpStore.Close()
+		})
+	}
+
 	// Create the server object
 	srv, err = NewServer(NewServerOpts{
 		Portals:       portals,
+		SessionStore:  sessionStore,
+		TOTPStore:     totpStore,
 		addTestRoutes: nil,
 		log:           log,
 	})
@@ -201,8 +223,9 @@ func createTestSessionTokenForDomain(t *testing.T, portalName string, profile *u
 	require.NoError(t, err)
 
 	// Sign the token
+	signingAlg, signingKey := cfg.GetSessionSigningKey()
 	tokenBytes, err := jwt.NewSerializer().
-		Sign(jwt.WithKey(jwa.HS256(), cfg.GetTokenSigningKey())).
+		Sign(jwt.WithKey(signingAlg, signingKey)).
 		Serialize(token)
 	require.NoError(t, err)
 
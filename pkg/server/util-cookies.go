@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,13 +18,17 @@ import (
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwe"
+	"github.com/lestrrat-go/jwx/v4/jwk"
 	"github.com/lestrrat-go/jwx/v4/jwt"
 	"github.com/lestrrat-go/jwx/v4/jwt/openid"
 	"golang.org/x/text/unicode/norm"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 )
 
@@ -35,6 +41,9 @@ const (
 	nonceClaim            = "tf_nonce"
 	sigClaim              = "tf_sig"
 	returnURLClaim        = "tf_return_url"
+	refreshTokenClaim     = "tf_rt"
+	idTokenClaim          = "tf_idt"
+	sessionExpClaim       = "tf_sexp"
 
 	maxTokenCacheTTL = 5 * time.Minute // Maximum TTL for token validation cache
 
@@ -48,49 +57,67 @@ const (
 	maxCookieChunks = 200
 )
 
-// errCachedTokenValidationFailed indicates that the session token failed validation on a previous request and the negative result was served from the cache
-var errCachedTokenValidationFailed = errors.New("session token validation failed (cached result)")
+var (
+	// errCachedTokenValidationFailed indicates that the session token failed validation on a previous request and the negative result was served from the cache
+	errCachedTokenValidationFailed = errors.New("session token validation failed (cached result)")
+	// errSessionRevoked indicates that the session token is valid, but the session is not in the session store because it was revoked
+	errSessionRevoked = errors.New("session was revoked")
+)
 
 func (s *Server) getSessionCookie(c *gin.Context, portalName string) (profile *user.Profile, provider auth.Provider, err error) {
+	entry, _, err := s.loadSessionCookie(c, portalName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.profile, entry.provider, nil
+}
+
+// loadSessionCookie returns the token cache entry for the session cookie in the request, with the user profile and provider populated
+// It also returns the cache key for the entry
+// If the request doesn't contain a session cookie, the returned entry is empty
+func (s *Server) loadSessionCookie(c *gin.Context, portalName string) (tokenCacheEntry, uint64, error) {
 	cookieName := s.sessionCookieName(portalName)
 
 	// Read the session cookie, reassembling it from chunk cookies (suffixes _1, _2, ...) if needed
 	// This parses the request's Cookie header only once
 	cookieValue, err := readSessionCookieValue(c, cookieName)
 	if errors.Is(err, http.ErrNoCookie) {
-		return nil, nil, nil
+		return tokenCacheEntry{}, 0, nil
 	} else if err != nil {
-		return nil, nil, err
+		return tokenCacheEntry{}, 0, err
 	}
 
 	// Get the cookie domain
 	cookieDomain, _, ok := cookieDomainForContext(c)
 	if !ok {
-		return nil, nil, errors.New("request host does not match any configured cookie domain")
+		return tokenCacheEntry{}, 0, errors.New("request host does not match any configured cookie domain")
 	}
 
-	// Parse the JWT in the cookie
-	entry, cacheKey, err := s.lookupSessionToken(cookieValue, portalName, cookieDomain)
+	return s.loadSessionToken(c.Request.Context(), cookieValue, portalName, cookieDomain)
+}
+
+// loadSessionToken returns the cache entry for a session token like lookupSessionToken, and it populates the user profile and provider on the entry too
+func (s *Server) loadSessionToken(ctx context.Context, val string, portalName string, cookieDomain string) (tokenCacheEntry, uint64, error) {
+	// Parse the JWT
+	entry, cacheKey, err := s.lookupSessionToken(ctx, val, portalName, cookieDomain)
 	if err != nil {
-		return nil, nil, err
+		return tokenCacheEntry{}, cacheKey, err
 	}
 
 	// Reuse the profile built for a previous request with this token, if we have one
 	if entry.profile != nil {
-		return entry.profile, entry.provider, nil
+		return entry, cacheKey, nil
 	}
 
 	// Build the profile from the token's claims, then keep it on the cache entry so subsequent requests don't have to build it again
-	profile, provider, err = s.buildSessionProfile(entry.token, portalName)
+	entry.profile, entry.provider, err = s.buildSessionProfile(entry.token, portalName)
 	if err != nil {
-		return nil, nil, err
+		return tokenCacheEntry{}, cacheKey, err
 	}
-
-	entry.profile = profile
-	entry.provider = provider
 	s.tokenCache.Set(cacheKey, entry, computeTokenCacheTTL(entry.token, false))
 
-	return profile, provider, nil
+	return entry, cacheKey, nil
 }
 
 // buildSessionProfile builds the user profile from the claims of a validated session token, and resolves the provider that issued it
@@ -211,9 +238,10 @@ func cookieValueUnescape(v string) string {
 // invalidSessionCookieIsSuspicious reports whether an error returned by getSessionCookie is "suspicious" (worth a security warning).
 // An expired token is a normal, expected event and returns false.
 // A cached negative validation result also returns false, so that repeatedly presenting the same invalid cookie doesn't flood the logs (the first, uncached attempt is what gets logged).
+// A session that was revoked returns false too, as its token is otherwise valid.
 // Anything else (a bad signature, a malformed JWT, a wrong issuer/audience, etc) may indicate a tampered cookie and returns true.
 func invalidSessionCookieIsSuspicious(err error) bool {
-	return !errors.Is(err, jwt.TokenExpiredError{}) && !errors.Is(err, errCachedTokenValidationFailed)
+	return !errors.Is(err, jwt.TokenExpiredError{}) && !errors.Is(err, errCachedTokenValidationFailed) && !errors.Is(err, errSessionRevoked)
 }
 
 // tokenCacheEntry is the result of a session token validation, stored in the token cache
@@ -231,12 +259,24 @@ type tokenCacheEntry struct {
 	// Never modify the profile (including its Groups, Roles, and AdditionalClaims) after it has been stored here
 	profile  *user.Profile
 	provider auth.Provider
+	// renewedToken is the session token that replaced this one, after the session was renewed with a refresh token
+	// Requests that still carry this token (for example because they were sent before the browser received the new cookie) are given the renewed token without refreshing the session again
+	renewedToken string
 	// valid reports whether the token passed validation
 	valid bool
 }
 
-func (s *Server) parseSessionToken(val string, portalName string, cookieDomain string) (openid.Token, error) {
-	entry, _, err := s.lookupSessionToken(val, portalName, cookieDomain)
+// issuedAt returns the time the session was created, or a zero time if the entry doesn't have a token
+func (e tokenCacheEntry) issuedAt() time.Time {
+	if e.token == nil {
+		return time.Time{}
+	}
+	iat, _ := e.token.IssuedAt()
+	return iat
+}
+
+func (s *Server) parseSessionToken(ctx context.Context, val string, portalName string, cookieDomain string) (openid.Token, error) {
+	entry, _, err := s.lookupSessionToken(ctx, val, portalName, cookieDomain)
 	if err != nil {
 		return nil, err
 	}
@@ -245,8 +285,25 @@ func (s *Server) parseSessionToken(val string, portalName string, cookieDomain s
 }
 
 // lookupSessionToken returns the cache entry for a session token, validating the token first if it isn't cached yet
+// When the session store is enabled, it also checks that the session hasn't been revoked
 // It also returns the cache key, so callers can store what they derived from the token on the same entry
-func (s *Server) lookupSessionToken(val string, portalName string, cookieDomain string) (tokenCacheEntry, uint64, error) {
+func (s *Server) lookupSessionToken(ctx context.Context, val string, portalName string, cookieDomain string) (tokenCacheEntry, uint64, error) {
+	entry, cacheKey, err := s.validateSessionToken(val, portalName, cookieDomain)
+	if err != nil {
+		return tokenCacheEntry{}, cacheKey, err
+	}
+
+	// The result of this check is never cached, so revoking a session is effective immediately, even for tokens that are in the token cache
+	err = s.checkSessionNotRevoked(ctx, entry.token)
+	if err != nil {
+		return tokenCacheEntry{}, cacheKey, err
+	}
+
+	return entry, cacheKey, nil
+}
+
+// validateSessionToken returns the cache entry for a session token, validating the token's signature and claims first if it isn't cached yet
+func (s *Server) validateSessionToken(val string, portalName string, cookieDomain string) (tokenCacheEntry, uint64, error) {
 	cfg := config.Get()
 	audience := cfg.GetTokenAudienceClaim(cookieDomain)
 
@@ -264,14 +321,24 @@ func (s *Server) lookupSessionToken(val string, portalName string, cookieDomain
 		return cached, cacheKey, nil
 	}
 
-	// Not in the cache: validate the token's signature and claims
-	token, err := jwt.Parse([]byte(val),
-		jwt.WithAcceptableSkew(acceptableClockSkew),
-		jwt.WithIssuer(jwtIssuer+":"+audience+":"+portalName),
-		jwt.WithAudience(audience),
-		jwt.WithKey(jwa.HS256(), cfg.GetTokenSigningKey()),
-		jwt.WithToken(openid.New()),
-	)
+	// Not in the cache: decrypt the token if needed, then validate its signature and claims
+	// Encrypted tokens are accepted even if encryption is currently disabled (and vice versa), so existing sessions remain valid when the option is changed
+	// The key is selected from the verification keys using the "kid" header
+	tokenBytes := []byte(val)
+	var err error
+	if isEncryptedSessionToken(val) {
+		tokenBytes, err = decryptSessionToken(cfg.GetSessionDecryptionKeys(), val)
+	}
+	var token jwt.Token
+	if err == nil {
+		token, err = jwt.Parse(tokenBytes,
+			jwt.WithAcceptableSkew(acceptableClockSkew),
+			jwt.WithIssuer(jwtIssuer+":"+audience+":"+portalName),
+			jwt.WithAudience(audience),
+			jwt.WithKeySet(cfg.GetSessionVerificationKeys()),
+			jwt.WithToken(openid.New()),
+		)
+	}
 
 	// Extract the concrete openid.Token from a successful parse
 	var oidcToken openid.Token
@@ -302,6 +369,28 @@ func (s *Server) lookupSessionToken(val string, portalName string, cookieDomain
 	return entry, cacheKey, nil
 }
 
+// checkSessionNotRevoked returns errSessionRevoked if the session store is enabled and the session for the token isn't in the store
+func (s *Server) checkSessionNotRevoked(ctx context.Context, token openid.Token) error {
+	if s.sessionStore == nil {
+		return nil
+	}
+
+	// Tokens issued while the session store was disabled don't have an ID, and they can't be revoked, so they are not accepted
+	sessionID, _ := token.JwtID()
+	if sessionID == "" {
+		return fmt.Errorf("%w: session token does not have a session ID", errSessionRevoked)
+	}
+
+	_, err := s.sessionStore.Get(ctx, sessionID)
+	if errors.Is(err, sessionstore.ErrSessionNotFound) {
+		return errSessionRevoked
+	} else if err != nil {
+		return fmt.Errorf("failed to retrieve session from the session store: %w", err)
+	}
+
+	return nil
+}
+
 func (s *Server) setSessionCookie(c *gin.Context, portalName string, profile *user.Profile, expiration time.Duration) error {
 	// Get the domain for the cookie
 	cookieDomain, _, ok := cookieDomainForContext(c)
@@ -309,58 +398,253 @@ func (s *Server) setSessionCookie(c *gin.Context, portalName string, profile *us
 		return errors.New("request host does not match any configured cookie domain")
 	}
 
-	return s.setSessionCookieForDomain(c, portalName, profile, expiration, cookieDomain)
+	return s.setSessionCookieForDomain(c, portalName, profile, sessionClaims{}, expiration, cookieDomain)
 }
 
-func (s *Server) setSessionCookieForReturnURL(c *gin.Context, portalName string, profile *user.Profile, expiration time.Duration, returnURL string) error {
+func (s *Server) setSessionCookieForReturnURL(c *gin.Context, portalName string, profile *user.Profile, claims sessionClaims, expiration time.Duration, returnURL string) error {
 	// Get the domain for the cookie from the return URL
 	cookieDomain, ok := cookieDomainForReturnURL(c, returnURL)
 	if !ok {
 		return errors.New("return URL host does not match any configured cookie domain")
 	}
 
-	return s.setSessionCookieForDomain(c, portalName, profile, expiration, cookieDomain)
+	return s.setSessionCookieForDomain(c, portalName, profile, claims, expiration, cookieDomain)
+}
+
+func (s *Server) setSessionCookieForDomain(c *gin.Context, portalName string, profile *user.Profile, claims sessionClaims, expiration time.Duration, cookieDomain string) error {
+	tokenStr, err := s.newSessionToken(c.Request.Context(), portalName, profile, claims, expiration, cookieDomain)
+	if err != nil {
+		return err
+	}
+
+	return s.writeSessionCookie(c, portalName, tokenStr, expiration, cookieDomain)
+}
+
+// sessionClaims contains the properties of a session that are stored in the session token, in addition to the user profile
+type sessionClaims struct {
+	// ID of the session, which is set in the "jti" claim
+	// This is used only when the session store is enabled; when empty, a new session ID is generated
+	sessionID string
+	// Refresh token for the session, encrypted
+	// This is set only when session refresh is enabled for the portal
+	refreshToken string
+	// ID token returned by the identity provider, used as hint when signing the user out of the identity provider
+	// This is set only when provider logout is enabled for the portal
+	idToken string
+	// Time the session expires, which is set in the "tf_sexp" claim
+	// This is set only when the portal has an idle timeout, in which case the token expires earlier, and it's re-issued as the session is used, up to this time
+	sessionExpiresAt time.Time
+	// Time the session was created, which is set in the "iat" claim
+	// Tokens that are re-issued for the same session, such as when the session is extended or refreshed, keep the original value, so conditions can check the age of the session
+	// When zero, the current time is used
+	issuedAt time.Time
+
+	// Subject and session ID of the user at the identity provider, from the ID token
+	// These are not included in the session token: they are saved in the session store only, where they are used to match back-channel logout requests
+	providerSubject   string
+	providerSessionID string
+}
+
+// sessionClaimsFromToken returns the session claims stored in a session token
+func sessionClaimsFromToken(token openid.Token) sessionClaims {
+	var sc sessionClaims
+	sc.sessionID, _ = token.JwtID()
+	sc.refreshToken, _ = jwt.Get[string](token, refreshTokenClaim)
+	sc.idToken, _ = jwt.Get[string](token, idTokenClaim)
+	sexp, _ := jwt.Get[float64](token, sessionExpClaim)
+	if sexp > 0 {
+		sc.sessionExpiresAt = time.Unix(int64(sexp), 0)
+	}
+	sc.issuedAt, _ = token.IssuedAt()
+	return sc
+}
+
+// appendClaims appends the session claims to a JWT builder
+func (sc sessionClaims) appendClaims(builder *jwt.Builder) {
+	if sc.sessionID != "" {
+		builder.JwtID(sc.sessionID)
+	}
+	if sc.refreshToken != "" {
+		builder.Claim(refreshTokenClaim, sc.refreshToken)
+	}
+	if sc.idToken != "" {
+		builder.Claim(idTokenClaim, sc.idToken)
+	}
+	if !sc.sessionExpiresAt.IsZero() {
+		builder.Claim(sessionExpClaim, sc.sessionExpiresAt.Unix())
+	}
 }
 
-func (s *Server) setSessionCookieForDomain(c *gin.Context, portalName string, profile *user.Profile, expiration time.Duration, cookieDomain string) error {
+// newSessionToken builds and signs a session token for the user profile
+// New sessions expire after the given expiration; if the claims contain the session's expiration time, that is used instead, so re-issued tokens don't extend the session
+// When the session store is enabled, the session is saved in the store too
+func (s *Server) newSessionToken(ctx context.Context, portalName string, profile *user.Profile, claims sessionClaims, expiration time.Duration, cookieDomain string) (string, error) {
 	if profile == nil {
-		return errors.New("profile is nil")
+		return "", errors.New("profile is nil")
 	}
 
 	expiration = expiration.Truncate(time.Second)
 	if expiration < time.Minute {
-		return errors.New("expiration must be at least 1 minute")
+		return "", errors.New("expiration must be at least 1 minute")
 	}
 
 	cfg := config.Get()
 
-	// Claims for the JWT
+	// Compute the expiration of the session
+	// Add 1 extra second to synchronize with cookie expiry
 	now := time.Now()
+	sessionExpiresAt := claims.sessionExpiresAt
+	if sessionExpiresAt.IsZero() {
+		sessionExpiresAt = now.Add(expiration + time.Second)
+	}
+
+	// When the portal has an idle timeout, the token expires sooner, and the session's expiration is stored in the token so it can be re-issued
+	tokenExpiresAt := sessionExpiresAt
+	portal := s.portals[portalName]
+	if portal != nil && portal.IdleTimeout > 0 {
+		claims.sessionExpiresAt = sessionExpiresAt
+		idleExpiresAt := now.Add(portal.IdleTimeout + time.Second)
+		if idleExpiresAt.Before(tokenExpiresAt) {
+			tokenExpiresAt = idleExpiresAt
+		}
+	}
+
+	// Save the session in the store
+	if s.sessionStore != nil {
+		var err error
+		claims.sessionID, err = s.storeSession(ctx, portalName, profile, claims, now, sessionExpiresAt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Claims for the JWT
 	audience := cfg.GetTokenAudienceClaim(cookieDomain)
 	builder := jwt.NewBuilder()
 	profile.AppendClaims(builder)
+	claims.appendClaims(builder)
+	issuedAt := claims.issuedAt
+	if issuedAt.IsZero() {
+		issuedAt = now
+	}
 	token, err := builder.
 		Issuer(jwtIssuer + ":" + audience + ":" + portalName).
 		Audience([]string{audience}).
-		IssuedAt(now).
-		// Add 1 extra second to synchronize with cookie expiry
-		Expiration(now.Add(expiration + time.Second)).
+		IssuedAt(issuedAt).
+		Expiration(tokenExpiresAt).
 		NotBefore(now).
 		Build()
 	if err != nil {
-		return fmt.Errorf("failed to build JWT: %w", err)
+		return "", fmt.Errorf("failed to build JWT: %w", err)
 	}
 
 	// Generate the JWT
-	cookieValue, err := jwt.NewSerializer().
-		Sign(jwt.WithKey(jwa.HS256(), cfg.GetTokenSigningKey())).
+	signingAlg, signingKey := cfg.GetSessionSigningKey()
+	tokenBytes, err := jwt.NewSerializer().
+		Sign(jwt.WithKey(signingAlg, signingKey)).
 		Serialize(token)
 	if err != nil {
-		return fmt.Errorf("failed to serialize token: %w", err)
+		return "", fmt.Errorf("failed to serialize token: %w", err)
+	}
+
+	// If enabled, encrypt the token so its claims can't be read by clients
+	if cfg.Cookies.Encrypt {
+		tokenBytes, err = encryptSessionToken(cfg.GetSessionEncryptionKey(), tokenBytes)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(tokenBytes), nil
+}
+
+// encryptSessionToken wraps a signed session token in a JWE, encrypted with A256GCM using the key directly
+func encryptSessionToken(key jwk.Key, tokenBytes []byte) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("session encryption key is not set")
+	}
+
+	headers := jwe.NewHeaders()
+	_ = headers.Set(jwe.ContentTypeKey, "JWT")
+	enc, err := jwe.Encrypt(tokenBytes,
+		jwe.WithKey(jwa.DIRECT(), key),
+		jwe.WithContentEncryption(jwa.A256GCM()),
+		jwe.WithProtectedHeaders(headers),
+		jwe.WithCompact(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt session token: %w", err)
+	}
+
+	return enc, nil
+}
+
+// decryptSessionToken returns the signed session token contained in an encrypted session token
+// The key is selected from the decryption keys using the "kid" header
+func decryptSessionToken(keys jwk.Set, val string) ([]byte, error) {
+	if keys == nil {
+		return nil, errors.New("session decryption keys are not set")
 	}
 
+	tokenBytes, err := jwe.Decrypt([]byte(val), jwe.WithKeySet(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session token: %w", err)
+	}
+
+	return tokenBytes, nil
+}
+
+// isEncryptedSessionToken returns true if the value is a JWE in compact serialization, which has 5 parts, rather than a JWS, which has 3
+func isEncryptedSessionToken(val string) bool {
+	return strings.Count(val, ".") == 4
+}
+
+// storeSession saves a session in the session store, and returns its ID
+// If the session ID in the claims is empty, a new session is created; otherwise, the existing session is updated, as long as it hasn't been revoked
+func (s *Server) storeSession(ctx context.Context, portalName string, profile *user.Profile, claims sessionClaims, now time.Time, expiresAt time.Time) (string, error) {
+	session := sessionstore.Session{
+		ID:                claims.sessionID,
+		Portal:            portalName,
+		Provider:          profile.Provider,
+		UserID:            profile.ID,
+		Email:             profile.GetEmail(),
+		ProviderSubject:   claims.providerSubject,
+		ProviderSessionID: claims.providerSessionID,
+		CreatedAt:         now,
+		ExpiresAt:         expiresAt,
+	}
+
+	if session.ID == "" {
+		session.ID = uuid.NewString()
+	} else {
+		existing, err := s.sessionStore.Get(ctx, session.ID)
+		if errors.Is(err, sessionstore.ErrSessionNotFound) {
+			return "", errSessionRevoked
+		} else if err != nil {
+			return "", fmt.Errorf("failed to retrieve session from the session store: %w", err)
+		}
+		session.CreatedAt = existing.CreatedAt
+
+		// Identity providers may not return a new ID token when the session is renewed
+		if session.ProviderSubject == "" && session.ProviderSessionID == "" {
+			session.ProviderSubject = existing.ProviderSubject
+			session.ProviderSessionID = existing.ProviderSessionID
+		}
+	}
+
+	err := s.sessionStore.Put(ctx, session)
+	if err != nil {
+		return "", fmt.Errorf("failed to save session in the session store: %w", err)
+	}
+
+	return session.ID, nil
+}
+
+// writeSessionCookie sets the session cookie in the response, splitting it in multiple chunks if needed
+func (s *Server) writeSessionCookie(c *gin.Context, portalName string, tokenStr string, expiration time.Duration, cookieDomain string) error {
+	cfg := config.Get()
 	cookieName := s.sessionCookieName(portalName)
-	tokenStr := string(cookieValue)
+	expiration = expiration.Truncate(time.Second)
 
 	// Check if we need to chunk the cookie
 	if len(tokenStr) <= maxCookieChunkSize {
@@ -427,6 +711,26 @@ func (s *Server) deleteSessionCookie(c *gin.Context, portalName string) {
 	expireStaleSessionChunks(c, cookieName, 1, cookieDomain, !cfg.Cookies.Insecure)
 }
 
+// revokeSessionCookie removes the session for the session cookie in the request from the session store, if enabled
+// Errors are logged and otherwise ignored, as the session cookie is deleted regardless
+func (s *Server) revokeSessionCookie(c *gin.Context, portalName string) {
+	if s.sessionStore == nil {
+		return
+	}
+
+	entry, _, err := s.loadSessionCookie(c, portalName)
+	if err != nil || entry.token == nil {
+		// There's no valid session to revoke
+		return
+	}
+
+	sessionID, _ := entry.token.JwtID()
+	err = s.sessionStore.Delete(c.Request.Context(), sessionID)
+	if err != nil {
+		s.requestLogger(c).WarnContext(c.Request.Context(), "Failed to remove session from the session store", slog.Any("error", err))
+	}
+}
+
 // expireStaleSessionChunks emits Max-Age=-1 Set-Cookie headers for any chunked session cookies in the request whose numeric suffix is >= startIdx
 // Used to clean up stale chunks from previous, larger sessions when the new session uses fewer (or zero) chunks
 func expireStaleSessionChunks(c *gin.Context, cookieName string, startIdx int, domain string, secure bool) {
@@ -477,7 +781,7 @@ func (s *Server) getStateCookie(c *gin.Context, portal *Portal, stateCookieID st
 		jwt.WithAcceptableSkew(acceptableClockSkew),
 		jwt.WithIssuer(jwtIssuer+":"+audience+":"+portal.Name),
 		jwt.WithAudience(audience),
-		jwt.WithKey(jwa.HS256(), cfg.GetTokenSigningKey()),
+		jwt.WithKeySet(cfg.GetTokenVerificationKeys()),
 	)
 	if err != nil {
 		return stateCookieContent{}, fmt.Errorf("failed to parse JWT: %w", err)
@@ -690,6 +994,7 @@ func (s *Server) tokenCacheKey(val string, audience string, portalName string) u
 }
 
 // computeTokenCacheTTL computes the TTL for a token validation result in the cache
+// Only the result of validating the token and the profile are cached: authorization conditions, which can depend on the time, are evaluated for every request
 // For valid (unexpired) tokens, the TTL is the minimum of maxTokenCacheTTL or the token's expiration time
 // For invalid tokens, the TTL is always maxTokenCacheTTL
 func computeTokenCacheTTL(token openid.Token, invalid bool) time.Duration {
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,10 +11,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/lestrrat-go/jwx/v4/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/sessionstore"
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 )
 
@@ -103,7 +107,7 @@ func TestSetSessionCookie(t *testing.T) {
 		cookies := w.Result().Cookies()
 		require.Len(t, cookies, 1)
 
-		_, err = srv.parseSessionToken(cookies[0].Value, testPortalName, "example.org")
+		_, err = srv.parseSessionToken(t.Context(), cookies[0].Value, testPortalName, "example.org")
 		require.Error(t, err)
 	})
 
@@ -986,7 +990,7 @@ func TestTokenCaching(t *testing.T) {
 		cookieValue := cookies[0].Value
 
 		// First parse - should validate and cache
-		token1, err := srv.parseSessionToken(cookieValue, testPortalName, "")
+		token1, err := srv.parseSessionToken(t.Context(), cookieValue, testPortalName, "")
 		require.NoError(t, err)
 		require.NotNil(t, token1)
 
@@ -1000,7 +1004,7 @@ func TestTokenCaching(t *testing.T) {
 		require.NotNil(t, cached.token, "cached result should hold the parsed token")
 
 		// Second parse - should use cache
-		token2, err := srv.parseSessionToken(cookieValue, testPortalName, "")
+		token2, err := srv.parseSessionToken(t.Context(), cookieValue, testPortalName, "")
 		require.NoError(t, err)
 		require.NotNil(t, token2)
 
@@ -1014,7 +1018,7 @@ func TestTokenCaching(t *testing.T) {
 		const invalidToken = "invalid.jwt.token.value" //nolint:gosec
 
 		// First parse - should fail and cache the error
-		token1, err := srv.parseSessionToken(invalidToken, testPortalName, "tfa.example.com")
+		token1, err := srv.parseSessionToken(t.Context(), invalidToken, testPortalName, "tfa.example.com")
 		require.Error(t, err)
 		require.Nil(t, token1)
 
@@ -1027,7 +1031,7 @@ func TestTokenCaching(t *testing.T) {
 		require.False(t, cached.valid, "cached negative result should be marked invalid")
 
 		// Second parse - should return cached error
-		token2, err := srv.parseSessionToken(invalidToken, testPortalName, "tfa.example.com")
+		token2, err := srv.parseSessionToken(t.Context(), invalidToken, testPortalName, "tfa.example.com")
 		require.Error(t, err)
 		require.Nil(t, token2)
 	})
@@ -1060,7 +1064,7 @@ func TestTokenCaching(t *testing.T) {
 		cookieValue := cookies[0].Value
 
 		// Parse the token
-		token, err := srv.parseSessionToken(cookieValue, testPortalName, "")
+		token, err := srv.parseSessionToken(t.Context(), cookieValue, testPortalName, "")
 		require.NoError(t, err)
 		require.NotNil(t, token)
 
@@ -1077,7 +1081,7 @@ func TestTokenCaching(t *testing.T) {
 		const invalidToken = "another.invalid.token" //nolint:gosec
 
 		// Parse invalid token
-		_, err := srv.parseSessionToken(invalidToken, testPortalName, "tfa.example.com")
+		_, err := srv.parseSessionToken(t.Context(), invalidToken, testPortalName, "tfa.example.com")
 		require.Error(t, err)
 
 		// Check that the TTL for invalid tokens is 5 minutes
@@ -1321,3 +1325,303 @@ func newContextWithSessionCookie(cookieName, cookieValue string) *gin.Context {
 	c.Request.AddCookie(&http.Cookie{Name: cookieName, Value: cookieValue}) //nolint:gosec
 	return c
 }
+
+func TestSessionStore(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Sessions.Store = "memory"
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	require.NotNil(t, srv.sessionStore)
+
+	testProfile := &user.Profile{
+		ID: "test-user-store",
+		Name: user.ProfileName{
+			FullName: "Store Test User",
+		},
+		Email: &user.ProfileEmail{
+			Value:    "store@example.com",
+			Verified: true,
+		},
+		Provider: "testoauth2",
+	}
+
+	cookieName := config.Get().Cookies.CookieName(testPortalName)
+	newSession := func(t *testing.T) string {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+
+		err := srv.setSessionCookie(c, testPortalName, testProfile, time.Hour)
+		require.NoError(t, err)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return cookies[0].Value
+	}
+	newContext := func(cookieValue string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		c.Request.AddCookie(&http.Cookie{ //nolint:gosec
+			Name:  cookieName,
+			Value: cookieValue,
+		})
+		return c
+	}
+
+	t.Run("session is saved in the store", func(t *testing.T) {
+		token, err := srv.parseSessionToken(t.Context(), newSession(t), testPortalName, "")
+		require.NoError(t, err)
+
+		sessionID, _ := token.JwtID()
+		require.NotEmpty(t, sessionID)
+
+		session, err := srv.sessionStore.Get(t.Context(), sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, testPortalName, session.Portal)
+		assert.Equal(t, "testoauth2", session.Provider)
+		assert.Equal(t, "test-user-store", session.UserID)
+		assert.Equal(t, "store@example.com", session.Email)
+		exp, _ := token.Expiration()
+		assert.WithinDuration(t, exp, session.ExpiresAt, time.Second)
+	})
+
+	t.Run("revoked session is rejected even when cached", func(t *testing.T) {
+		cookieValue := newSession(t)
+
+		// Populate the token cache
+		profile, _, err := srv.getSessionCookie(newContext(cookieValue), testPortalName)
+		require.NoError(t, err)
+		require.NotNil(t, profile)
+
+		// Revoke the session
+		n, err := srv.sessionStore.DeleteMatching(t.Context(), sessionstore.Filter{UserID: "test-user-store"})
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, n, 1)
+
+		_, _, err = srv.getSessionCookie(newContext(cookieValue), testPortalName)
+		require.ErrorIs(t, err, errSessionRevoked)
+		assert.False(t, invalidSessionCookieIsSuspicious(err))
+	})
+
+	t.Run("tokens without a session ID are rejected", func(t *testing.T) {
+		// Create a token while the store is disabled
+		store := srv.sessionStore
+		srv.sessionStore = nil
+		untracked, err := srv.newSessionToken(t.Context(), testPortalName, testProfile, sessionClaims{}, time.Hour, "")
+		srv.sessionStore = store
+		require.NoError(t, err)
+
+		_, err = srv.parseSessionToken(t.Context(), untracked, testPortalName, "")
+		require.ErrorIs(t, err, errSessionRevoked)
+	})
+
+	t.Run("renewed session keeps its ID", func(t *testing.T) {
+		token, err := srv.parseSessionToken(t.Context(), newSession(t), testPortalName, "")
+		require.NoError(t, err)
+		sessionID, _ := token.JwtID()
+		original, err := srv.sessionStore.Get(t.Context(), sessionID)
+		require.NoError(t, err)
+
+		renewed, err := srv.newSessionToken(t.Context(), testPortalName, testProfile, sessionClaims{sessionID: sessionID}, 2*time.Hour, "")
+		require.NoError(t, err)
+		renewedToken, err := srv.parseSessionToken(t.Context(), renewed, testPortalName, "")
+		require.NoError(t, err)
+		renewedID, _ := renewedToken.JwtID()
+		assert.Equal(t, sessionID, renewedID)
+
+		session, err := srv.sessionStore.Get(t.Context(), sessionID)
+		require.NoError(t, err)
+		assert.True(t, original.CreatedAt.Equal(session.CreatedAt))
+		assert.True(t, session.ExpiresAt.After(original.ExpiresAt))
+
+		// A revoked session can't be renewed
+		require.NoError(t, srv.sessionStore.Delete(t.Context(), sessionID))
+		_, err = srv.newSessionToken(t.Context(), testPortalName, testProfile, sessionClaims{sessionID: sessionID}, 2*time.Hour, "")
+		require.ErrorIs(t, err, errSessionRevoked)
+	})
+
+	t.Run("logging out removes the session from the store", func(t *testing.T) {
+		cookieValue := newSession(t)
+		token, err := srv.parseSessionToken(t.Context(), cookieValue, testPortalName, "")
+		require.NoError(t, err)
+		sessionID, _ := token.JwtID()
+
+		srv.revokeSessionCookie(newContext(cookieValue), testPortalName)
+
+		_, err = srv.sessionStore.Get(t.Context(), sessionID)
+		require.ErrorIs(t, err, sessionstore.ErrSessionNotFound)
+	})
+}
+
+func TestSessionTokenKeyRotation(t *testing.T) {
+	const (
+		oldKey = "old-signing-key-1234567890"
+		newKey = "new-signing-key-1234567890"
+	)
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Tokens.SigningKey = ""
+		c.Tokens.SigningKeys = []string{oldKey}
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+
+	cfg := config.Get()
+	profile := &user.Profile{Provider: "testoauth2", ID: "test-user-1"}
+	oldKid, _ := cfg.GetTokenSigningKey().KeyID()
+
+	tokenKid := func(t *testing.T, token string) string {
+		t.Helper()
+		msg, err := jws.Parse([]byte(token))
+		require.NoError(t, err)
+		require.Len(t, msg.Signatures(), 1)
+		kid, _ := msg.Signatures()[0].ProtectedHeaders().KeyID()
+		return kid
+	}
+
+	// Tokens issued before the rotation are signed with the old key
+	oldToken1, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+	require.NoError(t, err)
+	oldToken2, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, 2*time.Hour, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, oldKid, tokenKid(t, oldToken1))
+
+	t.Run("new key signs and old key verifies", func(t *testing.T) {
+		cfg.Tokens.SigningKeys = []string{newKey, oldKey}
+		require.NoError(t, cfg.SetTokenSigningKey(nil))
+
+		newToken, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+		newKid := tokenKid(t, newToken)
+		assert.NotEqual(t, oldKid, newKid)
+
+		_, err = srv.parseSessionToken(t.Context(), newToken, testPortalName, "example.com")
+		require.NoError(t, err)
+		_, err = srv.parseSessionToken(t.Context(), oldToken1, testPortalName, "example.com")
+		require.NoError(t, err)
+	})
+
+	t.Run("old key is removed", func(t *testing.T) {
+		cfg.Tokens.SigningKeys = []string{newKey}
+		require.NoError(t, cfg.SetTokenSigningKey(nil))
+
+		_, err = srv.parseSessionToken(t.Context(), oldToken2, testPortalName, "example.com")
+		require.Error(t, err)
+	})
+}
+
+func TestSessionTokenEncryption(t *testing.T) {
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Cookies.Encrypt = true
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+
+	cfg := config.Get()
+	profile := &user.Profile{
+		Provider: "testoauth2",
+		ID:       "test-user-1",
+		Email:    &user.ProfileEmail{Value: "test@example.com", Verified: true},
+	}
+
+	t.Run("claims are not readable", func(t *testing.T) {
+		token, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		assert.True(t, isEncryptedSessionToken(token))
+		assert.NotContains(t, token, base64.RawURLEncoding.EncodeToString([]byte("test@example.com")))
+		_, err = jwt.ParseInsecure([]byte(token))
+		require.Error(t, err)
+
+		parsed, err := srv.parseSessionToken(t.Context(), token, testPortalName, "example.com")
+		require.NoError(t, err)
+		email, _ := parsed.Email()
+		assert.Equal(t, "test@example.com", email)
+	})
+
+	t.Run("tampered token is rejected", func(t *testing.T) {
+		token, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		// Change a character in the authentication tag
+		tampered := []byte(token)
+		if tampered[len(tampered)-2] == 'A' {
+			tampered[len(tampered)-2] = 'B'
+		} else {
+			tampered[len(tampered)-2] = 'A'
+		}
+		_, err = srv.parseSessionToken(t.Context(), string(tampered), testPortalName, "example.com")
+		require.Error(t, err)
+	})
+
+	t.Run("unencrypted tokens are still accepted", func(t *testing.T) {
+		cfg.Cookies.Encrypt = false
+		token, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		cfg.Cookies.Encrypt = true
+		require.NoError(t, err)
+		assert.False(t, isEncryptedSessionToken(token))
+
+		_, err = srv.parseSessionToken(t.Context(), token, testPortalName, "example.com")
+		require.NoError(t, err)
+	})
+
+	t.Run("chunked cookie", func(t *testing.T) {
+		largeString := strings.Repeat("a", 1_500)
+		largeProfile := &user.Profile{
+			Provider: "testoauth2",
+			ID:       "test-user-1",
+			Email:    &user.ProfileEmail{Value: "test@example.com", Verified: true},
+			Groups:   []string{"group1-" + largeString, "group2-" + largeString, "group3-" + largeString},
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		err := srv.setSessionCookie(c, testPortalName, largeProfile, time.Hour)
+		require.NoError(t, err)
+
+		cookies := w.Result().Cookies()
+		require.Greater(t, len(cookies), 1)
+
+		w2 := httptest.NewRecorder()
+		c2, _ := gin.CreateTestContext(w2)
+		c2.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range cookies {
+			c2.Request.AddCookie(cookie)
+		}
+
+		val, err := readSessionCookieValue(c2, cfg.Cookies.CookieName(testPortalName))
+		require.NoError(t, err)
+		assert.True(t, isEncryptedSessionToken(val))
+
+		got, _, err := srv.getSessionCookie(c2, testPortalName)
+		require.NoError(t, err)
+		assert.Equal(t, largeProfile.Groups, got.Groups)
+	})
+
+	t.Run("keys are rotated with the signing keys", func(t *testing.T) {
+		cfg.Tokens.SigningKey = ""
+		cfg.Tokens.SigningKeys = []string{"old-signing-key-1234567890"}
+		require.NoError(t, cfg.SetTokenSigningKey(nil))
+
+		oldToken, err := srv.newSessionToken(t.Context(), testPortalName, profile, sessionClaims{}, time.Hour, "example.com")
+		require.NoError(t, err)
+
+		cfg.Tokens.SigningKeys = []string{"new-signing-key-1234567890", "old-signing-key-1234567890"}
+		require.NoError(t, cfg.SetTokenSigningKey(nil))
+		_, err = srv.parseSessionToken(t.Context(), oldToken, testPortalName, "example.com")
+		require.NoError(t, err)
+
+		cfg.Tokens.SigningKeys = []string{"new-signing-key-1234567890"}
+		require.NoError(t, cfg.SetTokenSigningKey(nil))
+		srv.tokenCache.Delete(srv.tokenCacheKey(oldToken, cfg.GetTokenAudienceClaim("example.com"), testPortalName))
+		_, err = srv.parseSessionToken(t.Context(), oldToken, testPortalName, "example.com")
+		require.Error(t, err)
+	})
+}
@@ -22,11 +22,13 @@ func TestHeaderConstantsAreCanonical(t *testing.T) {
 		headerXForwardedPort,
 		headerXForwardedProto,
 		headerXForwardedHost,
+		headerXForwardedMethod,
 		headerXForwardedServer,
 		headerXForwardedURI,
 		headerXForwardedUser,
 		headerXAuthenticatedUser,
 		headerXForwardAuthIf,
+		headerXForwardAuthPolicy,
 		headerXRequestID,
 	}
 
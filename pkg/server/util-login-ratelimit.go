@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/go-kit/ttlcache"
+)
+
+const (
+	// Failed login attempts are remembered for this long after the last failure
+	loginFailuresWindow = 15 * time.Minute
+	// Maximum number of failed login attempts for the same user from the same client IP
+	loginMaxFailuresPerUser = 5
+	// Maximum number of failed login attempts for the same user, from any client IP
+	// This is higher than the per-user limit, so attackers can't easily lock users out, but it stops attacks distributed across many IPs
+	loginMaxFailuresPerAccount = 50
+	// Maximum number of failed login attempts from the same client IP, for any user
+	loginMaxFailuresPerIP = 20
+)
+
+// loginRateLimiter keeps track of failed attempts to sign in with a login form, and blocks further attempts when there are too many
+type loginRateLimiter struct {
+	lock     sync.Mutex
+	failures *ttlcache.Cache[string, int]
+}
+
+func newLoginRateLimiter() *loginRateLimiter {
+	return &loginRateLimiter{
+		failures: ttlcache.NewCache[string, int](&ttlcache.CacheOptions{
+			CleanupInterval: time.Minute,
+		}),
+	}
+}
+
+// Allowed returns true if the client can attempt to sign in as the user
+func (l *loginRateLimiter) Allowed(portal string, provider string, username string, clientIP string) bool {
+	userKey, accountKey, ipKey := loginRateLimitKeys(portal, provider, username, clientIP)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	n, _ := l.failures.Get(userKey)
+	if n >= loginMaxFailuresPerUser {
+		return false
+	}
+	n, _ = l.failures.Get(accountKey)
+	if n >= loginMaxFailuresPerAccount {
+		return false
+	}
+	n, _ = l.failures.Get(ipKey)
+	return n < loginMaxFailuresPerIP
+}
+
+// RecordFailure records a failed attempt to sign in
+func (l *loginRateLimiter) RecordFailure(portal string, provider string, username string, clientIP string) {
+	userKey, accountKey, ipKey := loginRateLimitKeys(portal, provider, username, clientIP)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, k := range []string{userKey, accountKey, ipKey} {
+		n, _ := l.failures.Get(k)
+		l.failures.Set(k, n+1, loginFailuresWindow)
+	}
+}
+
+// RecordSuccess resets the failed attempts for the user from the client IP
+// Failed attempts for the user from any IP are not reset, so a successful sign-in doesn't allow attackers to continue a distributed attack
+func (l *loginRateLimiter) RecordSuccess(portal string, provider string, username string, clientIP string) {
+	userKey, _, _ := loginRateLimitKeys(portal, provider, username, clientIP)
+
+	l.lock.Lock()
+	l.failures.Delete(userKey)
+	l.lock.Unlock()
+}
+
+// Stop the background cleanup of the cache
+func (l *loginRateLimiter) Stop() {
+	l.failures.Stop()
+}
+
+func loginRateLimitKeys(portal string, provider string, username string, clientIP string) (userKey string, accountKey string, ipKey string) {
+	// Usernames are compared case-insensitively, so attackers can't get more attempts by changing the case
+	accountKey = "a\x00" + portal + "\x00" + provider + "\x00" + strings.ToLower(username)
+	userKey = "u\x00" + portal + "\x00" + provider + "\x00" + strings.ToLower(username) + "\x00" + clientIP
+	ipKey = "ip\x00" + clientIP
+	return userKey, accountKey, ipKey
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginRateLimiter(t *testing.T) {
+	t.Run("blocks a user after too many failures from the same IP", func(t *testing.T) {
+		l := newLoginRateLimiter()
+		defer l.Stop()
+
+		for range loginMaxFailuresPerUser {
+			assert.True(t, l.Allowed("portal", "provider", "alice", "1.1.1.1"))
+			l.RecordFailure("portal", "provider", "alice", "1.1.1.1")
+		}
+		assert.False(t, l.Allowed("portal", "provider", "alice", "1.1.1.1"))
+		assert.False(t, l.Allowed("portal", "provider", "ALICE", "1.1.1.1"), "usernames are case-insensitive")
+
+		// Other users, other IPs, and other providers are not affected
+		assert.True(t, l.Allowed("portal", "provider", "bob", "1.1.1.1"))
+		assert.True(t, l.Allowed("portal", "provider", "alice", "2.2.2.2"))
+		assert.True(t, l.Allowed("portal", "other", "alice", "1.1.1.1"))
+	})
+
+	t.Run("success resets the failures for the user", func(t *testing.T) {
+		l := newLoginRateLimiter()
+		defer l.Stop()
+
+		for range loginMaxFailuresPerUser - 1 {
+			l.RecordFailure("portal", "provider", "alice", "1.1.1.1")
+		}
+		l.RecordSuccess("portal", "provider", "alice", "1.1.1.1")
+		l.RecordFailure("portal", "provider", "alice", "1.1.1.1")
+		assert.True(t, l.Allowed("portal", "provider", "alice", "1.1.1.1"))
+	})
+
+	t.Run("blocks an IP after too many failures for any user", func(t *testing.T) {
+		l := newLoginRateLimiter()
+		defer l.Stop()
+
+		for i := range loginMaxFailuresPerIP {
+			l.RecordFailure("portal", "provider", "user"+string(rune('a'+i)), "1.1.1.1")
+		}
+		assert.False(t, l.Allowed("portal", "provider", "zed", "1.1.1.1"))
+		assert.True(t, l.Allowed("portal", "provider", "zed", "2.2.2.2"))
+	})
+
+	t.Run("blocks a user after too many failures from any IP", func(t *testing.T) {
+		l := newLoginRateLimiter()
+		defer l.Stop()
+
+		// Each IP stays below the per-user and per-IP limits
+		for i := range loginMaxFailuresPerAccount {
+			ip := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+			assert.True(t, l.Allowed("portal", "provider", "alice", ip))
+			l.RecordFailure("portal", "provider", "alice", ip)
+		}
+		assert.False(t, l.Allowed("portal", "provider", "alice", "2.2.2.2"))
+		assert.False(t, l.Allowed("portal", "provider", "Alice", "2.2.2.2"), "usernames are case-insensitive")
+
+		// A successful sign-in doesn't reset the failures from other IPs
+		l.RecordSuccess("portal", "provider", "alice", "10.0.0.0")
+		assert.False(t, l.Allowed("portal", "provider", "alice", "2.2.2.2"))
+
+		// Other users and other providers are not affected
+		assert.True(t, l.Allowed("portal", "provider", "bob", "2.2.2.2"))
+		assert.True(t, l.Allowed("portal", "other", "alice", "2.2.2.2"))
+	})
+}
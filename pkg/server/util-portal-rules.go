@@ -0,0 +1,220 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
+)
+
+// portalRule is a rule that controls access to the applications protected by a portal, based on the request forwarded by Traefik
+type portalRule struct {
+	host       string
+	pathPrefix string
+	pathRegexp *regexp.Regexp
+	methods    []string
+	action     string
+	predicate  conditions.UserProfilePredicate
+}
+
+func getRulesConfig(p config.ConfigPortal) []portalRule {
+	if len(p.Rules) == 0 {
+		return nil
+	}
+
+	rules := make([]portalRule, len(p.Rules))
+	for i, r := range p.Rules {
+		rules[i] = portalRule{
+			host:       r.Host,
+			pathPrefix: r.PathPrefix,
+			pathRegexp: r.GetPathRegexp(),
+			methods:    r.Methods,
+			action:     r.Action,
+			predicate:  r.GetPredicate(),
+		}
+	}
+	return rules
+}
+
+// ambiguousPathRule is returned by matchPortalRule when a rule with conditions on the path is reached, but the path of the request can't be determined unambiguously
+// It denies access to everyone, so encoded separators can't be used to bypass rules, nor to reach paths that are public
+var ambiguousPathRule = portalRule{
+	action: config.RuleActionDeny,
+}
+
+// matchPortalRule returns the first rule matching the request, or nil if no rule matches
+// The path of the request is resolved only if a rule that matches the host and method has conditions on the path
+func matchPortalRule(rules []portalRule, req *conditions.Request) *portalRule {
+	for i := range rules {
+		r := &rules[i]
+		if r.hasPathCondition() && r.matchesHostAndMethod(req) {
+			_, ok := req.GetPath()
+			if !ok {
+				return &ambiguousPathRule
+			}
+		}
+		if r.matches(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+// matches returns true if the rule matches the request
+// Rules with conditions on the path never match requests whose path can't be determined unambiguously
+func (r *portalRule) matches(req *conditions.Request) bool {
+	if !r.matchesHostAndMethod(req) {
+		return false
+	}
+	if !r.hasPathCondition() {
+		return true
+	}
+
+	p, ok := req.GetPath()
+	if !ok {
+		return false
+	}
+
+	if r.pathPrefix != "" && !utils.HasPathPrefix(p, r.pathPrefix) {
+		return false
+	}
+
+	if r.pathRegexp != nil && !r.pathRegexp.MatchString(p) {
+		return false
+	}
+
+	return true
+}
+
+func (r *portalRule) hasPathCondition() bool {
+	return r.pathPrefix != "" || r.pathRegexp != nil
+}
+
+func (r *portalRule) matchesHostAndMethod(req *conditions.Request) bool {
+	if r.host != "" && !utils.MatchHost(r.host, req.Host) {
+		return false
+	}
+
+	if len(r.methods) > 0 && !slices.Contains(r.methods, req.Method) {
+		return false
+	}
+
+	return true
+}
+
+// allows returns true if the rule allows the authenticated user to access the application
+func (r *portalRule) allows(ec *conditions.EvalContext) bool {
+	switch r.action {
+	case config.RuleActionDeny:
+		// With no condition, a deny rule denies everyone
+		return r.predicate != nil && !r.predicate(ec)
+	default:
+		return r.predicate == nil || r.predicate(ec)
+	}
+}
+
+// getForwardedRequest returns the properties of the request forwarded by Traefik, which rules and conditions are matched against
+// The path is resolved only when a rule or condition needs it
+// The result is cached in the request state, so it's computed at most once per request
+func getForwardedRequest(c *gin.Context) *conditions.Request {
+	rs := getRequestState(c)
+	if rs != nil && rs.forwardedRequest != nil {
+		return rs.forwardedRequest
+	}
+
+	h := c.Request.Header
+
+	// Host names are case-insensitive, and rules don't include the port
+	host := requestHost(c)
+	hostname, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = hostname
+	}
+
+	forwardedURI := headerValue(h, headerXForwardedURI)
+	req := &conditions.Request{
+		Method: strings.ToUpper(headerValue(h, headerXForwardedMethod)),
+		Host:   strings.ToLower(host),
+		Header: h,
+		ResolvePath: func() (string, error) {
+			return getForwardedPath(forwardedURI)
+		},
+	}
+
+	// The client IP was extracted from X-Forwarded-For by MiddlewareProxyHeaders
+	if rs != nil {
+		if rs.clientIP != "" {
+			req.ClientIP, _ = netip.ParseAddr(rs.clientIP)
+		}
+		rs.forwardedRequest = req
+	}
+
+	return req
+}
+
+// getDirectRequest returns the properties of a request made to Traefik Forward Auth directly, such as those for the admin API, which conditions are matched against
+func getDirectRequest(c *gin.Context) *conditions.Request {
+	host := c.Request.Host
+	hostname, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = hostname
+	}
+
+	req := &conditions.Request{
+		Method: c.Request.Method,
+		Host:   strings.ToLower(host),
+		Path:   c.Request.URL.Path,
+		Header: c.Request.Header,
+	}
+	req.ClientIP, _ = netip.ParseAddr(c.ClientIP())
+
+	return req
+}
+
+// getForwardedPath returns the decoded and normalized path from the value of the X-Forwarded-Uri header
+// Paths are normalized so requests such as "/public/../admin" can't be used to bypass the rules, since they're resolved by the application as "/admin"
+// Paths that contain encoded slashes, backslashes, or dots are rejected: applications may or may not decode them before routing, so there's no normalized path that is guaranteed to match what the application sees
+// For example, "/admin%2F..%2Fpublic" would be matched as "/public", while the application could route it under "/admin"
+func getForwardedPath(forwardedURI string) (string, error) {
+	if forwardedURI == "" {
+		return "/", nil
+	}
+
+	// Traefik sends the request URI in origin form (path and query), so we don't use url.Parse, which would interpret a path such as "//admin/users" as containing a host
+	rawPath, _, _ := strings.Cut(forwardedURI, "?")
+	if hasEncodedPathSeparator(rawPath) {
+		return "", errors.New("the forwarded URI contains encoded path separators or dots")
+	}
+
+	p, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", errors.New("failed to parse the forwarded URI")
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+
+	// path.Clean removes the trailing slash, which we need to keep as it can be significant for the application
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned, nil
+}
+
+// hasEncodedPathSeparator returns true if the path contains a percent-encoded slash, backslash, or dot
+func hasEncodedPathSeparator(rawPath string) bool {
+	lower := strings.ToLower(rawPath)
+	return strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") || strings.Contains(lower, "%2e")
+}
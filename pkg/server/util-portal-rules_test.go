@@ -0,0 +1,208 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils/conditions"
+)
+
+func TestGetForwardedPath(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "", want: "/"},
+		{uri: "/", want: "/"},
+		{uri: "/admin/users?page=2", want: "/admin/users"},
+		{uri: "/admin/", want: "/admin/"},
+		{uri: "/public/../admin", want: "/admin"},
+		{uri: "/caf%C3%A9/menu", want: "/café/menu"},
+		{uri: "/admin/users?redirect=%2F..%2Fpublic", want: "/admin/users"},
+		{uri: "//admin//users/./", want: "/admin/users/"},
+		{uri: "/../../etc", want: "/etc"},
+		{uri: "//admin/users", want: "/admin/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := getForwardedPath(tt.uri)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("invalid URI", func(t *testing.T) {
+		_, err := getForwardedPath("/%zz")
+		require.Error(t, err)
+	})
+
+	t.Run("encoded separators and dots", func(t *testing.T) {
+		for _, uri := range []string{
+			"/admin%2F..%2Fpublic",
+			"/admin%2f..%2fpublic",
+			"/public%2F..%2Fadmin",
+			"/public/%2e%2e/admin",
+			"/admin/%2E%2E/public",
+			"/admin%5C..%5Cpublic",
+			"/admin%5c",
+			"/admin/.%2e/public",
+		} {
+			_, err := getForwardedPath(uri)
+			require.Error(t, err, uri)
+		}
+	})
+}
+
+func TestGetForwardedRequest(t *testing.T) {
+	s := &Server{}
+
+	newContext := func(headers map[string]string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "http://auth.example.com/portals/test1", nil)
+		for k, v := range headers {
+			c.Request.Header.Set(k, v)
+		}
+		s.MiddlewareAddRequestState(c)
+		return c
+	}
+
+	t.Run("forwarded request", func(t *testing.T) {
+		c := newContext(map[string]string{
+			headerXForwardedHost:   "App.Example.com:8443",
+			headerXForwardedURI:    "/admin?x=1",
+			headerXForwardedMethod: "post",
+		})
+		getRequestState(c).clientIP = "10.1.2.3"
+
+		req := getForwardedRequest(c)
+		assert.Equal(t, "app.example.com", req.Host)
+		p, ok := req.GetPath()
+		assert.True(t, ok)
+		assert.Equal(t, "/admin", p)
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, netip.MustParseAddr("10.1.2.3"), req.ClientIP)
+
+		// The result is cached in the request state
+		assert.Same(t, req, getForwardedRequest(c))
+	})
+
+	t.Run("falls back to the request's host", func(t *testing.T) {
+		req := getForwardedRequest(newContext(nil))
+		assert.Equal(t, "auth.example.com", req.Host)
+		p, ok := req.GetPath()
+		assert.True(t, ok)
+		assert.Equal(t, "/", p)
+		assert.False(t, req.ClientIP.IsValid())
+	})
+
+	t.Run("ambiguous URI", func(t *testing.T) {
+		for _, uri := range []string{"/%zz", "/api/v4/projects/group%2Fproject"} {
+			req := getForwardedRequest(newContext(map[string]string{headerXForwardedURI: uri}))
+			_, ok := req.GetPath()
+			assert.False(t, ok, uri)
+		}
+	})
+}
+
+func TestPortalRuleMatches(t *testing.T) {
+	rules := getRulesConfig(config.ConfigPortal{
+		Rules: []config.ConfigPortalRule{
+			{PathPrefix: "/public/", Action: config.RuleActionPublic},
+			{Host: "*.example.com", Methods: []string{"DELETE"}, Action: config.RuleActionDeny},
+			{PathPrefix: "/"},
+		},
+	})
+	rules = append(rules, portalRule{pathRegexp: regexp.MustCompile(`^/api/v[0-9]+/`)})
+
+	tests := []struct {
+		name string
+		req  *conditions.Request
+		want int
+	}{
+		{name: "prefix with trailing slash", req: &conditions.Request{Host: "app.example.com", Path: "/public", Method: "GET"}, want: 0},
+		{name: "prefix matches sub-paths", req: &conditions.Request{Host: "app.example.com", Path: "/public/css/app.css", Method: "GET"}, want: 0},
+		{name: "prefix matches whole segments", req: &conditions.Request{Host: "app.example.com", Path: "/publications", Method: "DELETE"}, want: 1},
+		{name: "host and method", req: &conditions.Request{Host: "app.example.com", Path: "/items", Method: "DELETE"}, want: 1},
+		{name: "host not matching", req: &conditions.Request{Host: "example.org", Path: "/items", Method: "DELETE"}, want: 2},
+		{name: "root prefix matches all paths", req: &conditions.Request{Host: "app.example.com", Path: "/items", Method: "GET"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := matchPortalRule(rules, tt.req)
+			require.NotNil(t, rule)
+			assert.Same(t, &rules[tt.want], rule)
+		})
+	}
+
+	t.Run("path regex", func(t *testing.T) {
+		assert.True(t, rules[3].matches(&conditions.Request{Path: "/api/v2/items"}))
+		assert.False(t, rules[3].matches(&conditions.Request{Path: "/api/items"}))
+	})
+
+	t.Run("no rule matching", func(t *testing.T) {
+		assert.Nil(t, matchPortalRule(rules[:2], &conditions.Request{Host: "example.org", Path: "/", Method: "GET"}))
+	})
+
+	t.Run("ambiguous path", func(t *testing.T) {
+		newRequest := func(host string, method string) *conditions.Request {
+			return &conditions.Request{
+				Host:   host,
+				Method: method,
+				ResolvePath: func() (string, error) {
+					return getForwardedPath("/public%2F..%2Fadmin")
+				},
+			}
+		}
+
+		// Rules with conditions on the path deny the request
+		assert.Same(t, &ambiguousPathRule, matchPortalRule(rules, newRequest("app.example.com", "GET")))
+		assert.False(t, rules[0].matches(newRequest("app.example.com", "GET")))
+
+		// Rules without conditions on the path can match before that
+		assert.Same(t, &rules[1], matchPortalRule(rules[1:], newRequest("app.example.com", "DELETE")))
+
+		// The path is not resolved if no rule needs it
+		req := &conditions.Request{
+			Host:   "example.org",
+			Method: "DELETE",
+			ResolvePath: func() (string, error) {
+				panic("path should not be resolved")
+			},
+		}
+		assert.Nil(t, matchPortalRule(rules[1:2], req))
+	})
+}
+
+func TestPortalRuleAllows(t *testing.T) {
+	admins := func(ec *conditions.EvalContext) bool {
+		return ec.Profile.ID == "admin"
+	}
+	admin := &conditions.EvalContext{Profile: &user.Profile{ID: "admin"}}
+	other := &conditions.EvalContext{Profile: &user.Profile{ID: "other"}}
+
+	allow := portalRule{action: config.RuleActionAllow}
+	assert.True(t, allow.allows(other))
+
+	allowAdmins := portalRule{action: config.RuleActionAllow, predicate: admins}
+	assert.True(t, allowAdmins.allows(admin))
+	assert.False(t, allowAdmins.allows(other))
+
+	deny := portalRule{action: config.RuleActionDeny}
+	assert.False(t, deny.allows(admin))
+
+	denyAdmins := portalRule{action: config.RuleActionDeny, predicate: admins}
+	assert.False(t, denyAdmins.allows(admin))
+	assert.True(t, denyAdmins.allows(other))
+}
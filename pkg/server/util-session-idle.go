@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// extendIdleSession re-issues the session cookie with a new expiration when the portal has an idle timeout and less than half of the idle timeout is left before the session token expires
+// The new token never expires after the end of the session's lifetime
+func (s *Server) extendIdleSession(c *gin.Context, portal *Portal, entry tokenCacheEntry, cacheKey uint64) error {
+	if portal.IdleTimeout <= 0 || entry.token == nil || entry.profile == nil {
+		return nil
+	}
+
+	// Check if the token is close to the idle timeout
+	exp, ok := entry.token.Expiration()
+	if !ok || time.Until(exp) > portal.IdleTimeout/2 {
+		return nil
+	}
+
+	// Tokens that were issued before the idle timeout was enabled don't have a session expiration, and tokens that already expire at the end of the session can't be extended
+	prevClaims := sessionClaimsFromToken(entry.token)
+	if prevClaims.sessionExpiresAt.IsZero() || !prevClaims.sessionExpiresAt.After(exp) {
+		return nil
+	}
+
+	cookieDomain, _, ok := cookieDomainForContext(c)
+	if !ok {
+		return errors.New("request host does not match any configured cookie domain")
+	}
+
+	// Concurrent requests with the same session token share the same operation, so the token is re-issued only once
+	// This uses the same group as session refreshes, as both replace the session token
+	res, err, _ := s.sessionRefreshes.Do(strconv.FormatUint(cacheKey, 16), func() (any, error) {
+		// If the session was already renewed by another request, re-use the renewed token
+		cached, ok := s.tokenCache.Get(cacheKey)
+		if ok && cached.raw == entry.raw && cached.renewedToken != "" {
+			return cached.renewedToken, nil
+		}
+
+		// Use a context that isn't canceled if the client disconnects, as the result is shared with other requests
+		ctx := context.WithoutCancel(c.Request.Context())
+		renewed, err := s.newSessionToken(ctx, portal.Name, entry.profile, prevClaims, portal.SessionLifetime, cookieDomain)
+		if err != nil {
+			return nil, err
+		}
+
+		// Store the renewed token in the entry for the previous token
+		// The previous token remains valid until it expires, so requests that still carry it are given the renewed token
+		entry.renewedToken = renewed
+		s.tokenCache.Set(cacheKey, entry, computeTokenCacheTTL(entry.token, false))
+
+		return renewed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-issue session token: %w", err)
+	}
+	renewed, _ := res.(string)
+
+	// Load the renewed token, which also adds it to the cache
+	_, _, err = s.loadSessionToken(c.Request.Context(), renewed, portal.Name, cookieDomain)
+	if err != nil {
+		return fmt.Errorf("failed to load renewed session token: %w", err)
+	}
+
+	// Set the new session cookie, which expires at the end of the session
+	err = s.writeSessionCookie(c, portal.Name, renewed, time.Until(prevClaims.sessionExpiresAt), cookieDomain)
+	if err != nil {
+		return fmt.Errorf("failed to set session cookie: %w", err)
+	}
+
+	return nil
+}
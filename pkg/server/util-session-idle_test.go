@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestSessionIdleTimeout(t *testing.T) {
+	const portalName = "test1"
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].IdleTimeout = 10 * time.Minute
+	}))
+
+	srv, _ := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	cookieName := config.Get().Cookies.CookieName(portalName)
+	portal := srv.portals[portalName]
+	require.Equal(t, 10*time.Minute, portal.IdleTimeout)
+
+	profile := &user.Profile{
+		Provider: "testoauth2",
+		ID:       "test-user-1",
+		Name:     user.ProfileName{FullName: "Test User 1"},
+	}
+
+	// Issues a token that expires after the given idle timeout
+	newToken := func(t *testing.T, idleTimeout time.Duration, claims sessionClaims) string {
+		t.Helper()
+
+		portal.IdleTimeout = idleTimeout
+		defer func() {
+			portal.IdleTimeout = 10 * time.Minute
+		}()
+
+		token, err := srv.newSessionToken(t.Context(), portalName, profile, claims, portal.SessionLifetime, "example.com")
+		require.NoError(t, err)
+		return token
+	}
+
+	doRequest := func(t *testing.T, token string) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet,
+			fmt.Sprintf("http://localhost:%d/portals/%s", testServerPort, portalName), nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: token}) //nolint:gosec
+		populateRequiredProxyHeaders(t, req)
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		closeBody(res)
+		return res
+	}
+
+	sessionCookie := func(res *http.Response) *http.Cookie {
+		for _, c := range res.Cookies() {
+			if c.Name == cookieName {
+				return c
+			}
+		}
+		return nil
+	}
+
+	t.Run("token expires after the idle timeout", func(t *testing.T) {
+		token := newToken(t, 10*time.Minute, sessionClaims{})
+
+		parsed, err := srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+		require.NoError(t, err)
+		exp, _ := parsed.Expiration()
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), exp, 5*time.Second)
+		sc := sessionClaimsFromToken(parsed)
+		assert.WithinDuration(t, time.Now().Add(portal.SessionLifetime), sc.sessionExpiresAt, 5*time.Second)
+	})
+
+	t.Run("recently issued token is not re-issued", func(t *testing.T) {
+		res := doRequest(t, newToken(t, 10*time.Minute, sessionClaims{}))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, sessionCookie(res))
+	})
+
+	t.Run("token near the idle timeout is re-issued", func(t *testing.T) {
+		token := newToken(t, 2*time.Minute, sessionClaims{})
+		prev, err := srv.parseSessionToken(t.Context(), token, portalName, "example.com")
+		require.NoError(t, err)
+		sessionExpiresAt := sessionClaimsFromToken(prev).sessionExpiresAt
+
+		res := doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "test-user-1", res.Header.Get("X-Forwarded-User"))
+
+		renewed := sessionCookie(res)
+		require.NotNil(t, renewed)
+		require.NotEqual(t, token, renewed.Value)
+		assert.InDelta(t, time.Until(sessionExpiresAt).Seconds(), renewed.MaxAge, 5)
+
+		parsed, err := srv.parseSessionToken(t.Context(), renewed.Value, portalName, "example.com")
+		require.NoError(t, err)
+		exp, _ := parsed.Expiration()
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), exp, 5*time.Second)
+		assert.Equal(t, sessionExpiresAt.Unix(), sessionClaimsFromToken(parsed).sessionExpiresAt.Unix())
+
+		// Requests that still have the previous token receive the same renewed token
+		res = doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		again := sessionCookie(res)
+		require.NotNil(t, again)
+		assert.Equal(t, renewed.Value, again.Value)
+	})
+
+	t.Run("re-issued token does not extend the session", func(t *testing.T) {
+		sessionExpiresAt := time.Now().Add(3 * time.Minute).Truncate(time.Second)
+		token := newToken(t, 2*time.Minute, sessionClaims{sessionExpiresAt: sessionExpiresAt})
+
+		res := doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		renewed := sessionCookie(res)
+		require.NotNil(t, renewed)
+
+		parsed, err := srv.parseSessionToken(t.Context(), renewed.Value, portalName, "example.com")
+		require.NoError(t, err)
+		exp, _ := parsed.Expiration()
+		assert.Equal(t, sessionExpiresAt.Unix(), exp.Unix())
+	})
+
+	t.Run("re-issued token keeps the time the session was created", func(t *testing.T) {
+		issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+		token := newToken(t, 2*time.Minute, sessionClaims{issuedAt: issuedAt})
+
+		res := doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		renewed := sessionCookie(res)
+		require.NotNil(t, renewed)
+
+		parsed, err := srv.parseSessionToken(t.Context(), renewed.Value, portalName, "example.com")
+		require.NoError(t, err)
+		iat, _ := parsed.IssuedAt()
+		assert.Equal(t, issuedAt.Unix(), iat.Unix())
+	})
+
+	t.Run("token at the end of the session is not re-issued", func(t *testing.T) {
+		token := newToken(t, 10*time.Minute, sessionClaims{sessionExpiresAt: time.Now().Add(2 * time.Minute)})
+
+		res := doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, sessionCookie(res))
+	})
+}
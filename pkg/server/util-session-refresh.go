@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v4/jwt"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+// newSessionClaimsForAccessToken returns the session claims for a session created with an OAuth2 access token
+// When session refresh is enabled for the portal, the refresh token is encrypted and included in the claims
+// When provider logout is enabled for the portal, the ID token is included in the claims
+func newSessionClaimsForAccessToken(portal *Portal, profile *user.Profile, at auth.OAuth2AccessToken) (sessionClaims, error) {
+	var claims sessionClaims
+
+	// Get the subject and session ID at the identity provider from the ID token, which are used to match back-channel logout requests
+	// The ID token was received from the identity provider's token endpoint directly, so its signature doesn't need to be verified again here
+	if at.IDToken != "" {
+		idToken, err := jwt.ParseInsecure([]byte(at.IDToken))
+		if err == nil {
+			claims.providerSubject, _ = idToken.Subject()
+			claims.providerSessionID, _ = jwt.Get[string](idToken, "sid")
+		}
+	}
+
+	if portal.SessionRefresh && at.RefreshToken != "" {
+		enc, err := encryptRefreshToken(config.Get().GetRefreshTokenKey(), at.RefreshToken, refreshTokenAAD(portal.Name, profile))
+		if err != nil {
+			return sessionClaims{}, fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+		claims.refreshToken = enc
+	}
+
+	if portal.ProviderLogout {
+		claims.idToken = at.IDToken
+	}
+
+	return claims, nil
+}
+
+// refreshSession renews the session in the entry if it's about to expire and it contains a refresh token
+// When the session is renewed, the new session cookie is set in the response, and the method returns the cache entry and key for the renewed token
+// Otherwise, it returns the entry and key that were passed
+// If the identity provider rejected the refresh token, the returned error wraps auth.ErrTokenRequestRejected
+func (s *Server) refreshSession(c *gin.Context, portal *Portal, entry tokenCacheEntry, cacheKey uint64) (tokenCacheEntry, uint64, error) {
+	// Check if the session is within the refresh window
+	// When the portal has an idle timeout, this is based on the session's expiration rather than the token's
+	prevClaims := sessionClaimsFromToken(entry.token)
+	exp := prevClaims.sessionExpiresAt
+	if exp.IsZero() {
+		exp, _ = entry.token.Expiration()
+	}
+	if exp.IsZero() || time.Until(exp) > portal.SessionRefreshWindow {
+		return entry, cacheKey, nil
+	}
+
+	// The session can only be renewed if it has a refresh token and it was issued by an OAuth2 provider
+	if prevClaims.refreshToken == "" {
+		return entry, cacheKey, nil
+	}
+	provider, ok := entry.provider.(auth.OAuth2Provider)
+	if !ok {
+		return entry, cacheKey, nil
+	}
+
+	cookieDomain, _, ok := cookieDomainForContext(c)
+	if !ok {
+		return tokenCacheEntry{}, 0, errors.New("request host does not match any configured cookie domain")
+	}
+
+	// Concurrent requests with the same session token share the same refresh operation
+	// This matters because many identity providers rotate refresh tokens, so a refresh token can be used only once
+	res, err, _ := s.sessionRefreshes.Do(strconv.FormatUint(cacheKey, 16), func() (any, error) {
+		// If the session was already renewed by another request, re-use the renewed token
+		cached, ok := s.tokenCache.Get(cacheKey)
+		if ok && cached.raw == entry.raw && cached.renewedToken != "" {
+			return cached.renewedToken, nil
+		}
+
+		// Use a context that isn't canceled if the client disconnects, as the result is shared with other requests
+		ctx := context.WithoutCancel(c.Request.Context())
+		renewed, err := s.renewSessionToken(ctx, portal, entry.profile, provider, prevClaims, cookieDomain)
+		if err != nil {
+			return nil, err
+		}
+
+		// Store the renewed token in the entry for the previous token
+		entry.renewedToken = renewed
+		s.tokenCache.Set(cacheKey, entry, computeTokenCacheTTL(entry.token, false))
+
+		return renewed, nil
+	})
+	if err != nil {
+		return tokenCacheEntry{}, 0, err
+	}
+	renewed, _ := res.(string)
+
+	// Load the profile from the renewed token, which also adds it to the cache
+	renewedEntry, renewedCacheKey, err := s.loadSessionToken(c.Request.Context(), renewed, portal.Name, cookieDomain)
+	if err != nil {
+		return tokenCacheEntry{}, 0, fmt.Errorf("failed to load renewed session token: %w", err)
+	}
+
+	// Set the new session cookie
+	err = s.writeSessionCookie(c, portal.Name, renewed, portal.SessionLifetime, cookieDomain)
+	if err != nil {
+		return tokenCacheEntry{}, 0, fmt.Errorf("failed to set session cookie: %w", err)
+	}
+
+	s.requestLogger(c).DebugContext(c.Request.Context(), "Renewed session using the refresh token",
+		slog.String("provider", provider.GetProviderName()),
+		slog.String("subject", renewedEntry.profile.ID),
+	)
+
+	return renewedEntry, renewedCacheKey, nil
+}
+
+// renewSessionToken uses the refresh token to retrieve an updated user profile from the identity provider, then returns a new session token
+// The new session token keeps the same session ID, if any
+func (s *Server) renewSessionToken(ctx context.Context, portal *Portal, profile *user.Profile, provider auth.OAuth2Provider, prevClaims sessionClaims, cookieDomain string) (string, error) {
+	// The refresh token may have been encrypted with a key derived from a previous token signing key, so try all keys
+	var (
+		refreshToken string
+		err          error
+	)
+	aad := refreshTokenAAD(portal.Name, profile)
+	for _, key := range config.Get().GetRefreshTokenDecryptionKeys() {
+		refreshToken, err = decryptRefreshToken(key, prevClaims.refreshToken, aad)
+		if err == nil {
+			break
+		}
+	}
+	if refreshToken == "" {
+		if err == nil {
+			err = errors.New("refresh token key is not set")
+		}
+		return "", fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+
+	at, err := provider.OAuth2RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh access token: %w", err)
+	}
+
+	newProfile, err := provider.OAuth2RetrieveProfile(ctx, at)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve user profile: %w", err)
+	}
+
+	// The session must continue to belong to the same user
+	if newProfile.ID != profile.ID {
+		return "", errors.New("user profile returned by the identity provider is for a different user")
+	}
+
+	// The authentication methods are those used when the user signed in, such as a TOTP second factor
+	newProfile.AMR = profile.AMR
+
+	claims, err := newSessionClaimsForAccessToken(portal, newProfile, at)
+	if err != nil {
+		return "", err
+	}
+	claims.sessionID = prevClaims.sessionID
+	claims.issuedAt = prevClaims.issuedAt
+
+	// Identity providers may not return a new ID token when the access token is refreshed
+	if claims.idToken == "" {
+		claims.idToken = prevClaims.idToken
+	}
+
+	return s.newSessionToken(ctx, portal.Name, newProfile, claims, portal.SessionLifetime, cookieDomain)
+}
+
+// refreshTokenAAD returns the additional authenticated data used when encrypting refresh tokens
+// This binds the encrypted refresh token to the portal, provider, and user it was issued for
+func refreshTokenAAD(portalName string, profile *user.Profile) []byte {
+	return []byte("tfa-rt\x00" + portalName + "\x00" + profile.Provider + "\x00" + profile.ID)
+}
+
+// encryptRefreshToken encrypts a refresh token with AES-GCM
+// The result is the base64url-encoded concatenation of the nonce and the ciphertext
+func encryptRefreshToken(key []byte, refreshToken string, aad []byte) (string, error) {
+	gcm, err := newRefreshTokenAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	out := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(refreshToken)+gcm.Overhead())
+	_, err = io.ReadFull(rand.Reader, out)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out = gcm.Seal(out, out, []byte(refreshToken), aad)
+
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// decryptRefreshToken decrypts a refresh token encrypted with encryptRefreshToken
+func decryptRefreshToken(key []byte, enc string, aad []byte) (string, error) {
+	gcm, err := newRefreshTokenAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("invalid encoding: %w", err)
+	}
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func newRefreshTokenAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errors.New("refresh token key is not set")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
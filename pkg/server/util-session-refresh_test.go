@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/auth"
+	"github.com/italypaleale/traefik-forward-auth/pkg/config"
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestRefreshTokenEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	profile := &user.Profile{Provider: "testoauth2", ID: "user-1"}
+	aad := refreshTokenAAD("test1", profile)
+
+	t.Run("round trip", func(t *testing.T) {
+		enc, err := encryptRefreshToken(key, "my-refresh-token", aad)
+		require.NoError(t, err)
+		assert.NotContains(t, enc, "my-refresh-token")
+
+		dec, err := decryptRefreshToken(key, enc, aad)
+		require.NoError(t, err)
+		assert.Equal(t, "my-refresh-token", dec)
+	})
+
+	t.Run("encryption is not deterministic", func(t *testing.T) {
+		enc1, err := encryptRefreshToken(key, "my-refresh-token", aad)
+		require.NoError(t, err)
+		enc2, err := encryptRefreshToken(key, "my-refresh-token", aad)
+		require.NoError(t, err)
+		assert.NotEqual(t, enc1, enc2)
+	})
+
+	t.Run("bound to the user", func(t *testing.T) {
+		enc, err := encryptRefreshToken(key, "my-refresh-token", aad)
+		require.NoError(t, err)
+
+		_, err = decryptRefreshToken(key, enc, refreshTokenAAD("test1", &user.Profile{Provider: "testoauth2", ID: "user-2"}))
+		require.Error(t, err)
+		_, err = decryptRefreshToken(key, enc, refreshTokenAAD("test2", profile))
+		require.Error(t, err)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		enc, err := encryptRefreshToken(key, "my-refresh-token", aad)
+		require.NoError(t, err)
+
+		_, err = decryptRefreshToken([]byte("fedcba9876543210fedcba9876543210"), enc, aad)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := decryptRefreshToken(key, "not base64!", aad)
+		require.Error(t, err)
+		_, err = decryptRefreshToken(key, "AAAA", aad)
+		require.ErrorContains(t, err, "too short")
+	})
+}
+
+func TestSessionRefresh(t *testing.T) {
+	const portalName = "test1"
+
+	t.Cleanup(config.SetTestConfig(func(c *config.Config) {
+		c.Portals[0].SessionRefresh = true
+	}))
+
+	srv, logBuf := newTestServer(t)
+	require.NotNil(t, srv)
+	startTestServer(t, srv)
+	appClient := clientForListener(srv.appListener)
+
+	cookieName := config.Get().Cookies.CookieName(portalName)
+	portal := srv.portals[portalName]
+	require.True(t, portal.SessionRefresh)
+	require.Equal(t, 15*time.Minute, portal.SessionRefreshWindow)
+
+	newToken := func(t *testing.T, refreshToken string, expiration time.Duration) string {
+		t.Helper()
+
+		profile := &user.Profile{
+			Provider: "testoauth2",
+			ID:       "test-user-1",
+			Name:     user.ProfileName{FullName: "Test User 1"},
+		}
+		claims, err := newSessionClaimsForAccessToken(portal, profile, auth.OAuth2AccessToken{RefreshToken: refreshToken})
+		require.NoError(t, err)
+		token, err := srv.newSessionToken(t.Context(), portalName, profile, claims, expiration, "example.com")
+		require.NoError(t, err)
+		return token
+	}
+
+	doRequest := func(t *testing.T, token string) *http.Response {
+		t.Helper()
+
+		reqCtx, reqCancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer reqCancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet,
+			fmt.Sprintf("http://localhost:%d/portals/%s", testServerPort, portalName), nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: token}) //nolint:gosec
+		populateRequiredProxyHeaders(t, req)
+
+		res, err := appClient.Do(req)
+		require.NoError(t, err)
+		closeBody(res)
+		return res
+	}
+
+	sessionCookie := func(res *http.Response) *http.Cookie {
+		for _, c := range res.Cookies() {
+			if c.Name == cookieName {
+				return c
+			}
+		}
+		return nil
+	}
+
+	t.Run("session not near expiry is not renewed", func(t *testing.T) {
+		res := doRequest(t, newToken(t, "refresh~test-user-1", time.Hour))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, sessionCookie(res))
+	})
+
+	t.Run("session without refresh token is not renewed", func(t *testing.T) {
+		res := doRequest(t, newToken(t, "", 5*time.Minute))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, sessionCookie(res))
+	})
+
+	t.Run("session near expiry is renewed", func(t *testing.T) {
+		token := newToken(t, "refresh~test-user-1", 5*time.Minute)
+
+		res := doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "test-user-1", res.Header.Get("X-Forwarded-User"))
+
+		renewed := sessionCookie(res)
+		require.NotNil(t, renewed)
+		require.NotEqual(t, token, renewed.Value)
+		assert.Equal(t, int(portal.SessionLifetime.Seconds())-1, renewed.MaxAge)
+
+		parsed, err := srv.parseSessionToken(t.Context(), renewed.Value, portalName, "example.com")
+		require.NoError(t, err)
+		exp, _ := parsed.Expiration()
+		assert.WithinDuration(t, time.Now().Add(portal.SessionLifetime), exp, 5*time.Second)
+		rt, _ := jwt.Get[string](parsed, refreshTokenClaim)
+		assert.NotEmpty(t, rt)
+
+		// Requests that still have the previous token receive the same renewed token
+		res = doRequest(t, token)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		again := sessionCookie(res)
+		require.NotNil(t, again)
+		assert.Equal(t, renewed.Value, again.Value)
+	})
+
+	t.Run("session is terminated when the refresh token is rejected", func(t *testing.T) {
+		res := doRequest(t, newToken(t, "refresh~revoked-user", 5*time.Minute))
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		assert.Equal(t, "/portals/"+portalName+"/signin", urlMustParse(t, res.Header.Get("Location")).Path)
+
+		c := sessionCookie(res)
+		require.NotNil(t, c)
+		assert.Empty(t, c.Value)
+		assert.Contains(t, logBuf.String(), "rejected the refresh token")
+	})
+
+	t.Run("session is kept when the refresh fails", func(t *testing.T) {
+		res := doRequest(t, newToken(t, "not-a-valid-token", 5*time.Minute))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, sessionCookie(res))
+		assert.Contains(t, logBuf.String(), "Failed to renew the session")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
 	"strings"
@@ -119,36 +120,77 @@ func generateNonce() string {
 	return hex.EncodeToString(nonceBytes)
 }
 
-func (s *Server) renderSigninTemplate(c *gin.Context, portal *Portal, stateCookieID string, nonce string, logoutBanner bool) {
-	conf := config.Get()
+//nolint:revive
+type signingTemplateData_Provider struct {
+	Color       string
+	DisplayName string
+	Href        string
+	Icon        string
+}
 
-	//nolint:revive
-	type signingTemplateData_Provider struct {
-		Color       string
-		DisplayName string
-		Href        string
-		Icon        string
-	}
+//nolint:revive
+type signinTemplateData_LoginForm struct {
+	Action      string
+	State       string
+	Username    string
+	Error       string
+	DisplayName string
+	Icon        string
+	Color       string
+}
 
-	type signinTemplateData struct {
-		Title            string
-		BaseUrl          string
-		FaviconHref      string
-		FaviconType      string
-		FaviconSizes     string
-		Providers        []signingTemplateData_Provider
-		LogoutBanner     bool
-		BackgroundLarge  string
-		BackgroundMedium string
-		UsedIcons        string
-		StyleAsset       string
-		CspNonce         string
-	}
+//nolint:revive
+type signinTemplateData_Passkey struct {
+	// "login", "register", or "registered"
+	Mode        string
+	Action      string
+	State       string
+	Options     string
+	UserName    string
+	Error       string
+	Message     string
+	Link        string
+	DisplayName string
+	Icon        string
+	Color       string
+}
+
+//nolint:revive
+type signinTemplateData_TOTP struct {
+	Action string
+	Error  string
+	// These are set only when users are setting up their authenticator app
+	Account string
+	Secret  string
+	KeyURI  template.URL
+}
+
+type signinTemplateData struct {
+	Title            string
+	BaseUrl          string
+	FaviconHref      string
+	FaviconType      string
+	FaviconSizes     string
+	Providers        []signingTemplateData_Provider
+	LoginForm        *signinTemplateData_LoginForm
+	Passkey          *signinTemplateData_Passkey
+	TOTP             *signinTemplateData_TOTP
+	LogoutBanner     bool
+	BackgroundLarge  string
+	BackgroundMedium string
+	UsedIcons        string
+	StyleAsset       string
+	WebAuthnAsset    string
+	CspNonce         string
+}
+
+func (s *Server) renderSigninTemplate(c *gin.Context, portal *Portal, stateCookieID string, nonce string, logoutBanner bool) {
+	conf := config.Get()
 
 	data := signinTemplateData{
 		Title:            portal.DisplayName,
 		BaseUrl:          conf.Server.BasePath,
-		Providers:        make([]signingTemplateData_Provider, len(portal.Providers)),
+		Providers:        make([]signingTemplateData_Provider, len(portal.SigninProvidersList)),
 		LogoutBanner:     logoutBanner,
 		BackgroundLarge:  portal.PagesBackgroundLarge,
 		BackgroundMedium: portal.PagesBackgroundMedium,
@@ -161,8 +203,8 @@ func (s *Server) renderSigninTemplate(c *gin.Context, portal *Portal, stateCooki
 	}
 
 	var i int
-	usedIcons := make(map[string]struct{}, len(portal.ProvidersList))
-	for _, name := range portal.ProvidersList {
+	usedIcons := make(map[string]struct{}, len(portal.SigninProvidersList))
+	for _, name := range portal.SigninProvidersList {
 		provider := portal.Providers[name]
 
 		icon := provider.GetProviderIcon()
@@ -230,3 +272,113 @@ func (s *Server) renderAuthenticatedTemplate(c *gin.Context, portal *Portal, pro
 	}
 	c.HTML(http.StatusOK, "authenticated.html.tpl", data)
 }
+
+func (s *Server) renderSAMLPostTemplate(c *gin.Context, portal *Portal, samlResponse string, relayState string) {
+	conf := config.Get()
+
+	// This page re-submits the SAML response to the Assertion Consumer Service from our own origin
+	type samlPostTemplateData struct {
+		Title         string
+		BaseUrl       string
+		ActionUrl     string
+		SAMLResponse  string
+		RelayState    string
+		ResubmitField string
+		StyleAsset    string
+		CspNonce      string
+	}
+
+	nonce := setPageSecurityHeaders(c, portal)
+	data := samlPostTemplateData{
+		Title:         portal.DisplayName,
+		BaseUrl:       conf.Server.BasePath,
+		ActionUrl:     getSAMLACSURL(c, portal.Name),
+		SAMLResponse:  samlResponse,
+		RelayState:    relayState,
+		ResubmitField: samlResubmitField,
+		StyleAsset:    s.styleAsset,
+		CspNonce:      nonce,
+	}
+	c.HTML(http.StatusOK, "saml-post.html.tpl", data)
+}
+
+// renderLoginFormTemplate renders the signin page with the login form for a form provider
+func (s *Server) renderLoginFormTemplate(c *gin.Context, status int, portal *Portal, provider auth.FormProvider, state string, username string, errMsg string) {
+	conf := config.Get()
+
+	data := signinTemplateData{
+		Title:   portal.DisplayName,
+		BaseUrl: conf.Server.BasePath,
+		LoginForm: &signinTemplateData_LoginForm{
+			Action:      getPortalURI(c, portal.Name) + "/providers/" + provider.GetProviderName() + "/login",
+			State:       state,
+			Username:    username,
+			Error:       errMsg,
+			DisplayName: provider.GetProviderDisplayName(),
+			Icon:        provider.GetProviderIcon(),
+			Color:       provider.GetProviderColor(),
+		},
+		BackgroundLarge:  portal.PagesBackgroundLarge,
+		BackgroundMedium: portal.PagesBackgroundMedium,
+		UsedIcons:        provider.GetProviderIcon(),
+		StyleAsset:       s.styleAsset,
+	}
+	if s.favicon != nil {
+		data.FaviconHref = s.favicon.Path
+		data.FaviconType = s.favicon.LinkType
+		data.FaviconSizes = s.favicon.LinkSizes
+	}
+
+	data.CspNonce = setPageSecurityHeaders(c, portal)
+	c.HTML(status, "signin.html.tpl", data)
+}
+
+// renderPasskeyTemplate renders the signin page with the form to sign in with, or register, a passkey
+func (s *Server) renderPasskeyTemplate(c *gin.Context, status int, portal *Portal, provider auth.WebAuthnProvider, passkey signinTemplateData_Passkey) {
+	conf := config.Get()
+
+	passkey.DisplayName = provider.GetProviderDisplayName()
+	passkey.Icon = provider.GetProviderIcon()
+	passkey.Color = provider.GetProviderColor()
+
+	data := signinTemplateData{
+		Title:            portal.DisplayName,
+		BaseUrl:          conf.Server.BasePath,
+		Passkey:          &passkey,
+		BackgroundLarge:  portal.PagesBackgroundLarge,
+		BackgroundMedium: portal.PagesBackgroundMedium,
+		UsedIcons:        provider.GetProviderIcon(),
+		StyleAsset:       s.styleAsset,
+		WebAuthnAsset:    s.webAuthnAsset,
+	}
+	if s.favicon != nil {
+		data.FaviconHref = s.favicon.Path
+		data.FaviconType = s.favicon.LinkType
+		data.FaviconSizes = s.favicon.LinkSizes
+	}
+
+	data.CspNonce = setPageSecurityHeaders(c, portal)
+	c.HTML(status, "signin.html.tpl", data)
+}
+
+// renderTOTPTemplate renders the signin page with the form to enter a TOTP code
+func (s *Server) renderTOTPTemplate(c *gin.Context, status int, portal *Portal, totp *signinTemplateData_TOTP) {
+	conf := config.Get()
+
+	data := signinTemplateData{
+		Title:            portal.DisplayName,
+		BaseUrl:          conf.Server.BasePath,
+		TOTP:             totp,
+		BackgroundLarge:  portal.PagesBackgroundLarge,
+		BackgroundMedium: portal.PagesBackgroundMedium,
+		StyleAsset:       s.styleAsset,
+	}
+	if s.favicon != nil {
+		data.FaviconHref = s.favicon.Path
+		data.FaviconType = s.favicon.LinkType
+		data.FaviconSizes = s.favicon.LinkSizes
+	}
+
+	data.CspNonce = setPageSecurityHeaders(c, portal)
+	c.HTML(status, "signin.html.tpl", data)
+}
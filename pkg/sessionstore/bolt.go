@@ -0,0 +1,190 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltSessionsBucket = []byte("sessions")
+
+// BoltStore is a Store that keeps sessions in an embedded database on disk, using bbolt.
+// The database file can only be opened by one process at a time.
+type BoltStore struct {
+	db        *bolt.DB
+	lastPurge atomic.Int64
+}
+
+// NewBoltStore returns a new BoltStore, opening (or creating) the database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if path == "" {
+		return nil, errors.New("path for the session store database is required")
+	}
+
+	// The timeout prevents blocking forever if another process has the database open
+	db, err := bolt.Open(path, 0o600, &bolt.Options{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session store database '%s': %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, bErr := tx.CreateBucketIfNotExists(boltSessionsBucket)
+		return bErr
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize session store database: %w", err)
+	}
+
+	b := &BoltStore{
+		db: db,
+	}
+	b.lastPurge.Store(time.Now().Unix())
+	return b, nil
+}
+
+func (b *BoltStore) Put(_ context.Context, session Session) error {
+	if session.ID == "" {
+		return errors.New("session ID is empty")
+	}
+
+	enc, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	now := time.Now()
+	last := b.lastPurge.Load()
+	purge := now.Unix()-last > int64(purgeInterval.Seconds()) && b.lastPurge.CompareAndSwap(last, now.Unix())
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSessionsBucket)
+
+		// Periodically remove expired sessions, so they don't accumulate
+		if purge {
+			_, pErr := deleteMatchingInBucket(bucket, func(s Session) bool {
+				return s.Expired(now)
+			})
+			if pErr != nil {
+				return pErr
+			}
+		}
+
+		return bucket.Put([]byte(session.ID), enc)
+	})
+}
+
+func (b *BoltStore) Get(_ context.Context, id string) (session Session, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(boltSessionsBucket).Get([]byte(id))
+		if val == nil {
+			return ErrSessionNotFound
+		}
+
+		return json.Unmarshal(val, &session)
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	if session.Expired(time.Now()) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (b *BoltStore) List(_ context.Context, filter Filter) ([]Session, error) {
+	now := time.Now()
+	res := make([]Session, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSessionsBucket).ForEach(func(_ []byte, val []byte) error {
+			var s Session
+			uErr := json.Unmarshal(val, &s)
+			if uErr != nil {
+				return fmt.Errorf("failed to decode session: %w", uErr)
+			}
+
+			if !s.Expired(now) && filter.Matches(s) {
+				res = append(res, s)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (b *BoltStore) Delete(_ context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSessionsBucket).Delete([]byte(id))
+	})
+}
+
+func (b *BoltStore) DeleteMatching(_ context.Context, filter Filter) (n int, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		var dErr error
+		n, dErr = deleteMatchingInBucket(tx.Bucket(boltSessionsBucket), filter.Matches)
+		return dErr
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// deleteMatchingInBucket deletes all sessions in the bucket for which the match function returns true
+// It returns the number of sessions deleted that hadn't expired yet
+func deleteMatchingInBucket(bucket *bolt.Bucket, match func(s Session) bool) (int, error) {
+	now := time.Now()
+
+	// Keys cannot be deleted while iterating with ForEach, so we collect them first
+	keys := make([][]byte, 0)
+	var n int
+	err := bucket.ForEach(func(key []byte, val []byte) error {
+		var s Session
+		uErr := json.Unmarshal(val, &s)
+		if uErr != nil {
+			// Remove entries that cannot be decoded
+			keys = append(keys, key)
+			return nil
+		}
+
+		if match(s) {
+			keys = append(keys, key)
+			if !s.Expired(now) {
+				n++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, k := range keys {
+		err = bucket.Delete(k)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// Compile-time interface assertion
+var _ Store = &BoltStore{}
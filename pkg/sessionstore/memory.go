@@ -0,0 +1,102 @@
+package sessionstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps sessions in memory.
+// Sessions are lost when the process is restarted.
+type MemoryStore struct {
+	lock      sync.RWMutex
+	sessions  map[string]Session
+	lastPurge time.Time
+}
+
+// NewMemoryStore returns a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:  make(map[string]Session),
+		lastPurge: time.Now(),
+	}
+}
+
+func (m *MemoryStore) Put(_ context.Context, session Session) error {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// Periodically remove expired sessions, so they don't accumulate
+	if now.Sub(m.lastPurge) > purgeInterval {
+		for id, s := range m.sessions {
+			if s.Expired(now) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastPurge = now
+	}
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (Session, error) {
+	m.lock.RLock()
+	session, ok := m.sessions[id]
+	m.lock.RUnlock()
+
+	if !ok || session.Expired(time.Now()) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *MemoryStore) List(_ context.Context, filter Filter) ([]Session, error) {
+	now := time.Now()
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	res := make([]Session, 0)
+	for _, s := range m.sessions {
+		if !s.Expired(now) && filter.Matches(s) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, id string) error {
+	m.lock.Lock()
+	delete(m.sessions, id)
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *MemoryStore) DeleteMatching(_ context.Context, filter Filter) (int, error) {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// Expired sessions are removed too, but they are not counted
+	var n int
+	for id, s := range m.sessions {
+		if filter.Matches(s) {
+			delete(m.sessions, id)
+			if !s.Expired(now) {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// Compile-time interface assertion
+var _ Store = &MemoryStore{}
@@ -0,0 +1,114 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session doesn't exist, because it was revoked or it has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// purgeInterval is the minimum interval between purges of expired sessions
+const purgeInterval = time.Minute
+
+// Store is the interface for stores that keep track of sessions on the server, so they can be revoked before they expire.
+type Store interface {
+	// Put adds a session to the store, replacing any existing session with the same ID
+	Put(ctx context.Context, session Session) error
+	// Get returns a session by its ID
+	// If the session doesn't exist or it has expired, returns ErrSessionNotFound
+	Get(ctx context.Context, id string) (Session, error)
+	// List returns all sessions that match the filter and that haven't expired
+	List(ctx context.Context, filter Filter) ([]Session, error)
+	// Delete removes a session by its ID
+	// It's not an error if the session doesn't exist
+	Delete(ctx context.Context, id string) error
+	// DeleteMatching removes all sessions that match the filter, and returns the number of sessions removed
+	DeleteMatching(ctx context.Context, filter Filter) (int, error)
+	// Close releases the resources used by the store
+	Close() error
+}
+
+// Session contains the information about a session stored on the server.
+type Session struct {
+	// ID of the session, which is the "jti" claim of the session token
+	ID string `json:"id"`
+	// Name of the portal
+	Portal string `json:"portal"`
+	// Name of the provider
+	Provider string `json:"provider"`
+	// ID of the user
+	UserID string `json:"userId"`
+	// Email address of the user, if any
+	Email string `json:"email,omitempty"`
+	// Subject of the user at the identity provider ("sub" claim of the ID token), if any
+	// This can be different from the user ID for some providers
+	ProviderSubject string `json:"providerSubject,omitempty"`
+	// ID of the session at the identity provider ("sid" claim of the ID token), if any
+	ProviderSessionID string `json:"providerSessionId,omitempty"`
+	// Time the session was created
+	CreatedAt time.Time `json:"createdAt"`
+	// Time the session expires
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired returns true if the session has expired at the given time
+func (s Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.After(now)
+}
+
+// Filter is used to select sessions in List and DeleteMatching.
+// Empty fields match all sessions.
+type Filter struct {
+	// Name of the portal
+	Portal string
+	// Name of the provider
+	Provider string
+	// ID of the user
+	UserID string
+	// Email address of the user
+	// This is matched case-insensitively
+	Email string
+	// Subject of the user at the identity provider
+	ProviderSubject string
+	// ID of the session at the identity provider
+	ProviderSessionID string
+}
+
+// IsEmpty returns true if the filter matches all sessions
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+// Matches returns true if the session matches the filter
+func (f Filter) Matches(s Session) bool {
+	return (f.Portal == "" || f.Portal == s.Portal) &&
+		(f.Provider == "" || f.Provider == s.Provider) &&
+		(f.UserID == "" || f.UserID == s.UserID) &&
+		(f.Email == "" || strings.EqualFold(f.Email, s.Email)) &&
+		(f.ProviderSubject == "" || f.ProviderSubject == s.ProviderSubject) &&
+		(f.ProviderSessionID == "" || f.ProviderSessionID == s.ProviderSessionID)
+}
+
+// New returns a session store of the given type.
+// The value of storeType can be "memory" or "bolt"; for "bolt", path is the location of the database file.
+// If storeType is empty, it returns a nil Store, and sessions are not tracked on the server.
+func New(storeType string, path string) (Store, error) {
+	switch storeType {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		store, err := NewBoltStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported session store type '%s'", storeType)
+	}
+}
@@ -0,0 +1,129 @@
+package sessionstore
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testStore(t, NewMemoryStore())
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		store, err := NewBoltStore(filepath.Join(t.TempDir(), "sessions.db"))
+		require.NoError(t, err)
+		testStore(t, store)
+	})
+}
+
+func testStore(t *testing.T, store Store) {
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+	})
+
+	now := time.Now().Truncate(time.Second)
+	sessions := []Session{
+		{ID: "s1", Portal: "main", Provider: "github", UserID: "u1", Email: "user1@example.com", ProviderSubject: "sub1", ProviderSessionID: "sid1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "s2", Portal: "main", Provider: "google", UserID: "u1", Email: "User1@Example.com", ProviderSubject: "sub1", ProviderSessionID: "sid2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "s3", Portal: "other", Provider: "github", UserID: "u2", Email: "user2@example.com", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "expired", Portal: "main", Provider: "github", UserID: "u1", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+	for _, s := range sessions {
+		require.NoError(t, store.Put(t.Context(), s))
+	}
+
+	listIDs := func(t *testing.T, filter Filter) []string {
+		t.Helper()
+		list, err := store.List(t.Context(), filter)
+		require.NoError(t, err)
+		ids := make([]string, len(list))
+		for i, s := range list {
+			ids[i] = s.ID
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	t.Run("get", func(t *testing.T) {
+		s, err := store.Get(t.Context(), "s1")
+		require.NoError(t, err)
+		assert.Equal(t, "u1", s.UserID)
+		assert.Equal(t, "github", s.Provider)
+		assert.True(t, s.ExpiresAt.Equal(now.Add(time.Hour)))
+	})
+
+	t.Run("get missing or expired", func(t *testing.T) {
+		_, err := store.Get(t.Context(), "missing")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+		_, err = store.Get(t.Context(), "expired")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		assert.Equal(t, []string{"s1", "s2", "s3"}, listIDs(t, Filter{}))
+		assert.Equal(t, []string{"s1", "s2"}, listIDs(t, Filter{Portal: "main"}))
+		assert.Equal(t, []string{"s1", "s3"}, listIDs(t, Filter{Provider: "github"}))
+		assert.Equal(t, []string{"s1", "s2"}, listIDs(t, Filter{Email: "USER1@example.com"}))
+		assert.Equal(t, []string{"s3"}, listIDs(t, Filter{UserID: "u2"}))
+		assert.Empty(t, listIDs(t, Filter{Portal: "main", UserID: "u2"}))
+		assert.Equal(t, []string{"s1", "s2"}, listIDs(t, Filter{ProviderSubject: "sub1"}))
+		assert.Equal(t, []string{"s2"}, listIDs(t, Filter{ProviderSubject: "sub1", ProviderSessionID: "sid2"}))
+	})
+
+	t.Run("put replaces", func(t *testing.T) {
+		s, err := store.Get(t.Context(), "s3")
+		require.NoError(t, err)
+		s.ExpiresAt = now.Add(2 * time.Hour)
+		require.NoError(t, store.Put(t.Context(), s))
+
+		s, err = store.Get(t.Context(), "s3")
+		require.NoError(t, err)
+		assert.True(t, s.ExpiresAt.Equal(now.Add(2*time.Hour)))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, store.Delete(t.Context(), "s3"))
+		_, err := store.Get(t.Context(), "s3")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+
+		// Deleting again is not an error
+		require.NoError(t, store.Delete(t.Context(), "s3"))
+	})
+
+	t.Run("delete matching", func(t *testing.T) {
+		n, err := store.DeleteMatching(t.Context(), Filter{UserID: "u1"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Empty(t, listIDs(t, Filter{}))
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		store, err := New("", "")
+		require.NoError(t, err)
+		assert.Nil(t, store)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		store, err := New("memory", "")
+		require.NoError(t, err)
+		assert.IsType(t, &MemoryStore{}, store)
+	})
+
+	t.Run("bolt requires a path", func(t *testing.T) {
+		_, err := New("bolt", "")
+		require.Error(t, err)
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		_, err := New("redis", "")
+		require.ErrorContains(t, err, "unsupported session store type")
+	})
+}
@@ -0,0 +1,130 @@
+package totp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltEnrollmentsBucket = []byte("enrollments")
+
+// ErrNotFound is returned when a user doesn't have a TOTP enrollment
+var ErrNotFound = errors.New("enrollment not found")
+
+// Enrollment contains the TOTP secret of a user.
+type Enrollment struct {
+	// Secret, encoded as base32 without padding
+	Secret string `json:"secret"`
+	// True if the user has confirmed the enrollment by entering a valid code
+	// Until then, the secret can be shown to the user again
+	Confirmed bool `json:"confirmed"`
+	// Period of the last code that was accepted, which can't be used again
+	LastStep int64 `json:"lastStep,omitempty"`
+	// Time the enrollment was created
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EnrollmentKey returns the key for the enrollment of a user in the store.
+// Users are identified by the portal, the provider they signed in with, and their ID at the provider.
+func EnrollmentKey(portal string, provider string, userID string) string {
+	return portal + "\x00" + provider + "\x00" + userID
+}
+
+// Store keeps the TOTP enrollments of users in an embedded database on disk, using bbolt.
+// The database file can only be opened by one process at a time.
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore returns a new Store, opening (or creating) the database at path
+func NewStore(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("path for the TOTP store database is required")
+	}
+
+	// The timeout prevents blocking forever if another process has the database open
+	db, err := bolt.Open(path, 0o600, &bolt.Options{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TOTP store database '%s': %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, bErr := tx.CreateBucketIfNotExists(boltEnrollmentsBucket)
+		return bErr
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize TOTP store database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Get returns the enrollment for the key
+// If there's no enrollment, returns ErrNotFound
+func (s *Store) Get(_ context.Context, key string) (Enrollment, error) {
+	var e Enrollment
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltEnrollmentsBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &e)
+	})
+	if err != nil {
+		return Enrollment{}, err
+	}
+	return e, nil
+}
+
+// Update invokes fn with the enrollment for the key, and saves the enrollment after fn returns, in a single transaction
+// If there's no enrollment, fn is invoked with found set to false, and it can create it
+// If fn returns an error, no change is made and the error is returned
+func (s *Store) Update(_ context.Context, key string, fn func(e *Enrollment, found bool) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEnrollmentsBucket)
+
+		var e Enrollment
+		data := bucket.Get([]byte(key))
+		if data != nil {
+			err := json.Unmarshal(data, &e)
+			if err != nil {
+				return fmt.Errorf("failed to decode enrollment: %w", err)
+			}
+		}
+
+		err := fn(&e, data != nil)
+		if err != nil {
+			return err
+		}
+
+		enc, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode enrollment: %w", err)
+		}
+		return bucket.Put([]byte(key), enc)
+	})
+}
+
+// Delete removes the enrollment for the key
+// If there's no enrollment, returns ErrNotFound
+func (s *Store) Delete(_ context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEnrollmentsBucket)
+		if bucket.Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// Close releases the resources used by the store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,101 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period of the codes, in seconds
+	period = 30
+	// Number of digits in the codes
+	digits = 6
+	// Size of the secrets, in bytes
+	secretSize = 20
+	// Number of periods before and after the current one for which codes are accepted, to allow for clock skew
+	skewSteps = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, encoded as base32 without padding.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random data: %w", err)
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// Validate checks a code against the secret at the given time, accepting codes from the adjacent periods too.
+// To prevent codes from being replayed, codes are only accepted for periods after lastStep.
+// If the code is valid, it returns the period ("step") it was generated for, which must be stored as lastStep for the next validation.
+func Validate(secret string, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != digits {
+		return 0, false
+	}
+
+	current := now.Unix() / period
+	for s := current - skewSteps; s <= current+skewSteps; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(generateCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// KeyURI returns the "otpauth://" URI for the secret, which can be imported in authenticator apps.
+func KeyURI(issuer string, account string, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(digits))
+	q.Set("period", fmt.Sprint(period))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// generateCode returns the code for the period, as defined by RFC 6238 and RFC 4226
+func generateCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step)) //nolint:gosec
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0F
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
+
+	return fmt.Sprintf("%0*d", digits, v%1_000_000)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	// Authenticator apps display secrets in groups, and some users may copy them with spaces or lowercase letters
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	return secretEncoding.DecodeString(secret)
+}
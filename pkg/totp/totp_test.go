@@ -0,0 +1,122 @@
+package totp
+
+import (
+	"encoding/base32"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	// Test vectors from RFC 6238, appendix B (SHA-1), truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "287082"},
+		{time: 1111111109, code: "081804"},
+		{time: 1111111111, code: "050471"},
+		{time: 1234567890, code: "005924"},
+		{time: 2000000000, code: "279037"},
+		{time: 20000000000, code: "353130"},
+	}
+
+	for _, v := range vectors {
+		t.Run(v.code, func(t *testing.T) {
+			step, ok := Validate(secret, v.code, time.Unix(v.time, 0), 0)
+			require.True(t, ok)
+			assert.Equal(t, v.time/period, step)
+
+			// Codes cannot be reused
+			_, ok = Validate(secret, v.code, time.Unix(v.time, 0), step)
+			assert.False(t, ok)
+		})
+	}
+
+	t.Run("adjacent periods are accepted", func(t *testing.T) {
+		_, ok := Validate(secret, "287082", time.Unix(59+period, 0), 0)
+		assert.True(t, ok)
+		_, ok = Validate(secret, "287082", time.Unix(59-period, 0), 0)
+		assert.True(t, ok)
+		_, ok = Validate(secret, "287082", time.Unix(59+2*period, 0), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "287083", "abcdef"} {
+			_, ok := Validate(secret, code, time.Unix(59, 0), 0)
+			assert.False(t, ok, code)
+		}
+	})
+
+	t.Run("secret is normalized", func(t *testing.T) {
+		_, ok := Validate("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", "287082", time.Unix(59, 0), 0)
+		assert.True(t, ok)
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+	s1, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, s1, 32)
+	s2, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, s1, s2)
+}
+
+func TestKeyURI(t *testing.T) {
+	assert.Equal(t,
+		"otpauth://totp/My%20Portal:alice@example.com?algorithm=SHA1&digits=6&issuer=My+Portal&period=30&secret=ABCDEF",
+		KeyURI("My Portal", "alice@example.com", "ABCDEF"),
+	)
+	assert.Equal(t,
+		"otpauth://totp/alice?algorithm=SHA1&digits=6&period=30&secret=ABCDEF",
+		KeyURI("", "alice", "ABCDEF"),
+	)
+}
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "totp.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	key := EnrollmentKey("main", "github", "alice")
+
+	_, err = store.Get(t.Context(), key)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	err = store.Update(t.Context(), key, func(e *Enrollment, found bool) error {
+		assert.False(t, found)
+		e.Secret = "ABCDEF"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Errors returned by the function abort the update
+	errTest := errors.New("test error")
+	err = store.Update(t.Context(), key, func(e *Enrollment, found bool) error {
+		assert.True(t, found)
+		e.Confirmed = true
+		return errTest
+	})
+	require.ErrorIs(t, err, errTest)
+
+	e, err := store.Get(t.Context(), key)
+	require.NoError(t, err)
+	assert.Equal(t, "ABCDEF", e.Secret)
+	assert.False(t, e.Confirmed)
+
+	// Enrollments are per provider
+	_, err = store.Get(t.Context(), EnrollmentKey("main", "google", "alice"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Delete(t.Context(), key))
+	require.ErrorIs(t, store.Delete(t.Context(), key), ErrNotFound)
+}
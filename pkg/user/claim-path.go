@@ -0,0 +1,153 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClaimPath is a parsed path that selects a value in a JSON document, such as the claims of a user, using a subset of the JSONPath syntax.
+// Supported expressions are:
+//
+// - `name`: the property "name" of an object; the leading `$.` is optional
+// - `user.name`: nested properties
+// - `emails[0]`: the element at the given index of an array
+// - `teams[*].name`: the property "name" of all elements of an array
+// - `["https://example.com/claim"]`: a property whose name contains dots or other special characters
+type ClaimPath []claimPathSegment
+
+type claimPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// ParseClaimPath parses a path with the syntax accepted by ClaimPath
+func ParseClaimPath(path string) (ClaimPath, error) {
+	s := strings.TrimSpace(path)
+	switch {
+	case s == "":
+		return nil, errors.New("path is empty")
+	case s == "$":
+		return nil, errors.New("path must select a property")
+	case strings.HasPrefix(s, "$."):
+		s = s[2:]
+	case strings.HasPrefix(s, "$["):
+		s = s[1:]
+	}
+
+	res := ClaimPath{}
+	for len(s) > 0 {
+		switch s[0] {
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '[' in path '%s'", path)
+			}
+			inner := s[1:end]
+
+			switch {
+			case inner == "*":
+				res = append(res, claimPathSegment{wildcard: true})
+			case len(inner) > 0 && (inner[0] == '"' || inner[0] == '\''):
+				// Quoted keys can contain ']', so look for the closing quote first
+				closing := strings.IndexByte(s[2:], s[1])
+				if closing < 0 || len(s) < closing+4 || s[closing+3] != ']' {
+					return nil, fmt.Errorf("unterminated quoted key in path '%s'", path)
+				}
+				end = closing + 3
+				res = append(res, claimPathSegment{key: s[2 : closing+2]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid array index '%s' in path '%s'", inner, path)
+				}
+				res = append(res, claimPathSegment{index: idx, isIndex: true})
+			}
+			s = s[end+1:]
+		case '.':
+			// A dot must be followed by a property name
+			s = s[1:]
+			if s == "" || s[0] == '.' || s[0] == '[' {
+				return nil, fmt.Errorf("invalid '.' in path '%s'", path)
+			}
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if s[:end] == "*" {
+				res = append(res, claimPathSegment{wildcard: true})
+			} else {
+				res = append(res, claimPathSegment{key: s[:end]})
+			}
+			s = s[end:]
+		}
+	}
+
+	return res, nil
+}
+
+// HasWildcard returns true if the path can select multiple values
+func (p ClaimPath) HasWildcard() bool {
+	for _, seg := range p {
+		if seg.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the value selected by the path in the document.
+// When the path contains a wildcard, the result is a []any with all values that were selected.
+// The second return value is false if the path doesn't select any value.
+func (p ClaimPath) Get(doc any) (any, bool) {
+	cur := []any{doc}
+	for _, seg := range p {
+		next := make([]any, 0, len(cur))
+		for _, v := range cur {
+			switch {
+			case seg.wildcard:
+				switch arr := v.(type) {
+				case []any:
+					next = append(next, arr...)
+				case []string:
+					for _, e := range arr {
+						next = append(next, e)
+					}
+				}
+			case seg.isIndex:
+				switch arr := v.(type) {
+				case []any:
+					if seg.index < len(arr) {
+						next = append(next, arr[seg.index])
+					}
+				case []string:
+					if seg.index < len(arr) {
+						next = append(next, arr[seg.index])
+					}
+				}
+			default:
+				obj, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				val, ok := obj[seg.key]
+				if ok {
+					next = append(next, val)
+				}
+			}
+		}
+		cur = next
+	}
+
+	if p.HasWildcard() {
+		return cur, len(cur) > 0
+	}
+	if len(cur) == 0 || cur[0] == nil {
+		return nil, false
+	}
+	return cur[0], true
+}
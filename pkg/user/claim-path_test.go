@@ -0,0 +1,66 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClaimPath(t *testing.T) {
+	doc := map[string]any{
+		"id": "u1",
+		"data": map[string]any{
+			"user": map[string]any{"email": "u1@example.com"},
+		},
+		"emails": []any{
+			map[string]any{"value": "first@example.com"},
+			map[string]any{"value": "second@example.com"},
+		},
+		"teams": []any{
+			map[string]any{"name": "dev"},
+			map[string]any{"name": "ops"},
+			map[string]any{"slug": "no-name"},
+		},
+		"https://example.com/claim": "dotted",
+	}
+
+	tests := []struct {
+		path     string
+		expected any
+		found    bool
+	}{
+		{path: "id", expected: "u1", found: true},
+		{path: "$.id", expected: "u1", found: true},
+		{path: "data.user.email", expected: "u1@example.com", found: true},
+		{path: "emails[1].value", expected: "second@example.com", found: true},
+		{path: "$.emails[0].value", expected: "first@example.com", found: true},
+		{path: "teams[*].name", expected: []any{"dev", "ops"}, found: true},
+		{path: "teams.*.name", expected: []any{"dev", "ops"}, found: true},
+		{path: `["https://example.com/claim"]`, expected: "dotted", found: true},
+		{path: `$['https://example.com/claim']`, expected: "dotted", found: true},
+		{path: "missing", found: false},
+		{path: "emails[5].value", found: false},
+		{path: "id.nested", found: false},
+		{path: "teams[*].missing", found: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			p, err := ParseClaimPath(tc.path)
+			require.NoError(t, err)
+
+			val, ok := p.Get(doc)
+			assert.Equal(t, tc.found, ok)
+			if tc.found {
+				assert.Equal(t, tc.expected, val)
+			}
+		})
+	}
+
+	t.Run("invalid paths", func(t *testing.T) {
+		for _, path := range []string{"", "$", "a..b", "a.", "a[", "a[x]", "a[-1]", `a["b]`} {
+			_, err := ParseClaimPath(path)
+			require.Errorf(t, err, "expected error for path %q", path)
+		}
+	})
+}
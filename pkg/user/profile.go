@@ -34,6 +34,10 @@ type Profile struct {
 	// Roles
 	Roles []string
 
+	// Authentication methods used to sign in, as in the "amr" claim defined by RFC 8176
+	// For example, this includes "otp" and "mfa" when users completed a TOTP second factor
+	AMR []string
+
 	// Additional claims
 	AdditionalClaims map[string]any
 }
@@ -118,6 +122,11 @@ func NewProfileFromOpenIDToken(token openid.Token, provider string) (*Profile, e
 	profile.Groups = getGroupsClaimFromToken(token, "group")
 	profile.Roles = getGroupsClaimFromToken(token, "role")
 
+	// Authentication methods
+	if v, ok := token.Field("amr"); ok {
+		profile.AMR = cast.ToStringSlice(v)
+	}
+
 	return &profile, nil
 }
 
@@ -168,6 +177,11 @@ func NewProfileFromClaims(claims map[string]any, provider string) (*Profile, err
 	profile.Groups = getGroupsClaimFromMap(claims, "group")
 	profile.Roles = getGroupsClaimFromMap(claims, "role")
 
+	// Authentication methods
+	if v, ok := claims["amr"]; ok {
+		profile.AMR = cast.ToStringSlice(v)
+	}
+
 	return profile, nil
 }
 
@@ -267,6 +281,9 @@ func (p *Profile) AppendClaims(builder *jwt.Builder) {
 	if len(p.Roles) > 0 {
 		builder.Claim("roles", p.Roles)
 	}
+	if len(p.AMR) > 0 {
+		builder.Claim("amr", p.AMR)
+	}
 
 	for k, v := range p.AdditionalClaims {
 		builder.Claim(k, v)
@@ -316,8 +333,21 @@ func (p *Profile) Get(claim string) any {
 		return p.Groups
 	case "roles":
 		return p.Roles
+	case "amr":
+		return p.AMR
 	default:
-		return p.AdditionalClaims[claim]
+		val, ok := p.AdditionalClaims[claim]
+		if ok || !strings.ContainsAny(claim, ".[") {
+			return val
+		}
+
+		// Nested values can be referenced with a path, such as "address.country", "emails[0].value", or `["https://example.com/cap"][0].role`
+		path, err := ParseClaimPath(claim)
+		if err != nil {
+			return nil
+		}
+		val, _ = path.Get(p.AdditionalClaims)
+		return val
 	}
 }
 
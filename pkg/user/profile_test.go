@@ -251,6 +251,57 @@ func TestGetAs(t *testing.T) {
 	})
 }
 
+func TestGetNestedClaims(t *testing.T) {
+	profile := &Profile{
+		ID: "user123",
+		AdditionalClaims: map[string]any{
+			"address": map[string]any{
+				"country": "IT",
+				"geo":     map[string]any{"lat": 45.46},
+			},
+			"wids": []string{"role-1", "role-2"},
+			"https://example.com/cap": []any{
+				map[string]any{"role": "admin"},
+			},
+			"dotted.key": "direct",
+		},
+	}
+
+	tests := []struct {
+		claim    string
+		expected any
+	}{
+		{claim: "address.country", expected: "IT"},
+		{claim: "$.address.country", expected: "IT"},
+		{claim: "address.geo.lat", expected: 45.46},
+		{claim: "wids[1]", expected: "role-2"},
+		{claim: "wids[*]", expected: []any{"role-1", "role-2"}},
+		{claim: `["https://example.com/cap"][0].role`, expected: "admin"},
+		{claim: "dotted.key", expected: "direct"},
+		{claim: `["dotted.key"]`, expected: "direct"},
+		{claim: "address.missing", expected: nil},
+		{claim: "address.country.code", expected: nil},
+		{claim: "wids[2]", expected: nil},
+		{claim: "wids.1", expected: nil},
+		{claim: "https://example.com/cap.0.role", expected: nil},
+		{claim: "wids[-1]", expected: nil},
+		{claim: "wids[first]", expected: nil},
+		{claim: "missing.key", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.claim, func(t *testing.T) {
+			assert.Equal(t, tt.expected, profile.Get(tt.claim))
+		})
+	}
+
+	t.Run("as string", func(t *testing.T) {
+		val, ok := profile.GetString("address.country")
+		assert.True(t, ok)
+		assert.Equal(t, "IT", val)
+	})
+}
+
 func TestGetStringMatchesGetAs(t *testing.T) {
 	// getAsStringReference is the implementation GetAs[string] had before GetString existed
 	getAsStringReference := func(p *Profile, claim string) (val string, ok bool) {
@@ -276,6 +327,7 @@ func TestGetStringMatchesGetAs(t *testing.T) {
 			Timezone: "America/New_York",
 			Groups:   []string{"admins", "users"},
 			Roles:    []string{"admin", "editor"},
+			AMR:      []string{"otp", "mfa"},
 			AdditionalClaims: map[string]any{
 				"dept":     "eng",
 				"level":    7,
@@ -294,7 +346,7 @@ func TestGetStringMatchesGetAs(t *testing.T) {
 	claims := []string{
 		"provider", "id", "sub", "name", "given_name", "middle_name", "family_name",
 		"nickname", "preferred_username", "email", "email_verified", "picture", "locale", "zoneinfo",
-		"groups", "roles",
+		"groups", "roles", "amr",
 		"dept", "level", "active", "ratio", "tags", "explicit", "missing", "",
 	}
 
@@ -0,0 +1,173 @@
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// getClaimString returns the value of the claim as a string
+// The second returned value is false if the claim is not present or if its value is not stringifiable, e.g. it's a slice
+func getClaimString(ctx *EvalContext, claim string) (string, bool) {
+	v := ctx.Profile.Get(claim)
+	if v == nil {
+		return "", false
+	}
+
+	cur, err := cast.ToStringE(v)
+	if err != nil {
+		return "", false
+	}
+	return cur, true
+}
+
+// equalIgnoreCase checks if the claim has the expected value, ignoring case
+func equalIgnoreCase(claimIn any, expected any) UserProfilePredicate {
+	claim := cast.ToString(claimIn)
+	exp := cast.ToString(expected)
+
+	return func(ctx *EvalContext) bool {
+		cur, ok := getClaimString(ctx, claim)
+		return ok && strings.EqualFold(cur, exp)
+	}
+}
+
+// claimPrefix checks if the claim's value starts with the given prefix
+func claimPrefix(claimIn any, prefixIn any) UserProfilePredicate {
+	claim := cast.ToString(claimIn)
+	prefix := cast.ToString(prefixIn)
+
+	return func(ctx *EvalContext) bool {
+		cur, ok := getClaimString(ctx, claim)
+		return ok && strings.HasPrefix(cur, prefix)
+	}
+}
+
+// claimSuffix checks if the claim's value ends with the given suffix
+func claimSuffix(claimIn any, suffixIn any) UserProfilePredicate {
+	claim := cast.ToString(claimIn)
+	suffix := cast.ToString(suffixIn)
+
+	return func(ctx *EvalContext) bool {
+		cur, ok := getClaimString(ctx, claim)
+		return ok && strings.HasSuffix(cur, suffix)
+	}
+}
+
+// claimRegex checks if the claim's value matches the regular expression
+func claimRegex(claimIn any, patternIn any) (UserProfilePredicate, error) {
+	claim := cast.ToString(claimIn)
+
+	// Compile the expression once, when the condition is compiled
+	re, err := regexp.Compile(cast.ToString(patternIn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression in function ClaimRegex: %w", err)
+	}
+
+	return func(ctx *EvalContext) bool {
+		cur, ok := getClaimString(ctx, claim)
+		return ok && re.MatchString(cur)
+	}, nil
+}
+
+// claimExists checks if the claim is present and is not empty
+func claimExists(claimIn any) UserProfilePredicate {
+	claim := cast.ToString(claimIn)
+
+	return func(ctx *EvalContext) bool {
+		switch v := ctx.Profile.Get(claim).(type) {
+		case nil:
+			return false
+		case string:
+			return v != ""
+		case []string:
+			return len(v) > 0
+		case []any:
+			return len(v) > 0
+		default:
+			return true
+		}
+	}
+}
+
+// claimCompare returns a function for the parser that compares the claim's value with a number
+// Claims whose value is not a number, or a string containing a number, never match
+func claimCompare(cmp func(cur float64, expected float64) bool) func(claimIn any, expectedIn any) (UserProfilePredicate, error) {
+	return func(claimIn any, expectedIn any) (UserProfilePredicate, error) {
+		claim := cast.ToString(claimIn)
+		expected, err := cast.ToFloat64E(expectedIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%v' for claim '%s'", expectedIn, claim)
+		}
+
+		return func(ctx *EvalContext) bool {
+			v := ctx.Profile.Get(claim)
+			switch v.(type) {
+			case nil, bool:
+				// cast converts booleans to 0 and 1, but they can't be compared with numbers
+				return false
+			}
+
+			cur, err := cast.ToFloat64E(v)
+			return err == nil && cmp(cur, expected)
+		}, nil
+	}
+}
+
+// emailDomain checks if the user's email address is in any of the given domains
+// Sub-domains don't match: "example.com" does not match "user@sub.example.com"
+func emailDomain(domainsIn ...any) (UserProfilePredicate, error) {
+	if len(domainsIn) == 0 {
+		return nil, errors.New("function EmailDomain requires at least one domain")
+	}
+
+	domains := make([]string, len(domainsIn))
+	for i, d := range domainsIn {
+		domains[i] = strings.ToLower(strings.TrimPrefix(cast.ToString(d), "@"))
+	}
+
+	return func(ctx *EvalContext) bool {
+		email := ctx.Profile.GetEmail()
+		at := strings.LastIndexByte(email, '@')
+		if at < 0 {
+			return false
+		}
+
+		return slices.Contains(domains, strings.ToLower(email[at+1:]))
+	}, nil
+}
+
+// anyGroup checks if the user has at least one of the given groups
+func anyGroup(groupsIn ...any) (UserProfilePredicate, error) {
+	if len(groupsIn) == 0 {
+		return nil, errors.New("function AnyGroup requires at least one group")
+	}
+	groups := cast.ToStringSlice(groupsIn)
+
+	return func(ctx *EvalContext) bool {
+		return slices.ContainsFunc(groups, func(g string) bool {
+			return slices.Contains(ctx.Profile.Groups, g)
+		})
+	}, nil
+}
+
+// allGroups checks if the user has all the given groups
+func allGroups(groupsIn ...any) (UserProfilePredicate, error) {
+	if len(groupsIn) == 0 {
+		return nil, errors.New("function AllGroups requires at least one group")
+	}
+	groups := cast.ToStringSlice(groupsIn)
+
+	return func(ctx *EvalContext) bool {
+		for _, g := range groups {
+			if !slices.Contains(ctx.Profile.Groups, g) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,114 @@
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestClaimConditions(t *testing.T) {
+	ec := &EvalContext{
+		Profile: &user.Profile{
+			ID: "user1234",
+			Email: &user.ProfileEmail{
+				Value: "Pinco@Example.com",
+			},
+			Groups: []string{"g1", "g2"},
+			AdditionalClaims: map[string]any{
+				"location":  "Earth",
+				"level":     float64(3),
+				"age":       "42",
+				"is_admin":  false,
+				"empty":     "",
+				"empty_arr": []any{},
+				"wids":      []any{"62e90394-69f5-4237-9190-012177145e10"},
+				"address": map[string]any{
+					"country": "IT",
+				},
+				"https://example.com/cap/app": []any{
+					map[string]any{"role": "admin"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+	}{
+		{name: "equal ignoring case", condition: `ClaimEqualIgnoreCase("location", "EARTH")`, want: true},
+		{name: "not equal ignoring case", condition: `ClaimEqualIgnoreCase("location", "mars")`, want: false},
+		{name: "prefix", condition: `ClaimPrefix("id", "user")`, want: true},
+		{name: "prefix not matching", condition: `ClaimPrefix("id", "1234")`, want: false},
+		{name: "suffix", condition: `ClaimSuffix("id", "1234")`, want: true},
+		{name: "suffix not matching", condition: `ClaimSuffix("id", "user")`, want: false},
+		{name: "regex", condition: `ClaimRegex("id", "^user[0-9]+$")`, want: true},
+		{name: "regex is not anchored", condition: `ClaimRegex("id", "[0-9]{4}")`, want: true},
+		{name: "regex not matching", condition: `ClaimRegex("id", "^admin")`, want: false},
+		{name: "regex on missing claim", condition: `ClaimRegex("missing", ".*")`, want: false},
+		{name: "claim exists", condition: `ClaimExists("location")`, want: true},
+		{name: "boolean claim exists", condition: `ClaimExists("is_admin")`, want: true},
+		{name: "claim does not exist", condition: `ClaimExists("missing")`, want: false},
+		{name: "empty claim", condition: `ClaimExists("empty")`, want: false},
+		{name: "empty array claim", condition: `ClaimExists("empty_arr")`, want: false},
+		{name: "greater than", condition: `ClaimGreaterThan("level", 2)`, want: true},
+		{name: "greater than with equal value", condition: `ClaimGreaterThan("level", 3)`, want: false},
+		{name: "greater or equal", condition: `ClaimGreaterOrEqual("level", 3)`, want: true},
+		{name: "less than", condition: `ClaimLessThan("level", 3.5)`, want: true},
+		{name: "less or equal", condition: `ClaimLessOrEqual("level", 2)`, want: false},
+		{name: "compare number in string", condition: `ClaimGreaterOrEqual("age", 18)`, want: true},
+		{name: "compare with string argument", condition: `ClaimLessThan("age", "50")`, want: true},
+		{name: "compare non-numeric claim", condition: `ClaimGreaterThan("location", 0)`, want: false},
+		{name: "compare boolean claim", condition: `ClaimLessThan("is_admin", 1)`, want: false},
+		{name: "compare missing claim", condition: `ClaimLessThan("missing", 1)`, want: false},
+		{name: "email domain", condition: `EmailDomain("example.com")`, want: true},
+		{name: "email domain is case-insensitive", condition: `EmailDomain("example.org", "EXAMPLE.COM")`, want: true},
+		{name: "email domain not matching", condition: `EmailDomain("example.org")`, want: false},
+		{name: "email domain does not match parent domain", condition: `EmailDomain("com")`, want: false},
+		{name: "any group", condition: `AnyGroup("g3", "g2")`, want: true},
+		{name: "any group not matching", condition: `AnyGroup("g3", "g4")`, want: false},
+		{name: "all groups", condition: `AllGroups("g1", "g2")`, want: true},
+		{name: "all groups not matching", condition: `AllGroups("g1", "g3")`, want: false},
+		{name: "nested claim", condition: `ClaimEqual("address.country", "IT")`, want: true},
+		{name: "nested claim not matching", condition: `ClaimEqual("address.country", "FR")`, want: false},
+		{name: "array claim contains", condition: `ClaimContains("wids", "62e90394-69f5-4237-9190-012177145e10")`, want: true},
+		{name: "nested claim in array", condition: `ClaimEqual("['https://example.com/cap/app'][0].role", "admin")`, want: true},
+		{name: "nested claim with index out of range", condition: `ClaimExists("['https://example.com/cap/app'][1].role")`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := NewPredicate(tt.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, predicate(ec))
+		})
+	}
+
+	t.Run("no email", func(t *testing.T) {
+		predicate, err := NewPredicate(`EmailDomain("example.com")`)
+		require.NoError(t, err)
+		assert.False(t, predicate(&EvalContext{Profile: &user.Profile{ID: "user1234"}}))
+	})
+}
+
+func TestClaimConditionsInvalid(t *testing.T) {
+	tests := []struct {
+		condition   string
+		expectedErr string
+	}{
+		{condition: `ClaimRegex("id", "[a-")`, expectedErr: "invalid regular expression"},
+		{condition: `ClaimGreaterThan("level", "high")`, expectedErr: "invalid number 'high'"},
+		{condition: `EmailDomain()`, expectedErr: "requires at least one domain"},
+		{condition: `AnyGroup()`, expectedErr: "requires at least one group"},
+		{condition: `AllGroups()`, expectedErr: "requires at least one group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := NewPredicate(tt.condition)
+			require.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
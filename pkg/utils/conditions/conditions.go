@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"time"
 
 	"github.com/spf13/cast"
 	"github.com/vulcand/predicate"
@@ -11,13 +12,49 @@ import (
 	"github.com/italypaleale/traefik-forward-auth/pkg/user"
 )
 
-type UserProfilePredicate func(p *user.Profile) bool
+// UserProfilePredicate is a compiled condition
+// Predicates don't hold any state about the request, and functions that depend on the time read it when they are evaluated, so the same predicate can be cached and evaluated for any number of requests, concurrently
+type UserProfilePredicate func(ctx *EvalContext) bool
+
+// EvalContext contains the values conditions are evaluated against
+type EvalContext struct {
+	// Profile of the authenticated user
+	Profile *user.Profile
+	// Request that is being authorized
+	// When nil, functions that reference the request, such as ClientIPIn, return false
+	Request *Request
+	// Time the session was created, from the "iat" claim of the session token
+	// This is not part of the profile because profiles are shared by all requests for the same session token
+	// When zero, such as for users authenticated with a bearer token, SessionAge returns false
+	SessionIssuedAt time.Time
+	// Time the condition is evaluated at
+	// When zero, the current time is used
+	Time time.Time
+}
+
+// now returns the time the condition is evaluated at
+func (ec *EvalContext) now() time.Time {
+	if ec.Time.IsZero() {
+		return time.Now()
+	}
+	return ec.Time
+}
 
 var parser predicate.Parser
 
 func init() {
 	var err error
-	parser, err = predicate.NewParser(predicate.Def{
+	parser, err = newParser(undefinedPolicy)
+	if err != nil {
+		// Indicates a development-time error
+		panic("failed to init parser: " + err.Error())
+	}
+}
+
+// newParser returns a new parser for conditions
+// The policyFn function resolves references to named policies with the Policy function
+func newParser(policyFn func(nameIn any) (UserProfilePredicate, error)) (predicate.Parser, error) {
+	return predicate.NewParser(predicate.Def{
 		// Allows passing true and false as booleans, unquoted
 		GetIdentifier: getIdentifier,
 		Operators: predicate.Operators{
@@ -33,21 +70,51 @@ func init() {
 			"Group":         group,
 			"Role":          role,
 			"EmailVerified": emailVerified,
+			"AMR":           amr,
+			"Policy":        policyFn,
+			"ClientIPIn":    clientIPIn,
+			"Method":        method,
+			"PathPrefix":    pathPrefix,
+			"Host":          host,
+			"HeaderEqual":   headerEqual,
+
+			"ClaimEqualIgnoreCase": equalIgnoreCase,
+			"ClaimPrefix":          claimPrefix,
+			"ClaimSuffix":          claimSuffix,
+			"ClaimRegex":           claimRegex,
+			"ClaimExists":          claimExists,
+			"ClaimGreaterThan":     claimCompare(func(cur, expected float64) bool { return cur > expected }),
+			"ClaimGreaterOrEqual":  claimCompare(func(cur, expected float64) bool { return cur >= expected }),
+			"ClaimLessThan":        claimCompare(func(cur, expected float64) bool { return cur < expected }),
+			"ClaimLessOrEqual":     claimCompare(func(cur, expected float64) bool { return cur <= expected }),
+			"EmailDomain":          emailDomain,
+			"AnyGroup":             anyGroup,
+			"AllGroups":            allGroups,
+
+			"Between":    between,
+			"Weekday":    weekday,
+			"SessionAge": sessionAge,
 		},
 	})
-	if err != nil {
-		// Indicates a development-time error
-		panic("failed to init parser: " + err.Error())
-	}
 }
 
+// NewPredicate returns a predicate for the condition
+// Conditions parsed with this function cannot reference named policies: use Policies.NewPredicate for that
 func NewPredicate(in string) (UserProfilePredicate, error) {
-	pr, err := parser.Parse(in)
+	return newPredicateWithParser(parser, in)
+}
+
+func newPredicateWithParser(pp predicate.Parser, in string) (UserProfilePredicate, error) {
+	pr, err := pp.Parse(in)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse condition: %w", err)
 	}
 
-	uppr, _ := pr.(UserProfilePredicate)
+	// Expressions that aren't boolean, such as `false` or `"email"`, are parsed without errors but don't return a predicate
+	uppr, ok := pr.(UserProfilePredicate)
+	if !ok || uppr == nil {
+		return nil, errors.New("condition does not return a boolean")
+	}
 	return uppr, nil
 }
 
@@ -66,34 +133,34 @@ func getIdentifier(selector []string) (any, error) {
 }
 
 func not(a UserProfilePredicate) UserProfilePredicate {
-	return func(p *user.Profile) bool {
-		return !a(p)
+	return func(ctx *EvalContext) bool {
+		return !a(ctx)
 	}
 }
 
 func and(a, b UserProfilePredicate) UserProfilePredicate {
-	return func(p *user.Profile) bool {
-		return a(p) && b(p)
+	return func(ctx *EvalContext) bool {
+		return a(ctx) && b(ctx)
 	}
 }
 
 func or(a, b UserProfilePredicate) UserProfilePredicate {
-	return func(p *user.Profile) bool {
-		return a(p) || b(p)
+	return func(ctx *EvalContext) bool {
+		return a(ctx) || b(ctx)
 	}
 }
 
 // equal checks if the claim has the expected value
 // This only works for strings or stringifiable values
 func equal(claimAny any, expected any) UserProfilePredicate {
-	return func(p *user.Profile) bool {
+	return func(ctx *EvalContext) bool {
 		claim, ok := claimAny.(string)
 		if !ok {
 			return false
 		}
 
 		// By using ToStringE, we can return false if the current value is not stringifiable, e.g. it's a slice
-		cur, err := cast.ToStringE(p.Get(claim))
+		cur, err := cast.ToStringE(ctx.Profile.Get(claim))
 		if err != nil {
 			return false
 		}
@@ -106,43 +173,56 @@ func equal(claimAny any, expected any) UserProfilePredicate {
 // If the claim is a string, it's converted to a slice separated by spaces
 // This only works for values and slice elements that are strings or stringifiable
 func contains(claimAny any, expected any) UserProfilePredicate {
-	return func(p *user.Profile) bool {
+	return func(ctx *EvalContext) bool {
 		claim, ok := claimAny.(string)
 		if !ok {
 			return false
 		}
 
-		cur := cast.ToStringSlice(p.Get(claim))
+		cur := cast.ToStringSlice(ctx.Profile.Get(claim))
 		return slices.Contains(cur, cast.ToString(expected))
 	}
 }
 
 // group checks if the user has the specified group
 func group(groupIn any) UserProfilePredicate {
-	return func(p *user.Profile) bool {
+	return func(ctx *EvalContext) bool {
 		group := cast.ToString(groupIn)
 		if group == "" {
 			return false
 		}
 
-		return slices.Contains(p.Groups, group)
+		return slices.Contains(ctx.Profile.Groups, group)
 	}
 }
 
 // role checks if the user has the specified role
 func role(roleIn any) UserProfilePredicate {
-	return func(p *user.Profile) bool {
+	return func(ctx *EvalContext) bool {
 		role := cast.ToString(roleIn)
 		if role == "" {
 			return false
 		}
 
-		return slices.Contains(p.Roles, role)
+		return slices.Contains(ctx.Profile.Roles, role)
 	}
 }
 
 func emailVerified() UserProfilePredicate {
-	return func(p *user.Profile) bool {
-		return p.Email != nil && p.Email.Value != "" && p.Email.Verified
+	return func(ctx *EvalContext) bool {
+		email := ctx.Profile.Email
+		return email != nil && email.Value != "" && email.Verified
+	}
+}
+
+// amr checks if the user signed in with the specified authentication method, as listed in the "amr" claim
+func amr(methodIn any) UserProfilePredicate {
+	return func(ctx *EvalContext) bool {
+		method := cast.ToString(methodIn)
+		if method == "" {
+			return false
+		}
+
+		return slices.Contains(ctx.Profile.AMR, method)
 	}
 }
@@ -25,6 +25,7 @@ func TestConditions(t *testing.T) {
 		},
 		Groups: []string{"g1", "g2"},
 		Roles:  []string{"r1", "r2"},
+		AMR:    []string{"otp", "mfa"},
 		AdditionalClaims: map[string]any{
 			"location": "earth",
 			"is_admin": false,
@@ -85,13 +86,16 @@ func TestConditions(t *testing.T) {
 		{name: "condition with four function calls", condition: `Group("g1") && Role("r1") && EmailVerified() && ClaimContains("name", "Pinco")`, want: true},
 		{name: "using Eq instead of Equal", condition: `Eq("id", "user1234")`, want: true},
 		{name: "using Cont instead of Contains", condition: `Cont("groups", "g1")`, want: true},
+		{name: "has authentication method", condition: `AMR("mfa")`, want: true},
+		{name: "does not have authentication method", condition: `AMR("hwk")`, want: false},
+		{name: "empty authentication method check", condition: `AMR("")`, want: false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			predicate, err := NewPredicate(tt.condition)
 			require.NoError(t, err)
 
-			result := predicate(profile)
+			result := predicate(&EvalContext{Profile: profile})
 			assert.Equal(t, tt.want, result)
 		})
 	}
@@ -147,7 +151,7 @@ func TestEmailVerified(t *testing.T) {
 			predicate, err := NewPredicate("EmailVerified()")
 			require.NoError(t, err)
 
-			result := predicate(tt.profile)
+			result := predicate(&EvalContext{Profile: tt.profile})
 			assert.Equal(t, tt.want, result)
 		})
 	}
@@ -229,7 +233,7 @@ func TestContainsFunction(t *testing.T) {
 			predicate, err := NewPredicate(tt.condition)
 			require.NoError(t, err)
 
-			result := predicate(tt.profile)
+			result := predicate(&EvalContext{Profile: tt.profile})
 			assert.Equal(t, tt.want, result)
 		})
 	}
@@ -261,6 +265,16 @@ func TestNewPredicateFailure(t *testing.T) {
 			condition:   `ClaimEqual("id")`,
 			expectedErr: "Call with too few input arguments",
 		},
+		{
+			name:        "boolean literal",
+			condition:   `false`,
+			expectedErr: "condition does not return a boolean",
+		},
+		{
+			name:        "string literal",
+			condition:   `"email"`,
+			expectedErr: "condition does not return a boolean",
+		},
 		{
 			name:        "invalid boolean expression",
 			condition:   `ClaimEqual("id", "test") &&`,
@@ -0,0 +1,99 @@
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/vulcand/predicate"
+)
+
+// Policies contains named authorization policies, which are conditions that can be referenced with the Policy function
+type Policies struct {
+	defs     map[string]string
+	compiled map[string]UserProfilePredicate
+	parser   predicate.Parser
+
+	// Names of the policies being compiled, used to detect cycles
+	// This is only used while the policies are compiled in NewPolicies
+	compiling []string
+}
+
+// NewPolicies compiles the named policies
+// It returns an error if any policy is not valid, references a policy that doesn't exist, or references itself directly or indirectly
+func NewPolicies(defs map[string]string) (*Policies, error) {
+	p := &Policies{
+		defs:     defs,
+		compiled: make(map[string]UserProfilePredicate, len(defs)),
+	}
+
+	var err error
+	p.parser, err = newParser(p.resolve)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init parser: %w", err)
+	}
+
+	for name := range defs {
+		_, err = p.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.compiling = nil
+
+	return p, nil
+}
+
+// NewPredicate returns a predicate for the condition, which can reference the named policies with the Policy function
+func (p *Policies) NewPredicate(in string) (UserProfilePredicate, error) {
+	if p == nil {
+		return NewPredicate(in)
+	}
+	return newPredicateWithParser(p.parser, in)
+}
+
+// Get returns the predicate for the policy with the given name
+func (p *Policies) Get(name string) (UserProfilePredicate, bool) {
+	if p == nil {
+		return nil, false
+	}
+	pr, ok := p.compiled[name]
+	return pr, ok
+}
+
+// resolve returns the predicate for the named policy, compiling it if needed
+// It is invoked by the parser for the Policy function
+func (p *Policies) resolve(nameIn any) (UserProfilePredicate, error) {
+	name := cast.ToString(nameIn)
+
+	pr, ok := p.compiled[name]
+	if ok {
+		return pr, nil
+	}
+
+	def, ok := p.defs[name]
+	if !ok {
+		return nil, fmt.Errorf("policy '%s' is not defined", name)
+	}
+
+	for i, n := range p.compiling {
+		if n == name {
+			return nil, fmt.Errorf("policy '%s' references itself: %s", name, strings.Join(append(p.compiling[i:], name), " -> "))
+		}
+	}
+
+	p.compiling = append(p.compiling, name)
+	pr, err := newPredicateWithParser(p.parser, def)
+	p.compiling = p.compiling[:len(p.compiling)-1]
+	if err != nil {
+		return nil, fmt.Errorf("policy '%s' is invalid: %w", name, err)
+	}
+
+	p.compiled[name] = pr
+	return pr, nil
+}
+
+// undefinedPolicy is used as Policy function when there are no named policies
+func undefinedPolicy(nameIn any) (UserProfilePredicate, error) {
+	return nil, fmt.Errorf("policy '%s' is not defined", cast.ToString(nameIn))
+}
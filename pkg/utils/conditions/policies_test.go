@@ -0,0 +1,117 @@
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestPolicies(t *testing.T) {
+	policies, err := NewPolicies(map[string]string{
+		"admins":     `Group("admins")`,
+		"mfa":        `AMR("mfa")`,
+		"mfa-admins": `Policy("admins") && Policy("mfa")`,
+		"ops":        `Policy("mfa-admins") || Role("ops")`,
+	})
+	require.NoError(t, err)
+
+	admin := &user.Profile{ID: "admin", Groups: []string{"admins"}, AMR: []string{"pwd", "mfa"}}
+	adminNoMFA := &user.Profile{ID: "admin2", Groups: []string{"admins"}}
+	operator := &user.Profile{ID: "operator", Roles: []string{"ops"}}
+
+	tests := []struct {
+		policy  string
+		profile *user.Profile
+		want    bool
+	}{
+		{policy: "admins", profile: admin, want: true},
+		{policy: "admins", profile: operator, want: false},
+		{policy: "mfa-admins", profile: admin, want: true},
+		{policy: "mfa-admins", profile: adminNoMFA, want: false},
+		{policy: "ops", profile: admin, want: true},
+		{policy: "ops", profile: operator, want: true},
+		{policy: "ops", profile: adminNoMFA, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.profile.ID, func(t *testing.T) {
+			pr, ok := policies.Get(tt.policy)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, pr(&EvalContext{Profile: tt.profile}))
+		})
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, ok := policies.Get("nope")
+		assert.False(t, ok)
+	})
+
+	t.Run("conditions can reference policies", func(t *testing.T) {
+		pr, err := policies.NewPredicate(`Policy("admins") && ClaimEqual("id", "admin")`)
+		require.NoError(t, err)
+		assert.True(t, pr(&EvalContext{Profile: admin}))
+		assert.False(t, pr(&EvalContext{Profile: adminNoMFA}))
+
+		_, err = policies.NewPredicate(`Policy("nope")`)
+		require.ErrorContains(t, err, "policy 'nope' is not defined")
+	})
+
+	t.Run("conditions without policies", func(t *testing.T) {
+		_, err := NewPredicate(`Policy("admins")`)
+		require.ErrorContains(t, err, "policy 'admins' is not defined")
+
+		var nilPolicies *Policies
+		pr, err := nilPolicies.NewPredicate(`Group("admins")`)
+		require.NoError(t, err)
+		assert.True(t, pr(&EvalContext{Profile: admin}))
+	})
+}
+
+func TestNewPoliciesFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		defs        map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "invalid condition",
+			defs:        map[string]string{"admins": `Group("admins"`},
+			expectedErr: "policy 'admins' is invalid",
+		},
+		{
+			name:        "undefined policy",
+			defs:        map[string]string{"admins": `Policy("nope")`},
+			expectedErr: "policy 'nope' is not defined",
+		},
+		{
+			name:        "self reference",
+			defs:        map[string]string{"admins": `Group("admins") || Policy("admins")`},
+			expectedErr: "policy 'admins' references itself: admins -> admins",
+		},
+		{
+			name: "cycle",
+			defs: map[string]string{
+				"a": `Policy("b")`,
+				"b": `Policy("c")`,
+				"c": `Group("x") && Policy("a")`,
+			},
+			expectedErr: "references itself",
+		},
+		{
+			name:        "not a boolean",
+			defs:        map[string]string{"admins": `"admins"`},
+			expectedErr: "condition does not return a boolean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := NewPolicies(tt.defs)
+			require.Error(t, err)
+			assert.Nil(t, policies)
+			assert.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
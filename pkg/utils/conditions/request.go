@@ -0,0 +1,145 @@
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/utils"
+)
+
+// Request contains the properties of the request that is being authorized
+// When authorizing a request forwarded by Traefik, these are the properties of the original request
+type Request struct {
+	// IP of the client
+	ClientIP netip.Addr
+	// HTTP method, in uppercase
+	Method string
+	// Host, in lowercase and without the port
+	Host string
+	// Path, decoded and normalized
+	// If ResolvePath is set, use GetPath, which populates this field the first time it's called
+	Path string
+	// Request headers
+	Header http.Header
+
+	// Function that returns the decoded and normalized path, which is invoked only if the path is needed
+	// It returns an error if the path can't be determined unambiguously
+	ResolvePath func() (string, error)
+
+	pathErr error
+}
+
+// GetPath returns the decoded and normalized path of the request
+// The second returned value is false if the path can't be determined unambiguously, in which case conditions on the path must not match
+func (r *Request) GetPath() (string, bool) {
+	if r.ResolvePath != nil {
+		r.Path, r.pathErr = r.ResolvePath()
+		r.ResolvePath = nil
+	}
+	return r.Path, r.pathErr == nil
+}
+
+// clientIPIn checks if the client's IP is in any of the given ranges, in CIDR notation
+// Single IP addresses are accepted too
+func clientIPIn(rangesIn ...any) (UserProfilePredicate, error) {
+	if len(rangesIn) == 0 {
+		return nil, errors.New("function ClientIPIn requires at least one IP range")
+	}
+
+	// Parse the ranges once, when the condition is compiled
+	prefixes := make([]netip.Prefix, len(rangesIn))
+	for i, r := range rangesIn {
+		str := cast.ToString(r)
+		prefix, err := netip.ParsePrefix(str)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(str)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid IP range '%s' in function ClientIPIn", str)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes[i] = prefix.Masked()
+	}
+
+	return func(ctx *EvalContext) bool {
+		if ctx.Request == nil || !ctx.Request.ClientIP.IsValid() {
+			return false
+		}
+
+		ip := ctx.Request.ClientIP.Unmap()
+		for _, p := range prefixes {
+			if p.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// method checks if the request's method is any of the given ones
+func method(methodsIn ...any) (UserProfilePredicate, error) {
+	if len(methodsIn) == 0 {
+		return nil, errors.New("function Method requires at least one method")
+	}
+
+	methods := make([]string, len(methodsIn))
+	for i, m := range methodsIn {
+		methods[i] = strings.ToUpper(cast.ToString(m))
+	}
+
+	return func(ctx *EvalContext) bool {
+		return ctx.Request != nil && slices.Contains(methods, ctx.Request.Method)
+	}, nil
+}
+
+// pathPrefix checks if the request's path has the given prefix, matching whole path segments
+// Paths that can't be determined unambiguously never match
+func pathPrefix(prefixIn any) (UserProfilePredicate, error) {
+	prefix := cast.ToString(prefixIn)
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("invalid prefix '%s' in function PathPrefix: must start with '/'", prefix)
+	}
+
+	return func(ctx *EvalContext) bool {
+		if ctx.Request == nil {
+			return false
+		}
+		p, ok := ctx.Request.GetPath()
+		return ok && utils.HasPathPrefix(p, prefix)
+	}, nil
+}
+
+// host checks if the request's host matches the pattern, which can contain glob characters such as "*.example.com"
+func host(patternIn any) (UserProfilePredicate, error) {
+	pattern := strings.ToLower(cast.ToString(patternIn))
+	_, err := path.Match(pattern, "")
+	if pattern == "" || err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s' in function Host", pattern)
+	}
+
+	return func(ctx *EvalContext) bool {
+		return ctx.Request != nil && utils.MatchHost(pattern, ctx.Request.Host)
+	}, nil
+}
+
+// headerEqual checks if the request has a header with the given value
+// If the header is repeated, any of its values can match
+func headerEqual(nameIn any, expected any) UserProfilePredicate {
+	name := cast.ToString(nameIn)
+	value := cast.ToString(expected)
+
+	return func(ctx *EvalContext) bool {
+		if ctx.Request == nil || name == "" {
+			return false
+		}
+
+		return slices.Contains(ctx.Request.Header.Values(name), value)
+	}
+}
@@ -0,0 +1,141 @@
+package conditions
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestRequestConditions(t *testing.T) {
+	ec := &EvalContext{
+		Profile: &user.Profile{
+			ID:     "user1234",
+			Groups: []string{"admins"},
+		},
+		Request: &Request{
+			ClientIP: netip.MustParseAddr("10.8.1.2"),
+			Method:   "POST",
+			Host:     "app.example.com",
+			Path:     "/api/items",
+			Header: http.Header{
+				"X-Tenant": []string{"other", "acme"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+	}{
+		{name: "client IP in range", condition: `ClientIPIn("10.8.0.0/16")`, want: true},
+		{name: "client IP in any range", condition: `ClientIPIn("192.168.0.0/16", "10.0.0.0/8")`, want: true},
+		{name: "client IP not in range", condition: `ClientIPIn("192.168.0.0/16")`, want: false},
+		{name: "client IP equal to address", condition: `ClientIPIn("10.8.1.2")`, want: true},
+		{name: "client IP in IPv6 range", condition: `ClientIPIn("fd00::/8")`, want: false},
+		{name: "method", condition: `Method("POST")`, want: true},
+		{name: "method is case-insensitive", condition: `Method("get", "post")`, want: true},
+		{name: "method not matching", condition: `Method("GET", "HEAD")`, want: false},
+		{name: "path prefix", condition: `PathPrefix("/api")`, want: true},
+		{name: "path prefix with trailing slash", condition: `PathPrefix("/api/")`, want: true},
+		{name: "path prefix matches whole segments", condition: `PathPrefix("/ap")`, want: false},
+		{name: "host", condition: `Host("app.example.com")`, want: true},
+		{name: "host with glob", condition: `Host("*.EXAMPLE.com")`, want: true},
+		{name: "host not matching", condition: `Host("*.example.org")`, want: false},
+		{name: "header equal", condition: `HeaderEqual("X-Tenant", "acme")`, want: true},
+		{name: "header name is case-insensitive", condition: `HeaderEqual("x-tenant", "acme")`, want: true},
+		{name: "header not equal", condition: `HeaderEqual("X-Tenant", "ACME")`, want: false},
+		{name: "header missing", condition: `HeaderEqual("X-Other", "acme")`, want: false},
+		{name: "combined with profile", condition: `Group("admins") && ClientIPIn("10.8.0.0/16") && !Method("DELETE")`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := NewPredicate(tt.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, predicate(ec))
+		})
+	}
+
+	t.Run("IPv4-mapped IPv6 client IP", func(t *testing.T) {
+		predicate, err := NewPredicate(`ClientIPIn("10.8.0.0/16")`)
+		require.NoError(t, err)
+		assert.True(t, predicate(&EvalContext{
+			Profile: ec.Profile,
+			Request: &Request{ClientIP: netip.MustParseAddr("::ffff:10.8.1.2")},
+		}))
+	})
+
+	t.Run("path resolved lazily", func(t *testing.T) {
+		calls := 0
+		req := &Request{
+			Method: "GET",
+			ResolvePath: func() (string, error) {
+				calls++
+				return "/api/items", nil
+			},
+		}
+
+		predicate, err := NewPredicate(`Method("GET")`)
+		require.NoError(t, err)
+		assert.True(t, predicate(&EvalContext{Profile: ec.Profile, Request: req}))
+		assert.Equal(t, 0, calls)
+
+		predicate, err = NewPredicate(`PathPrefix("/api") && PathPrefix("/api/items")`)
+		require.NoError(t, err)
+		assert.True(t, predicate(&EvalContext{Profile: ec.Profile, Request: req}))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ambiguous path", func(t *testing.T) {
+		req := &Request{
+			Method: "GET",
+			ResolvePath: func() (string, error) {
+				return "", errors.New("ambiguous path")
+			},
+		}
+
+		for _, cond := range []string{`PathPrefix("/")`, `PathPrefix("/api")`} {
+			predicate, err := NewPredicate(cond)
+			require.NoError(t, err)
+			assert.False(t, predicate(&EvalContext{Profile: ec.Profile, Request: req}), cond)
+		}
+
+		predicate, err := NewPredicate(`Method("GET")`)
+		require.NoError(t, err)
+		assert.True(t, predicate(&EvalContext{Profile: ec.Profile, Request: req}))
+	})
+
+	t.Run("no request", func(t *testing.T) {
+		for _, cond := range []string{`ClientIPIn("0.0.0.0/0")`, `Method("GET")`, `PathPrefix("/")`, `Host("*")`, `HeaderEqual("X-Tenant", "acme")`} {
+			predicate, err := NewPredicate(cond)
+			require.NoError(t, err)
+			assert.False(t, predicate(&EvalContext{Profile: ec.Profile}), cond)
+		}
+	})
+}
+
+func TestRequestConditionsInvalid(t *testing.T) {
+	tests := []struct {
+		condition   string
+		expectedErr string
+	}{
+		{condition: `ClientIPIn()`, expectedErr: "requires at least one IP range"},
+		{condition: `ClientIPIn("10.0.0.0/8", "nope")`, expectedErr: "invalid IP range 'nope'"},
+		{condition: `Method()`, expectedErr: "requires at least one method"},
+		{condition: `PathPrefix("api")`, expectedErr: "must start with '/'"},
+		{condition: `Host("[example.com")`, expectedErr: "invalid pattern"},
+		{condition: `Host("")`, expectedErr: "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := NewPredicate(tt.condition)
+			require.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
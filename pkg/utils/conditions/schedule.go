@@ -0,0 +1,167 @@
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// between checks if the current time of day is between start (inclusive) and end (exclusive), in the "HH:MM" format
+// If end is before start, the window spans midnight, e.g. "22:00" to "06:00"
+// The optional third argument is the name of the time zone, which defaults to UTC
+func between(startIn any, endIn any, tzIn ...any) (UserProfilePredicate, error) {
+	start, err := parseTimeOfDay(startIn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time in function Between: %w", err)
+	}
+	end, err := parseTimeOfDay(endIn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time in function Between: %w", err)
+	}
+	if start == end {
+		return nil, errors.New("start and end times in function Between must be different")
+	}
+
+	loc, err := parseTimeZone("Between", tzIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *EvalContext) bool {
+		now := ctx.now().In(loc)
+		cur := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+		if start < end {
+			return cur >= start && cur < end
+		}
+		return cur >= start || cur < end
+	}, nil
+}
+
+// weekday checks if the current day of the week is any of the given ones
+// Days are a comma-separated list of names or ranges, such as "Mon-Fri" or "Mon,Wed,Fri"
+// The optional second argument is the name of the time zone, which defaults to UTC
+func weekday(daysIn any, tzIn ...any) (UserProfilePredicate, error) {
+	days, err := parseWeekdays(cast.ToString(daysIn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid days in function Weekday: %w", err)
+	}
+
+	loc, err := parseTimeZone("Weekday", tzIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *EvalContext) bool {
+		return days[ctx.now().In(loc).Weekday()]
+	}, nil
+}
+
+// sessionAge compares the time since the session was created with a duration
+// The operator is one of "<", "<=", ">", ">="
+func sessionAge(opIn any, durationIn any) (UserProfilePredicate, error) {
+	d, err := time.ParseDuration(cast.ToString(durationIn))
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid duration '%v' in function SessionAge", durationIn)
+	}
+
+	var cmp func(age time.Duration) bool
+	switch op := cast.ToString(opIn); op {
+	case "<":
+		cmp = func(age time.Duration) bool { return age < d }
+	case "<=":
+		cmp = func(age time.Duration) bool { return age <= d }
+	case ">":
+		cmp = func(age time.Duration) bool { return age > d }
+	case ">=":
+		cmp = func(age time.Duration) bool { return age >= d }
+	default:
+		return nil, fmt.Errorf("invalid operator '%s' in function SessionAge", op)
+	}
+
+	return func(ctx *EvalContext) bool {
+		if ctx.SessionIssuedAt.IsZero() {
+			return false
+		}
+
+		return cmp(ctx.now().Sub(ctx.SessionIssuedAt))
+	}, nil
+}
+
+// parseTimeOfDay parses a time in the "HH:MM" format, returning the time since midnight
+func parseTimeOfDay(in any) (time.Duration, error) {
+	str := cast.ToString(in)
+	t, err := time.Parse("15:04", str)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not in the HH:MM format", str)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseTimeZone returns the location from the optional argument with the name of the time zone
+func parseTimeZone(fn string, tzIn []any) (*time.Location, error) {
+	switch len(tzIn) {
+	case 0:
+		return time.UTC, nil
+	case 1:
+		// Continues below
+	default:
+		return nil, fmt.Errorf("function %s accepts only one time zone", fn)
+	}
+
+	tz := cast.ToString(tzIn[0])
+	loc, err := time.LoadLocation(tz)
+	if tz == "" || err != nil {
+		return nil, fmt.Errorf("invalid time zone '%s' in function %s", tz, fn)
+	}
+	return loc, nil
+}
+
+// parseWeekdays parses a comma-separated list of days of the week or ranges, returning the set of days that are included
+func parseWeekdays(in string) (map[time.Weekday]bool, error) {
+	if in == "" {
+		return nil, errors.New("value is empty")
+	}
+
+	days := make(map[time.Weekday]bool, 7)
+	for part := range strings.SplitSeq(in, ",") {
+		fromStr, toStr, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, ok := weekdayNames[strings.ToLower(strings.TrimSpace(fromStr))]
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a day of the week", fromStr)
+		}
+		if !isRange {
+			days[from] = true
+			continue
+		}
+
+		to, ok := weekdayNames[strings.ToLower(strings.TrimSpace(toStr))]
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a day of the week", toStr)
+		}
+
+		// Ranges can wrap around the end of the week, such as "Fri-Mon"
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
@@ -0,0 +1,102 @@
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/traefik-forward-auth/pkg/user"
+)
+
+func TestScheduleConditions(t *testing.T) {
+	// Wednesday, 10:30 in UTC, which is 12:30 in Rome
+	now := time.Date(2025, time.July, 16, 10, 30, 0, 0, time.UTC)
+	ec := &EvalContext{
+		Profile:         &user.Profile{ID: "user1234"},
+		SessionIssuedAt: now.Add(-30 * time.Minute),
+		Time:            now,
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+	}{
+		{name: "between", condition: `Between("08:00", "18:00")`, want: true},
+		{name: "between at the start", condition: `Between("10:30", "18:00")`, want: true},
+		{name: "between at the end", condition: `Between("08:00", "10:30")`, want: false},
+		{name: "not between", condition: `Between("12:00", "18:00")`, want: false},
+		{name: "between with time zone", condition: `Between("12:00", "18:00", "Europe/Rome")`, want: true},
+		{name: "not between with time zone", condition: `Between("08:00", "12:00", "Europe/Rome")`, want: false},
+		{name: "between spanning midnight", condition: `Between("22:00", "11:00")`, want: true},
+		{name: "not between spanning midnight", condition: `Between("22:00", "06:00")`, want: false},
+		{name: "weekday in range", condition: `Weekday("Mon-Fri")`, want: true},
+		{name: "weekday not in range", condition: `Weekday("Sat-Sun")`, want: false},
+		{name: "weekday in range wrapping around", condition: `Weekday("Fri-Wed")`, want: true},
+		{name: "weekday in list", condition: `Weekday("mon, wednesday")`, want: true},
+		{name: "weekday not in list", condition: `Weekday("Mon,Tue,Thu-Fri")`, want: false},
+		{name: "weekday with time zone", condition: `Weekday("Tue", "Pacific/Kiritimati")`, want: false},
+		{name: "weekday with time zone in the next day", condition: `Weekday("Thu", "Pacific/Kiritimati")`, want: true},
+		{name: "session age less than", condition: `SessionAge("<", "1h")`, want: true},
+		{name: "session age less or equal", condition: `SessionAge("<=", "30m")`, want: true},
+		{name: "session age greater than", condition: `SessionAge(">", "30m")`, want: false},
+		{name: "session age greater or equal", condition: `SessionAge(">=", "15m")`, want: true},
+		{name: "combined", condition: `Group("contractors") || (Weekday("Mon-Fri", "Europe/Rome") && Between("08:00", "18:00", "Europe/Rome"))`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := NewPredicate(tt.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, predicate(ec))
+		})
+	}
+
+	t.Run("uses the current time", func(t *testing.T) {
+		predicate, err := NewPredicate(`SessionAge("<", "1m")`)
+		require.NoError(t, err)
+
+		ec := &EvalContext{
+			Profile:         &user.Profile{ID: "user1234"},
+			SessionIssuedAt: time.Now(),
+		}
+		assert.True(t, predicate(ec))
+
+		ec.SessionIssuedAt = time.Now().Add(-2 * time.Minute)
+		assert.False(t, predicate(ec))
+	})
+
+	t.Run("no session", func(t *testing.T) {
+		for _, cond := range []string{`SessionAge("<", "1h")`, `SessionAge(">", "1h")`} {
+			predicate, err := NewPredicate(cond)
+			require.NoError(t, err)
+			assert.False(t, predicate(&EvalContext{Profile: ec.Profile, Time: now}), cond)
+		}
+	})
+}
+
+func TestScheduleConditionsInvalid(t *testing.T) {
+	tests := []struct {
+		condition   string
+		expectedErr string
+	}{
+		{condition: `Between("8am", "18:00")`, expectedErr: "invalid start time"},
+		{condition: `Between("08:00", "24:00")`, expectedErr: "invalid end time"},
+		{condition: `Between("08:00", "08:00")`, expectedErr: "must be different"},
+		{condition: `Between("08:00", "18:00", "Mars/Olympus")`, expectedErr: "invalid time zone 'Mars/Olympus'"},
+		{condition: `Between("08:00", "18:00", "UTC", "UTC")`, expectedErr: "accepts only one time zone"},
+		{condition: `Weekday("")`, expectedErr: "invalid days"},
+		{condition: `Weekday("Mon-Fry")`, expectedErr: "'Fry' is not a day of the week"},
+		{condition: `Weekday("Mon", "")`, expectedErr: "invalid time zone"},
+		{condition: `SessionAge("=", "1h")`, expectedErr: "invalid operator '='"},
+		{condition: `SessionAge("<", "1 hour")`, expectedErr: "invalid duration"},
+		{condition: `SessionAge("<", "-1h")`, expectedErr: "invalid duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := NewPredicate(tt.condition)
+			require.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"strings"
 )
 
@@ -63,3 +64,20 @@ func ReadFileFromFS(repo fs.FS, name string) ([]byte, error) {
 
 	return data, nil
 }
+
+// HasPathPrefix returns true if the path is equal to the prefix, or if it's inside the prefix
+// Prefixes match whole path segments: for example, "/admin" is a prefix of "/admin" and "/admin/users", but not of "/administrator"
+func HasPathPrefix(p string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// MatchHost returns true if the host matches the pattern, which can contain glob characters, such as "*.example.com"
+// The comparison is case-insensitive
+func MatchHost(pattern string, host string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return ok
+}
@@ -25,3 +25,45 @@ func TestIsSubDomain(t *testing.T) {
 		assert.Equalf(t, tc.result, result, "domain='%s' sub='%s'", tc.domain, tc.sub)
 	}
 }
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		result bool
+	}{
+		{"/admin", "/admin", true},
+		{"/admin/users", "/admin", true},
+		{"/admin/users", "/admin/", true},
+		{"/admin", "/admin/", true},
+		{"/administrator", "/admin", false},
+		{"/", "/admin", false},
+		{"/anything", "/", true},
+	}
+
+	for _, tc := range tests {
+		result := HasPathPrefix(tc.path, tc.prefix)
+		assert.Equalf(t, tc.result, result, "path='%s' prefix='%s'", tc.path, tc.prefix)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		result  bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com", true},
+		{"*.example.com", "app.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"app?.example.com", "app1.example.com", true},
+		{"example.com", "example.org", false},
+		{"[example.com", "example.com", false},
+	}
+
+	for _, tc := range tests {
+		result := MatchHost(tc.pattern, tc.host)
+		assert.Equalf(t, tc.result, result, "pattern='%s' host='%s'", tc.pattern, tc.host)
+	}
+}
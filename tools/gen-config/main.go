@@ -216,6 +216,10 @@ func processStruct(structDef structDef, yamlPrefix string, parentYamlPath string
 		case fullYamlPath == "portals.$.headers" && sectionName == "portals":
 			processHeadersField(outYAML, outMD, yamlPrefix)
 
+		// Handle the special "rules" field
+		case fullYamlPath == "portals.$.rules" && sectionName == "portals":
+			processRulesField(outYAML, outMD, yamlPrefix)
+
 		// Handle the special "server.domains" field
 		case fullYamlPath == "server.domains" && sectionName == "":
 			processServerDomainsField(outYAML, outMD, yamlPrefix)
@@ -472,6 +476,21 @@ func processHeadersField(outYAML io.Writer, outMD io.Writer, yamlPrefix string)
 	processStruct(structTypes["ConfigPortalHeader"], "    #    ", "portals.$.headers.$", "portals.$.headers", outYAML, outMD, false)
 }
 
+// processRulesField handles the special "rules" field
+func processRulesField(outYAML io.Writer, outMD io.Writer, yamlPrefix string) {
+	y := func(format string, a ...any) { fmt.Fprintf(outYAML, yamlPrefix+format, a...) }
+	y("## rules (list of rules)\n")
+	y("## Description:\n")
+	y("##   List of rules to control access to the applications protected by the portal, based on the host, path, and method of each request.\n")
+	y("##   Rules are evaluated in order, and only the first one matching the request is applied. When no rule matches, all authenticated users are allowed.\n")
+	y("#rules:\n")
+	y("#  -\n")
+
+	fmt.Fprintln(outMD, `| <a id="config-opt-portals-$-rules"></a>`+"`portals.$.rules`"+`| list of rules | List of rules to control access to the applications protected by the portal, based on the host, path, and method of each request.<br>Rules are evaluated in order, and only the first one matching the request is applied. When no rule matches, all authenticated users are allowed. | |`)
+
+	processStruct(structTypes["ConfigPortalRule"], "    #    ", "portals.$.rules.$", "portals.$.rules", outYAML, outMD, false)
+}
+
 func printMarkdownHeader(header string, outMD io.Writer) {
 	fmt.Fprintf(outMD, "%s\n\n", header)
 	fmt.Fprint(outMD, "| Name | Type | Description | |\n")